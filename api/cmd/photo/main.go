@@ -7,12 +7,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/cbellee/photo-api/internal/audit"
 	"github.com/cbellee/photo-api/internal/facestore"
 	"github.com/cbellee/photo-api/internal/handler"
+	"github.com/cbellee/photo-api/internal/jobs"
 	"github.com/cbellee/photo-api/internal/storage"
 	"github.com/cbellee/photo-api/internal/telemetry"
 	"github.com/cbellee/photo-api/internal/utils"
@@ -59,16 +62,49 @@ func main() {
 	}
 	azureClientId := utils.GetEnvValue("AZURE_CLIENT_ID", "")
 
+	variantSizes, err := handler.ParseVariantSizes(utils.GetEnvValue("IMAGE_VARIANT_SIZES", "160,320,480,640,800,1024,1280,1600"))
+	if err != nil {
+		slog.Error("invalid IMAGE_VARIANT_SIZES", "error", err)
+		return
+	}
+
+	maxDownloadMb, err := strconv.ParseInt(utils.GetEnvValue("MAX_DOWNLOAD_MB", "2048"), 10, 64)
+	if err != nil {
+		slog.Error("invalid MAX_DOWNLOAD_MB", "error", err)
+		return
+	}
+
+	maxUploadPixels, err := strconv.ParseInt(utils.GetEnvValue("MAX_UPLOAD_PIXELS", "100000000"), 10, 64)
+	if err != nil {
+		slog.Error("invalid MAX_UPLOAD_PIXELS", "error", err)
+		return
+	}
+
+	trashRetentionDays, err := strconv.Atoi(utils.GetEnvValue("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || trashRetentionDays < 0 {
+		slog.Error("invalid TRASH_RETENTION_DAYS: must be a whole number of days", "error", err)
+		return
+	}
+
 	cfg := &handler.Config{
-		ServiceName:          utils.GetEnvValue("SERVICE_NAME", "photoService"),
-		ServicePort:          utils.GetEnvValue("SERVICE_PORT", "8080"),
-		UploadsContainerName: utils.GetEnvValue("UPLOADS_CONTAINER_NAME", "uploads"),
-		ImagesContainerName:  utils.GetEnvValue("IMAGES_CONTAINER_NAME", "images"),
-		StorageUrl:           storageUrl,
-		MemoryLimitMb:        32,
-		JwksURL:              utils.GetEnvValue("JWKS_URL", "https://0cd02bb5-3c24-4f77-8b19-99223d65aa67.ciamlogin.com/0cd02bb5-3c24-4f77-8b19-99223d65aa67/discovery/v2.0/keys?appid=689078c3-c0ad-4c10-a0d3-1c430c2e471d"),
-		RoleName:             utils.GetEnvValue("ROLE_NAME", "photo.upload"),
-		CorsOrigins:          strings.Split(utils.GetEnvValue("CORS_ORIGINS", "http://localhost:5173,https://photo-dev.bellee.net,https://photo.bellee.net"), ","),
+		ServiceName:                 utils.GetEnvValue("SERVICE_NAME", "photoService"),
+		ServicePort:                 utils.GetEnvValue("SERVICE_PORT", "8080"),
+		UploadsContainerName:        utils.GetEnvValue("UPLOADS_CONTAINER_NAME", "uploads"),
+		ImagesContainerName:         utils.GetEnvValue("IMAGES_CONTAINER_NAME", "images"),
+		RenditionsContainerName:     utils.GetEnvValue("RENDITIONS_CONTAINER_NAME", "renditions"),
+		VariantsContainerName:       utils.GetEnvValue("VARIANTS_CONTAINER_NAME", "variants"),
+		UploadSessionsContainerName: utils.GetEnvValue("UPLOAD_SESSIONS_CONTAINER_NAME", "upload-sessions"),
+		JobsContainerName:           utils.GetEnvValue("JOBS_CONTAINER_NAME", "jobs"),
+		ImageVariantSizes:           variantSizes,
+		ImageBaseURL:                utils.GetEnvValue("IMAGE_BASE_URL", ""),
+		StorageUrl:                  storageUrl,
+		MemoryLimitMb:               32,
+		MaxDownloadBytes:            maxDownloadMb << 20,
+		MaxUploadPixels:             maxUploadPixels,
+		TrashRetention:              time.Duration(trashRetentionDays) * 24 * time.Hour,
+		JwksURL:                     utils.GetEnvValue("JWKS_URL", "https://0cd02bb5-3c24-4f77-8b19-99223d65aa67.ciamlogin.com/0cd02bb5-3c24-4f77-8b19-99223d65aa67/discovery/v2.0/keys?appid=689078c3-c0ad-4c10-a0d3-1c430c2e471d"),
+		RoleName:                    utils.GetEnvValue("ROLE_NAME", "photo.upload"),
+		CorsOrigins:                 strings.Split(utils.GetEnvValue("CORS_ORIGINS", "http://localhost:5173,https://photo-dev.bellee.net,https://photo.bellee.net"), ","),
 	}
 
 	// ── JWKS keyfunc (cached, refreshed in background) ─────────────
@@ -124,6 +160,71 @@ func main() {
 		}
 	}
 
+	// ── Cron mode ───────────────────────────────────────────────────
+	// "similar" reports near-duplicate photos and "purge" empties the
+	// trash, each then exiting, so the API image can also run as a
+	// scheduled job. They run after the face store is created, which purge
+	// needs.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "similar":
+			if err := runSimilarReport(ctx, store, cfg); err != nil {
+				slog.Error("similarity report failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		case "purge":
+			if err := runPurge(ctx, store, cfg); err != nil {
+				slog.Error("trash purge failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// ── Audit log ───────────────────────────────────────────────────
+	// Mutations made through admin endpoints are recorded in the sink
+	// chosen by AUDIT_SINK: "log" (stdout and OTel), "sqlite", "table" or
+	// "none". A sink that cannot be created falls back to the log.
+	switch auditSink := envOr("AUDIT_SINK", "log"); auditSink {
+	case "none":
+		slog.Warn("audit log disabled")
+	case "sqlite", "table":
+		var sink audit.Sink
+		if auditSink == "sqlite" {
+			sink, err = audit.NewSQLiteSink(envOr("AUDIT_DB", "/data/audit.db"))
+		} else {
+			cred, credErr := azidentity.NewDefaultAzureCredential(nil)
+			if credErr != nil {
+				err = credErr
+			} else {
+				sink, err = audit.NewTableSink(envOr("TABLE_STORE_URL", ""), envOr("AUDIT_TABLE_NAME", "audit"), cred)
+			}
+		}
+		if err != nil {
+			slog.Error("error creating audit sink, logging audit entries instead", "type", auditSink, "error", err)
+			cfg.Audit = audit.NewLogSink(nil)
+		} else {
+			cfg.Audit = sink
+			defer sink.Close()
+			slog.Info("audit sink initialised", "type", auditSink)
+		}
+	default:
+		if auditSink != "log" {
+			slog.Warn("unknown AUDIT_SINK, logging audit entries", "type", auditSink)
+		}
+		cfg.Audit = audit.NewLogSink(nil)
+	}
+
+	// ── Background jobs ─────────────────────────────────────────────
+	// Jobs run until shutdown; unfinished ones, including those of a
+	// previous process, are resumed periodically.
+	jobsCtx, jobsCancel := context.WithCancel(context.Background())
+	jobManager := jobs.NewManager(jobsCtx, jobs.NewBlobStore(store, cfg.JobsContainerName))
+	handler.RegisterJobOps(jobManager, store, cfg)
+	cfg.Jobs = jobManager
+	go jobManager.Run(time.Minute)
+
 	// ── Routes ──────────────────────────────────────────────────────
 	port := fmt.Sprintf(":%s", cfg.ServicePort)
 	api := http.NewServeMux()
@@ -164,21 +265,50 @@ func main() {
 	api.HandleFunc("GET /api/{collection}", handler.AlbumHandler(store, cfg))
 	api.HandleFunc("GET /api/{collection}/{album}", handler.PhotoHandler(store, cfg))
 	api.HandleFunc("POST /api/upload", handler.RequireRole(cfg, handler.UploadHandler(store, cfg)))
+	api.HandleFunc("POST /api/upload/batch", handler.RequireRole(cfg, handler.BatchUploadHandler(store, cfg)))
+	api.HandleFunc("POST /api/upload/sas", handler.RequireRole(cfg, handler.UploadSASHandler(store, cfg)))
+	api.HandleFunc("POST /api/upload/complete", handler.RequireRole(cfg, handler.CompleteUploadHandler(store, cfg)))
+	api.HandleFunc("GET /api/upload/status/{collection}/{album}/{name}", handler.RequireRole(cfg, handler.ProcessingStatusHandler(store, cfg)))
+	api.HandleFunc("POST /api/uploads", handler.RequireRole(cfg, handler.CreateUploadHandler(store, cfg)))
+	api.HandleFunc("GET /api/uploads/{id}", handler.RequireRole(cfg, handler.UploadStatusHandler(store, cfg)))
+	api.HandleFunc("PATCH /api/uploads/{id}", handler.RequireRole(cfg, handler.AppendUploadHandler(store, cfg)))
+	api.HandleFunc("POST /api/uploads/{id}/commit", handler.RequireRole(cfg, handler.CommitUploadHandler(store, cfg)))
+	api.HandleFunc("DELETE /api/uploads/{id}", handler.RequireRole(cfg, handler.AbortUploadHandler(store, cfg)))
 	api.HandleFunc("PUT /api/update/{collection}/{album}/{id}", handler.RequireRole(cfg, handler.UpdateHandler(store, cfg)))
 	api.HandleFunc("GET /api/tags", handler.TagListHandler(store, cfg))
+	api.HandleFunc("GET /api/duplicates", handler.RequireRole(cfg, handler.DuplicatesHandler(store, cfg)))
+	api.HandleFunc("GET /api/original/{collection}/{album}/{name}", handler.RequireRole(cfg, handler.OriginalHandler(store, cfg)))
+	api.HandleFunc("GET /api/download/{collection}/{album}", handler.DownloadAlbumHandler(store, cfg))
+	api.HandleFunc("GET /api/image/{collection}/{album}/{name}", handler.ImageHandler(store, cfg))
+	api.HandleFunc("GET /api/similar/{collection}/{album}/{name}", handler.RequireRole(cfg, handler.SimilarHandler(store, cfg)))
 
 	// Admin: rename collection/album (copies blobs to new paths)
 	api.HandleFunc("PUT /api/rename/{collection}", handler.RequireRole(cfg, handler.RenameCollectionHandler(store, cfg)))
 	api.HandleFunc("PUT /api/rename/{collection}/{album}", handler.RequireRole(cfg, handler.RenameAlbumHandler(store, cfg)))
 
-	// Admin: soft-delete collection/album (sets isDeleted='true' on all blobs)
+	// Admin: move photos into another album
+	api.HandleFunc("POST /api/move", handler.RequireRole(cfg, handler.MoveHandler(store, cfg)))
+
+	// Admin: soft-delete collection/album/photo (sets isDeleted='true' on all blobs)
 	api.HandleFunc("DELETE /api/{collection}", handler.RequireRole(cfg, handler.SoftDeleteCollectionHandler(store, cfg)))
 	api.HandleFunc("DELETE /api/{collection}/{album}", handler.RequireRole(cfg, handler.SoftDeleteAlbumHandler(store, cfg)))
+	api.HandleFunc("DELETE /api/{collection}/{album}/{name}", handler.RequireRole(cfg, handler.SoftDeletePhotoHandler(store, cfg)))
+
+	// Admin: list soft-deleted photos; the purge cron job deletes them
+	// after TRASH_RETENTION_DAYS.
+	api.HandleFunc("GET /api/trash", handler.RequireRole(cfg, handler.TrashHandler(store, cfg)))
 
 	// Admin: restore (undelete) a soft-deleted collection or album
 	api.HandleFunc("PATCH /api/{collection}/{album}", handler.RequireRole(cfg, handler.RestoreAlbumHandler(store, cfg)))
 	api.HandleFunc("PATCH /api/{collection}", handler.RequireRole(cfg, handler.RestoreCollectionHandler(store, cfg)))
 
+	// Admin: progress and retry of the background jobs started above
+	api.HandleFunc("GET /api/jobs/{id}", handler.RequireRole(cfg, handler.JobHandler(cfg)))
+	api.HandleFunc("POST /api/jobs/{id}/retry", handler.RequireRole(cfg, handler.RetryJobHandler(cfg)))
+
+	// Admin: audit log of mutations
+	api.HandleFunc("GET /api/audit", handler.RequireRole(cfg, handler.AuditHandler(cfg)))
+
 	// Admin: thumbnail management (rotate or change thumbnail image)
 	api.HandleFunc("PUT /api/thumbnail/{collection}", handler.RequireRole(cfg, handler.ThumbnailCollectionHandler(store, cfg)))
 	api.HandleFunc("PUT /api/thumbnail/{collection}/{album}", handler.RequireRole(cfg, handler.ThumbnailAlbumHandler(store, cfg)))
@@ -201,7 +331,8 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   cfg.CorsOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
-		AllowedHeaders:   []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization"},
+		AllowedHeaders:   []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", "Upload-Offset"},
+		ExposedHeaders:   []string{"Location", "Upload-Offset", "Upload-Length"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -236,6 +367,10 @@ func main() {
 		slog.Error("server shutdown error", "error", err)
 	}
 
+	// Stop background jobs between items; they resume after the restart.
+	jobsCancel()
+	jobManager.Wait()
+
 	// Stop JWKS background refresh.
 	jwksCancel()
 
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/handler"
+	"github.com/cbellee/photo-api/internal/storage"
+)
+
+// runPurge is the "purge" cron mode: it permanently deletes photos that
+// have been in the trash longer than TRASH_RETENTION_DAYS, with their
+// renditions, originals and face records, and exits.
+func runPurge(ctx context.Context, store storage.BlobStore, cfg *handler.Config) error {
+	res, err := handler.PurgeTrash(ctx, store, cfg, time.Now())
+	slog.InfoContext(ctx, "trash purge complete",
+		"scanned", res.Scanned,
+		"purged", res.Purged,
+		"stamped", res.Stamped,
+		"failed", res.Failed,
+		"retention", cfg.TrashRetention)
+	return err
+}
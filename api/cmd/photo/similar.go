@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+
+	"github.com/cbellee/photo-api/internal/handler"
+	"github.com/cbellee/photo-api/internal/similarity"
+	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/cbellee/photo-api/internal/utils"
+)
+
+// runSimilarReport is the "similar" cron mode: it hashes any photos that
+// predate perceptual hashing, logs each cluster of near-duplicate photos for
+// cleanup and exits. SIMILAR_MAX_HAMMING sets the distance threshold.
+func runSimilarReport(ctx context.Context, store storage.BlobStore, cfg *handler.Config) error {
+	maxHamming, err := strconv.Atoi(utils.GetEnvValue("SIMILAR_MAX_HAMMING", strconv.Itoa(similarity.DefaultMaxHamming)))
+	if err != nil || maxHamming < 0 || maxHamming > similarity.HashBits {
+		return fmt.Errorf("invalid SIMILAR_MAX_HAMMING: must be between 0 and %d", similarity.HashBits)
+	}
+
+	photos, err := similarity.Scan(ctx, store, cfg.ImagesContainerName, runtime.NumCPU())
+	if err != nil {
+		return err
+	}
+
+	clusters := similarity.Clusters(photos, maxHamming)
+	duplicates := 0
+	for _, c := range clusters {
+		duplicates += len(c.Photos) - 1
+		slog.InfoContext(ctx, "near-duplicate cluster", "photos", c.Photos, "max_distance", c.MaxDistance)
+	}
+	slog.InfoContext(ctx, "similarity report complete",
+		"photos", len(photos),
+		"clusters", len(clusters),
+		"duplicates", duplicates,
+		"max_hamming", maxHamming)
+	return nil
+}
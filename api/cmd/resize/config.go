@@ -1,5 +1,14 @@
 package main
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
 // Config holds all application configuration for the resize service.
 type Config struct {
 	ServiceName         string
@@ -13,4 +22,65 @@ type Config struct {
 	StorageAccount      string
 	StorageSuffix       string
 	StorageContainer    string
+
+	// ResizeKernel is the resampling kernel; nil selects draw.CatmullRom.
+	ResizeKernel draw.Interpolator
+	// JPEGQuality is the encoder quality for resized JPEGs (1-100); zero
+	// selects utils.DefaultJPEGQuality.
+	JPEGQuality int
+
+	// Renditions are the extra derivative sizes written to
+	// RenditionsContainerName as "<rendition>/<collection>/<album>/<file>".
+	Renditions              []Rendition
+	RenditionsContainerName string
+}
+
+// Rendition is a named derivative size generated alongside the primary image.
+type Rendition struct {
+	Name    string
+	MaxSize int // longest edge in pixels
+}
+
+// renditionNameRe restricts rendition names to a single safe path segment.
+var renditionNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedRendition names the primary image in the photo API's rendition
+// maps and ?rendition= parameter, so no derivative may use it.
+const reservedRendition = "full"
+
+// ParseRenditions parses a comma-separated list of name=size pairs, e.g.
+// "thumb=320,medium=1024". An empty spec yields no renditions. Names must
+// be unique and may not be the reserved "full".
+func ParseRenditions(spec string) ([]Rendition, error) {
+	var out []Rendition
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, sizeStr, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("rendition %q: expected name=size", part)
+		}
+		name = strings.TrimSpace(name)
+		if !renditionNameRe.MatchString(name) {
+			return nil, fmt.Errorf("rendition %q: name must be lowercase letters, digits or dashes", name)
+		}
+		if name == reservedRendition {
+			return nil, fmt.Errorf("rendition %q: name is reserved for the primary image", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rendition %q: duplicate name", name)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("rendition %q: size must be a positive integer", name)
+		}
+		seen[name] = true
+		out = append(out, Rendition{Name: name, MaxSize: size})
+	}
+
+	return out, nil
 }
@@ -3,14 +3,19 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"log/slog"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cbellee/photo-api/internal/exif"
 	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/similarity"
 	"github.com/cbellee/photo-api/internal/storage"
 	"github.com/cbellee/photo-api/internal/utils"
 	"github.com/dapr/go-sdk/service/common"
@@ -20,6 +25,10 @@ import (
 
 var tracer = otel.Tracer("resize-api")
 
+// exifOrientationKey is exif.MetaOrientation as read back from the blob
+// store.
+var exifOrientationKey = models.CanonicalMetadataKey(exif.MetaOrientation)
+
 // blobRef holds the decomposed parts of a blob URL.
 type blobRef struct {
 	container  string
@@ -43,13 +52,20 @@ func NewHandler(store storage.BlobStore, cfg *Config) *Handler {
 // It always returns nil so Dapr ACKs the message.  Returning a non-nil
 // error causes Dapr to NACK the RabbitMQ message, which requeues it and
 // creates an infinite retry loop for non-transient failures (e.g. 404).
+// Progress and failures are recorded on the upload blob instead, see
+// setStatus.
 func (h *Handler) Resize(ctx context.Context, in *common.BindingEvent) (out []byte, err error) {
 	ctx, span := tracer.Start(ctx, "resize.Resize")
 	defer span.End()
+
+	var ref blobRef
 	defer func() {
 		if err != nil {
 			slog.ErrorContext(ctx, "resize failed (message acknowledged to prevent requeue)", "error", err)
 			span.RecordError(err)
+			if ref.path != "" {
+				h.setStatus(ctx, ref, models.ProcessingFailed, err.Error())
+			}
 			err = nil // ACK — reprocessing will not fix non-transient errors
 		}
 	}()
@@ -67,7 +83,7 @@ func (h *Handler) Resize(ctx context.Context, in *common.BindingEvent) (out []by
 	h.logEvent(ctx, evt, in)
 
 	// Decompose the blob URL.
-	ref, err := parseBlobRef(evt.Data.URL)
+	ref, err = parseBlobRef(evt.Data.URL)
 	if err != nil {
 		return nil, fmt.Errorf("parsing blob URL: %w", err)
 	}
@@ -78,8 +94,12 @@ func (h *Handler) Resize(ctx context.Context, in *common.BindingEvent) (out []by
 		attribute.String("blob.album", ref.album),
 	)
 	slog.InfoContext(ctx, "processing blob", "container", ref.container, "path", ref.path, "album", ref.album, "collection", ref.collection)
+	h.setStatus(ctx, ref, models.ProcessingInProgress, "")
 
-	// Download the source blob.
+	// Download the source blob. Unlike the API's download handlers this
+	// reads the whole upload rather than streaming it with OpenBlob: the
+	// decoder, the EXIF reader and the renditions all need the full image
+	// in memory, and hashing the buffer costs no extra read.
 	blobBytes, err := h.store.GetBlob(ctx, ref.path, ref.container)
 	if err != nil {
 		return nil, fmt.Errorf("downloading blob %s: %w", ref.path, err)
@@ -95,12 +115,47 @@ func (h *Handler) Resize(ctx context.Context, in *common.BindingEvent) (out []by
 		return nil, fmt.Errorf("getting blob metadata for %s: %w", ref.path, err)
 	}
 
+	// The photo API serves the original by the SHA-256 recorded below
+	// without re-reading it, so check that the upload is still the content
+	// hashed when it was stored.
+	sum := sha256.Sum256(blobBytes)
+	if want := tags["contentHash"]; want != "" && want != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("upload %s does not match its content hash %s", ref.path, want)
+	}
+	// The processing status belongs to the upload, not the derived image.
+	delete(metadata, models.MetaProcessingStatus)
+	delete(metadata, models.MetaProcessingError)
+	delete(metadata, models.MetaProcessingUpdatedAt)
+
+	// Read the EXIF orientation from the upload. Re-encoding drops EXIF, so
+	// the rotation must be baked into the pixels during the resize.
+	orientation := 1
+	if exifData, err := exif.Extract(bytes.NewReader(blobBytes)); err != nil {
+		slog.DebugContext(ctx, "no exif data in upload, assuming upright", "path", ref.path, "error", err)
+	} else if exifData.Orientation != 0 {
+		orientation = exifData.Orientation
+	}
+	span.SetAttributes(attribute.Int("image.orientation", orientation))
+
 	// Resize the image.
-	imgBytes, err := utils.ResizeImage(blobBytes, evt.Data.ContentType, ref.path, h.cfg.MaxImageHeight, h.cfg.MaxImageWidth)
+	imgBytes, err := utils.ResizeImage(blobBytes, evt.Data.ContentType, ref.path, utils.ResizeOptions{
+		MaxHeight:   h.cfg.MaxImageHeight,
+		MaxWidth:    h.cfg.MaxImageWidth,
+		Orientation: orientation,
+		Kernel:      h.cfg.ResizeKernel,
+		JPEGQuality: h.cfg.JPEGQuality,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("resizing image %s: %w", ref.path, err)
 	}
 
+	// WebP uploads are re-encoded as JPEG; the blob name is kept so tags,
+	// thumbnails and face references that use it stay valid.
+	contentType := utils.EncodedContentType(evt.Data.ContentType)
+	if contentType != evt.Data.ContentType {
+		slog.InfoContext(ctx, "converted image format", "path", ref.path, "from", evt.Data.ContentType, "to", contentType)
+	}
+
 	// Read the dimensions of the resized image.
 	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(imgBytes))
 	if err != nil {
@@ -113,15 +168,129 @@ func (h *Handler) Resize(ctx context.Context, in *common.BindingEvent) (out []by
 	metadata["Height"] = fmt.Sprint(imgCfg.Height)
 	metadata["Width"] = fmt.Sprint(imgCfg.Width)
 
+	// Link the derived image to the full-resolution upload it was made
+	// from, which is kept under the same name in the source container.
+	metadata[models.MetaOriginalContainer] = ref.container
+	metadata[models.MetaOriginalSize] = strconv.Itoa(len(blobBytes))
+	metadata[models.MetaOriginalContentType] = evt.Data.ContentType
+	metadata[models.MetaOriginalSha256] = hex.EncodeToString(sum[:])
+
+	// Record a perceptual hash of the upright image for near-duplicate
+	// detection. It is optional, so a failure is only logged.
+	if hash, err := similarity.HashBytes(imgBytes); err != nil {
+		slog.WarnContext(ctx, "perceptual hash failed", "path", ref.path, "error", err)
+	} else {
+		metadata[similarity.MetadataKey] = hash
+	}
+
+	// The stored pixels are now upright, so record EXIF orientation 1 for
+	// every consumer. The "orientation" tag is a separate manual rotation
+	// (in degrees) set from the UI and is left untouched.
+	if _, ok := metadata[exifOrientationKey]; ok || orientation != 1 {
+		metadata[exifOrientationKey] = "1"
+	}
+
+	// Derive the smaller renditions from the resized image, which is
+	// already upright and cheaper to decode than the original. A failed
+	// rendition is left out of the metadata so clients fall back to Src.
+	var renditions []string
+	for _, r := range h.cfg.Renditions {
+		if err := h.saveRendition(ctx, imgBytes, ref.path, contentType, r); err != nil {
+			slog.WarnContext(ctx, "rendition failed", "path", ref.path, "rendition", r.Name, "error", err)
+			continue
+		}
+		renditions = append(renditions, r.Name)
+	}
+	if len(renditions) > 0 {
+		metadata["Renditions"] = strings.Join(renditions, ",")
+	} else {
+		delete(metadata, "Renditions")
+	}
+	span.SetAttributes(attribute.StringSlice("image.renditions", renditions))
+
 	// Save the resized image to the images container.
-	err = h.store.SaveBlob(ctx, bytes.NewReader(imgBytes), int64(len(imgBytes)), ref.path, h.cfg.ImagesContainerName, tags, metadata, evt.Data.ContentType)
+	err = h.store.SaveBlob(ctx, bytes.NewReader(imgBytes), int64(len(imgBytes)), ref.path, h.cfg.ImagesContainerName, tags, metadata, contentType)
 	if err != nil {
 		return nil, fmt.Errorf("saving resized blob %s: %w", ref.path, err)
 	}
 
+	h.setStatus(ctx, ref, models.ProcessingDone, "")
 	return nil, nil
 }
 
+// maxStatusErrorLen bounds the error message stored with a failed status;
+// Azure limits the total size of a blob's metadata to 8 KiB.
+const maxStatusErrorLen = 1024
+
+// setStatus records the processing status of an upload in its metadata, so
+// clients can follow it with the photo API's upload status endpoint.
+// message is the error of a failed upload. The status is informational, so
+// failing to record it is only logged.
+func (h *Handler) setStatus(ctx context.Context, ref blobRef, status, message string) {
+	md, err := h.store.GetBlobMetadata(ctx, ref.path, ref.container)
+	if err != nil {
+		slog.WarnContext(ctx, "error reading upload metadata for status", "path", ref.path, "status", status, "error", err)
+		return
+	}
+	if md == nil {
+		md = map[string]string{}
+	}
+	md[models.MetaProcessingStatus] = status
+	md[models.MetaProcessingUpdatedAt] = time.Now().UTC().Format(time.RFC3339)
+	delete(md, models.MetaProcessingError)
+	if message != "" {
+		md[models.MetaProcessingError] = metadataValue(message, maxStatusErrorLen)
+	}
+	if err := h.store.SetBlobMetadata(ctx, ref.path, ref.container, md); err != nil {
+		slog.WarnContext(ctx, "error recording upload status", "path", ref.path, "status", status, "error", err)
+	}
+}
+
+// metadataValue makes s safe to store as a metadata value, which is sent as
+// an HTTP header: characters outside printable ASCII are replaced and the
+// result is cut to at most n bytes.
+func metadataValue(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, s)
+	if len(s) > n {
+		s = s[:n]
+	}
+	return s
+}
+
+// saveRendition scales imgBytes to fit r.MaxSize and stores it in the
+// renditions container as "<rendition>/<path>".
+func (h *Handler) saveRendition(ctx context.Context, imgBytes []byte, path, contentType string, r Rendition) error {
+	out, err := utils.ResizeImage(imgBytes, contentType, path, utils.ResizeOptions{
+		MaxHeight:   r.MaxSize,
+		MaxWidth:    r.MaxSize,
+		Kernel:      h.cfg.ResizeKernel,
+		JPEGQuality: h.cfg.JPEGQuality,
+	})
+	if err != nil {
+		return fmt.Errorf("resizing: %w", err)
+	}
+
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		return fmt.Errorf("decoding rendition config: %w", err)
+	}
+	md := map[string]string{
+		"Height": fmt.Sprint(imgCfg.Height),
+		"Width":  fmt.Sprint(imgCfg.Width),
+	}
+
+	name := r.Name + "/" + path
+	if err := h.store.SaveBlob(ctx, bytes.NewReader(out), int64(len(out)), name, h.cfg.RenditionsContainerName, nil, md, contentType); err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+	return nil
+}
+
 // parseBlobRef decomposes an Azure Blob Storage URL into its constituent parts.
 // Expected URL format: https://<account>.<suffix>/<container>/<collection>/<album>/<file>
 func parseBlobRef(rawURL string) (blobRef, error) {
@@ -52,6 +52,23 @@ func main() {
 		return
 	}
 
+	kernel, err := utils.ParseKernel(utils.GetEnvValue("RESIZE_KERNEL", "catmullrom"))
+	if err != nil {
+		slog.Error("invalid RESIZE_KERNEL", "error", err)
+		return
+	}
+	jpegQuality, err := strconv.Atoi(utils.GetEnvValue("JPEG_QUALITY", strconv.Itoa(utils.DefaultJPEGQuality)))
+	if err != nil || jpegQuality < 1 || jpegQuality > 100 {
+		slog.Error("invalid JPEG_QUALITY, must be 1-100", "value", jpegQuality, "error", err)
+		return
+	}
+
+	renditions, err := ParseRenditions(utils.GetEnvValue("RENDITIONS", "thumb=320,medium=1024"))
+	if err != nil {
+		slog.Error("invalid RENDITIONS", "error", err)
+		return
+	}
+
 	storageAccount := utils.GetEnvValue("STORAGE_ACCOUNT_NAME", "")
 	storageSuffix := utils.GetEnvValue("STORAGE_ACCOUNT_SUFFIX", "blob.core.windows.net")
 
@@ -67,6 +84,11 @@ func main() {
 		StorageAccount:      storageAccount,
 		StorageSuffix:       storageSuffix,
 		StorageContainer:    utils.GetEnvValue("STORAGE_CONTAINER_NAME", ""),
+		ResizeKernel:        kernel,
+		JPEGQuality:         jpegQuality,
+
+		Renditions:              renditions,
+		RenditionsContainerName: utils.GetEnvValue("RENDITIONS_CONTAINER_NAME", "renditions"),
 	}
 
 	// ── Create blob store ────────────────────────────────────────────
@@ -3,16 +3,26 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"io"
+	"maps"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/similarity"
 	"github.com/cbellee/photo-api/internal/storage"
 	"github.com/dapr/go-sdk/service/common"
 	"github.com/stretchr/testify/assert"
@@ -657,6 +667,57 @@ func makeTestJPEG(t *testing.T, width, height int) []byte {
 	return buf.Bytes()
 }
 
+// makeTestWebP returns a lossless (VP8L) WebP of the given dimensions filled
+// with c. The standard library has no WebP encoder, but a solid colour needs
+// only single-symbol prefix codes, so every pixel is encoded in zero bits.
+func makeTestWebP(t *testing.T, width, height int, c color.NRGBA) []byte {
+	t.Helper()
+	require.True(t, width >= 1 && width <= 1<<14 && height >= 1 && height <= 1<<14)
+
+	var bits []byte
+	var acc, n uint
+	put := func(v, nbits uint) {
+		acc |= v << n
+		n += nbits
+		for n >= 8 {
+			bits = append(bits, byte(acc))
+			acc >>= 8
+			n -= 8
+		}
+	}
+
+	put(0x2f, 8) // VP8L signature
+	put(uint(width-1), 14)
+	put(uint(height-1), 14)
+	put(0, 1) // alpha hint
+	put(0, 3) // version
+	put(0, 1) // no transforms
+	put(0, 1) // no colour cache
+	put(0, 1) // no meta prefix codes
+	// Green, red, blue, alpha and distance codes, each a "simple" code with
+	// a single 8-bit symbol.
+	for _, sym := range []uint8{c.G, c.R, c.B, c.A, 0} {
+		put(1, 1) // simple code
+		put(0, 1) // one symbol
+		put(1, 1) // 8-bit symbol
+		put(uint(sym), 8)
+	}
+	if n > 0 {
+		bits = append(bits, byte(acc))
+	}
+	if len(bits)%2 == 1 {
+		bits = append(bits, 0) // RIFF chunks are padded to even length
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+len(bits)))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(bits)))
+	buf.Write(bits)
+	return buf.Bytes()
+}
+
 func TestResizeHandler_HappyPath(t *testing.T) {
 	cfg := testConfig()
 	cfg.MaxImageHeight = 600
@@ -714,6 +775,19 @@ func TestResizeHandler_HappyPath(t *testing.T) {
 	assert.NotEmpty(t, savedMeta["Width"])
 	assert.NotEmpty(t, savedMeta["Height"])
 	assert.NotEmpty(t, savedMeta["Size"])
+
+	// The derived image records the original it was made from.
+	sum := sha256.Sum256(srcJPEG)
+	assert.Equal(t, "uploads", savedMeta["OriginalContainer"])
+	assert.Equal(t, strconv.Itoa(len(srcJPEG)), savedMeta["OriginalSize"])
+	assert.Equal(t, "image/jpeg", savedMeta["OriginalContentType"])
+	assert.Equal(t, hex.EncodeToString(sum[:]), savedMeta["OriginalSha256"])
+
+	// A perceptual hash of the resized image is stored for near-duplicate
+	// detection.
+	wantHash, err := similarity.HashBytes(savedBlob)
+	require.NoError(t, err)
+	assert.Equal(t, wantHash, savedMeta[similarity.MetadataKey])
 }
 
 func TestResizeHandler_HappyPath_SmallImage(t *testing.T) {
@@ -752,7 +826,325 @@ func TestResizeHandler_HappyPath_SmallImage(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Nil(t, result)
-	assert.NotNil(t, savedBlob)
+	require.NotNil(t, savedBlob)
+
+	// Images already within bounds are not upscaled.
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(savedBlob))
+	require.NoError(t, err)
+	assert.Equal(t, 200, imgCfg.Width)
+	assert.Equal(t, 150, imgCfg.Height)
+}
+
+// withOrientation inserts an APP1 EXIF segment carrying only the IFD0
+// Orientation tag directly after the JPEG SOI marker.
+func withOrientation(t *testing.T, jpegBytes []byte, orientation uint16) []byte {
+	t.Helper()
+	require.True(t, bytes.HasPrefix(jpegBytes, []byte{0xFF, 0xD8}), "not a JPEG")
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))      // IFD0 offset
+	binary.Write(&tiff, binary.LittleEndian, uint16(1))      // entry count
+	binary.Write(&tiff, binary.LittleEndian, uint16(0x0112)) // Orientation
+	binary.Write(&tiff, binary.LittleEndian, uint16(3))      // SHORT
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, orientation)
+	binary.Write(&tiff, binary.LittleEndian, uint16(0)) // padding
+	binary.Write(&tiff, binary.LittleEndian, uint32(0)) // next IFD
+
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(tiff.Len()+6+2))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(jpegBytes[2:])
+	return out.Bytes()
+}
+
+func TestResizeHandler_AppliesExifOrientation(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxImageHeight = 600
+	cfg.MaxImageWidth = 800
+
+	// A phone portrait: landscape pixels tagged "rotate 90° CW".
+	srcJPEG := withOrientation(t, makeTestJPEG(t, 400, 300), 6)
+
+	var savedBlob []byte
+	var savedMeta map[string]string
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return srcJPEG, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"collection": "c", "album": "a"}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"ExifOrientation": "6"}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			savedBlob, _ = io.ReadAll(reader)
+			savedMeta = metadata
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	testURL := "https://teststorage.blob.core.windows.net/uploads/c/a/portrait.jpg"
+	event := createTestBindingEvent(testURL, "image/jpeg", int32(len(srcJPEG)))
+
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, savedBlob, "blob should have been saved")
+
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(savedBlob))
+	require.NoError(t, err)
+	assert.Less(t, imgCfg.Width, imgCfg.Height, "stored image should be portrait")
+	assert.Equal(t, fmt.Sprint(imgCfg.Width), savedMeta["Width"])
+	assert.Equal(t, fmt.Sprint(imgCfg.Height), savedMeta["Height"])
+	assert.Equal(t, "1", savedMeta["ExifOrientation"], "stored orientation should be reset to upright")
+}
+
+func TestResizeHandler_Renditions(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxImageHeight = 600
+	cfg.MaxImageWidth = 800
+	cfg.Renditions = []Rendition{{Name: "thumb", MaxSize: 100}, {Name: "medium", MaxSize: 400}}
+	cfg.RenditionsContainerName = "renditions"
+
+	srcJPEG := makeTestJPEG(t, 2000, 1500)
+
+	var mu sync.Mutex
+	saved := map[string][]byte{}
+	var primaryMeta map[string]string
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return srcJPEG, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"collection": "c", "album": "a"}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			data, _ := io.ReadAll(reader)
+			mu.Lock()
+			defer mu.Unlock()
+			saved[containerName+"/"+blobName] = data
+			if containerName == cfg.ImagesContainerName {
+				primaryMeta = metadata
+			}
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	testURL := "https://teststorage.blob.core.windows.net/uploads/c/a/photo.jpg"
+	event := createTestBindingEvent(testURL, "image/jpeg", int32(len(srcJPEG)))
+
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	require.Contains(t, saved, "test-images/c/a/photo.jpg")
+	require.Contains(t, saved, "renditions/thumb/c/a/photo.jpg")
+	require.Contains(t, saved, "renditions/medium/c/a/photo.jpg")
+	assert.Equal(t, "thumb,medium", primaryMeta["Renditions"])
+
+	for name, want := range map[string]int{"thumb": 100, "medium": 400} {
+		imgCfg, _, err := image.DecodeConfig(bytes.NewReader(saved["renditions/"+name+"/c/a/photo.jpg"]))
+		require.NoError(t, err)
+		assert.Equal(t, want, imgCfg.Width, name)
+	}
+}
+
+func TestResizeHandler_RenditionFailureIsNotFatal(t *testing.T) {
+	cfg := testConfig()
+	cfg.Renditions = []Rendition{{Name: "thumb", MaxSize: 100}}
+	cfg.RenditionsContainerName = "renditions"
+
+	srcJPEG := makeTestJPEG(t, 400, 300)
+	var primaryMeta map[string]string
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return srcJPEG, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			// Stale value from an earlier run must not survive.
+			return map[string]string{"Renditions": "thumb"}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			if containerName == "renditions" {
+				return assert.AnError
+			}
+			primaryMeta = metadata
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	event := createTestBindingEvent("https://teststorage.blob.core.windows.net/uploads/c/a/f.jpg", "image/jpeg", int32(len(srcJPEG)))
+
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, primaryMeta, "primary image should still be saved")
+	assert.NotContains(t, primaryMeta, "Renditions")
+}
+
+func TestParseRenditions(t *testing.T) {
+	got, err := ParseRenditions(" thumb=320, medium=1024 ,large=1600")
+	require.NoError(t, err)
+	assert.Equal(t, []Rendition{{"thumb", 320}, {"medium", 1024}, {"large", 1600}}, got)
+
+	got, err = ParseRenditions("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	for _, spec := range []string{"thumb", "thumb=0", "thumb=abc", "Thumb=10", "a/b=10", "t=1,t=2", "full=1600"} {
+		_, err := ParseRenditions(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestResizeHandler_WebP(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxImageHeight = 600
+	cfg.MaxImageWidth = 800
+	cfg.Renditions = []Rendition{{Name: "thumb", MaxSize: 100}}
+	cfg.RenditionsContainerName = "renditions"
+
+	srcWebP := makeTestWebP(t, 1000, 500, color.NRGBA{R: 200, G: 40, B: 90, A: 255})
+
+	type savedBlob struct {
+		data        []byte
+		contentType string
+	}
+	saved := map[string]savedBlob{}
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return srcWebP, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"collection": "c", "album": "a"}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			data, _ := io.ReadAll(reader)
+			saved[containerName+"/"+blobName] = savedBlob{data, contentType}
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	testURL := "https://teststorage.blob.core.windows.net/uploads/c/a/photo.webp"
+	event := createTestBindingEvent(testURL, "image/webp", int32(len(srcWebP)))
+
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	// The blob name is kept, but the stored bytes and content type are JPEG.
+	for _, key := range []string{"test-images/c/a/photo.webp", "renditions/thumb/c/a/photo.webp"} {
+		b, ok := saved[key]
+		require.True(t, ok, "%s should have been saved", key)
+		assert.Equal(t, "image/jpeg", b.contentType, key)
+
+		img, err := jpeg.Decode(bytes.NewReader(b.data))
+		require.NoError(t, err, key)
+		r, g, bl, _ := img.At(img.Bounds().Dx()/2, img.Bounds().Dy()/2).RGBA()
+		assert.InDelta(t, 200, r>>8, 8, key)
+		assert.InDelta(t, 40, g>>8, 8, key)
+		assert.InDelta(t, 90, bl>>8, 8, key)
+	}
+
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(saved["test-images/c/a/photo.webp"].data))
+	require.NoError(t, err)
+	assert.Equal(t, 800, imgCfg.Width)
+	assert.Equal(t, 400, imgCfg.Height)
+}
+
+func TestResizeHandler_HEIC(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxImageHeight = 256
+	cfg.MaxImageWidth = 256
+
+	// 512x512 HEIC sample from the github.com/gen2brain/heic test suite.
+	srcHEIC, err := os.ReadFile("../../testdata/sample.heic")
+	require.NoError(t, err)
+
+	var savedBlob []byte
+	var savedContainer, savedName, savedType string
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return srcHEIC, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"collection": "c", "album": "a"}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			savedBlob, _ = io.ReadAll(reader)
+			savedContainer, savedName, savedType = containerName, blobName, contentType
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	testURL := "https://teststorage.blob.core.windows.net/uploads/c/a/IMG_0001.HEIC"
+	event := createTestBindingEvent(testURL, "image/heic", int32(len(srcHEIC)))
+
+	_, err = h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	// Converted to JPEG in the images container; the upload is untouched.
+	assert.Equal(t, cfg.ImagesContainerName, savedContainer)
+	assert.Equal(t, "c/a/IMG_0001.HEIC", savedName)
+	assert.Equal(t, "image/jpeg", savedType)
+	assert.Empty(t, mock.DeleteBlobCalls, "the original upload must be kept")
+
+	img, err := jpeg.Decode(bytes.NewReader(savedBlob))
+	require.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+	assert.Equal(t, 256, img.Bounds().Dy())
+}
+
+func TestResizeHandler_InvalidWebP(t *testing.T) {
+	cfg := testConfig()
+	saveCalled := false
+
+	mock := &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return []byte("RIFF\x00\x00\x00\x00WEBPjunk"), nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			saveCalled = true
+			return nil
+		},
+	}
+
+	h := NewHandler(mock, cfg)
+	event := createTestBindingEvent("https://teststorage.blob.core.windows.net/uploads/c/a/bad.webp", "image/webp", 16)
+
+	// Handler always ACKs to prevent requeue; error is logged, not returned.
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+	assert.False(t, saveCalled, "undecodable WebP should not be saved")
 }
 
 func TestResizeHandler_GetBlobError(t *testing.T) {
@@ -858,3 +1250,102 @@ func TestResizeHandler_GetBlobMetadataError(t *testing.T) {
 	// Handler always ACKs to prevent requeue; error is logged, not returned.
 	require.NoError(t, err)
 }
+
+// statusStore returns a mock whose upload metadata is kept in memory, so
+// status updates made by the handler are visible to later reads.
+func statusStore(t *testing.T, cfg *Config, src []byte, saveErr error) *storage.MockBlobStore {
+	t.Helper()
+	var mu sync.Mutex
+	uploadMeta := map[string]string{
+		"Width":                        "100",
+		models.MetaProcessingStatus:    models.ProcessingPending,
+		models.MetaProcessingUpdatedAt: "2026-01-01T00:00:00Z",
+	}
+	return &storage.MockBlobStore{
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			return src, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{}, nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			assert.Equal(t, "uploads", containerName)
+			mu.Lock()
+			defer mu.Unlock()
+			return maps.Clone(uploadMeta), nil
+		},
+		SetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string, metadata map[string]string) error {
+			assert.Equal(t, "uploads", containerName)
+			assert.Equal(t, "c/a/f.jpg", blobName)
+			mu.Lock()
+			defer mu.Unlock()
+			uploadMeta = maps.Clone(metadata)
+			return nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			if containerName == cfg.ImagesContainerName {
+				assert.NotContains(t, metadata, models.MetaProcessingStatus)
+				assert.NotContains(t, metadata, models.MetaProcessingUpdatedAt)
+				return saveErr
+			}
+			return nil
+		},
+	}
+}
+
+func TestResizeHandler_RecordsProcessingStatus(t *testing.T) {
+	cfg := testConfig()
+	mock := statusStore(t, cfg, makeTestJPEG(t, 100, 100), nil)
+
+	h := NewHandler(mock, cfg)
+	event := createTestBindingEvent("https://teststorage.blob.core.windows.net/uploads/c/a/f.jpg", "image/jpeg", 1024)
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	require.Len(t, mock.SetBlobMetadataCalls, 2)
+	assert.Equal(t, models.ProcessingInProgress, mock.SetBlobMetadataCalls[0].Metadata[models.MetaProcessingStatus])
+	done := mock.SetBlobMetadataCalls[1].Metadata
+	assert.Equal(t, models.ProcessingDone, done[models.MetaProcessingStatus])
+	assert.NotContains(t, done, models.MetaProcessingError)
+	assert.NotEqual(t, "2026-01-01T00:00:00Z", done[models.MetaProcessingUpdatedAt])
+	assert.Equal(t, "100", done["Width"], "other upload metadata is kept")
+}
+
+func TestResizeHandler_RecordsFailure(t *testing.T) {
+	cfg := testConfig()
+	mock := statusStore(t, cfg, makeTestJPEG(t, 100, 100), errors.New("storage unavailable"))
+
+	h := NewHandler(mock, cfg)
+	event := createTestBindingEvent("https://teststorage.blob.core.windows.net/uploads/c/a/f.jpg", "image/jpeg", 1024)
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, mock.SetBlobMetadataCalls)
+	last := mock.SetBlobMetadataCalls[len(mock.SetBlobMetadataCalls)-1].Metadata
+	assert.Equal(t, models.ProcessingFailed, last[models.MetaProcessingStatus])
+	assert.Contains(t, last[models.MetaProcessingError], "storage unavailable")
+}
+
+func TestResizeHandler_RejectsUploadNotMatchingContentHash(t *testing.T) {
+	cfg := testConfig()
+	mock := statusStore(t, cfg, makeTestJPEG(t, 100, 100), nil)
+	mock.GetBlobTagsFunc = func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+		return map[string]string{"contentHash": strings.Repeat("0", 64)}, nil
+	}
+
+	h := NewHandler(mock, cfg)
+	event := createTestBindingEvent("https://teststorage.blob.core.windows.net/uploads/c/a/f.jpg", "image/jpeg", 1024)
+	_, err := h.Resize(context.Background(), event)
+	require.NoError(t, err)
+
+	assert.Empty(t, mock.SaveBlobCalls, "no image is derived from a changed upload")
+	last := mock.SetBlobMetadataCalls[len(mock.SetBlobMetadataCalls)-1].Metadata
+	assert.Equal(t, models.ProcessingFailed, last[models.MetaProcessingStatus])
+	assert.Contains(t, last[models.MetaProcessingError], "does not match its content hash")
+}
+
+func TestMetadataValue(t *testing.T) {
+	assert.Equal(t, "bad file caf? \"x\"", metadataValue("bad file café \"x\"", 100))
+	assert.Equal(t, "line?two", metadataValue("line\ntwo", 100))
+	assert.Equal(t, "abc", metadataValue("abcdef", 3))
+}
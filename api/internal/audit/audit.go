@@ -0,0 +1,104 @@
+// Package audit records who changed what through the admin API. Each
+// mutation made by an authorised caller becomes an Entry, written to a
+// pluggable Sink: SQLite for local development, Azure Table Storage in
+// production, or the structured log (stdout and OpenTelemetry) where no
+// queryable store is wanted.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotQueryable is returned by sinks that can record entries but not
+// search them.
+var ErrNotQueryable = errors.New("audit sink cannot be queried")
+
+// Entry is one audited mutation.
+type Entry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the caller's JWT subject and ActorName their display name.
+	Actor     string `json:"actor"`
+	ActorName string `json:"actorName,omitempty"`
+	// Action is the route that was called, e.g. "PUT /api/rename/{collection}".
+	Action string `json:"action"`
+	// Target is what was changed, usually a "collection[/album[/name]]"
+	// path.
+	Target string `json:"target"`
+	// Status is the HTTP status of the response.
+	Status int `json:"status"`
+	// Before and After are the tags that changed, as they were before the
+	// mutation and as it set them.
+	Before map[string]string `json:"before,omitempty"`
+	After  map[string]string `json:"after,omitempty"`
+	// JobID is the background job that carries out the mutation, if any.
+	JobID string `json:"jobId,omitempty"`
+}
+
+// Filter selects entries to return from Sink.Query.
+type Filter struct {
+	// Since excludes entries older than it, if set.
+	Since time.Time
+	// Actor matches an entry's Actor or ActorName, if set.
+	Actor string
+	// Target matches an entry's Target, or anything beneath it: "nature"
+	// also matches "nature/sunset/photo1.jpg".
+	Target string
+	// Limit caps the number of entries returned.
+	Limit int
+}
+
+// Sink stores audit entries.
+type Sink interface {
+	// Record stores an entry.
+	Record(ctx context.Context, e Entry) error
+	// Query returns the entries matching f, newest first, or
+	// ErrNotQueryable.
+	Query(ctx context.Context, f Filter) ([]Entry, error)
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// NewID returns a random entry ID.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Actor identifies an authenticated caller.
+type Actor struct {
+	ID   string // JWT "sub"
+	Name string // JWT "name"
+}
+
+type actorKey struct{}
+type entryKey struct{}
+
+// WithActor returns a context carrying the authenticated caller.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFrom returns the caller stored by WithActor.
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(Actor)
+	return a, ok
+}
+
+// WithEntry returns a context carrying the entry being built for the
+// current request, so handlers can fill in its target and tags.
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// EntryFrom returns the entry stored by WithEntry, or nil if the request
+// is not audited.
+func EntryFrom(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryKey{}).(*Entry)
+	return e
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteSink(t *testing.T) *SQLiteSink {
+	t.Helper()
+	s, err := NewSQLiteSink(t.TempDir() + "/audit.db")
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteSink_Query(t *testing.T) {
+	s := newTestSQLiteSink(t)
+	ctx := context.Background()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{ID: "1", Time: base, Actor: "u1", ActorName: "Alice", Action: "PUT /api/rename/{collection}", Target: "nature", Status: 202,
+			Before: map[string]string{"collection": "nature"}, After: map[string]string{"collection": "wildlife"}, JobID: "job1"},
+		{ID: "2", Time: base.Add(time.Hour), Actor: "u2", ActorName: "Bob", Action: "DELETE /api/{collection}/{album}", Target: "nature/sunset", Status: 202},
+		{ID: "3", Time: base.Add(2 * time.Hour), Actor: "u1", ActorName: "Alice", Action: "PUT /api/update/{collection}/{album}/{id}", Target: "nature/sunset/photo1.jpg", Status: 200},
+		{ID: "4", Time: base.Add(3 * time.Hour), Actor: "u2", ActorName: "Bob", Action: "DELETE /api/{collection}", Target: "nature2", Status: 202},
+	}
+	for _, e := range entries {
+		require.NoError(t, s.Record(ctx, e))
+	}
+
+	ids := func(f Filter) []string {
+		t.Helper()
+		if f.Limit == 0 {
+			f.Limit = 100
+		}
+		got, err := s.Query(ctx, f)
+		require.NoError(t, err)
+		var ids []string
+		for _, e := range got {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"4", "3", "2", "1"}, ids(Filter{}), "newest first")
+	assert.Equal(t, []string{"4", "3"}, ids(Filter{Since: base.Add(2 * time.Hour)}))
+	assert.Equal(t, []string{"3", "1"}, ids(Filter{Actor: "u1"}))
+	assert.Equal(t, []string{"4", "2"}, ids(Filter{Actor: "Bob"}), "matches the display name")
+	assert.Equal(t, []string{"3", "2", "1"}, ids(Filter{Target: "nature"}), "matches beneath the target but not nature2")
+	assert.Equal(t, []string{"3"}, ids(Filter{Target: "nature/sunset", Actor: "Alice"}))
+	assert.Equal(t, []string{"4", "3"}, ids(Filter{Limit: 2}))
+
+	got, err := s.Query(ctx, Filter{Target: "nature", Since: base, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, entries[0], got[2], "entries round-trip")
+	assert.Nil(t, got[0].Before)
+}
+
+func TestLogSink(t *testing.T) {
+	s := NewLogSink(nil)
+	assert.NoError(t, s.Record(context.Background(), Entry{ID: "1", Actor: "u1", Target: "nature"}))
+	_, err := s.Query(context.Background(), Filter{})
+	assert.ErrorIs(t, err, ErrNotQueryable)
+}
+
+func TestRowKeyTime_SortsNewestFirst(t *testing.T) {
+	t1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Nanosecond)
+	assert.Less(t, rowKeyTime(t2), rowKeyTime(t1))
+	assert.Len(t, rowKeyTime(t1), len(rowKeyTime(time.Unix(0, 0))))
+	// An entry at exactly Since is within the "RowKey lt '<since>.'" range.
+	assert.Less(t, rowKeyTime(t1)+"-abc", rowKeyTime(t1)+".")
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	_, ok := ActorFrom(ctx)
+	assert.False(t, ok)
+	assert.Nil(t, EntryFrom(ctx))
+
+	ctx = WithActor(ctx, Actor{ID: "u1", Name: "Alice"})
+	a, ok := ActorFrom(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "Alice", a.Name)
+
+	e := &Entry{ID: "1"}
+	assert.Same(t, e, EntryFrom(WithEntry(ctx, e)))
+}
@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogSink writes entries to a structured logger, which the API's logger
+// sends to stdout and, when configured, OpenTelemetry. It cannot be
+// queried.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink returns a sink that logs entries to logger, or to the default
+// logger if it is nil.
+func NewLogSink(logger *slog.Logger) *LogSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Record(ctx context.Context, e Entry) error {
+	s.logger.InfoContext(ctx, "audit",
+		"audit.id", e.ID,
+		"audit.time", e.Time,
+		"audit.actor", e.Actor,
+		"audit.actor_name", e.ActorName,
+		"audit.action", e.Action,
+		"audit.target", e.Target,
+		"audit.status", e.Status,
+		"audit.before", e.Before,
+		"audit.after", e.After,
+		"audit.job_id", e.JobID)
+	return nil
+}
+
+func (s *LogSink) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	return nil, ErrNotQueryable
+}
+
+func (s *LogSink) Close() error { return nil }
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteSink stores entries in a local SQLite database. It is used for
+// local development and tests.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+// NewSQLiteSink opens (or creates) the SQLite database at dbPath and
+// initialises the schema.
+func NewSQLiteSink(dbPath string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("audit: open db: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		return nil, fmt.Errorf("audit: WAL mode: %w", err)
+	}
+	if _, err := db.Exec("PRAGMA busy_timeout=5000"); err != nil {
+		return nil, fmt.Errorf("audit: busy timeout: %w", err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id         TEXT PRIMARY KEY,
+			time_ns    INTEGER NOT NULL,
+			actor      TEXT NOT NULL,
+			actor_name TEXT NOT NULL DEFAULT '',
+			action     TEXT NOT NULL,
+			target     TEXT NOT NULL,
+			status     INTEGER NOT NULL,
+			before     TEXT NOT NULL DEFAULT '',
+			after      TEXT NOT NULL DEFAULT '',
+			job_id     TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_time ON audit_log(time_ns);
+	`); err != nil {
+		return nil, fmt.Errorf("audit: init schema: %w", err)
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+// Close releases the database connection.
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteSink) Record(ctx context.Context, e Entry) error {
+	before, err := marshalTags(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalTags(e.After)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (id, time_ns, actor, actor_name, action, target, status, before, after, job_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.Time.UnixNano(), e.Actor, e.ActorName, e.Action, e.Target, e.Status, before, after, e.JobID)
+	if err != nil {
+		return fmt.Errorf("audit: insert entry: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteSink) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	var where []string
+	var args []any
+	if !f.Since.IsZero() {
+		where = append(where, "time_ns >= ?")
+		args = append(args, f.Since.UnixNano())
+	}
+	if f.Actor != "" {
+		where = append(where, "(actor = ? OR actor_name = ?)")
+		args = append(args, f.Actor, f.Actor)
+	}
+	if f.Target != "" {
+		// "/" sorts just before "0", so the range holds everything
+		// beneath the target.
+		where = append(where, "(target = ? OR (target >= ? AND target < ?))")
+		args = append(args, f.Target, f.Target+"/", f.Target+"0")
+	}
+	query := "SELECT id, time_ns, actor, actor_name, action, target, status, before, after, job_id FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time_ns DESC, id LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit: query: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var timeNs int64
+		var before, after string
+		if err := rows.Scan(&e.ID, &timeNs, &e.Actor, &e.ActorName, &e.Action, &e.Target, &e.Status, &before, &after, &e.JobID); err != nil {
+			return nil, fmt.Errorf("audit: scan: %w", err)
+		}
+		e.Time = time.Unix(0, timeNs).UTC()
+		if e.Before, err = unmarshalTags(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = unmarshalTags(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// marshalTags encodes tags as JSON, or "" if there are none.
+func marshalTags(tags map[string]string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("audit: marshal tags: %w", err)
+	}
+	return string(b), nil
+}
+
+// unmarshalTags decodes tags encoded by marshalTags.
+func unmarshalTags(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(s), &tags); err != nil {
+		return nil, fmt.Errorf("audit: unmarshal tags: %w", err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// tablePartition is the single partition holding every entry. Audit
+// volumes are small, and one partition lets queries scan by time.
+const tablePartition = "audit"
+
+// TableSink stores entries in an Azure Storage table. Row keys count down
+// from the end of time, so a partition scan returns the newest entries
+// first.
+type TableSink struct {
+	client *aztables.Client
+}
+
+// auditEntity is an Entry as stored in the table.
+type auditEntity struct {
+	aztables.Entity
+	ID        string `json:"ID"`
+	Time      string `json:"Time"` // RFC3339Nano
+	Actor     string `json:"Actor"`
+	ActorName string `json:"ActorName"`
+	Action    string `json:"Action"`
+	Target    string `json:"Target"`
+	Status    int    `json:"Status"`
+	Before    string `json:"Before"` // JSON-encoded tags
+	After     string `json:"After"`  // JSON-encoded tags
+	JobID     string `json:"JobID"`
+}
+
+// NewTableSink creates the table client and the table if it does not
+// exist. The credential must have "Storage Table Data Contributor" role.
+func NewTableSink(serviceURL, tableName string, cred azcore.TokenCredential) (*TableSink, error) {
+	svcClient, err := aztables.NewServiceClient(serviceURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("audit: table service client: %w", err)
+	}
+	client := svcClient.NewClient(tableName)
+	if _, err := client.CreateTable(context.Background(), nil); err != nil {
+		// Ignore "TableAlreadyExists".
+		if !strings.Contains(err.Error(), "TableAlreadyExists") {
+			return nil, fmt.Errorf("audit: create table: %w", err)
+		}
+	}
+	return &TableSink{client: client}, nil
+}
+
+func (s *TableSink) Close() error { return nil }
+
+func (s *TableSink) Record(ctx context.Context, e Entry) error {
+	before, err := marshalTags(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalTags(e.After)
+	if err != nil {
+		return err
+	}
+	ent := auditEntity{
+		Entity: aztables.Entity{
+			PartitionKey: tablePartition,
+			RowKey:       rowKeyTime(e.Time) + "-" + e.ID,
+		},
+		ID:        e.ID,
+		Time:      e.Time.UTC().Format(time.RFC3339Nano),
+		Actor:     e.Actor,
+		ActorName: e.ActorName,
+		Action:    e.Action,
+		Target:    e.Target,
+		Status:    e.Status,
+		Before:    before,
+		After:     after,
+		JobID:     e.JobID,
+	}
+	b, err := json.Marshal(ent)
+	if err != nil {
+		return fmt.Errorf("audit: marshal entity: %w", err)
+	}
+	if _, err := s.client.AddEntity(ctx, b, nil); err != nil {
+		return fmt.Errorf("audit: add entity: %w", err)
+	}
+	return nil
+}
+
+func (s *TableSink) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s'", tablePartition)
+	if !f.Since.IsZero() {
+		// Entries at or after Since have row keys up to Since's, plus
+		// their "-<id>" suffix.
+		filter += fmt.Sprintf(" and RowKey lt '%s.'", rowKeyTime(f.Since))
+	}
+	if f.Actor != "" {
+		filter += fmt.Sprintf(" and (Actor eq '%s' or ActorName eq '%s')", escapeOData(f.Actor), escapeOData(f.Actor))
+	}
+	if f.Target != "" {
+		// Table Storage has no "starts with"; "/" sorts just before "0",
+		// so the range holds everything beneath the target.
+		t := escapeOData(f.Target)
+		filter += fmt.Sprintf(" and (Target eq '%s' or (Target ge '%s/' and Target lt '%s0'))", t, t, t)
+	}
+
+	entries := []Entry{}
+	pager := s.client.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter})
+	for pager.More() && len(entries) < f.Limit {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("audit: list entities: %w", err)
+		}
+		for _, raw := range resp.Entities {
+			var ent auditEntity
+			if err := json.Unmarshal(raw, &ent); err != nil {
+				return nil, fmt.Errorf("audit: unmarshal entity: %w", err)
+			}
+			e := Entry{
+				ID:        ent.ID,
+				Actor:     ent.Actor,
+				ActorName: ent.ActorName,
+				Action:    ent.Action,
+				Target:    ent.Target,
+				Status:    ent.Status,
+				JobID:     ent.JobID,
+			}
+			e.Time, _ = time.Parse(time.RFC3339Nano, ent.Time)
+			if e.Before, err = unmarshalTags(ent.Before); err != nil {
+				return nil, err
+			}
+			if e.After, err = unmarshalTags(ent.After); err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+			if len(entries) == f.Limit {
+				break
+			}
+		}
+	}
+	return entries, nil
+}
+
+// rowKeyTime encodes t so that later times sort first.
+func rowKeyTime(t time.Time) string {
+	return fmt.Sprintf("%019d", math.MaxInt64-t.UnixNano())
+}
+
+func escapeOData(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
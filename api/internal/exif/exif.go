@@ -1,24 +1,306 @@
 package exif
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/cbellee/photo-api/internal/models"
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 )
 
-// GetExifJSON extracts EXIF metadata from an image reader and returns it as a JSON string.
-// The caller should provide a reader positioned at the start of the image data.
-func GetExifJSON(r io.Reader) (string, error) {
-	exMeta, err := exif.Decode(r)
+// exifTimeLayout is the fixed layout EXIF uses for DateTime* fields.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// offsetFields are the EXIF 2.31 time-zone tags. goexif predates them, so
+// they are loaded from the EXIF sub-IFD by offsetParser.
+var offsetFields = map[uint16]exif.FieldName{
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+}
+
+// offsetParser is a goexif parser that loads offsetFields.
+type offsetParser struct{}
+
+func (offsetParser) Parse(x *exif.Exif) error {
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil {
+		return nil
+	}
+
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil
+	}
+	// Decode failures of the sub-IFD are already reported by goexif's own parser.
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(dir, offsetFields, false)
+	return nil
+}
+
+func init() {
+	exif.RegisterParsers(offsetParser{})
+}
+
+// Extract decodes the EXIF block of an image and returns the fields the
+// photo API exposes. The caller should provide a reader positioned at the
+// start of the image data. JPEG, TIFF and HEIF/HEIC containers are
+// supported. Damaged sub-IFDs (e.g. a corrupt GPS block) are tolerated as
+// long as the main IFD decodes.
+func Extract(r io.Reader) (*models.ExifData, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(12); isHEIF(head) {
+		// HEIF stores EXIF as an item located through the meta box, which
+		// needs random access to the whole file.
+		file, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading heif data: %w", err)
+		}
+		tiffData, err := heifExif(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading exif data: %w", err)
+		}
+		r = bytes.NewReader(tiffData)
+	} else {
+		r = br
+	}
+
+	x, err := exif.Decode(r)
+	if err != nil && (x == nil || exif.IsCriticalError(err)) {
+		return nil, fmt.Errorf("reading exif data: %w", err)
+	}
+	return build(decodedSource{x}), nil
+}
+
+// FromLegacyJSON converts the goexif JSON previously stored in the
+// "exifData" metadata key into the structured form, so photos uploaded
+// before fields were stored individually still expose an exif object.
+func FromLegacyJSON(s string) (*models.ExifData, error) {
+	var src legacySource
+	if err := json.Unmarshal([]byte(s), &src); err != nil {
+		return nil, fmt.Errorf("decoding legacy exif json: %w", err)
+	}
+	return build(src), nil
+}
+
+// fieldSource abstracts over decoded EXIF and legacy goexif JSON so both are
+// mapped onto models.ExifData by the same rules.
+type fieldSource interface {
+	// str returns a non-empty ASCII field value.
+	str(name exif.FieldName) (string, bool)
+	// num returns the i'th value of a rational, integer or float field.
+	num(name exif.FieldName, i int) (float64, bool)
+}
+
+// build maps EXIF fields onto models.ExifData.
+func build(src fieldSource) *models.ExifData {
+	d := &models.ExifData{}
+
+	d.Make, _ = src.str(exif.Make)
+	d.Model, _ = src.str(exif.Model)
+	d.LensModel, _ = src.str(exif.LensModel)
+
+	if v, ok := src.num(exif.FocalLength, 0); ok {
+		d.FocalLength = round(v, 2)
+	}
+	if v, ok := src.num(exif.FNumber, 0); ok {
+		d.Aperture = round(v, 2)
+	}
+	if v, ok := src.num(exif.ExposureTime, 0); ok && v > 0 {
+		d.ExposureTime = v
+		d.ShutterSpeed = shutterSpeed(v)
+	}
+	if v, ok := src.num(exif.ISOSpeedRatings, 0); ok {
+		d.ISO = int(v)
+	}
+	if v, ok := src.num(exif.Flash, 0); ok {
+		// Bit 0 of the Flash field records whether the flash fired.
+		fired := int(v)&1 == 1
+		d.Flash = &fired
+	}
+	if v, ok := src.num(exif.Orientation, 0); ok {
+		d.Orientation = int(v)
+	}
+
+	if lat, ok := degrees(src, exif.GPSLatitude, exif.GPSLatitudeRef, "S"); ok {
+		d.Latitude = &lat
+	}
+	if long, ok := degrees(src, exif.GPSLongitude, exif.GPSLongitudeRef, "W"); ok {
+		d.Longitude = &long
+	}
+	if alt, ok := src.num(exif.GPSAltitude, 0); ok {
+		// GPSAltitudeRef 1 means below sea level.
+		if ref, ok := src.num(exif.GPSAltitudeRef, 0); ok && ref == 1 {
+			alt = -alt
+		}
+		alt = round(alt, 2)
+		d.Altitude = &alt
+	}
+
+	if t, err := dateTaken(src); err == nil {
+		d.DateTaken = t
+	}
+
+	return d
+}
+
+// dateTaken resolves the capture time from DateTimeOriginal, falling back to
+// DateTime. When OffsetTimeOriginal (or OffsetTime) is present the result
+// carries that UTC offset; otherwise the camera's zone is unknown and the
+// wall-clock time is returned as UTC.
+func dateTaken(src fieldSource) (time.Time, error) {
+	raw, ok := src.str(exif.DateTimeOriginal)
+	if !ok {
+		raw, ok = src.str(exif.DateTime)
+		if !ok {
+			return time.Time{}, errors.New("no DateTimeOriginal or DateTime field")
+		}
+	}
+
+	loc := time.UTC
+	for _, name := range []exif.FieldName{"OffsetTimeOriginal", "OffsetTime"} {
+		if off, ok := src.str(name); ok {
+			if t, err := time.Parse("-07:00", off); err == nil {
+				_, secs := t.Zone()
+				loc = time.FixedZone("", secs)
+				break
+			}
+		}
+	}
+
+	t, err := time.ParseInLocation(exifTimeLayout, raw, loc)
 	if err != nil {
-		return "", fmt.Errorf("reading exif data: %w", err)
+		return time.Time{}, fmt.Errorf("parsing exif date %q: %w", raw, err)
+	}
+	return t, nil
+}
+
+// degrees converts a degrees/minutes/seconds GPS field into signed decimal
+// degrees, negating it when the reference field equals negRef.
+func degrees(src fieldSource, name, refName exif.FieldName, negRef string) (float64, bool) {
+	var parts [3]float64
+	for i := range parts {
+		v, ok := src.num(name, i)
+		if !ok {
+			return 0, false
+		}
+		parts[i] = v
+	}
+
+	deg := parts[0] + parts[1]/60 + parts[2]/3600
+	if ref, ok := src.str(refName); ok && strings.EqualFold(ref, negRef) {
+		deg = -deg
+	}
+	return round(deg, 6), true
+}
+
+// shutterSpeed formats an exposure time in seconds the way cameras display
+// it: fractions below one second ("1/250") and decimals above ("2.5").
+func shutterSpeed(secs float64) string {
+	if secs >= 1 {
+		return strconv.FormatFloat(round(secs, 1), 'f', -1, 64)
 	}
+	return fmt.Sprintf("1/%d", int(math.Round(1/secs)))
+}
 
-	jsonByte, err := exMeta.MarshalJSON()
+func round(v float64, places int) float64 {
+	p := math.Pow10(places)
+	return math.Round(v*p) / p
+}
+
+// decodedSource reads fields from goexif's decoded representation.
+type decodedSource struct {
+	x *exif.Exif
+}
+
+func (s decodedSource) str(name exif.FieldName) (string, bool) {
+	tag, err := s.x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return "", false
+	}
+	v, err := tag.StringVal()
 	if err != nil {
-		return "", fmt.Errorf("marshalling exif metadata to JSON: %w", err)
+		return "", false
+	}
+	v = strings.TrimSpace(strings.TrimRight(v, "\x00"))
+	return v, v != ""
+}
+
+func (s decodedSource) num(name exif.FieldName, i int) (float64, bool) {
+	tag, err := s.x.Get(name)
+	if err != nil || i >= int(tag.Count) {
+		return 0, false
 	}
 
-	return string(jsonByte), nil
+	switch tag.Format() {
+	case tiff.RatVal:
+		n, d, err := tag.Rat2(i)
+		if err != nil || d == 0 {
+			return 0, false
+		}
+		return float64(n) / float64(d), true
+	case tiff.IntVal:
+		v, err := tag.Int64(i)
+		return float64(v), err == nil
+	case tiff.FloatVal:
+		v, err := tag.Float(i)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// legacySource reads fields from goexif's MarshalJSON output, where strings
+// are JSON strings and numeric fields are arrays of numbers or "num/den"
+// rational strings.
+type legacySource map[exif.FieldName]json.RawMessage
+
+func (s legacySource) str(name exif.FieldName) (string, bool) {
+	var v string
+	if err := json.Unmarshal(s[name], &v); err != nil {
+		return "", false
+	}
+	v = strings.TrimSpace(v)
+	return v, v != ""
+}
+
+func (s legacySource) num(name exif.FieldName, i int) (float64, bool) {
+	var vals []json.RawMessage
+	if err := json.Unmarshal(s[name], &vals); err != nil || i >= len(vals) {
+		return 0, false
+	}
+
+	var f float64
+	if err := json.Unmarshal(vals[i], &f); err == nil {
+		return f, true
+	}
+
+	var rat string
+	if err := json.Unmarshal(vals[i], &rat); err != nil {
+		return 0, false
+	}
+	num, den, ok := strings.Cut(rat, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0, false
+	}
+	return n / d, true
 }
@@ -3,9 +3,12 @@ package exif
 import (
 	"bytes"
 	"encoding/binary"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cbellee/photo-api/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -56,18 +59,123 @@ func buildJPEGWithExif(t *testing.T) []byte {
 	return jpeg.Bytes()
 }
 
-func TestGetExifJSON_SuccessPath(t *testing.T) {
+// testTag is a raw TIFF IFD entry used by buildTIFF. Data holds the value
+// bytes in little-endian order; values longer than 4 bytes are written to
+// the data area and referenced by offset.
+type testTag struct {
+	id    uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiTag(id uint16, s string) testTag {
+	return testTag{id: id, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func byteTag(id uint16, v byte) testTag {
+	return testTag{id: id, typ: 1, count: 1, data: []byte{v}}
+}
+
+func shortTag(id uint16, v uint16) testTag {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return testTag{id: id, typ: 3, count: 1, data: b}
+}
+
+// rationalTag builds an unsigned RATIONAL entry from numerator/denominator pairs.
+func rationalTag(id uint16, pairs ...uint32) testTag {
+	b := make([]byte, 4*len(pairs))
+	for i, v := range pairs {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return testTag{id: id, typ: 5, count: uint32(len(pairs) / 2), data: b}
+}
+
+// buildTIFF lays out IFD0 followed by optional EXIF and GPS sub-IFDs and a
+// shared data area, adding the sub-IFD pointer tags to IFD0 as needed.
+func buildTIFF(ifd0, exifIFD, gpsIFD []testTag) []byte {
+	le := binary.LittleEndian
+	ifdSize := func(tags []testTag) uint32 {
+		if len(tags) == 0 {
+			return 0
+		}
+		return uint32(2 + 12*len(tags) + 4)
+	}
+	pointer := func(id uint16) testTag {
+		return testTag{id: id, typ: 4, count: 1, data: make([]byte, 4)}
+	}
+
+	if len(exifIFD) > 0 {
+		ifd0 = append(ifd0, pointer(0x8769))
+	}
+	if len(gpsIFD) > 0 {
+		ifd0 = append(ifd0, pointer(0x8825))
+	}
+
+	offExif := 8 + ifdSize(ifd0)
+	offGPS := offExif + ifdSize(exifIFD)
+	dataBase := offGPS + ifdSize(gpsIFD)
+	for i := range ifd0 {
+		switch ifd0[i].id {
+		case 0x8769:
+			le.PutUint32(ifd0[i].data, offExif)
+		case 0x8825:
+			le.PutUint32(ifd0[i].data, offGPS)
+		}
+	}
+
+	var out, data bytes.Buffer
+	out.Write([]byte{'I', 'I'})
+	binary.Write(&out, le, uint16(0x002A))
+	binary.Write(&out, le, uint32(8))
+
+	for _, ifd := range [][]testTag{ifd0, exifIFD, gpsIFD} {
+		if len(ifd) == 0 {
+			continue
+		}
+		binary.Write(&out, le, uint16(len(ifd)))
+		for _, tag := range ifd {
+			binary.Write(&out, le, tag.id)
+			binary.Write(&out, le, tag.typ)
+			binary.Write(&out, le, tag.count)
+			if len(tag.data) <= 4 {
+				val := make([]byte, 4)
+				copy(val, tag.data)
+				out.Write(val)
+			} else {
+				binary.Write(&out, le, dataBase+uint32(data.Len()))
+				data.Write(tag.data)
+			}
+		}
+		binary.Write(&out, le, uint32(0)) // next IFD
+	}
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+// wrapJPEG embeds TIFF-encoded EXIF data in a minimal JPEG APP1 segment.
+func wrapJPEG(tiffData []byte) []byte {
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(len(tiffData)+6+2))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiffData)
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+func TestExtract_SuccessPath(t *testing.T) {
 	data := buildJPEGWithExif(t)
 
-	result, err := GetExifJSON(bytes.NewReader(data))
+	result, err := Extract(bytes.NewReader(data))
 
 	require.NoError(t, err, "valid EXIF JPEG should not produce an error")
-	assert.NotEmpty(t, result, "result should contain EXIF JSON")
-	assert.Contains(t, result, "{", "result should be a JSON object")
-	assert.Contains(t, result, "Make", "result should contain the Make tag")
+	require.NotNil(t, result, "result should contain EXIF data")
+	assert.Equal(t, "Test", result.Make, "result should contain the Make tag")
 }
 
-func TestGetExifJSON(t *testing.T) {
+func TestExtract(t *testing.T) {
 	tests := []struct {
 		name          string
 		data          []byte
@@ -133,20 +241,18 @@ func TestGetExifJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := GetExifJSON(bytes.NewReader(tt.data))
+			result, err := Extract(bytes.NewReader(tt.data))
 
 			if tt.expectError {
 				assert.Error(t, err, "Expected an error for test case: %s", tt.description)
-				assert.Empty(t, result, "Expected empty result when error occurs")
+				assert.Nil(t, result, "Expected empty result when error occurs")
 			} else {
 				assert.NoError(t, err, "Expected no error for test case: %s", tt.description)
 
 				if tt.expectEmpty {
-					assert.Empty(t, result, "Expected empty result")
+					assert.Nil(t, result, "Expected empty result")
 				} else {
-					assert.NotEmpty(t, result, "Expected non-empty result")
-					assert.True(t, strings.Contains(result, "{") || strings.Contains(result, "["),
-						"Expected JSON-like structure in result")
+					assert.NotNil(t, result, "Expected non-empty result")
 				}
 			}
 
@@ -158,42 +264,42 @@ func TestGetExifJSON(t *testing.T) {
 	}
 }
 
-func TestGetExifJSON_ReturnTypes(t *testing.T) {
+func TestExtract_ReturnTypes(t *testing.T) {
 	t.Run("Return type validation", func(t *testing.T) {
-		result, err := GetExifJSON(bytes.NewReader([]byte{}))
+		result, err := Extract(bytes.NewReader([]byte{}))
 
-		assert.IsType(t, "", result, "Result should be string type")
+		assert.IsType(t, (*models.ExifData)(nil), result, "Result should be *models.ExifData")
 		if err != nil {
 			assert.IsType(t, (*error)(nil), &err, "Error should be error type")
 		}
 	})
 }
 
-func TestGetExifJSON_BufferState(t *testing.T) {
+func TestExtract_BufferState(t *testing.T) {
 	t.Run("Input data not modified after function call", func(t *testing.T) {
 		originalData := []byte{0x00, 0x01, 0x02, 0x03}
 		input := make([]byte, len(originalData))
 		copy(input, originalData)
 
-		_, _ = GetExifJSON(bytes.NewReader(input))
+		_, _ = Extract(bytes.NewReader(input))
 
 		assert.Equal(t, originalData, input,
 			"Input data should remain unchanged after function call")
 	})
 }
 
-func TestGetExifJSON_LargeData(t *testing.T) {
+func TestExtract_LargeData(t *testing.T) {
 	t.Run("Boundary case - large invalid data", func(t *testing.T) {
 		largeInvalidData := make([]byte, 1024*1024) // 1MB of zeros
 
-		result, err := GetExifJSON(bytes.NewReader(largeInvalidData))
+		result, err := Extract(bytes.NewReader(largeInvalidData))
 
 		assert.Error(t, err, "Should return error for large invalid data")
-		assert.Empty(t, result, "Should return empty result for invalid data")
+		assert.Nil(t, result, "Should return empty result for invalid data")
 	})
 }
 
-func TestGetExifJSON_ErrorHandling(t *testing.T) {
+func TestExtract_ErrorHandling(t *testing.T) {
 	t.Run("Error handling consistency", func(t *testing.T) {
 		testCases := []struct {
 			name string
@@ -208,10 +314,10 @@ func TestGetExifJSON_ErrorHandling(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				result, err := GetExifJSON(bytes.NewReader(tc.data))
+				result, err := Extract(bytes.NewReader(tc.data))
 
 				assert.Error(t, err, "Should return error for %s", tc.name)
-				assert.Empty(t, result, "Should return empty result for %s", tc.name)
+				assert.Nil(t, result, "Should return empty result for %s", tc.name)
 				assert.NotNil(t, err, "Error should not be nil")
 				assert.NotEmpty(t, err.Error(), "Error message should not be empty")
 			})
@@ -219,23 +325,23 @@ func TestGetExifJSON_ErrorHandling(t *testing.T) {
 	})
 }
 
-func TestGetExifJSON_MemoryManagement(t *testing.T) {
+func TestExtract_MemoryManagement(t *testing.T) {
 	t.Run("Memory management test", func(t *testing.T) {
 		for i := 0; i < 100; i++ {
-			_, _ = GetExifJSON(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
+			_, _ = Extract(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
 		}
 		assert.True(t, true, "Memory management test completed successfully")
 	})
 }
 
-func TestGetExifJSON_ConcurrentAccess(t *testing.T) {
+func TestExtract_ConcurrentAccess(t *testing.T) {
 	t.Run("Concurrent access test", func(t *testing.T) {
 		done := make(chan bool, 10)
 
 		for i := 0; i < 10; i++ {
 			go func() {
 				defer func() { done <- true }()
-				_, _ = GetExifJSON(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
+				_, _ = Extract(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
 			}()
 		}
 
@@ -247,7 +353,7 @@ func TestGetExifJSON_ConcurrentAccess(t *testing.T) {
 	})
 }
 
-func TestGetExifJSON_InputValidation(t *testing.T) {
+func TestExtract_InputValidation(t *testing.T) {
 	t.Run("Input validation comprehensive", func(t *testing.T) {
 		inputs := []struct {
 			name string
@@ -267,20 +373,210 @@ func TestGetExifJSON_InputValidation(t *testing.T) {
 
 		for _, input := range inputs {
 			t.Run(input.name, func(t *testing.T) {
-				result, err := GetExifJSON(bytes.NewReader(input.data))
+				result, err := Extract(bytes.NewReader(input.data))
 
 				assert.Error(t, err)
-				assert.Empty(t, result)
+				assert.Nil(t, result)
 			})
 		}
 	})
 }
 
-func BenchmarkGetExifJSON(b *testing.B) {
+func BenchmarkExtract(b *testing.B) {
 	testData := []byte{0x01, 0x02, 0x03, 0x04}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = GetExifJSON(bytes.NewReader(testData))
+		_, _ = Extract(bytes.NewReader(testData))
 	}
 }
+
+func TestExtract_DateTakenWithOffset(t *testing.T) {
+	data := wrapJPEG(buildTIFF(nil, []testTag{
+		asciiTag(0x9003, "2024:06:01 14:03:22"),
+		asciiTag(0x9011, "+10:00"),
+	}, nil))
+
+	got, err := Extract(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06-01T14:03:22+10:00", got.DateTaken.Format(time.RFC3339))
+}
+
+func TestExtract_DateTakenFallsBackToOffsetTime(t *testing.T) {
+	data := wrapJPEG(buildTIFF(nil, []testTag{
+		asciiTag(0x9003, "2024:06:01 14:03:22"),
+		asciiTag(0x9010, "-05:30"),
+	}, nil))
+
+	got, err := Extract(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06-01T14:03:22-05:30", got.DateTaken.Format(time.RFC3339))
+}
+
+func TestExtract_DateTakenWithoutOffsetIsUTC(t *testing.T) {
+	data := wrapJPEG(buildTIFF(nil, []testTag{
+		asciiTag(0x9003, "2019:12:31 23:59:59"),
+	}, nil))
+
+	got, err := Extract(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC), got.DateTaken)
+}
+
+func TestExtract_DateTakenFallsBackToDateTime(t *testing.T) {
+	data := wrapJPEG(buildTIFF([]testTag{
+		asciiTag(0x0132, "2020:02:29 08:00:00"),
+	}, nil, nil))
+
+	got, err := Extract(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 2, 29, 8, 0, 0, 0, time.UTC), got.DateTaken)
+}
+
+func TestExtract_DateTakenMissingOrMalformed(t *testing.T) {
+	t.Run("no date fields", func(t *testing.T) {
+		got, err := Extract(bytes.NewReader(buildJPEGWithExif(t)))
+		require.NoError(t, err)
+		assert.True(t, got.DateTaken.IsZero())
+	})
+
+	t.Run("malformed date", func(t *testing.T) {
+		data := wrapJPEG(buildTIFF(nil, []testTag{asciiTag(0x9003, "not a date")}, nil))
+		got, err := Extract(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.True(t, got.DateTaken.IsZero())
+	})
+}
+
+// fullExifJPEG returns a JPEG carrying every field Extract maps.
+func fullExifJPEG() []byte {
+	return wrapJPEG(buildTIFF(
+		[]testTag{
+			asciiTag(0x010F, "Canon"),
+			asciiTag(0x0110, "EOS R5"),
+			shortTag(0x0112, 6),
+		},
+		[]testTag{
+			rationalTag(0x829A, 1, 250), // ExposureTime
+			rationalTag(0x829D, 28, 10), // FNumber
+			shortTag(0x8827, 400),       // ISOSpeedRatings
+			asciiTag(0x9003, "2024:06:01 14:03:22"),
+			shortTag(0x9209, 0x19),       // Flash: fired, auto
+			rationalTag(0x920A, 500, 10), // FocalLength
+			asciiTag(0xA434, "RF24-70mm F2.8 L IS USM"),
+		},
+		[]testTag{
+			asciiTag(0x0001, "S"),
+			rationalTag(0x0002, 33, 1, 51, 1, 3600, 100),
+			asciiTag(0x0003, "E"),
+			rationalTag(0x0004, 151, 1, 12, 1, 0, 1),
+			byteTag(0x0005, 1),
+			rationalTag(0x0006, 1250, 100),
+		},
+	))
+}
+
+func TestExtract_AllFields(t *testing.T) {
+	got, err := Extract(bytes.NewReader(fullExifJPEG()))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Canon", got.Make)
+	assert.Equal(t, "EOS R5", got.Model)
+	assert.Equal(t, "RF24-70mm F2.8 L IS USM", got.LensModel)
+	assert.Equal(t, 50.0, got.FocalLength)
+	assert.Equal(t, 2.8, got.Aperture)
+	assert.Equal(t, 0.004, got.ExposureTime)
+	assert.Equal(t, "1/250", got.ShutterSpeed)
+	assert.Equal(t, 400, got.ISO)
+	require.NotNil(t, got.Flash)
+	assert.True(t, *got.Flash)
+	assert.Equal(t, 6, got.Orientation)
+	require.NotNil(t, got.Latitude)
+	assert.InDelta(t, -33.86, *got.Latitude, 1e-6)
+	require.NotNil(t, got.Longitude)
+	assert.InDelta(t, 151.2, *got.Longitude, 1e-6)
+	require.NotNil(t, got.Altitude)
+	assert.Equal(t, -12.5, *got.Altitude)
+	assert.Equal(t, "2024-06-01T14:03:22Z", got.DateTaken.Format(time.RFC3339))
+}
+
+func TestShutterSpeed(t *testing.T) {
+	assert.Equal(t, "1/250", shutterSpeed(0.004))
+	assert.Equal(t, "1/3", shutterSpeed(0.3333))
+	assert.Equal(t, "1", shutterSpeed(1))
+	assert.Equal(t, "2.5", shutterSpeed(2.5))
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	want, err := Extract(bytes.NewReader(fullExifJPEG()))
+	require.NoError(t, err)
+
+	md := ToMetadata(want)
+	assert.Equal(t, "Canon", md[MetaMake])
+	assert.Equal(t, "1/250", md[MetaShutterSpeed])
+	assert.Equal(t, "true", md[MetaFlash])
+	assert.Equal(t, "2024-06-01T14:03:22Z", md[MetaDateTaken])
+
+	// blobemu returns metadata keys with the first letter capitalised;
+	// Azure returns them in canonical header form ("Exiffocallength"),
+	// which the store maps back with models.CanonicalMetadataKey.
+	capitalised := make(map[string]string, len(md))
+	azure := make(map[string]string, len(md))
+	for k, v := range md {
+		capitalised[strings.ToUpper(k[:1])+k[1:]] = v
+		azure[models.CanonicalMetadataKey(http.CanonicalHeaderKey(k))] = v
+	}
+	assert.Contains(t, azure, "ExifFocalLength")
+
+	for name, input := range map[string]map[string]string{"as written": md, "capitalised": capitalised, "azure": azure} {
+		t.Run(name, func(t *testing.T) {
+			got := FromMetadata(input)
+			require.NotNil(t, got)
+			assert.True(t, want.DateTaken.Equal(got.DateTaken))
+			got.DateTaken = want.DateTaken
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestToMetadata_OmitsEmptyAndSanitises(t *testing.T) {
+	md := ToMetadata(&models.ExifData{Make: "Caf\u00e9\n Cam "})
+	assert.Equal(t, map[string]string{MetaMake: "Caf Cam"}, md)
+
+	assert.Empty(t, ToMetadata(nil))
+}
+
+func TestFromMetadata_NoExifKeys(t *testing.T) {
+	assert.Nil(t, FromMetadata(map[string]string{"Width": "100", "Height": "50"}))
+	assert.Nil(t, FromMetadata(nil))
+}
+
+func TestFromLegacyJSON(t *testing.T) {
+	legacy := `{"Make":"NIKON CORPORATION","Model":"NIKON D750","FNumber":["56/10"],` +
+		`"ExposureTime":["1/60"],"ISOSpeedRatings":[800],"Flash":[16],"FocalLength":["850/10"],` +
+		`"DateTimeOriginal":"2018:07:14 19:45:00","GPSLatitude":["51/1","30/1","0/1"],` +
+		`"GPSLatitudeRef":"N","GPSLongitude":["0/1","7/1","3960/100"],"GPSLongitudeRef":"W"}`
+
+	got, err := FromLegacyJSON(legacy)
+	require.NoError(t, err)
+
+	assert.Equal(t, "NIKON CORPORATION", got.Make)
+	assert.Equal(t, "NIKON D750", got.Model)
+	assert.Equal(t, 5.6, got.Aperture)
+	assert.Equal(t, "1/60", got.ShutterSpeed)
+	assert.Equal(t, 800, got.ISO)
+	require.NotNil(t, got.Flash)
+	assert.False(t, *got.Flash)
+	assert.Equal(t, 85.0, got.FocalLength)
+	assert.Equal(t, time.Date(2018, 7, 14, 19, 45, 0, 0, time.UTC), got.DateTaken)
+	require.NotNil(t, got.Latitude)
+	assert.Equal(t, 51.5, *got.Latitude)
+	require.NotNil(t, got.Longitude)
+	assert.Equal(t, -0.127667, *got.Longitude)
+	assert.Nil(t, got.Altitude)
+}
+
+func TestFromLegacyJSON_Invalid(t *testing.T) {
+	_, err := FromLegacyJSON("not json")
+	assert.Error(t, err)
+}
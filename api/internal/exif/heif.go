@@ -0,0 +1,254 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// HEIFBrands are the ISOBMFF major brands written by phones and cameras for
+// HEIF stills. The utils package registers its HEIF decoder for the same
+// list; the blob emulator, a separate module, keeps its own copy.
+var HEIFBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+var errNoHEIFExif = errors.New("heif: no exif item")
+
+// isHEIF reports whether head, the first 12 bytes of a file, starts an
+// ISOBMFF "ftyp" box with one of HEIFBrands.
+func isHEIF(head []byte) bool {
+	return len(head) >= 12 && string(head[4:8]) == "ftyp" && slices.Contains(HEIFBrands, string(head[8:12]))
+}
+
+// box is an ISOBMFF box: its four-character type and payload.
+type box struct {
+	typ  string
+	data []byte
+}
+
+// readBoxes splits b into consecutive boxes.
+func readBoxes(b []byte) ([]box, error) {
+	var boxes []box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("heif: truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		hdr := uint64(8)
+		switch size {
+		case 0: // box extends to the end of the file
+			size = uint64(len(b))
+		case 1: // 64-bit size follows the type
+			if len(b) < 16 {
+				return nil, fmt.Errorf("heif: truncated %q box", typ)
+			}
+			size, hdr = binary.BigEndian.Uint64(b[8:]), 16
+		}
+		if size < hdr || size > uint64(len(b)) {
+			return nil, fmt.Errorf("heif: invalid %q box size %d", typ, size)
+		}
+		boxes = append(boxes, box{typ: typ, data: b[hdr:size]})
+		b = b[size:]
+	}
+	return boxes, nil
+}
+
+// findBox returns the first box of type typ.
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, bx := range boxes {
+		if bx.typ == typ {
+			return bx, true
+		}
+	}
+	return box{}, false
+}
+
+// fieldReader reads big-endian integers of varying width from a box payload,
+// latching the first out-of-range read as an error.
+type fieldReader struct {
+	b   []byte
+	err error
+}
+
+func (r *fieldReader) uint(n int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if n > len(r.b) {
+		r.err = fmt.Errorf("heif: truncated box")
+		return 0
+	}
+	var v uint64
+	for _, c := range r.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// heifExif returns the TIFF-encoded EXIF block stored as the "Exif" item of
+// a HEIF file. The item is located via the meta box's iinf and iloc boxes.
+func heifExif(file []byte) ([]byte, error) {
+	top, err := readBoxes(file)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok || len(meta.data) < 4 {
+		return nil, fmt.Errorf("heif: missing meta box")
+	}
+	children, err := readBoxes(meta.data[4:]) // skip version and flags
+	if err != nil {
+		return nil, err
+	}
+
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return nil, fmt.Errorf("heif: missing iinf box")
+	}
+	itemID, err := exifItemID(iinf.data)
+	if err != nil {
+		return nil, err
+	}
+
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, fmt.Errorf("heif: missing iloc box")
+	}
+	var idat []byte
+	if bx, ok := findBox(children, "idat"); ok {
+		idat = bx.data
+	}
+	payload, err := itemData(iloc.data, itemID, file, idat)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload starts with the offset of the TIFF header, usually
+	// skipping an "Exif\0\0" prefix.
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("heif: truncated exif item")
+	}
+	skip := uint64(binary.BigEndian.Uint32(payload)) + 4
+	if skip > uint64(len(payload)) {
+		return nil, fmt.Errorf("heif: invalid exif header offset")
+	}
+	return payload[skip:], nil
+}
+
+// exifItemID returns the ID of the first item of type "Exif" in an iinf box.
+func exifItemID(iinf []byte) (uint32, error) {
+	r := fieldReader{b: iinf}
+	version := r.uint(1)
+	r.uint(3) // flags
+	if version == 0 {
+		r.uint(2) // entry count
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	entries, err := readBoxes(r.b)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.typ != "infe" {
+			continue
+		}
+		er := fieldReader{b: e.data}
+		v := er.uint(1)
+		er.uint(3) // flags
+		if v < 2 {
+			continue // item types were introduced in version 2
+		}
+		var id uint64
+		if v == 2 {
+			id = er.uint(2)
+		} else {
+			id = er.uint(4)
+		}
+		er.uint(2) // protection index
+		typ := er.uint(4)
+		if er.err == nil && typ == 0x45786966 { // "Exif"
+			return uint32(id), nil
+		}
+	}
+	return 0, errNoHEIFExif
+}
+
+// itemData concatenates the extents of item id as described by an iloc box.
+// Extents are read from the file (construction method 0) or from the meta
+// box's idat (construction method 1).
+func itemData(iloc []byte, id uint32, file, idat []byte) ([]byte, error) {
+	r := fieldReader{b: iloc}
+	version := r.uint(1)
+	r.uint(3) // flags
+	sizes := r.uint(2)
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseOffsetSize, indexSize := int(sizes>>4&0xf), int(sizes&0xf)
+	if version < 1 {
+		indexSize = 0
+	}
+
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+
+	for range count {
+		var itemID uint64
+		if version < 2 {
+			itemID = r.uint(2)
+		} else {
+			itemID = r.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0xf
+		}
+		r.uint(2) // data reference index
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+
+		var out bytes.Buffer
+		for range extents {
+			r.uint(indexSize)
+			offset := base + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if r.err != nil || uint32(itemID) != id {
+				continue
+			}
+
+			src := file
+			if method == 1 {
+				src = idat
+			} else if method != 0 {
+				return nil, fmt.Errorf("heif: unsupported construction method %d", method)
+			}
+			if length == 0 { // extent runs to the end of the source
+				length = uint64(len(src)) - min(offset, uint64(len(src)))
+			}
+			if offset > uint64(len(src)) || length > uint64(len(src))-offset {
+				return nil, fmt.Errorf("heif: exif extent out of range")
+			}
+			out.Write(src[offset : offset+length])
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if uint32(itemID) == id {
+			return out.Bytes(), nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, fmt.Errorf("heif: exif item %d has no location", id)
+}
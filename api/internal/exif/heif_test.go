@@ -0,0 +1,149 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isoBox encodes an ISOBMFF box.
+func isoBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	b = append(b, typ...)
+	return append(b, body...)
+}
+
+// fullBoxHeader returns the version and flags prefix of a full box.
+func fullBoxHeader(version byte) []byte {
+	return []byte{version, 0, 0, 0}
+}
+
+// infeV2 encodes a version 2 item info entry.
+func infeV2(id uint16, itemType string) []byte {
+	b := fullBoxHeader(2)
+	b = binary.BigEndian.AppendUint16(b, id)
+	b = binary.BigEndian.AppendUint16(b, 0) // protection index
+	b = append(b, itemType...)
+	b = append(b, 0) // empty item name
+	return isoBox("infe", b)
+}
+
+// buildHEIF wraps tiffData in a minimal HEIF container: an hvc1 primary
+// item plus an Exif item whose single extent lives in mdat (construction
+// method 0) or, when inIdat is set, in the meta box's idat (method 1).
+func buildHEIF(t *testing.T, tiffData []byte, inIdat bool) []byte {
+	t.Helper()
+
+	exifItem := append(binary.BigEndian.AppendUint32(nil, 6), "Exif\x00\x00"...)
+	exifItem = append(exifItem, tiffData...)
+	hevc := []byte("not really hevc")
+
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	iinf := append(fullBoxHeader(0), 0, 2)
+	iinf = append(iinf, infeV2(1, "hvc1")...)
+	iinf = append(iinf, infeV2(2, "Exif")...)
+
+	// iloc builds a version 1 iloc box with 4-byte offsets and lengths;
+	// exifOffset is patched in once the layout is known.
+	iloc := func(exifOffset uint32) []byte {
+		b := fullBoxHeader(1)
+		b = append(b, 0x44, 0x00) // offset_size=4 length_size=4 base_offset_size=0 index_size=0
+		b = binary.BigEndian.AppendUint16(b, 2)
+		method := uint16(0)
+		if inIdat {
+			method = 1
+		}
+		for _, it := range []struct {
+			id     uint16
+			method uint16
+			offset uint32
+			length int
+		}{
+			{1, 0, 0, len(hevc)},
+			{2, method, exifOffset, len(exifItem)},
+		} {
+			b = binary.BigEndian.AppendUint16(b, it.id)
+			b = binary.BigEndian.AppendUint16(b, it.method)
+			b = binary.BigEndian.AppendUint16(b, 0) // data reference index
+			b = binary.BigEndian.AppendUint16(b, 1) // extent count
+			b = binary.BigEndian.AppendUint32(b, it.offset)
+			b = binary.BigEndian.AppendUint32(b, uint32(it.length))
+		}
+		return isoBox("iloc", b)
+	}
+
+	meta := func(exifOffset uint32) []byte {
+		children := [][]byte{fullBoxHeader(0), isoBox("iinf", iinf), iloc(exifOffset)}
+		if inIdat {
+			children = append(children, isoBox("idat", exifItem))
+		}
+		return isoBox("meta", children...)
+	}
+
+	if inIdat {
+		return bytes.Join([][]byte{ftyp, meta(0), isoBox("mdat", hevc)}, nil)
+	}
+	// The Exif extent follows the hevc bytes in mdat.
+	offset := uint32(len(ftyp) + len(meta(0)) + 8 + len(hevc))
+	return bytes.Join([][]byte{ftyp, meta(offset), isoBox("mdat", hevc, exifItem)}, nil)
+}
+
+func TestExtract_HEIF(t *testing.T) {
+	tiffData := buildTIFF(
+		[]testTag{asciiTag(0x010F, "Apple"), asciiTag(0x0110, "iPhone 15 Pro"), shortTag(0x0112, 6)},
+		[]testTag{asciiTag(0x9003, "2024:07:01 09:15:00"), asciiTag(0x9011, "+09:00")},
+		nil,
+	)
+
+	for _, tc := range []struct {
+		name   string
+		inIdat bool
+	}{
+		{"exif in mdat", false},
+		{"exif in idat", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Extract(bytes.NewReader(buildHEIF(t, tiffData, tc.inIdat)))
+
+			require.NoError(t, err)
+			assert.Equal(t, "Apple", d.Make)
+			assert.Equal(t, "iPhone 15 Pro", d.Model)
+			assert.Equal(t, 6, d.Orientation)
+			assert.Equal(t, "2024-07-01T09:15:00+09:00", d.DateTaken.Format("2006-01-02T15:04:05Z07:00"))
+		})
+	}
+}
+
+func TestExtract_HEIFWithoutExif(t *testing.T) {
+	iinf := append(fullBoxHeader(0), 0, 1)
+	iinf = append(iinf, infeV2(1, "hvc1")...)
+	file := bytes.Join([][]byte{
+		isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")),
+		isoBox("meta", fullBoxHeader(0), isoBox("iinf", iinf)),
+	}, nil)
+
+	_, err := Extract(bytes.NewReader(file))
+	assert.ErrorIs(t, err, errNoHEIFExif)
+}
+
+func TestExtract_HEIFTruncated(t *testing.T) {
+	tiffData := buildTIFF([]testTag{asciiTag(0x010F, "Apple")}, nil, nil)
+	file := buildHEIF(t, tiffData, false)
+
+	for _, n := range []int{16, 40, len(file) / 2, len(file) - 3} {
+		_, err := Extract(bytes.NewReader(file[:n]))
+		assert.Error(t, err, "truncated at %d", n)
+	}
+}
+
+func TestIsHEIF(t *testing.T) {
+	assert.True(t, isHEIF([]byte("\x00\x00\x00\x18ftypheic")))
+	assert.True(t, isHEIF([]byte("\x00\x00\x00\x18ftypmif1")))
+	assert.False(t, isHEIF([]byte("\x00\x00\x00\x18ftypavif")))
+	assert.False(t, isHEIF([]byte{0xFF, 0xD8, 0xFF, 0xE1}))
+}
@@ -0,0 +1,167 @@
+package exif
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+)
+
+// Blob metadata keys used to store EXIF fields individually. Keys are
+// written in camelCase and read back from the blob stores in the casing
+// given by models.CanonicalMetadataKey, so FromMetadata accepts either form.
+const (
+	MetaMake         = "exifMake"
+	MetaModel        = "exifModel"
+	MetaLensModel    = "exifLensModel"
+	MetaFocalLength  = "exifFocalLength"
+	MetaAperture     = "exifAperture"
+	MetaExposureTime = "exifExposureTime"
+	MetaShutterSpeed = "exifShutterSpeed"
+	MetaISO          = "exifIso"
+	MetaFlash        = "exifFlash"
+	MetaOrientation  = "exifOrientation"
+	MetaLatitude     = "gpsLatitude"
+	MetaLongitude    = "gpsLongitude"
+	MetaAltitude     = "gpsAltitude"
+	MetaDateTaken    = "dateTaken"
+
+	// MetaLegacyJSON holds the raw goexif JSON of photos uploaded before
+	// the fields were stored individually.
+	MetaLegacyJSON = "ExifData"
+)
+
+func init() {
+	models.RegisterMetadataKeys(
+		MetaMake, MetaModel, MetaLensModel, MetaFocalLength, MetaAperture,
+		MetaExposureTime, MetaShutterSpeed, MetaISO, MetaFlash, MetaOrientation,
+		MetaLatitude, MetaLongitude, MetaAltitude, MetaDateTaken, MetaLegacyJSON,
+	)
+}
+
+// ToMetadata flattens EXIF data into blob metadata key/value pairs. Empty
+// fields are omitted. String values are reduced to printable ASCII because
+// metadata travels as HTTP headers.
+func ToMetadata(d *models.ExifData) map[string]string {
+	md := make(map[string]string)
+	if d == nil {
+		return md
+	}
+
+	setStr := func(key, v string) {
+		if v = printableASCII(v); v != "" {
+			md[key] = v
+		}
+	}
+	setFloat := func(key string, v float64) {
+		if v != 0 {
+			md[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	setPtr := func(key string, v *float64) {
+		if v != nil {
+			md[key] = strconv.FormatFloat(*v, 'f', -1, 64)
+		}
+	}
+
+	setStr(MetaMake, d.Make)
+	setStr(MetaModel, d.Model)
+	setStr(MetaLensModel, d.LensModel)
+	setFloat(MetaFocalLength, d.FocalLength)
+	setFloat(MetaAperture, d.Aperture)
+	setFloat(MetaExposureTime, d.ExposureTime)
+	setStr(MetaShutterSpeed, d.ShutterSpeed)
+	if d.ISO != 0 {
+		md[MetaISO] = strconv.Itoa(d.ISO)
+	}
+	if d.Flash != nil {
+		md[MetaFlash] = strconv.FormatBool(*d.Flash)
+	}
+	if d.Orientation != 0 {
+		md[MetaOrientation] = strconv.Itoa(d.Orientation)
+	}
+	setPtr(MetaLatitude, d.Latitude)
+	setPtr(MetaLongitude, d.Longitude)
+	setPtr(MetaAltitude, d.Altitude)
+	if !d.DateTaken.IsZero() {
+		md[MetaDateTaken] = d.DateTaken.Format(time.RFC3339)
+	}
+
+	return md
+}
+
+// FromMetadata rebuilds EXIF data from blob metadata written by ToMetadata.
+// It returns nil when none of the EXIF keys are present.
+func FromMetadata(md map[string]string) *models.ExifData {
+	d := &models.ExifData{}
+	found := false
+
+	get := func(key string) (string, bool) {
+		if v, ok := md[key]; ok {
+			found = true
+			return v, true
+		}
+		if v, ok := md[models.CanonicalMetadataKey(key)]; ok {
+			found = true
+			return v, true
+		}
+		return "", false
+	}
+	getFloat := func(key string) (float64, bool) {
+		v, ok := get(key)
+		if !ok {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	getPtr := func(key string) *float64 {
+		if f, ok := getFloat(key); ok {
+			return &f
+		}
+		return nil
+	}
+
+	d.Make, _ = get(MetaMake)
+	d.Model, _ = get(MetaModel)
+	d.LensModel, _ = get(MetaLensModel)
+	d.FocalLength, _ = getFloat(MetaFocalLength)
+	d.Aperture, _ = getFloat(MetaAperture)
+	d.ExposureTime, _ = getFloat(MetaExposureTime)
+	d.ShutterSpeed, _ = get(MetaShutterSpeed)
+	if v, ok := get(MetaISO); ok {
+		d.ISO, _ = strconv.Atoi(v)
+	}
+	if v, ok := get(MetaFlash); ok {
+		if fired, err := strconv.ParseBool(v); err == nil {
+			d.Flash = &fired
+		}
+	}
+	if v, ok := get(MetaOrientation); ok {
+		d.Orientation, _ = strconv.Atoi(v)
+	}
+	d.Latitude = getPtr(MetaLatitude)
+	d.Longitude = getPtr(MetaLongitude)
+	d.Altitude = getPtr(MetaAltitude)
+	if v, ok := get(MetaDateTaken); ok {
+		d.DateTaken, _ = time.Parse(time.RFC3339, v)
+	}
+
+	if !found {
+		return nil
+	}
+	return d
+}
+
+// printableASCII drops any byte outside the printable ASCII range and trims
+// surrounding whitespace.
+func printableASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 0x20 && c < 0x7f {
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -19,6 +19,16 @@ type FaceStore interface {
 	// GetFacesByPhoto returns all faces detected in a specific photo.
 	GetFacesByPhoto(ctx context.Context, ref PhotoRef) ([]Face, error)
 
+	// UpdatePhotoRef points the faces detected in photo "from" at "to",
+	// after the photo has been renamed or moved. It is idempotent: once
+	// the faces have moved, calling it again does nothing.
+	UpdatePhotoRef(ctx context.Context, from, to PhotoRef) error
+
+	// DeleteFacesByPhoto deletes the faces detected in a photo that is
+	// being permanently deleted. Their persons' face counts and thumbnails
+	// are updated, and persons left with no faces are deleted.
+	DeleteFacesByPhoto(ctx context.Context, ref PhotoRef) error
+
 	// ── Person CRUD ──────────────────────────────────────────────────
 
 	// GetAllPersons returns every person ordered by name (unnamed last).
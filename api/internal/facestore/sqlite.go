@@ -158,6 +158,79 @@ func (s *SQLiteStore) GetFacesByPhoto(ctx context.Context, ref PhotoRef) ([]Face
 	return scanFaces(rows)
 }
 
+// ── UpdatePhotoRef ──────────────────────────────────────────────────────────
+
+func (s *SQLiteStore) UpdatePhotoRef(ctx context.Context, from, to PhotoRef) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE faces SET photo_collection = ?, photo_album = ?, photo_name = ?
+		WHERE photo_collection = ? AND photo_album = ? AND photo_name = ?
+	`, to.Collection, to.Album, to.Name, from.Collection, from.Album, from.Name)
+	if err != nil {
+		return fmt.Errorf("facestore: update photo ref: %w", err)
+	}
+	return nil
+}
+
+// ── DeleteFacesByPhoto ──────────────────────────────────────────────────────
+
+func (s *SQLiteStore) DeleteFacesByPhoto(ctx context.Context, ref PhotoRef) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT person_id FROM faces
+		WHERE photo_collection = ? AND photo_album = ? AND photo_name = ?
+	`, ref.Collection, ref.Album, ref.Name)
+	if err != nil {
+		return fmt.Errorf("facestore: list persons: %w", err)
+	}
+	var personIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		personIDs = append(personIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM faces WHERE photo_collection = ? AND photo_album = ? AND photo_name = ?
+	`, ref.Collection, ref.Album, ref.Name)
+	if err != nil {
+		return fmt.Errorf("facestore: delete faces: %w", err)
+	}
+
+	for _, id := range personIDs {
+		// Recount, and replace a thumbnail that was one of the deleted faces.
+		_, err = tx.ExecContext(ctx, `
+			UPDATE persons SET
+				face_count = (SELECT COUNT(*) FROM faces WHERE person_id = ?1),
+				thumbnail_face_id = CASE
+					WHEN thumbnail_face_id IN (SELECT id FROM faces WHERE person_id = ?1) THEN thumbnail_face_id
+					ELSE COALESCE((SELECT id FROM faces WHERE person_id = ?1 ORDER BY confidence DESC LIMIT 1), '')
+				END
+			WHERE id = ?1
+		`, id)
+		if err != nil {
+			return fmt.Errorf("facestore: update person: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM persons WHERE id = ? AND face_count = 0`, id)
+		if err != nil {
+			return fmt.Errorf("facestore: delete person: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // ── GetAllPersons ───────────────────────────────────────────────────────────
 
 func (s *SQLiteStore) GetAllPersons(ctx context.Context) ([]Person, error) {
@@ -76,6 +76,76 @@ func TestGetFacesByPhoto(t *testing.T) {
 	assert.Len(t, faces, 2)
 }
 
+func TestUpdatePhotoRef(t *testing.T) {
+	store := tempDB(t)
+	ctx := context.Background()
+
+	from := PhotoRef{Collection: "trips", Album: "paris", Name: "img003.jpg"}
+	to := PhotoRef{Collection: "trips", Album: "france", Name: "img003.jpg"}
+	other := PhotoRef{Collection: "trips", Album: "paris", Name: "img004.jpg"}
+	for i, ref := range []PhotoRef{from, from, other} {
+		err := store.SaveFace(ctx, Face{
+			FaceID:              "f" + string(rune('1'+i)),
+			PersonID:            "p1",
+			PhotoRef:            ref,
+			LandmarkFingerprint: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			FaceHash:            "0000000000000000",
+			CreatedAt:           time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.UpdatePhotoRef(ctx, from, to))
+	require.NoError(t, store.UpdatePhotoRef(ctx, from, to), "updating again is a no-op")
+
+	faces, err := store.GetFacesByPhoto(ctx, from)
+	require.NoError(t, err)
+	assert.Empty(t, faces)
+	faces, err = store.GetFacesByPhoto(ctx, to)
+	require.NoError(t, err)
+	assert.Len(t, faces, 2)
+	assert.Equal(t, to, faces[0].PhotoRef)
+	faces, err = store.GetFacesByPhoto(ctx, other)
+	require.NoError(t, err)
+	assert.Len(t, faces, 1)
+}
+
+func TestDeleteFacesByPhoto(t *testing.T) {
+	store := tempDB(t)
+	ctx := context.Background()
+
+	purged := PhotoRef{Collection: "trips", Album: "paris", Name: "img005.jpg"}
+	kept := PhotoRef{Collection: "trips", Album: "paris", Name: "img006.jpg"}
+	for _, f := range []struct {
+		fid, pid string
+		ref      PhotoRef
+	}{{"f1", "p1", purged}, {"f2", "p1", kept}, {"f3", "p2", purged}} {
+		err := store.SaveFace(ctx, Face{
+			FaceID:              f.fid,
+			PersonID:            f.pid,
+			PhotoRef:            f.ref,
+			LandmarkFingerprint: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			FaceHash:            "0000000000000000",
+			CreatedAt:           time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.DeleteFacesByPhoto(ctx, purged))
+
+	faces, err := store.GetFacesByPhoto(ctx, purged)
+	require.NoError(t, err)
+	assert.Empty(t, faces)
+
+	p1, err := store.GetPersonByID(ctx, "p1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p1.FaceCount)
+	assert.Equal(t, "f2", p1.ThumbnailFaceID, "the deleted thumbnail is replaced")
+
+	_, err = store.GetPersonByID(ctx, "p2")
+	assert.Error(t, err, "a person with no faces left is deleted")
+}
+
 func TestSetPersonName(t *testing.T) {
 	store := tempDB(t)
 	ctx := context.Background()
@@ -185,6 +185,106 @@ func (ts *TableStore) GetFacesByPhoto(ctx context.Context, ref PhotoRef) ([]Face
 	return faces, nil
 }
 
+// ── UpdatePhotoRef ──────────────────────────────────────────────────────────
+
+func (ts *TableStore) UpdatePhotoRef(ctx context.Context, from, to PhotoRef) error {
+	faces, err := ts.GetFacesByPhoto(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	// For each face: update its photo, index it under the new photo, then
+	// drop the old index entry last so an interrupted update is found and
+	// finished by the next call.
+	for _, f := range faces {
+		patch := map[string]any{
+			"PartitionKey":    f.PersonID,
+			"RowKey":          f.FaceID,
+			"PhotoCollection": to.Collection,
+			"PhotoAlbum":      to.Album,
+			"PhotoName":       to.Name,
+		}
+		b, _ := json.Marshal(patch)
+		if _, err := ts.faces.UpdateEntity(ctx, b, &aztables.UpdateEntityOptions{UpdateMode: aztables.UpdateModeMerge}); err != nil {
+			return fmt.Errorf("facestore: update face %s: %w", f.FaceID, err)
+		}
+
+		pfe := photofaceEntity{
+			Entity: aztables.Entity{
+				PartitionKey: to.Key(),
+				RowKey:       f.FaceID,
+			},
+			PersonID: f.PersonID,
+		}
+		pfeBytes, _ := json.Marshal(pfe)
+		if _, err := ts.photofaces.UpsertEntity(ctx, pfeBytes, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace}); err != nil {
+			return fmt.Errorf("facestore: insert photoface: %w", err)
+		}
+		if _, err := ts.photofaces.DeleteEntity(ctx, from.Key(), f.FaceID, nil); err != nil {
+			return fmt.Errorf("facestore: delete photoface: %w", err)
+		}
+	}
+	return nil
+}
+
+// ── DeleteFacesByPhoto ──────────────────────────────────────────────────────
+
+func (ts *TableStore) DeleteFacesByPhoto(ctx context.Context, ref PhotoRef) error {
+	faces, err := ts.GetFacesByPhoto(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	// 1. Delete each face, then its reverse index entry, so an interrupted
+	//    delete is found and finished by the next call.
+	deleted := make(map[string]bool)
+	persons := make(map[string]bool)
+	for _, f := range faces {
+		if _, err := ts.faces.DeleteEntity(ctx, f.PersonID, f.FaceID, nil); err != nil {
+			return fmt.Errorf("facestore: delete face %s: %w", f.FaceID, err)
+		}
+		if _, err := ts.photofaces.DeleteEntity(ctx, ref.Key(), f.FaceID, nil); err != nil {
+			return fmt.Errorf("facestore: delete photoface: %w", err)
+		}
+		deleted[f.FaceID] = true
+		persons[f.PersonID] = true
+	}
+
+	// 2. Recount each person, deleting those left with no faces and
+	//    replacing thumbnails that were deleted.
+	for personID := range persons {
+		remaining, err := ts.GetFacesByPerson(ctx, personID)
+		if err != nil {
+			return err
+		}
+		if len(remaining) == 0 {
+			if _, err := ts.persons.DeleteEntity(ctx, "person", personID, nil); err != nil {
+				return fmt.Errorf("facestore: delete person %s: %w", personID, err)
+			}
+			continue
+		}
+		if err := ts.recalcFaceCount(ctx, personID); err != nil {
+			return err
+		}
+		p, err := ts.GetPersonByID(ctx, personID)
+		if err != nil {
+			return err
+		}
+		if deleted[p.ThumbnailFaceID] {
+			patch := map[string]any{
+				"PartitionKey":    "person",
+				"RowKey":          personID,
+				"ThumbnailFaceID": remaining[0].FaceID,
+			}
+			b, _ := json.Marshal(patch)
+			if _, err := ts.persons.UpdateEntity(ctx, b, &aztables.UpdateEntityOptions{UpdateMode: aztables.UpdateModeMerge}); err != nil {
+				return fmt.Errorf("facestore: update thumbnail %s: %w", personID, err)
+			}
+		}
+	}
+	return nil
+}
+
 // ── GetAllPersons ───────────────────────────────────────────────────────────
 
 func (ts *TableStore) GetAllPersons(ctx context.Context) ([]Person, error) {
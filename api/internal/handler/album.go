@@ -119,7 +119,7 @@ func AlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			markedBlobs[i].Tags = tags
 		}
 
-		photos := BlobsToPhotos(markedBlobs)
+		photos := BlobsToPhotos(markedBlobs, cfg)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(photos)
@@ -113,7 +113,7 @@ func AllAlbumsHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			return
 		}
 
-		photos := BlobsToPhotos(deduped)
+		photos := BlobsToPhotos(deduped, cfg)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(photos)
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/audit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// defaultAuditEntries is the number of entries AuditHandler returns
+	// without ?limit=.
+	defaultAuditEntries = 100
+	// maxAuditEntries caps ?limit=.
+	maxAuditEntries = 1000
+)
+
+// auditTargetParams are the path parameters that make up an audit entry's
+// default target, in order.
+var auditTargetParams = []string{"collection", "album", "name", "id", "personID"}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// serveAudited runs next and records the mutation it made on behalf of
+// actor. The entry's target defaults to the request's path parameters;
+// handlers refine it, and add the tags they changed, with auditChange.
+// Requests that only read are not recorded.
+func serveAudited(w http.ResponseWriter, r *http.Request, cfg *Config, actor audit.Actor, next http.HandlerFunc) {
+	if cfg.Audit == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		next(w, r)
+		return
+	}
+
+	entry := &audit.Entry{
+		ID:        audit.NewID(),
+		Time:      time.Now().UTC(),
+		Actor:     actor.ID,
+		ActorName: actor.Name,
+		Action:    r.Pattern,
+		Target:    requestTarget(r),
+	}
+	if entry.Action == "" {
+		entry.Action = r.Method + " " + r.URL.Path
+	}
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next(rec, r.WithContext(audit.WithEntry(r.Context(), entry)))
+	entry.Status = rec.status
+
+	// The response has been written; a failure here is only logged.
+	if err := cfg.Audit.Record(context.WithoutCancel(r.Context()), *entry); err != nil {
+		slog.ErrorContext(r.Context(), "error recording audit entry",
+			"action", entry.Action, "target", entry.Target, "actor", entry.Actor, "error", err)
+	}
+}
+
+// requestTarget joins the request's path parameters, e.g.
+// "nature/sunset" for /api/nature/sunset.
+func requestTarget(r *http.Request) string {
+	var parts []string
+	for _, p := range auditTargetParams {
+		if v := r.PathValue(p); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	if len(parts) == 0 {
+		return r.URL.Path
+	}
+	return strings.Join(parts, "/")
+}
+
+// auditChange records on the request's audit entry, if any, what was
+// changed and the tags that changed, as they were and as they are now.
+// Tags with the same value in both are left out.
+func auditChange(ctx context.Context, target string, before, after map[string]string) {
+	entry := audit.EntryFrom(ctx)
+	if entry == nil {
+		return
+	}
+	entry.Target = target
+	entry.Before, entry.After = nil, nil
+	for k, v := range before {
+		if a, ok := after[k]; ok && a == v {
+			continue
+		}
+		if entry.Before == nil {
+			entry.Before = map[string]string{}
+		}
+		entry.Before[k] = v
+	}
+	for k, v := range after {
+		if b, ok := before[k]; ok && b == v {
+			continue
+		}
+		if entry.After == nil {
+			entry.After = map[string]string{}
+		}
+		entry.After[k] = v
+	}
+}
+
+// auditItem returns a context carrying a new audit entry for one item of a
+// request that changes several, such as a file in a batch upload, and a
+// function that records it with the item's status. The entry copies the
+// request's actor and action and is recorded on its own, so each item
+// keeps its target and tags. If the request is not audited, ctx is
+// returned unchanged and record does nothing.
+func auditItem(ctx context.Context, cfg *Config) (itemCtx context.Context, record func(status int)) {
+	parent := audit.EntryFrom(ctx)
+	if parent == nil || cfg.Audit == nil {
+		return ctx, func(int) {}
+	}
+	entry := &audit.Entry{
+		ID:        audit.NewID(),
+		Time:      time.Now().UTC(),
+		Actor:     parent.Actor,
+		ActorName: parent.ActorName,
+		Action:    parent.Action,
+		Target:    parent.Target,
+	}
+	return audit.WithEntry(ctx, entry), func(status int) {
+		entry.Status = status
+		if err := cfg.Audit.Record(context.WithoutCancel(ctx), *entry); err != nil {
+			slog.ErrorContext(ctx, "error recording audit entry",
+				"action", entry.Action, "target", entry.Target, "actor", entry.Actor, "error", err)
+		}
+	}
+}
+
+// auditJob records on the request's audit entry, if any, the background
+// job carrying out the mutation.
+func auditJob(ctx context.Context, jobID string) {
+	if entry := audit.EntryFrom(ctx); entry != nil {
+		entry.JobID = jobID
+	}
+}
+
+// AuditHandler returns audit entries, newest first. ?since= (RFC 3339)
+// excludes older entries, ?actor= matches the caller's subject or name,
+// ?target= matches a target and everything beneath it, and ?limit= caps
+// the number returned.
+//
+// GET /api/audit
+func AuditHandler(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Audit")
+		defer span.End()
+
+		if cfg.Audit == nil {
+			http.Error(w, "audit log not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		q := r.URL.Query()
+		f := audit.Filter{
+			Actor:  q.Get("actor"),
+			Target: strings.Trim(q.Get("target"), "/"),
+			Limit:  defaultAuditEntries,
+		}
+		if s := q.Get("since"); s != "" {
+			since, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			f.Since = since
+		}
+		if s := q.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit < 1 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			f.Limit = min(limit, maxAuditEntries)
+		}
+		span.SetAttributes(
+			attribute.String("audit.actor", f.Actor),
+			attribute.String("audit.target", f.Target),
+		)
+
+		entries, err := cfg.Audit.Query(ctx, f)
+		if errors.Is(err, audit.ErrNotQueryable) {
+			http.Error(w, "audit log cannot be queried; entries are written to the log", http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error querying audit log", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// maxBatchMetadataBytes bounds the metadata part of a batch upload.
+const maxBatchMetadataBytes = 1 << 20
+
+// batchPartTimeout is how long each part of a batch upload may take to read
+// and store. The server's timeouts cover the whole request, so the deadlines
+// are pushed back before every part to let large batches finish.
+const batchPartTimeout = 5 * time.Minute
+
+// uploadResult reports the outcome of one file in a batch upload.
+type uploadResult struct {
+	Filename string `json:"filename"`
+	Status   int    `json:"status"`
+	BlobPath string `json:"blobPath,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Existing is the photo a rejected duplicate matches.
+	Existing string `json:"existing,omitempty"`
+}
+
+// batchUploadResponse is the JSON body returned by BatchUploadHandler.
+type batchUploadResponse struct {
+	Message  string         `json:"message"`
+	Uploaded int            `json:"uploaded"`
+	Results  []uploadResult `json:"results"`
+}
+
+// BatchUploadHandler stores several photos from one multipart request. The
+// first part must be "metadata", a JSON array of per-file metadata; it is
+// followed by one "photo" part per entry, matched by position.
+//
+// Parts are read in order with a multipart.Reader, so only the photo being
+// processed is held in memory, and files larger than cfg.MemoryLimitMb are
+// rejected. Each file is processed like a single upload and a failure only
+// affects its own result: the response lists every file with its status,
+// blob path and error, and is 201 when all were stored or 206 otherwise.
+//
+// POST /api/upload/batch
+func BatchUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.BatchUpload")
+		defer span.End()
+
+		batchStart := time.Now()
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			slog.WarnContext(ctx, "batch upload rejected: not a multipart request", "error", err)
+			http.Error(w, "Multipart form not found", http.StatusBadRequest)
+			return
+		}
+
+		part, err := mr.NextPart()
+		if err != nil || part.FormName() != "metadata" {
+			http.Error(w, "metadata must be the first part", http.StatusBadRequest)
+			return
+		}
+		var metadata []models.ImageTags
+		if err := json.NewDecoder(io.LimitReader(part, maxBatchMetadataBytes)).Decode(&metadata); err != nil {
+			slog.WarnContext(ctx, "batch upload rejected: invalid metadata json", "error", err)
+			http.Error(w, "Invalid metadata", http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(attribute.Int("batch.files", len(metadata)))
+
+		maxFileBytes := cfg.MemoryLimitMb << 20
+		rc := http.NewResponseController(w)
+		results := []uploadResult{}
+		uploaded, photos := 0, 0
+		for {
+			extendBatchDeadlines(ctx, rc)
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// The request body is unreadable, so no further parts can
+				// be processed; report what has been stored so far.
+				slog.ErrorContext(ctx, "error reading batch upload part", "index", photos, "error", err)
+				results = append(results, uploadResult{Status: http.StatusBadRequest, Error: "error reading request: " + err.Error()})
+				break
+			}
+			if part.FormName() != "photo" {
+				continue
+			}
+			i := photos
+			photos++
+
+			res := uploadResult{Filename: part.FileName()}
+			switch {
+			case res.Filename == "":
+				res.Status, res.Error = http.StatusBadRequest, "photo part has no filename"
+			case i >= len(metadata):
+				res.Status, res.Error = http.StatusBadRequest, fmt.Sprintf("no metadata for photo %d", i)
+			default:
+				res = uploadBatchFile(ctx, store, cfg, metadata[i], res.Filename, part, maxFileBytes)
+			}
+			if res.Status == http.StatusCreated {
+				uploaded++
+			}
+			results = append(results, res)
+		}
+
+		message := "batch upload completed"
+		status := http.StatusCreated
+		if uploaded < len(results) || len(results) < len(metadata) {
+			message = "batch upload completed with errors"
+			status = http.StatusPartialContent
+			span.SetStatus(codes.Error, message)
+		}
+		slog.InfoContext(ctx, message,
+			"files", len(results),
+			"uploaded", uploaded,
+			"expected", len(metadata),
+			"total_elapsed_ms", time.Since(batchStart).Milliseconds(),
+		)
+		span.SetAttributes(attribute.Int("batch.uploaded", uploaded))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(batchUploadResponse{
+			Message:  message,
+			Uploaded: uploaded,
+			Results:  results,
+		})
+	}
+}
+
+// extendBatchDeadlines gives the next part of a batch upload
+// batchPartTimeout to be read, stored and, after the last part, answered.
+func extendBatchDeadlines(ctx context.Context, rc *http.ResponseController) {
+	deadline := time.Now().Add(batchPartTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(ctx, "error extending read deadline", "error", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(ctx, "error extending write deadline", "error", err)
+	}
+}
+
+// uploadBatchFile buffers one photo part, which must be seekable for
+// processUpload, and stores it in its own span. A stored file gets its own
+// audit entry, with its path and tags; the batch request's entry only
+// records the overall status.
+func uploadBatchFile(ctx context.Context, store storage.BlobStore, cfg *Config, it models.ImageTags, filename string, part io.Reader, maxBytes int64) uploadResult {
+	ctx, span := tracer.Start(ctx, "handler.BatchUpload.file")
+	defer span.End()
+
+	res := uploadResult{Filename: filename}
+	start := time.Now()
+
+	data, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading batch upload file", "filename", filename, "error", err)
+		span.RecordError(err)
+		res.Status, res.Error = http.StatusBadRequest, "error reading file"
+		return res
+	}
+	if int64(len(data)) > maxBytes {
+		span.SetStatus(codes.Error, "file too large")
+		res.Status, res.Error = http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds %d MB", maxBytes>>20)
+		return res
+	}
+
+	fileCtx, recordAudit := auditItem(ctx, cfg)
+	res.BlobPath, err = processUpload(fileCtx, store, cfg, it, filename, bytes.NewReader(data), int64(len(data)), start)
+	var ue *uploadError
+	switch {
+	case err == nil:
+		res.Status = http.StatusCreated
+		recordAudit(res.Status)
+	case errors.As(err, &ue):
+		res.Status, res.Error, res.Existing = ue.Status, ue.Message, ue.Existing
+	default:
+		res.Status, res.Error = http.StatusInternalServerError, "Internal Server Error"
+	}
+	return res
+}
@@ -124,7 +124,7 @@ func CollectionHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			return
 		}
 
-		photos := BlobsToPhotos(resultBlobs)
+		photos := BlobsToPhotos(resultBlobs, cfg)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(photos)
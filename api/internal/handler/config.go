@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"time"
+
+	"github.com/cbellee/photo-api/internal/audit"
 	"github.com/cbellee/photo-api/internal/facestore"
+	"github.com/cbellee/photo-api/internal/jobs"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -11,15 +15,49 @@ type Config struct {
 	ServicePort          string
 	UploadsContainerName string
 	ImagesContainerName  string
-	StorageUrl           string
-	MemoryLimitMb        int64
-	JwksURL              string
-	RoleName             string
-	CorsOrigins          []string
+	// RenditionsContainerName holds the resized derivatives written by the
+	// resize worker as "<rendition>/<collection>/<album>/<file>".
+	RenditionsContainerName string
+	// VariantsContainerName caches the images generated on the fly by the
+	// image endpoint's ?w=&h=&fit=&fmt=&q= parameters.
+	VariantsContainerName string
+	// UploadSessionsContainerName holds the state and data of resumable and
+	// direct uploads.
+	UploadSessionsContainerName string
+	// JobsContainerName holds the state of background jobs.
+	JobsContainerName string
+	// ImageVariantSizes lists the widths and heights the image endpoint may
+	// generate.
+	ImageVariantSizes []int
+	// ImageBaseURL, when set, makes photo URLs point at the image proxy
+	// (e.g. "/api/image") instead of directly at blob storage.
+	ImageBaseURL  string
+	StorageUrl    string
+	MemoryLimitMb int64
+	// MaxDownloadBytes caps the size of album zip downloads. Zero disables
+	// the limit.
+	MaxDownloadBytes int64
+	// MaxUploadPixels rejects uploads whose width × height is larger, as
+	// likely decompression bombs. Zero disables the limit.
+	MaxUploadPixels int64
+	// TrashRetention is how long soft-deleted photos are kept before the
+	// purge job deletes them permanently.
+	TrashRetention time.Duration
+	JwksURL        string
+	RoleName       string
+	CorsOrigins    []string
 	// JWTKeyfunc is a cached keyfunc created once at startup from the JwksURL.
 	// If nil, VerifyToken will fall back to creating a one-shot keyfunc.
 	JWTKeyfunc jwt.Keyfunc
 
+	// Jobs runs bulk mutations such as renames in the background. May be
+	// nil, in which case those endpoints are unavailable.
+	Jobs *jobs.Manager
+
+	// Audit records the mutations made through RequireRole-protected
+	// endpoints. May be nil, in which case nothing is recorded.
+	Audit audit.Sink
+
 	// FaceStore provides access to face detection / recognition data.
 	// May be nil if face detection is not configured for this instance.
 	FaceStore facestore.FaceStore
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// directUploadExpiry is how long a presigned upload URL can be used. It only
+// has to outlast the start of the upload request.
+const directUploadExpiry = 15 * time.Minute
+
+// directUploadResponse is the JSON body returned by UploadSASHandler.
+type directUploadResponse struct {
+	ID string `json:"id"`
+	// UploadURL, Method and Headers describe the request that uploads the
+	// photo; Headers must be sent as given.
+	UploadURL string            `json:"uploadUrl"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	// Tags are the index tags the photo is stored with on completion, in
+	// addition to its content hash and capture time.
+	Tags      map[string]string `json:"tags"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// completeUploadRequest is the JSON body for CompleteUploadHandler.
+type completeUploadRequest struct {
+	ID string `json:"id"`
+}
+
+// UploadSASHandler lets a client upload a photo straight to blob storage
+// instead of through the API. The body is the same as CreateUploadHandler's;
+// the response holds a presigned request, valid for directUploadExpiry, that
+// can only write the session's staging blob. After uploading, the client
+// calls CompleteUploadHandler with the returned id.
+//
+// The staging blob is in the upload sessions container rather than the
+// uploads container, so the resize worker only sees photos that have been
+// validated.
+//
+// POST /api/upload/sas
+func UploadSASHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.UploadSAS")
+		defer span.End()
+
+		if r.Body == nil {
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var req createUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		sess, err := newUploadSession(req)
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			http.Error(w, ue.Message, ue.Status)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating upload id", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		sess.Direct = true
+		span.SetAttributes(
+			attribute.String("upload.id", sess.ID),
+			attribute.String("filename", req.Filename),
+			attribute.Int64("file.size", req.Size),
+		)
+
+		presigned, err := store.PresignUpload(ctx, sess.dataBlob(), cfg.UploadSessionsContainerName, req.Metadata.Type, directUploadExpiry)
+		if err != nil {
+			slog.ErrorContext(ctx, "error presigning upload", "upload_id", sess.ID, "error", err)
+			span.SetStatus(codes.Error, "presign failed")
+			span.RecordError(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := saveUploadSession(ctx, store, cfg, sess); err != nil {
+			slog.ErrorContext(ctx, "error saving upload session", "upload_id", sess.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(ctx, "direct upload presigned",
+			"upload_id", sess.ID,
+			"filename", req.Filename,
+			"size", req.Size,
+			"expires_at", presigned.ExpiresOn,
+		)
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(directUploadResponse{
+			ID:        sess.ID,
+			UploadURL: presigned.URL,
+			Method:    presigned.Method,
+			Headers:   presigned.Headers,
+			Tags:      uploadTags(sess.Metadata, fmt.Sprintf("%s/%s/%s", sess.Metadata.Collection, sess.Metadata.Album, sess.Filename)),
+			ExpiresAt: presigned.ExpiresOn,
+		})
+	}
+}
+
+// CompleteUploadHandler finishes a direct upload. The staging blob must have
+// the declared size and content type; it is then validated (dimensions,
+// EXIF, duplicates), tagged and stored exactly as UploadHandler does.
+//
+// POST /api/upload/complete
+func CompleteUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.CompleteUpload")
+		defer span.End()
+
+		uploadStart := time.Now()
+
+		if r.Body == nil {
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var req completeUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		sess, ok := loadUploadSession(ctx, w, store, cfg, req.ID, true)
+		if !ok {
+			return
+		}
+		span.SetAttributes(attribute.String("upload.id", sess.ID))
+
+		props, err := store.GetBlobProperties(ctx, sess.dataBlob(), cfg.UploadSessionsContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "photo has not been uploaded", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting uploaded blob properties", "upload_id", sess.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var rejected *uploadError
+		switch {
+		case props.Size != sess.Size:
+			rejected = &uploadError{Status: http.StatusBadRequest, Message: fmt.Sprintf("uploaded %d bytes, expected %d", props.Size, sess.Size)}
+		case props.ContentType != sess.Metadata.Type:
+			rejected = &uploadError{Status: http.StatusUnsupportedMediaType, Message: "uploaded content type does not match metadata"}
+		}
+		if rejected != nil {
+			slog.WarnContext(ctx, "direct upload rejected",
+				"upload_id", sess.ID,
+				"size", props.Size,
+				"expected_size", sess.Size,
+				"content_type", props.ContentType,
+				"expected_content_type", sess.Metadata.Type,
+			)
+			span.SetStatus(codes.Error, rejected.Message)
+			deleteUploadSession(ctx, store, cfg, sess.ID)
+			writeUploadError(w, rejected)
+			return
+		}
+
+		finishUpload(ctx, w, store, cfg, sess, uploadStart)
+	}
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/cbellee/photo-api/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// downloadEntryTimeout is how long each zip entry may take to write. The
+// server's WriteTimeout covers the whole response, so the deadline is pushed
+// back before every entry to let large albums finish.
+const downloadEntryTimeout = 5 * time.Minute
+
+// Supported values for the ?rendition= query parameter of album downloads.
+const (
+	downloadFull     = "full"
+	downloadOriginal = "original"
+)
+
+// DownloadAlbumHandler streams a zip archive of every non-deleted photo in an
+// album. Each entry is copied from blob storage straight to the response,
+// so no photo is held in memory.
+//
+// ?rendition=full (the default) archives the resized images; ?rendition=original
+// archives the uploads they were derived from and, like OriginalHandler,
+// requires the upload role. When cfg.MaxDownloadBytes is set, albums whose
+// recorded sizes exceed it are rejected with 413 before anything is written.
+//
+// GET /api/download/{collection}/{album}.zip
+func DownloadAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.DownloadAlbum")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			slog.ErrorContext(ctx, "invalid path param", "name", "collection", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The mux cannot match a wildcard followed by a literal within a
+		// segment, so the ".zip" suffix is trimmed here.
+		album := strings.TrimSuffix(r.PathValue("album"), ".zip")
+		if err := validatePathParam("album", album); err != nil {
+			slog.ErrorContext(ctx, "invalid path param", "name", "album", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rendition := r.URL.Query().Get("rendition")
+		switch rendition {
+		case "":
+			rendition = downloadFull
+		case downloadFull:
+		case downloadOriginal:
+			if _, ok := authorize(w, r, cfg); !ok {
+				return
+			}
+		default:
+			http.Error(w, fmt.Sprintf("rendition must be %s or %s", downloadFull, downloadOriginal), http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(
+			attribute.String("collection", collection),
+			attribute.String("album", album),
+			attribute.String("rendition", rendition),
+		)
+
+		query := fmt.Sprintf("@container='%s' AND collection='%s' AND album='%s' AND isDeleted='false'", cfg.ImagesContainerName, collection, album)
+		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error filtering blobs by tags", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(blobs) == 0 {
+			http.Error(w, "No photos found", http.StatusNotFound)
+			return
+		}
+		sortBlobs(blobs, sortRequest{Field: sortByName})
+
+		// Reject oversized albums up front, while an error status can still
+		// be sent. Sizes are re-checked while streaming in case the recorded
+		// metadata is missing or stale.
+		var expected int64
+		for _, b := range blobs {
+			expected += downloadSize(b, rendition)
+		}
+		span.SetAttributes(attribute.Int("download.photos", len(blobs)), attribute.Int64("download.expected_bytes", expected))
+		if cfg.MaxDownloadBytes > 0 && expected > cfg.MaxDownloadBytes {
+			slog.WarnContext(ctx, "album download exceeds size limit", "collection", collection, "album", album, "bytes", expected, "limit", cfg.MaxDownloadBytes)
+			http.Error(w, "Album is too large to download", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": album + ".zip"}))
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		flusher, _ := w.(http.Flusher)
+		rc := http.NewResponseController(w)
+		zw := zip.NewWriter(w)
+		names := map[string]bool{}
+		var written int64
+		for _, b := range blobs {
+			if err := rc.SetWriteDeadline(time.Now().Add(downloadEntryTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				slog.WarnContext(ctx, "error extending write deadline", "error", err)
+			}
+			n, err := writeZipEntry(r, zw, store, cfg, b, rendition, uniqueZipName(names, zipEntryName(b, rendition)), cfg.MaxDownloadBytes-written)
+			if err != nil {
+				// The status line has already been sent; abort the connection
+				// so the client sees a truncated archive rather than a valid
+				// one with photos missing.
+				slog.ErrorContext(ctx, "error writing album download", "collection", collection, "album", album, "blob", b.Name, "error", err)
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				panic(http.ErrAbortHandler)
+			}
+			written += n
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err := zw.Close(); err != nil {
+			slog.ErrorContext(ctx, "error finishing album download", "collection", collection, "album", album, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		span.SetAttributes(attribute.Int64("download.bytes", written))
+	}
+}
+
+var errDownloadTooLarge = errors.New("album download exceeds size limit")
+
+// writeZipEntry streams the selected rendition of b into zw as entry. remaining
+// is the number of bytes still allowed by cfg.MaxDownloadBytes; it is ignored
+// when no limit is configured. It returns the number of bytes added.
+func writeZipEntry(r *http.Request, zw *zip.Writer, store storage.BlobStore, cfg *Config, b models.Blob, rendition, entry string, remaining int64) (int64, error) {
+	ctx, span := tracer.Start(r.Context(), "handler.DownloadAlbum.blob")
+	defer span.End()
+
+	container, name := cfg.ImagesContainerName, b.Name
+	if rendition == downloadOriginal {
+		container, name = originalLocation(cfg, b.Name, b.MetaData)
+	}
+	span.SetAttributes(attribute.String("blob.name", name), attribute.String("blob.container", container))
+
+	rc, props, err := store.OpenBlob(ctx, name, container, 0, -1)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, fmt.Errorf("open blob %s/%s: %w", container, name, err)
+	}
+	defer rc.Close()
+	span.SetAttributes(attribute.Int64("blob.size", props.ContentLength))
+	if cfg.MaxDownloadBytes > 0 && props.ContentLength > remaining {
+		span.SetStatus(codes.Error, errDownloadTooLarge.Error())
+		return 0, errDownloadTooLarge
+	}
+
+	hdr := &zip.FileHeader{
+		Name: entry,
+		// Photos are already compressed; deflating them again only costs CPU.
+		Method: zip.Store,
+	}
+	if t := blobDateTaken(b); !t.IsZero() {
+		hdr.Modified = t
+	} else if t := blobUploadedAt(b); !t.IsZero() {
+		hdr.Modified = t
+	}
+
+	f, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, rc)
+	if err != nil {
+		return n, fmt.Errorf("copy blob %s/%s: %w", container, name, err)
+	}
+	return n, nil
+}
+
+// downloadSize returns the recorded size of the selected rendition of b, or 0
+// if it is unknown.
+func downloadSize(b models.Blob, rendition string) int64 {
+	key := "Size"
+	if rendition == downloadOriginal {
+		key = models.MetaOriginalSize
+	}
+	n, _ := strconv.ParseInt(b.MetaData[key], 10, 64)
+	return n
+}
+
+// zipEntryName returns the archive path for b. Resized WebP and HEIF photos
+// are stored as JPEG under their original name, so their extension is
+// swapped to match the content.
+func zipEntryName(b models.Blob, rendition string) string {
+	name := path.Base(b.Name)
+	if rendition == downloadOriginal {
+		return name
+	}
+	ct := b.MetaData[models.MetaOriginalContentType]
+	if ct != "" && ct != "image/jpeg" && utils.EncodedContentType(ct) == "image/jpeg" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + ".jpg"
+	}
+	return name
+}
+
+// uniqueZipName returns name, or name with a numeric suffix if it is already
+// in used, and records the result in used. Swapping extensions in
+// zipEntryName can map b.heic onto an existing b.jpg.
+func uniqueZipName(used map[string]bool, name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
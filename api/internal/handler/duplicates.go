@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// duplicateGroup is one entry of the duplicates report: photos sharing the
+// same content hash.
+type duplicateGroup struct {
+	ContentHash string   `json:"contentHash"`
+	Photos      []string `json:"photos"`
+}
+
+// DuplicatesHandler reports non-deleted photos whose contents are identical,
+// grouped by their contentHash tag. Groups are ordered largest first and
+// photos by name. ?collection= limits the report to one collection. Photos
+// uploaded before content hashing was introduced carry no hash and are not
+// reported.
+//
+// GET /api/duplicates
+func DuplicatesHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Duplicates")
+		defer span.End()
+
+		query := fmt.Sprintf("@container='%s' AND isDeleted='false'", cfg.ImagesContainerName)
+		if collection := r.URL.Query().Get("collection"); collection != "" {
+			if err := validatePathParam("collection", collection); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			span.SetAttributes(attribute.String("collection", collection))
+			query = fmt.Sprintf("@container='%s' AND collection='%s' AND isDeleted='false'", cfg.ImagesContainerName, collection)
+		}
+
+		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error filtering blobs by tags", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		byHash := make(map[string][]string)
+		for _, b := range blobs {
+			if hash := b.Tags["contentHash"]; hash != "" {
+				byHash[hash] = append(byHash[hash], b.Name)
+			}
+		}
+
+		groups := []duplicateGroup{}
+		for hash, names := range byHash {
+			if len(names) < 2 {
+				continue
+			}
+			slices.Sort(names)
+			groups = append(groups, duplicateGroup{ContentHash: hash, Photos: names})
+		}
+		slices.SortFunc(groups, func(a, b duplicateGroup) int {
+			if c := cmp.Compare(len(b.Photos), len(a.Photos)); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.ContentHash, b.ContentHash)
+		})
+		span.SetAttributes(attribute.Int("photos.scanned", len(blobs)), attribute.Int("duplicates.groups", len(groups)))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+	}
+}
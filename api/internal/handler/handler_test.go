@@ -1,33 +1,56 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image/jpeg"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/cbellee/photo-api/internal/audit"
+	"github.com/cbellee/photo-api/internal/facestore"
+	"github.com/cbellee/photo-api/internal/jobs"
 	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/similarity"
 	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
 )
 
 // ── Test fixtures ───────────────────────────────────────────────────
 
 func testConfig() *Config {
 	return &Config{
-		ServiceName:          "testService",
-		ServicePort:          "8080",
-		UploadsContainerName: "uploads",
-		ImagesContainerName:  "images",
-		StorageUrl:           "https://teststorage.blob.core.windows.net",
-		MemoryLimitMb:        32,
-		JwksURL:              "https://test.jwks.url",
-		RoleName:             "photo.upload",
-		CorsOrigins:          []string{"http://localhost:5173"},
+		ServiceName:                 "testService",
+		ServicePort:                 "8080",
+		UploadsContainerName:        "uploads",
+		ImagesContainerName:         "images",
+		RenditionsContainerName:     "renditions",
+		VariantsContainerName:       "variants",
+		UploadSessionsContainerName: "upload-sessions",
+		ImageVariantSizes:           []int{160, 320, 640},
+		StorageUrl:                  "https://teststorage.blob.core.windows.net",
+		MemoryLimitMb:               32,
+		MaxUploadPixels:             100_000_000,
+		JwksURL:                     "https://test.jwks.url",
+		RoleName:                    "photo.upload",
+		CorsOrigins:                 []string{"http://localhost:5173"},
 	}
 }
 
@@ -46,9 +69,11 @@ func sampleBlobs() []models.Blob {
 				"orientation":     "1",
 			},
 			MetaData: map[string]string{
-				"Width":    "1920",
-				"Height":   "1080",
-				"ExifData": `{"camera":"Canon"}`,
+				"Width":     "1920",
+				"Height":    "1080",
+				"ExifMake":  "Canon",
+				"ExifModel": "EOS R5",
+				"ExifIso":   "200",
 			},
 		},
 		{
@@ -75,7 +100,7 @@ func sampleBlobs() []models.Blob {
 
 func TestBlobsToPhotos_ConvertsCorrectly(t *testing.T) {
 	blobs := sampleBlobs()
-	photos := BlobsToPhotos(blobs)
+	photos := BlobsToPhotos(blobs, testConfig())
 
 	require.Len(t, photos, 2)
 
@@ -87,7 +112,10 @@ func TestBlobsToPhotos_ConvertsCorrectly(t *testing.T) {
 	assert.Equal(t, "nature", photos[0].Collection)
 	assert.Equal(t, "sunset", photos[0].Album)
 	assert.Equal(t, "A sunset photo", photos[0].Description)
-	assert.Equal(t, `{"camera":"Canon"}`, photos[0].ExifData)
+	require.NotNil(t, photos[0].Exif)
+	assert.Equal(t, "Canon", photos[0].Exif.Make)
+	assert.Equal(t, "EOS R5", photos[0].Exif.Model)
+	assert.Equal(t, 200, photos[0].Exif.ISO)
 	assert.False(t, photos[0].IsDeleted)
 	assert.True(t, photos[0].AlbumImage)
 	assert.True(t, photos[0].CollectionImage)
@@ -101,8 +129,45 @@ func TestBlobsToPhotos_ConvertsCorrectly(t *testing.T) {
 	assert.Equal(t, 0, photos[1].Orientation)
 }
 
+func TestBlobsToPhotos_DateTaken(t *testing.T) {
+	blobs := []models.Blob{
+		{Name: "tag", Tags: map[string]string{"dateTaken": "2024-06-01T14:03:22+10:00"}},
+		{Name: "meta", MetaData: map[string]string{"DateTaken": "2021-03-04T05:06:07Z"}},
+		{Name: "none"},
+	}
+
+	photos := BlobsToPhotos(blobs, testConfig())
+
+	require.Len(t, photos, 3)
+	assert.True(t, photos[0].DateTaken.Equal(time.Date(2024, 6, 1, 4, 3, 22, 0, time.UTC)))
+	assert.True(t, photos[1].DateTaken.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)))
+	assert.True(t, photos[2].DateTaken.IsZero())
+}
+
+func TestBlobsToPhotos_LegacyExifJSON(t *testing.T) {
+	blobs := []models.Blob{{
+		Name:     "old",
+		MetaData: map[string]string{"ExifData": `{"Make":"Canon","FNumber":["28/10"]}`},
+	}}
+
+	photos := BlobsToPhotos(blobs, testConfig())
+
+	require.NotNil(t, photos[0].Exif)
+	assert.Equal(t, "Canon", photos[0].Exif.Make)
+	assert.Equal(t, 2.8, photos[0].Exif.Aperture)
+}
+
+func TestBlobsToPhotos_NoExif(t *testing.T) {
+	photos := BlobsToPhotos([]models.Blob{{Name: "plain", MetaData: map[string]string{"Width": "10"}}}, testConfig())
+	assert.Nil(t, photos[0].Exif)
+
+	body, err := json.Marshal(photos[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), `"exif"`)
+}
+
 func TestBlobsToPhotos_EmptySlice(t *testing.T) {
-	photos := BlobsToPhotos([]models.Blob{})
+	photos := BlobsToPhotos([]models.Blob{}, testConfig())
 	assert.NotNil(t, photos) // should be empty slice, not nil
 	assert.Empty(t, photos)
 }
@@ -125,7 +190,7 @@ func TestBlobsToPhotos_InvalidMetadataDefaults(t *testing.T) {
 		},
 	}
 
-	photos := BlobsToPhotos(blobs)
+	photos := BlobsToPhotos(blobs, testConfig())
 	require.Len(t, photos, 1)
 	assert.Equal(t, 0, photos[0].Width)
 	assert.Equal(t, 0, photos[0].Height)
@@ -135,6 +200,51 @@ func TestBlobsToPhotos_InvalidMetadataDefaults(t *testing.T) {
 	assert.Equal(t, 0, photos[0].Orientation)
 }
 
+func TestBlobsToPhotos_Renditions(t *testing.T) {
+	blobs := sampleBlobs()
+	blobs[0].MetaData["Renditions"] = "thumb,medium"
+
+	photos := BlobsToPhotos(blobs, testConfig())
+	require.Len(t, photos, 2)
+	assert.Equal(t, map[string]string{
+		"full":   "https://teststorage.blob.core.windows.net/images/nature/sunset/photo1.jpg",
+		"thumb":  "https://teststorage.blob.core.windows.net/renditions/thumb/nature/sunset/photo1.jpg",
+		"medium": "https://teststorage.blob.core.windows.net/renditions/medium/nature/sunset/photo1.jpg",
+	}, photos[0].Renditions)
+	assert.Nil(t, photos[1].Renditions, "photos without renditions should omit the map")
+}
+
+func TestBlobsToPhotos_RenditionsIgnoredForOtherContainers(t *testing.T) {
+	blobs := []models.Blob{{
+		Name:     "c/a/img.jpg",
+		Path:     "https://teststorage.blob.core.windows.net/uploads/c/a/img.jpg",
+		MetaData: map[string]string{"Renditions": "thumb"},
+	}}
+
+	photos := BlobsToPhotos(blobs, testConfig())
+	require.Len(t, photos, 1)
+	assert.Nil(t, photos[0].Renditions)
+}
+
+func TestBlobsToPhotos_ImageProxyURLs(t *testing.T) {
+	cfg := testConfig()
+	cfg.ImageBaseURL = "https://api.example.com/api/image/"
+	blobs := []models.Blob{{
+		Name:     "sport/ravens vs stingrays/goal #1.jpg",
+		Path:     "https://teststorage.blob.core.windows.net/images/sport/ravens vs stingrays/goal #1.jpg",
+		MetaData: map[string]string{"Renditions": "thumb"},
+	}}
+
+	photos := BlobsToPhotos(blobs, cfg)
+	require.Len(t, photos, 1)
+	base := "https://api.example.com/api/image/sport/ravens%20vs%20stingrays/goal%20%231.jpg"
+	assert.Equal(t, base, photos[0].Src)
+	assert.Equal(t, map[string]string{
+		"full":  base,
+		"thumb": base + "?rendition=thumb",
+	}, photos[0].Renditions)
+}
+
 // ── TagListHandler tests ────────────────────────────────────────────
 
 func TestTagListHandler_ReturnsTagMap(t *testing.T) {
@@ -290,6 +400,248 @@ func TestPhotoHandler_NoBlobsFound_Returns404(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestPhotoHandler_Paged_ReturnsPageAndCursor(t *testing.T) {
+	cfg := testConfig()
+	blobs := sampleBlobs()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsPageFunc: func(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+			assert.Contains(t, query, "album='sunset'")
+			assert.Equal(t, int32(1), maxResults)
+			if marker == "" {
+				return blobs[:1], "page2", nil
+			}
+			assert.Equal(t, "page2", marker)
+			return blobs[1:], "", nil
+		},
+	}
+	handler := PhotoHandler(mock, cfg)
+
+	get := func(url string) photoPage {
+		req := httptest.NewRequest("GET", url, nil)
+		req.SetPathValue("collection", "nature")
+		req.SetPathValue("album", "sunset")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var page photoPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page
+	}
+
+	first := get("/api/nature/sunset?limit=1")
+	require.Len(t, first.Photos, 1)
+	assert.Equal(t, "nature/sunset/photo1.jpg", first.Photos[0].Name)
+	require.NotEmpty(t, first.NextCursor)
+
+	second := get("/api/nature/sunset?limit=1&cursor=" + first.NextCursor)
+	require.Len(t, second.Photos, 1)
+	assert.Equal(t, "nature/sunset/photo2.jpg", second.Photos[0].Name)
+	assert.Empty(t, second.NextCursor, "last page should not carry a cursor")
+	assert.Empty(t, mock.FilterBlobsByTagsCalls, "paged requests must not use the un-paged query")
+}
+
+func TestPhotoHandler_Paged_LimitIsCapped(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsPageFunc: func(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+			return sampleBlobs(), "", nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/nature/sunset?limit=100000", nil)
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	w := httptest.NewRecorder()
+	PhotoHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mock.FilterBlobsByTagsPageCalls, 1)
+	assert.Equal(t, int32(maxPageSize), mock.FilterBlobsByTagsPageCalls[0].MaxResults)
+}
+
+func TestPhotoHandler_Paged_InvalidParams_Returns400(t *testing.T) {
+	for _, url := range []string{
+		"/api/nature/sunset?limit=0",
+		"/api/nature/sunset?limit=abc",
+		"/api/nature/sunset?cursor=%21%21notbase64",
+	} {
+		t.Run(url, func(t *testing.T) {
+			mock := &storage.MockBlobStore{}
+			req := httptest.NewRequest("GET", url, nil)
+			req.SetPathValue("collection", "nature")
+			req.SetPathValue("album", "sunset")
+			w := httptest.NewRecorder()
+			PhotoHandler(mock, testConfig()).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, mock.FilterBlobsByTagsPageCalls)
+		})
+	}
+}
+
+func TestPhotoHandler_Paged_SkipsEmptyPages(t *testing.T) {
+	calls := 0
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsPageFunc: func(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+			calls++
+			if calls == 1 {
+				return nil, "partition-boundary", nil
+			}
+			return sampleBlobs(), "", nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/nature/sunset?limit=10", nil)
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	w := httptest.NewRecorder()
+	PhotoHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var page photoPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Photos, 2)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCollectionPhotosHandler_Paged(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsPageFunc: func(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+			assert.Contains(t, query, "collection='nature'")
+			assert.Equal(t, int32(defaultPageSize), maxResults)
+			assert.Equal(t, "abc", marker)
+			return sampleBlobs(), "def", nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/photos/nature?cursor="+pageCursor{Marker: "abc"}.encode(), nil)
+	req.SetPathValue("collection", "nature")
+	w := httptest.NewRecorder()
+	CollectionPhotosHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var page photoPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Photos, 2)
+	c, err := decodeCursor(page.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, "def", c.Marker)
+}
+
+// datedBlobs returns blobs whose names, capture and upload times are ordered
+// differently so each sort key produces a distinct order.
+func datedBlobs() []models.Blob {
+	mk := func(name, taken, uploaded string) models.Blob {
+		b := models.Blob{
+			Name:     "nature/sunset/" + name,
+			Tags:     map[string]string{"collection": "nature", "album": "sunset"},
+			MetaData: map[string]string{models.MetaUploadedAt: uploaded},
+		}
+		if taken != "" {
+			b.Tags["dateTaken"] = taken
+		}
+		return b
+	}
+	return []models.Blob{
+		mk("b.jpg", "2024-06-01T10:00:00+10:00", "2025-01-03T00:00:00Z"),
+		mk("a.jpg", "2024-06-01T09:00:00Z", "2025-01-01T00:00:00Z"),
+		mk("c.jpg", "", "2025-01-02T00:00:00Z"),
+		mk("d.jpg", "2023-01-01T00:00:00Z", ""),
+	}
+}
+
+func photoNames(photos []models.Photo) []string {
+	names := make([]string, len(photos))
+	for i, p := range photos {
+		names[i] = strings.TrimPrefix(p.Name, "nature/sunset/")
+	}
+	return names
+}
+
+func TestPhotoHandler_Sort(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"b.jpg", "a.jpg", "c.jpg", "d.jpg"}},
+		{"?sort=name", []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}},
+		{"?sort=name&order=desc", []string{"d.jpg", "c.jpg", "b.jpg", "a.jpg"}},
+		// b.jpg is 00:00Z once its +10:00 offset is applied; undated c.jpg sorts last.
+		{"?sort=dateTaken", []string{"d.jpg", "b.jpg", "a.jpg", "c.jpg"}},
+		{"?sort=dateTaken&order=desc", []string{"a.jpg", "b.jpg", "d.jpg", "c.jpg"}},
+		{"?sort=uploaded", []string{"a.jpg", "c.jpg", "b.jpg", "d.jpg"}},
+		{"?sort=uploaded&order=desc", []string{"b.jpg", "c.jpg", "a.jpg", "d.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			mock := &storage.MockBlobStore{
+				FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+					return datedBlobs(), nil
+				},
+			}
+			req := httptest.NewRequest("GET", "/api/nature/sunset"+tt.query, nil)
+			req.SetPathValue("collection", "nature")
+			req.SetPathValue("album", "sunset")
+			w := httptest.NewRecorder()
+			PhotoHandler(mock, testConfig()).ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var photos []models.Photo
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &photos))
+			assert.Equal(t, tt.want, photoNames(photos))
+		})
+	}
+}
+
+func TestPhotoHandler_Sort_InvalidParams_Returns400(t *testing.T) {
+	for _, q := range []string{"?sort=size", "?sort=name&order=up"} {
+		t.Run(q, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/nature/sunset"+q, nil)
+			req.SetPathValue("collection", "nature")
+			req.SetPathValue("album", "sunset")
+			w := httptest.NewRecorder()
+			PhotoHandler(&storage.MockBlobStore{}, testConfig()).ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestCollectionPhotosHandler_SortedPaging(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return datedBlobs(), nil
+		},
+	}
+	handler := CollectionPhotosHandler(mock, testConfig())
+
+	var got []string
+	cursor := ""
+	for range 5 {
+		url := "/api/photos/nature?sort=dateTaken&order=desc&limit=3"
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		req := httptest.NewRequest("GET", url, nil)
+		req.SetPathValue("collection", "nature")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var page photoPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		got = append(got, photoNames(page.Photos)...)
+		cursor = page.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"a.jpg", "b.jpg", "d.jpg", "c.jpg"}, got)
+	assert.Empty(t, mock.FilterBlobsByTagsPageCalls, "sorted listings are paged in memory")
+}
+
 // ── AlbumHandler tests ──────────────────────────────────────────────
 
 func TestAlbumHandler_ReturnsAlbums(t *testing.T) {
@@ -499,6 +851,43 @@ func TestUpdateHandler_UpdatesTags(t *testing.T) {
 	assert.Equal(t, "Updated description", mock.SetBlobTagsCalls[0].Tags["description"])
 }
 
+func TestUpdateHandler_PreservesContentHash(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{
+				"name":            "nature/sunset/photo1.jpg",
+				"collection":      "nature",
+				"album":           "sunset",
+				"description":     "Old description",
+				"isDeleted":       "false",
+				"collectionImage": "false",
+				"albumImage":      "false",
+				"contentHash":     "abc123",
+			}, nil
+		},
+		SetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string, tags map[string]string) error {
+			return nil
+		},
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, nil
+		},
+	}
+
+	body := `{"collection":"nature","album":"sunset","description":"New description","isDeleted":"false","collectionImage":"false","albumImage":"false","contentHash":"forged"}`
+	req := httptest.NewRequest("PUT", "/api/update/nature/sunset/photo1.jpg", strings.NewReader(body))
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	req.SetPathValue("id", "photo1.jpg")
+	w := httptest.NewRecorder()
+
+	UpdateHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mock.SetBlobTagsCalls, 1)
+	assert.Equal(t, "abc123", mock.SetBlobTagsCalls[0].Tags["contentHash"])
+}
+
 func TestUpdateHandler_EmptyBody_Returns400(t *testing.T) {
 	cfg := testConfig()
 	mock := &storage.MockBlobStore{}
@@ -650,6 +1039,241 @@ func TestUpdateHandler_SwapsCollectionImage(t *testing.T) {
 	assert.Equal(t, "nature/sunset/photo1.jpg", setBlobTagsCalls[1].BlobName)
 }
 
+// ── OriginalHandler tests ───────────────────────────────────────────
+
+func originalRequest(collection, album, name string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/original/"+collection+"/"+album+"/"+name, nil)
+	req.SetPathValue("collection", collection)
+	req.SetPathValue("album", album)
+	req.SetPathValue("name", name)
+	return req
+}
+
+// originalStore serves md as the photo's metadata and content, via
+// imageStore, as its original upload.
+func originalStore(md map[string]string, content string) *storage.MockBlobStore {
+	mock := imageStore(content)
+	mock.GetBlobMetadataFunc = func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+		return md, nil
+	}
+	return mock
+}
+
+func TestOriginalHandler_ServesRecordedOriginal(t *testing.T) {
+	original := "full resolution heic bytes"
+	sum := sha256.Sum256([]byte(original))
+	hash := hex.EncodeToString(sum[:])
+
+	mock := originalStore(map[string]string{
+		"OriginalContainer":   "archive",
+		"OriginalContentType": "image/heic",
+		"OriginalSha256":      hash,
+	}, original)
+
+	w := httptest.NewRecorder()
+	OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "IMG_1.HEIC"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, original, w.Body.String())
+	assert.Equal(t, "image/heic", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=IMG_1.HEIC`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "private, max-age=3600", w.Header().Get("Cache-Control"))
+	assert.Equal(t, `"`+hash+`"`, w.Header().Get("ETag"))
+	assert.Equal(t, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":", w.Header().Get("Repr-Digest"))
+	assert.Equal(t, strconv.Itoa(len(original)), w.Header().Get("Content-Length"))
+
+	require.Len(t, mock.GetBlobMetadataCalls, 1)
+	assert.Equal(t, storage.GetBlobMetadataCall{BlobName: "nature/sunset/IMG_1.HEIC", ContainerName: "images"}, mock.GetBlobMetadataCalls[0])
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, "nature/sunset/IMG_1.HEIC", mock.OpenBlobCalls[0].BlobName)
+	assert.Equal(t, "archive", mock.OpenBlobCalls[0].ContainerName)
+	assert.Empty(t, mock.GetBlobCalls, "the original is streamed, not buffered")
+}
+
+func TestOriginalHandler_MovedPhoto(t *testing.T) {
+	mock := originalStore(map[string]string{models.MetaOriginalName: "nature/sunset/IMG_1.jpg"}, "jpeg bytes")
+
+	w := httptest.NewRecorder()
+	OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("travel", "paris", "IMG_1.jpg"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, "nature/sunset/IMG_1.jpg", mock.OpenBlobCalls[0].BlobName)
+	assert.Equal(t, "uploads", mock.OpenBlobCalls[0].ContainerName)
+}
+
+func TestOriginalHandler_LegacyPhotoFallsBackToUploads(t *testing.T) {
+	mock := originalStore(map[string]string{"Width": "4"}, "jpeg bytes")
+
+	w := httptest.NewRecorder()
+	OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "old.jpg"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"), "the blob's own content type")
+	assert.Equal(t, `"0x8DC"`, w.Header().Get("ETag"), "the blob's own ETag")
+	assert.Empty(t, w.Header().Get("Repr-Digest"))
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, "uploads", mock.OpenBlobCalls[0].ContainerName)
+}
+
+func TestOriginalHandler_RangeAndConditionalRequests(t *testing.T) {
+	sum := sha256.Sum256([]byte("0123456789"))
+	hash := hex.EncodeToString(sum[:])
+	mock := originalStore(map[string]string{"OriginalContentType": "image/jpeg", "OriginalSha256": hash}, "0123456789")
+	h := OriginalHandler(mock, testConfig())
+
+	req := originalRequest("nature", "sunset", "p.jpg")
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "2345", w.Body.String())
+	assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+
+	req = originalRequest("nature", "sunset", "p.jpg")
+	req.Header.Set("If-None-Match", `"`+hash+`"`)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Len(t, mock.OpenBlobCalls, 1, "a 304 does not open the original")
+}
+
+func TestOriginalHandler_NotFound(t *testing.T) {
+	t.Run("photo", func(t *testing.T) {
+		mock := &storage.MockBlobStore{
+			GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+				return nil, fmt.Errorf("getting metadata: %w", storage.ErrNotFound)
+			},
+		}
+		w := httptest.NewRecorder()
+		OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "missing.jpg"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "photo not found")
+	})
+
+	t.Run("original", func(t *testing.T) {
+		mock := &storage.MockBlobStore{
+			GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+				return map[string]string{}, nil
+			},
+			GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+				return storage.BlobProperties{}, storage.ErrNotFound
+			},
+		}
+		w := httptest.NewRecorder()
+		OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "purged.jpg"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "original not found")
+	})
+}
+
+func TestOriginalHandler_Errors(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return nil, assert.AnError
+		},
+	}
+
+	w := httptest.NewRecorder()
+	OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "p.jpg"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = httptest.NewRecorder()
+	OriginalHandler(mock, testConfig()).ServeHTTP(w, originalRequest("nature", "sunset", "bad'name.jpg"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, mock.GetBlobMetadataCalls, 1, "invalid names must not reach storage")
+}
+
+// ── ProcessingStatusHandler tests ───────────────────────────────────
+
+func statusRequest(collection, album, name string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/upload/status/"+collection+"/"+album+"/"+name, nil)
+	req.SetPathValue("collection", collection)
+	req.SetPathValue("album", album)
+	req.SetPathValue("name", name)
+	return req
+}
+
+func TestProcessingStatusHandler_ReportsRecordedStatus(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			assert.Equal(t, "nature/sunset/IMG_1.HEIC", blobName)
+			assert.Equal(t, "uploads", containerName)
+			return map[string]string{
+				models.MetaProcessingStatus:    models.ProcessingFailed,
+				models.MetaProcessingError:     "resizing image nature/sunset/IMG_1.HEIC: unsupported image",
+				models.MetaProcessingUpdatedAt: "2026-10-17T09:30:00Z",
+			}, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	ProcessingStatusHandler(mock, testConfig()).ServeHTTP(w, statusRequest("nature", "sunset", "IMG_1.HEIC"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{
+		"collection": "nature",
+		"album": "sunset",
+		"name": "IMG_1.HEIC",
+		"status": "failed",
+		"error": "resizing image nature/sunset/IMG_1.HEIC: unsupported image",
+		"updatedAt": "2026-10-17T09:30:00Z"
+	}`, w.Body.String())
+	assert.Len(t, mock.GetBlobMetadataCalls, 1)
+}
+
+func TestProcessingStatusHandler_LegacyUpload(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		imageErr error
+		want     int
+		status   string
+	}{
+		{"photo exists", nil, http.StatusOK, models.ProcessingDone},
+		{"photo missing", storage.ErrNotFound, http.StatusOK, models.ProcessingPending},
+		{"lookup fails", assert.AnError, http.StatusInternalServerError, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &storage.MockBlobStore{
+				GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+					if containerName == "images" {
+						return map[string]string{"Width": "4"}, tt.imageErr
+					}
+					return map[string]string{"Width": "4"}, nil
+				},
+			}
+
+			w := httptest.NewRecorder()
+			ProcessingStatusHandler(mock, testConfig()).ServeHTTP(w, statusRequest("nature", "sunset", "old.jpg"))
+
+			require.Equal(t, tt.want, w.Code)
+			if tt.status != "" {
+				var resp processingStatusResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equal(t, tt.status, resp.Status)
+				assert.Empty(t, resp.Error)
+			}
+		})
+	}
+}
+
+func TestProcessingStatusHandler_Errors(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return nil, fmt.Errorf("get metadata status 404: %w", storage.ErrNotFound)
+		},
+	}
+	handler := ProcessingStatusHandler(mock, testConfig())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, statusRequest("nature", "sunset", "missing.jpg"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, statusRequest("nature", "sun'set", "p.jpg"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 // ── GetCollectionImage tests ────────────────────────────────────────
 
 func TestGetCollectionImage_Found(t *testing.T) {
@@ -710,3 +1334,1532 @@ func TestConfig_Defaults(t *testing.T) {
 	assert.Contains(t, cfg.StorageUrl, "https://")
 	assert.Equal(t, int64(32), cfg.MemoryLimitMb)
 }
+
+// ── DuplicatesHandler tests ─────────────────────────────────────────
+
+func TestDuplicatesHandler_GroupsByHash(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{
+				{Name: "nature/sunset/b.jpg", Tags: map[string]string{"contentHash": "aaa"}},
+				{Name: "trips/rome/x.jpg", Tags: map[string]string{"contentHash": "bbb"}},
+				{Name: "nature/forest/a.jpg", Tags: map[string]string{"contentHash": "aaa"}},
+				{Name: "nature/sunset/unique.jpg", Tags: map[string]string{"contentHash": "ccc"}},
+				{Name: "trips/rome/y.jpg", Tags: map[string]string{"contentHash": "bbb"}},
+				{Name: "trips/rome/z.jpg", Tags: map[string]string{"contentHash": "bbb"}},
+				{Name: "old/legacy/nohash.jpg", Tags: map[string]string{}},
+				{Name: "old/legacy/nohash2.jpg", Tags: map[string]string{}},
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/duplicates", nil)
+	w := httptest.NewRecorder()
+	DuplicatesHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@container='images' AND isDeleted='false'", mock.FilterBlobsByTagsCalls[0].Query)
+	var groups []duplicateGroup
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &groups))
+	assert.Equal(t, []duplicateGroup{
+		{ContentHash: "bbb", Photos: []string{"trips/rome/x.jpg", "trips/rome/y.jpg", "trips/rome/z.jpg"}},
+		{ContentHash: "aaa", Photos: []string{"nature/forest/a.jpg", "nature/sunset/b.jpg"}},
+	}, groups)
+}
+
+func TestDuplicatesHandler_NoDuplicates_ReturnsEmptyList(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{{Name: "nature/sunset/a.jpg", Tags: map[string]string{"contentHash": "aaa"}}}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/duplicates?collection=nature", nil)
+	w := httptest.NewRecorder()
+	DuplicatesHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@container='images' AND collection='nature' AND isDeleted='false'", mock.FilterBlobsByTagsCalls[0].Query)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestDuplicatesHandler_InvalidCollection_Returns400(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/duplicates?collection="+url.QueryEscape("a'b"), nil)
+	w := httptest.NewRecorder()
+	DuplicatesHandler(&storage.MockBlobStore{}, testConfig()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDuplicatesHandler_StorageError_Returns500(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, fmt.Errorf("storage down")
+		},
+	}
+	req := httptest.NewRequest("GET", "/api/duplicates", nil)
+	w := httptest.NewRecorder()
+	DuplicatesHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// ── SimilarHandler tests ────────────────────────────────────────────
+
+func similarRequest(query string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/similar/nature/sunset/a.jpg"+query, nil)
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	req.SetPathValue("name", "a.jpg")
+	return req
+}
+
+func similarStore(targetHash string) *storage.MockBlobStore {
+	return &storage.MockBlobStore{
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			if blobName != "nature/sunset/a.jpg" {
+				return nil, storage.ErrNotFound
+			}
+			return map[string]string{similarity.MetadataKey: targetHash}, nil
+		},
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{
+				{Name: "nature/sunset/a.jpg", MetaData: map[string]string{similarity.MetadataKey: targetHash}},
+				{Name: "nature/forest/near.jpg", MetaData: map[string]string{similarity.MetadataKey: "0000000000000007"}},
+				{Name: "trips/rome/exact.jpg", MetaData: map[string]string{similarity.MetadataKey: "0000000000000000"}},
+				{Name: "trips/rome/far.jpg", MetaData: map[string]string{similarity.MetadataKey: "ffffffffffffffff"}},
+				{Name: "old/legacy/unhashed.jpg", MetaData: map[string]string{}},
+			}, nil
+		},
+	}
+}
+
+func TestSimilarHandler_ReturnsMatchesClosestFirst(t *testing.T) {
+	mock := similarStore("0000000000000000")
+	w := httptest.NewRecorder()
+	SimilarHandler(mock, testConfig()).ServeHTTP(w, similarRequest(""))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp similarResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "nature/sunset/a.jpg", resp.Photo)
+	assert.Equal(t, similarity.DefaultMaxHamming, resp.MaxHamming)
+	assert.Equal(t, []similarity.Match{
+		{Name: "trips/rome/exact.jpg", Distance: 0},
+		{Name: "nature/forest/near.jpg", Distance: 3},
+	}, resp.Matches)
+}
+
+func TestSimilarHandler_MaxHamming(t *testing.T) {
+	mock := similarStore("0000000000000000")
+	w := httptest.NewRecorder()
+	SimilarHandler(mock, testConfig()).ServeHTTP(w, similarRequest("?maxHamming=2"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp similarResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []similarity.Match{{Name: "trips/rome/exact.jpg", Distance: 0}}, resp.Matches)
+}
+
+func TestSimilarHandler_InvalidMaxHamming_Returns400(t *testing.T) {
+	for _, q := range []string{"?maxHamming=-1", "?maxHamming=65", "?maxHamming=abc"} {
+		w := httptest.NewRecorder()
+		SimilarHandler(&storage.MockBlobStore{}, testConfig()).ServeHTTP(w, similarRequest(q))
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
+}
+
+func TestSimilarHandler_PhotoNotFound_Returns404(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, blobName)
+		},
+	}
+	w := httptest.NewRecorder()
+	SimilarHandler(mock, testConfig()).ServeHTTP(w, similarRequest(""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSimilarHandler_NoHash_Returns409(t *testing.T) {
+	mock := similarStore("")
+	w := httptest.NewRecorder()
+	SimilarHandler(mock, testConfig()).ServeHTTP(w, similarRequest(""))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, mock.FilterBlobsByTagsCalls)
+}
+
+// ── DownloadAlbumHandler tests ──────────────────────────────────────
+
+func downloadRequest(collection, album, query string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/download/"+collection+"/"+album+query, nil)
+	req.SetPathValue("collection", collection)
+	req.SetPathValue("album", album)
+	return req
+}
+
+func downloadBlobs() []models.Blob {
+	return []models.Blob{
+		{
+			Name:     "nature/sunset/b.heic",
+			Tags:     map[string]string{"collection": "nature", "album": "sunset", "isDeleted": "false"},
+			MetaData: map[string]string{"Size": "6", "OriginalSize": "9", "OriginalContentType": "image/heic", "OriginalContainer": "archive"},
+		},
+		{
+			Name:     "nature/sunset/a.jpg",
+			Tags:     map[string]string{"collection": "nature", "album": "sunset", "isDeleted": "false", "dateTaken": "2024-07-01T09:15:00Z"},
+			MetaData: map[string]string{"Size": "5", "OriginalSize": "8"},
+		},
+	}
+}
+
+// streamContent returns an OpenBlobFunc that serves the whole of
+// content(blobName, containerName).
+func streamContent(content func(blobName, containerName string) (string, error)) func(context.Context, string, string, int64, int64) (io.ReadCloser, storage.BlobProperties, error) {
+	return func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, storage.BlobProperties, error) {
+		data, err := content(blobName, containerName)
+		if err != nil {
+			return nil, storage.BlobProperties{}, err
+		}
+		n := int64(len(data))
+		return io.NopCloser(strings.NewReader(data)), storage.BlobProperties{ContentLength: n, Size: n}, nil
+	}
+}
+
+func zipEntry(t *testing.T, f *zip.File) string {
+	t.Helper()
+	rc, err := f.Open()
+	require.NoError(t, err)
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestDownloadAlbumHandler_StreamsZip(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			assert.Contains(t, query, "collection='nature'")
+			assert.Contains(t, query, "album='sunset'")
+			assert.Contains(t, query, "isDeleted='false'")
+			return downloadBlobs(), nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			assert.Equal(t, "images", containerName)
+			return blobName, nil
+		}),
+	}
+
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, testConfig()).ServeHTTP(w, downloadRequest("nature", "sunset.zip", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=sunset.zip", w.Header().Get("Content-Disposition"))
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "a.jpg", zr.File[0].Name, "entries are ordered by name")
+	assert.Equal(t, "b.jpg", zr.File[1].Name, "converted HEIC is named as JPEG")
+	assert.Equal(t, zip.Store, zr.File[0].Method)
+	assert.Equal(t, 2024, zr.File[0].Modified.Year())
+	assert.Equal(t, "nature/sunset/a.jpg", zipEntry(t, zr.File[0]))
+	assert.Equal(t, "nature/sunset/b.heic", zipEntry(t, zr.File[1]))
+	assert.Empty(t, mock.GetBlobCalls, "entries are streamed, not buffered")
+}
+
+func TestDownloadAlbumHandler_RenamedEntriesDoNotCollide(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{
+				{Name: "nature/sunset/b.jpg"},
+				{Name: "nature/sunset/b.heic", MetaData: map[string]string{"OriginalContentType": "image/heic"}},
+				{Name: "nature/sunset/b.webp", MetaData: map[string]string{"OriginalContentType": "image/webp"}},
+			}, nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			return blobName, nil
+		}),
+	}
+
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, testConfig()).ServeHTTP(w, downloadRequest("nature", "sunset.zip", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 3)
+	got := map[string]string{}
+	for _, f := range zr.File {
+		got[f.Name] = zipEntry(t, f)
+	}
+	assert.Equal(t, map[string]string{
+		"b.jpg":     "nature/sunset/b.heic",
+		"b (2).jpg": "nature/sunset/b.jpg",
+		"b (3).jpg": "nature/sunset/b.webp",
+	}, got)
+}
+
+func TestDownloadAlbumHandler_OutlastsServerWriteTimeout(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{{Name: "nature/sunset/a.jpg"}, {Name: "nature/sunset/b.jpg"}, {Name: "nature/sunset/c.jpg"}}, nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			time.Sleep(60 * time.Millisecond)
+			return blobName, nil
+		}),
+	}
+
+	// The album takes longer to stream than the server's WriteTimeout.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("collection", "nature")
+		r.SetPathValue("album", "sunset.zip")
+		DownloadAlbumHandler(mock, testConfig()).ServeHTTP(w, r)
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	assert.Len(t, zr.File, 3)
+}
+
+func TestDownloadAlbumHandler_OriginalRequiresRole(t *testing.T) {
+	cfg := testConfig()
+	cfg.JWTKeyfunc = testKeyfunc
+	mock := &storage.MockBlobStore{}
+
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, cfg).ServeHTTP(w, downloadRequest("nature", "sunset.zip", "?rendition=original"))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, mock.FilterBlobsByTagsCalls)
+}
+
+func TestDownloadAlbumHandler_Originals(t *testing.T) {
+	cfg := testConfig()
+	cfg.JWTKeyfunc = testKeyfunc
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return downloadBlobs(), nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			return containerName, nil
+		}),
+	}
+
+	req := downloadRequest("nature", "sunset.zip", "?rendition=original")
+	req.Header.Set("Authorization", "Bearer "+signTestJWT(t, []string{"photo.upload"}, time.Now().Add(time.Hour)))
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, cfg).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "a.jpg", zr.File[0].Name)
+	assert.Equal(t, "uploads", zipEntry(t, zr.File[0]), "legacy photos fall back to the uploads container")
+	assert.Equal(t, "b.heic", zr.File[1].Name)
+	assert.Equal(t, "archive", zipEntry(t, zr.File[1]))
+}
+
+func TestDownloadAlbumHandler_InvalidRendition(t *testing.T) {
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(&storage.MockBlobStore{}, testConfig()).ServeHTTP(w, downloadRequest("nature", "sunset.zip", "?rendition=thumb"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDownloadAlbumHandler_EmptyAlbum(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, testConfig()).ServeHTTP(w, downloadRequest("nature", "empty.zip", ""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDownloadAlbumHandler_TooLarge(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxDownloadBytes = 10
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return downloadBlobs(), nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	DownloadAlbumHandler(mock, cfg).ServeHTTP(w, downloadRequest("nature", "sunset.zip", ""))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, mock.OpenBlobCalls, "no photos are fetched once the limit is known to be exceeded")
+}
+
+func TestDownloadAlbumHandler_AbortsOnFetchError(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return downloadBlobs(), nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			if strings.HasSuffix(blobName, "b.heic") {
+				return "", fmt.Errorf("storage unavailable")
+			}
+			return "ok", nil
+		}),
+	}
+
+	h := DownloadAlbumHandler(mock, testConfig())
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), downloadRequest("nature", "sunset.zip", ""))
+	})
+}
+
+func TestDownloadAlbumHandler_AbortsWhenStreamExceedsLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxDownloadBytes = 20
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return downloadBlobs(), nil
+		},
+		OpenBlobFunc: streamContent(func(blobName, containerName string) (string, error) {
+			return strings.Repeat("x", 15), nil // larger than the recorded sizes
+		}),
+	}
+
+	h := DownloadAlbumHandler(mock, cfg)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), downloadRequest("nature", "sunset.zip", ""))
+	})
+}
+
+// ── ImageHandler tests ──────────────────────────────────────────────
+
+var imageModTime = time.Date(2024, 7, 1, 9, 15, 0, 0, time.UTC)
+
+// imageStore serves content as the single blob in the mock store, a photo
+// that is not deleted.
+func imageStore(content string) *storage.MockBlobStore {
+	props := storage.BlobProperties{
+		ContentType:  "image/jpeg",
+		Size:         int64(len(content)),
+		ETag:         `"0x8DC"`,
+		LastModified: imageModTime,
+	}
+	return &storage.MockBlobStore{
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"isDeleted": "false"}, nil
+		},
+		GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+			return props, nil
+		},
+		OpenBlobFunc: func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, storage.BlobProperties, error) {
+			if rangeEnd < 0 {
+				rangeEnd = int64(len(content)) - 1
+			}
+			p := props
+			p.ContentLength = rangeEnd - rangeStart + 1
+			return io.NopCloser(strings.NewReader(content[rangeStart : rangeEnd+1])), p, nil
+		},
+	}
+}
+
+func imageRequest(collection, album, name, query string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/image/"+collection+"/"+album+"/"+name+query, nil)
+	req.SetPathValue("collection", collection)
+	req.SetPathValue("album", album)
+	req.SetPathValue("name", name)
+	return req
+}
+
+func TestImageHandler_StreamsImage(t *testing.T) {
+	mock := imageStore("0123456789")
+
+	w := httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, `"0x8DC"`, w.Header().Get("ETag"))
+	assert.Equal(t, "Mon, 01 Jul 2024 09:15:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Equal(t, imageCacheControl, w.Header().Get("Cache-Control"))
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, storage.OpenBlobCall{BlobName: "nature/sunset/p.jpg", ContainerName: "images", RangeStart: 0, RangeEnd: -1}, mock.OpenBlobCalls[0])
+}
+
+func TestImageHandler_Rendition(t *testing.T) {
+	mock := imageStore("thumb")
+
+	w := httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?rendition=thumb"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, "thumb/nature/sunset/p.jpg", mock.OpenBlobCalls[0].BlobName)
+	assert.Equal(t, "renditions", mock.OpenBlobCalls[0].ContainerName)
+
+	w = httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?rendition=../x"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImageHandler_NotModified(t *testing.T) {
+	for _, tc := range []struct {
+		name, header, value string
+	}{
+		{"etag", "If-None-Match", `"other", "0x8DC"`},
+		{"weak etag", "If-None-Match", `W/"0x8DC"`},
+		{"wildcard", "If-None-Match", "*"},
+		{"modified since", "If-Modified-Since", "Mon, 01 Jul 2024 09:15:00 GMT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := imageStore("0123456789")
+			req := imageRequest("nature", "sunset", "p.jpg", "")
+			req.Header.Set(tc.header, tc.value)
+
+			w := httptest.NewRecorder()
+			ImageHandler(mock, testConfig()).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.Equal(t, `"0x8DC"`, w.Header().Get("ETag"))
+			assert.Empty(t, mock.OpenBlobCalls, "the blob is not downloaded for a 304")
+		})
+	}
+}
+
+func TestImageHandler_Modified(t *testing.T) {
+	for _, tc := range []struct {
+		name, header, value string
+	}{
+		{"etag", "If-None-Match", `"stale"`},
+		{"modified since", "If-Modified-Since", "Sun, 30 Jun 2024 09:15:00 GMT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := imageRequest("nature", "sunset", "p.jpg", "")
+			req.Header.Set(tc.header, tc.value)
+
+			w := httptest.NewRecorder()
+			ImageHandler(imageStore("0123456789"), testConfig()).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "0123456789", w.Body.String())
+		})
+	}
+}
+
+func TestImageHandler_Range(t *testing.T) {
+	for _, tc := range []struct {
+		rng, want, contentRange string
+	}{
+		{"bytes=2-5", "2345", "bytes 2-5/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-3", "789", "bytes 7-9/10"},
+		{"bytes=8-100", "89", "bytes 8-9/10"},
+	} {
+		t.Run(tc.rng, func(t *testing.T) {
+			req := imageRequest("nature", "sunset", "p.jpg", "")
+			req.Header.Set("Range", tc.rng)
+
+			w := httptest.NewRecorder()
+			ImageHandler(imageStore("0123456789"), testConfig()).ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusPartialContent, w.Code)
+			assert.Equal(t, tc.want, w.Body.String())
+			assert.Equal(t, tc.contentRange, w.Header().Get("Content-Range"))
+			assert.Equal(t, strconv.Itoa(len(tc.want)), w.Header().Get("Content-Length"))
+		})
+	}
+}
+
+func TestImageHandler_RangeIgnored(t *testing.T) {
+	for _, tc := range []struct {
+		name, ifRange, rng string
+	}{
+		{"multiple ranges", "", "bytes=0-1,4-5"},
+		{"malformed", "", "bytes=5-2"},
+		{"stale if-range etag", `"old"`, "bytes=2-5"},
+		{"stale if-range date", "Sun, 30 Jun 2024 09:15:00 GMT", "bytes=2-5"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := imageRequest("nature", "sunset", "p.jpg", "")
+			req.Header.Set("Range", tc.rng)
+			if tc.ifRange != "" {
+				req.Header.Set("If-Range", tc.ifRange)
+			}
+
+			w := httptest.NewRecorder()
+			ImageHandler(imageStore("0123456789"), testConfig()).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "0123456789", w.Body.String())
+		})
+	}
+}
+
+func TestImageHandler_RangeNotSatisfiable(t *testing.T) {
+	req := imageRequest("nature", "sunset", "p.jpg", "")
+	req.Header.Set("Range", "bytes=10-")
+
+	w := httptest.NewRecorder()
+	ImageHandler(imageStore("0123456789"), testConfig()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+}
+
+func TestImageHandler_Head(t *testing.T) {
+	mock := imageStore("0123456789")
+	req := imageRequest("nature", "sunset", "p.jpg", "")
+	req.Method = http.MethodHead
+
+	w := httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Empty(t, mock.OpenBlobCalls)
+}
+
+func TestImageHandler_NotFound(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return nil, fmt.Errorf("get tags status 404: %w", storage.ErrNotFound)
+		},
+	}
+
+	w := httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "missing.jpg", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mock = imageStore("0123456789")
+	mock.GetBlobPropertiesFunc = func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+		return storage.BlobProperties{}, fmt.Errorf("get properties status 404: %w", storage.ErrNotFound)
+	}
+	w = httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?rendition=thumb"))
+	assert.Equal(t, http.StatusNotFound, w.Code, "missing rendition")
+}
+
+func TestImageHandler_DeletedPhoto(t *testing.T) {
+	mock := imageStore("0123456789")
+	mock.GetBlobTagsFunc = func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+		assert.Equal(t, "nature/sunset/p.jpg", blobName)
+		assert.Equal(t, "images", containerName)
+		return map[string]string{"isDeleted": "true"}, nil
+	}
+	cfg := testConfig()
+	cfg.JWTKeyfunc = testKeyfunc
+
+	for _, query := range []string{"", "?rendition=thumb", "?w=320"} {
+		w := httptest.NewRecorder()
+		ImageHandler(mock, cfg).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", query))
+		assert.Equal(t, http.StatusNotFound, w.Code, query)
+	}
+	assert.Empty(t, mock.OpenBlobCalls, "a deleted photo is not served")
+
+	req := imageRequest("nature", "sunset", "p.jpg", "")
+	req.Header.Set("Authorization", "Bearer "+signActorJWT(t, "user-1", "Alice"))
+	w := httptest.NewRecorder()
+	ImageHandler(mock, cfg).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "the upload role can see the trash")
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+}
+
+// ── Image variant tests ─────────────────────────────────────────────
+
+// variantStore is a mock whose images container holds a single 800x400 JPEG
+// and whose variants container starts empty and keeps whatever is saved.
+func variantStore(t *testing.T) *storage.MockBlobStore {
+	src := makeJPEG(t, 800, 400)
+	cache := map[string][]byte{}
+	var mu sync.Mutex
+
+	return &storage.MockBlobStore{
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"isDeleted": "false"}, nil
+		},
+		GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch containerName {
+			case "images":
+				return storage.BlobProperties{ContentType: "image/jpeg", Size: int64(len(src)), ETag: `"src-v1"`, LastModified: imageModTime}, nil
+			case "variants":
+				if data, ok := cache[blobName]; ok {
+					return storage.BlobProperties{ContentType: "image/jpeg", Size: int64(len(data)), ETag: `"cache"`}, nil
+				}
+			}
+			return storage.BlobProperties{}, storage.ErrNotFound
+		},
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			assert.Equal(t, "images", containerName)
+			return src, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			assert.Equal(t, "variants", containerName)
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			mu.Lock()
+			cache[blobName] = data
+			mu.Unlock()
+			return nil
+		},
+		OpenBlobFunc: func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, storage.BlobProperties, error) {
+			mu.Lock()
+			data := cache[blobName]
+			mu.Unlock()
+			return io.NopCloser(bytes.NewReader(data)), storage.BlobProperties{ContentType: "image/jpeg", ContentLength: int64(len(data)), Size: int64(len(data))}, nil
+		},
+	}
+}
+
+func TestImageHandler_VariantGeneratedThenCached(t *testing.T) {
+	mock := variantStore(t)
+	h := ImageHandler(mock, testConfig())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?w=320&h=320&fit=cover&q=80"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	etag := w.Header().Get("ETag")
+	assert.Contains(t, etag, "w320-h320-cover-q80.jpg")
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 320, cfg.Width)
+	assert.Equal(t, 320, cfg.Height)
+
+	require.Len(t, mock.SaveBlobCalls, 1)
+	cacheName := mock.SaveBlobCalls[0].BlobName
+	assert.True(t, strings.HasPrefix(cacheName, "nature/sunset/p.jpg/"), cacheName)
+	assert.Equal(t, "image/jpeg", mock.SaveBlobCalls[0].ContentType)
+
+	// The repeat request is streamed from the cache without decoding.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?w=320&h=320&fit=cover&q=80"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, mock.SaveBlobCalls[0].Data, w.Body.Bytes())
+	assert.Len(t, mock.GetBlobCalls, 1, "the source is only downloaded once")
+	assert.Len(t, mock.SaveBlobCalls, 1)
+	require.Len(t, mock.OpenBlobCalls, 1)
+	assert.Equal(t, cacheName, mock.OpenBlobCalls[0].BlobName)
+
+	// A conditional request is answered without touching the cache.
+	req := imageRequest("nature", "sunset", "p.jpg", "?w=320&h=320&fit=cover&q=80")
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Len(t, mock.OpenBlobCalls, 1)
+}
+
+func TestImageHandler_VariantDeletedPhoto(t *testing.T) {
+	mock := variantStore(t)
+	mock.GetBlobTagsFunc = func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+		return map[string]string{"isDeleted": "true"}, nil
+	}
+	cfg := testConfig()
+	cfg.JWTKeyfunc = testKeyfunc
+
+	// The variant is not cached yet, so it is generated on this request.
+	req := imageRequest("nature", "sunset", "p.jpg", "?w=320")
+	req.Header.Set("Authorization", "Bearer "+signActorJWT(t, "user-1", "Alice"))
+	w := httptest.NewRecorder()
+	ImageHandler(mock, cfg).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mock.SaveBlobCalls, 1)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+}
+
+func TestImageHandler_VariantWebP(t *testing.T) {
+	mock := variantStore(t)
+
+	w := httptest.NewRecorder()
+	ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", "?w=160&fmt=webp"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/webp", w.Header().Get("Content-Type"))
+	cfg, err := webp.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 160, cfg.Width)
+	assert.Equal(t, 80, cfg.Height)
+	require.Len(t, mock.SaveBlobCalls, 1)
+	assert.True(t, strings.HasSuffix(mock.SaveBlobCalls[0].BlobName, "/w160-h0-contain-q0.webp"), "lossless variants have no quality")
+}
+
+func TestImageHandler_VariantSourceReplaced(t *testing.T) {
+	src := storage.BlobProperties{ETag: `"v1"`}
+	v := variantRequest{Width: 320, Fit: "contain", Format: "image/jpeg", Quality: 90}
+
+	first := variantBlobName("c/a/p.jpg", src, v)
+	src.ETag = `"v2"`
+	assert.NotEqual(t, first, variantBlobName("c/a/p.jpg", src, v))
+}
+
+func TestImageHandler_VariantInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"?w=321",
+		"?h=abc",
+		"?w=320&fit=fill",
+		"?w=320&fmt=avif",
+		"?w=320&q=0",
+		"?w=320&q=101",
+		"?w=320&fmt=webp&q=50",
+		"?w=320&rendition=thumb",
+	} {
+		t.Run(query, func(t *testing.T) {
+			mock := variantStore(t)
+			w := httptest.NewRecorder()
+			ImageHandler(mock, testConfig()).ServeHTTP(w, imageRequest("nature", "sunset", "p.jpg", query))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, mock.GetBlobCalls)
+		})
+	}
+}
+
+func TestParseVariantSizes(t *testing.T) {
+	sizes, err := ParseVariantSizes("640, 160,320,640,")
+	require.NoError(t, err)
+	assert.Equal(t, []int{160, 320, 640}, sizes)
+
+	_, err = ParseVariantSizes("160,big")
+	assert.Error(t, err)
+	_, err = ParseVariantSizes("0")
+	assert.Error(t, err)
+}
+
+// ── Background job tests ────────────────────────────────────────────
+
+// jobConfig returns a test config whose jobs run against store and are
+// kept in memory.
+func jobConfig(store storage.BlobStore) *Config {
+	cfg := testConfig()
+	m := jobs.NewManager(context.Background(), jobs.NewMemoryStore())
+	RegisterJobOps(m, store, cfg)
+	cfg.Jobs = m
+	return cfg
+}
+
+// memBlob is a blob held by jobStore.
+type memBlob struct {
+	tags, md map[string]string
+	size     int64
+}
+
+// jobStore holds blobs in memory, keyed by "container/name", so they can be
+// moved and retagged. blobs are put in the images container and returned
+// by every tag query.
+func jobStore(blobs []models.Blob) (*storage.MockBlobStore, map[string]*memBlob) {
+	var mu sync.Mutex
+	mem := map[string]*memBlob{}
+	for _, b := range blobs {
+		mem["images/"+b.Name] = &memBlob{tags: maps.Clone(b.Tags), md: maps.Clone(b.MetaData)}
+	}
+	get := func(container, name string) (*memBlob, error) {
+		b, ok := mem[container+"/"+name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s/%s", storage.ErrNotFound, container, name)
+		}
+		return b, nil
+	}
+	return &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return blobs, nil
+		},
+		GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, blobName)
+			if err != nil {
+				return storage.BlobProperties{}, err
+			}
+			return storage.BlobProperties{Size: b.size}, nil
+		},
+		GetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, blobName)
+			if err != nil {
+				return nil, err
+			}
+			return maps.Clone(b.tags), nil
+		},
+		SetBlobTagsFunc: func(ctx context.Context, blobName string, containerName string, tags map[string]string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, blobName)
+			if err != nil {
+				return err
+			}
+			b.tags = tags
+			return nil
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, blobName)
+			if err != nil {
+				return nil, err
+			}
+			return maps.Clone(b.md), nil
+		},
+		SetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string, md map[string]string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, blobName)
+			if err != nil {
+				return err
+			}
+			b.md = md
+			return nil
+		},
+		CopyBlobFunc: func(ctx context.Context, src string, dest string, containerName string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := get(containerName, src)
+			if err != nil {
+				return err
+			}
+			mem[containerName+"/"+dest] = &memBlob{tags: maps.Clone(b.tags), md: maps.Clone(b.md), size: b.size}
+			return nil
+		},
+		ListBlobNamesFunc: func(ctx context.Context, prefix string, containerName string) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var names []string
+			for key := range mem {
+				if name, ok := strings.CutPrefix(key, containerName+"/"); ok && strings.HasPrefix(name, prefix) {
+					names = append(names, name)
+				}
+			}
+			return names, nil
+		},
+		DeleteBlobFunc: func(ctx context.Context, blobName string, containerName string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := get(containerName, blobName); err != nil {
+				return err
+			}
+			delete(mem, containerName+"/"+blobName)
+			return nil
+		},
+	}, mem
+}
+
+// decodeAccepted checks for a 202 response and returns the submitted job's
+// saved state once it has finished.
+func decodeAccepted(t *testing.T, w *httptest.ResponseRecorder, cfg *Config) (mutationResponse, *jobs.Job) {
+	t.Helper()
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var resp mutationResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "/api/jobs/"+resp.JobID, resp.StatusURL)
+	assert.Equal(t, resp.StatusURL, w.Header().Get("Location"))
+
+	cfg.Jobs.Wait()
+	job, err := cfg.Jobs.Get(context.Background(), resp.JobID)
+	require.NoError(t, err)
+	return resp, job
+}
+
+func TestRenameAlbumHandler_MovesBlobsInJob(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:2])
+	cfg := jobConfig(store)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/rename/nature/sunset", strings.NewReader(`{"newName":"dusk"}`))
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	w := httptest.NewRecorder()
+	RenameAlbumHandler(store, cfg).ServeHTTP(w, req)
+
+	resp, job := decodeAccepted(t, w, cfg)
+	assert.Equal(t, 2, resp.Affected)
+	assert.Equal(t, "dusk", resp.NewName)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+	assert.Equal(t, 2, job.Completed)
+	assert.Equal(t, "nature/dusk/photo1.jpg", job.Items[0].Target)
+
+	require.Len(t, store.CopyBlobCalls, 2)
+	assert.Equal(t, "nature/dusk/photo1.jpg", store.CopyBlobCalls[0].DestBlobName)
+	require.Len(t, store.DeleteBlobCalls, 2)
+	assert.Equal(t, "nature/sunset/photo1.jpg", store.DeleteBlobCalls[0].BlobName)
+	newTags := store.SetBlobTagsCalls[0].Tags
+	assert.Equal(t, "dusk", newTags["album"])
+	assert.Equal(t, "nature/dusk/photo1.jpg", newTags["name"])
+	assert.Equal(t, "A sunset photo", newTags["description"], "other tags are copied")
+}
+
+func TestMoveBlobOp_UpdatesFacesAndRepeats(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:1])
+	cfg := testConfig()
+	faces, err := facestore.NewSQLiteStore(t.TempDir() + "/faces.db")
+	require.NoError(t, err)
+	defer faces.Close()
+	cfg.FaceStore = faces
+	from := facestore.PhotoRef{Collection: "nature", Album: "sunset", Name: "photo1.jpg"}
+	require.NoError(t, faces.SaveFace(context.Background(), facestore.Face{FaceID: "f1", PersonID: "p1", PhotoRef: from}))
+
+	op := moveBlobOp(store, cfg)
+	item := &jobs.Item{Name: "nature/sunset/photo1.jpg", Target: "nature/dusk/photo1.jpg", Tags: map[string]string{"album": "dusk"}}
+	require.NoError(t, op(context.Background(), &jobs.Job{}, item))
+	require.NoError(t, op(context.Background(), &jobs.Job{}, item), "a move that already happened succeeds")
+	assert.Len(t, store.CopyBlobCalls, 1)
+	assert.Len(t, store.DeleteBlobCalls, 1)
+
+	moved, err := faces.GetFacesByPhoto(context.Background(), facestore.PhotoRef{Collection: "nature", Album: "dusk", Name: "photo1.jpg"})
+	require.NoError(t, err)
+	assert.Len(t, moved, 1)
+
+	item = &jobs.Item{Name: "nature/sunset/photo9.jpg", Target: "nature/dusk/photo9.jpg"}
+	assert.Error(t, op(context.Background(), &jobs.Job{}, item), "neither source nor target exists")
+}
+
+func TestMoveBlobOp_BadCopyKeepsSource(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:1])
+	getProps := store.GetBlobPropertiesFunc
+	store.GetBlobPropertiesFunc = func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+		props, err := getProps(ctx, blobName, containerName)
+		if blobName == "nature/sunset/photo1.jpg" {
+			props.Size = 100
+		}
+		return props, err
+	}
+
+	item := &jobs.Item{Name: "nature/sunset/photo1.jpg", Target: "nature/dusk/photo1.jpg"}
+	err := moveBlobOp(store, testConfig())(context.Background(), &jobs.Job{}, item)
+	assert.ErrorContains(t, err, "expected 100")
+	assert.Empty(t, store.DeleteBlobCalls)
+}
+
+func TestMoveBlobOp_AlreadyAtTarget(t *testing.T) {
+	// A copy whose tags were not updated before a crash is found again
+	// by re-running the rename, with the same name as its target.
+	store, _ := jobStore(sampleBlobs()[:1])
+	item := &jobs.Item{Name: "nature/sunset/photo1.jpg", Target: "nature/sunset/photo1.jpg", Tags: map[string]string{"collection": "nature"}}
+	require.NoError(t, moveBlobOp(store, testConfig())(context.Background(), &jobs.Job{}, item))
+	assert.Empty(t, store.CopyBlobCalls)
+	assert.Empty(t, store.DeleteBlobCalls)
+	require.Len(t, store.SetBlobTagsCalls, 1)
+}
+
+func TestSoftDeleteCollectionHandler_RetagsInJob(t *testing.T) {
+	store, mem := jobStore(sampleBlobs()[:2])
+	cfg := jobConfig(store)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/nature", nil)
+	req.SetPathValue("collection", "nature")
+	w := httptest.NewRecorder()
+	SoftDeleteCollectionHandler(store, cfg).ServeHTTP(w, req)
+
+	_, job := decodeAccepted(t, w, cfg)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+	require.Len(t, store.SetBlobTagsCalls, 2)
+	tags := store.SetBlobTagsCalls[0].Tags
+	assert.Equal(t, "true", tags["isDeleted"])
+	assert.Equal(t, "false", tags["albumImage"])
+	assert.Equal(t, "false", tags["collectionImage"])
+	assert.Equal(t, "A sunset photo", tags["description"])
+	assert.NotEmpty(t, mem["images/nature/sunset/photo1.jpg"].md[models.MetaDeletedAt])
+}
+
+func TestRestoreCollectionHandler_ReassignsCoverImages(t *testing.T) {
+	blobs := []models.Blob{
+		{Name: "nature/a/1.jpg", Tags: map[string]string{"album": "a", "isDeleted": "true"}},
+		{Name: "nature/a/2.jpg", Tags: map[string]string{"album": "a", "isDeleted": "true"}},
+		{Name: "nature/b/3.jpg", Tags: map[string]string{"album": "b", "isDeleted": "true"}},
+	}
+	store, _ := jobStore(blobs)
+	cfg := jobConfig(store)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/nature", nil)
+	req.SetPathValue("collection", "nature")
+	w := httptest.NewRecorder()
+	RestoreCollectionHandler(store, cfg).ServeHTTP(w, req)
+
+	_, job := decodeAccepted(t, w, cfg)
+	assert.Equal(t, map[string]string{"isDeleted": "false", "collectionImage": "true", "albumImage": "true"}, job.Items[0].Tags)
+	assert.Equal(t, map[string]string{"isDeleted": "false"}, job.Items[1].Tags)
+	assert.Equal(t, map[string]string{"isDeleted": "false", "albumImage": "true"}, job.Items[2].Tags)
+}
+
+func TestSoftDeleteCollectionHandler_NoJobs_Returns503(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:1])
+	req := httptest.NewRequest(http.MethodDelete, "/api/nature", nil)
+	req.SetPathValue("collection", "nature")
+	w := httptest.NewRecorder()
+	SoftDeleteCollectionHandler(store, testConfig()).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func jobRequest(method, id string) *http.Request {
+	req := httptest.NewRequest(method, "/api/jobs/"+id, nil)
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestJobHandler(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:1])
+	cfg := jobConfig(store)
+	job, err := cfg.Jobs.Submit(context.Background(), jobSoftDeleteAlbum, nil, []jobs.Item{{Name: "nature/sunset/photo1.jpg"}})
+	require.NoError(t, err)
+	cfg.Jobs.Wait()
+
+	w := httptest.NewRecorder()
+	JobHandler(cfg).ServeHTTP(w, jobRequest(http.MethodGet, job.ID))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var got jobs.Job
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, jobs.StatusSucceeded, got.Status)
+	assert.Equal(t, 1, got.Completed)
+
+	w = httptest.NewRecorder()
+	JobHandler(cfg).ServeHTTP(w, jobRequest(http.MethodGet, "0123456789abcdef0123456789abcdef"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	JobHandler(cfg).ServeHTTP(w, jobRequest(http.MethodGet, "../uploads"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRetryJobHandler(t *testing.T) {
+	store, mem := jobStore(nil)
+	cfg := jobConfig(store)
+	job, err := cfg.Jobs.Submit(context.Background(), jobSoftDeleteAlbum, nil, []jobs.Item{{Name: "missing.jpg"}})
+	require.NoError(t, err)
+	cfg.Jobs.Wait()
+
+	// The blob appears, so the retried item succeeds.
+	mem["images/missing.jpg"] = &memBlob{}
+	w := httptest.NewRecorder()
+	RetryJobHandler(cfg).ServeHTTP(w, jobRequest(http.MethodPost, job.ID))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	cfg.Jobs.Wait()
+
+	got, err := cfg.Jobs.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusSucceeded, got.Status)
+	assert.Equal(t, 2, got.Items[0].Attempts)
+
+	w = httptest.NewRecorder()
+	RetryJobHandler(cfg).ServeHTTP(w, jobRequest(http.MethodPost, job.ID))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// ── MoveHandler tests ───────────────────────────────────────────────
+
+func moveRequestBody(t *testing.T, req moveRequest) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	return httptest.NewRequest(http.MethodPost, "/api/move", bytes.NewReader(body))
+}
+
+func TestMoveHandler_MovesPhotoAndFixesCovers(t *testing.T) {
+	blobs := sampleBlobs()[:2]
+	blobs[0].MetaData = map[string]string{"Renditions": "thumb"}
+	store, mem := jobStore(blobs)
+	mem["renditions/thumb/nature/sunset/photo1.jpg"] = &memBlob{}
+	// Neither the destination album nor its collection has a cover yet.
+	store.FilterBlobsByTagsFunc = func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+		if strings.Contains(query, "Image='true'") {
+			return nil, nil
+		}
+		return blobs, nil
+	}
+	cfg := jobConfig(store)
+
+	w := httptest.NewRecorder()
+	MoveHandler(store, cfg).ServeHTTP(w, moveRequestBody(t, moveRequest{
+		Sources:     []photoLocation{{Collection: "nature", Album: "sunset", Name: "photo1.jpg"}},
+		Destination: photoLocation{Collection: "travel", Album: "paris"},
+	}))
+	_, job := decodeAccepted(t, w, cfg)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+
+	moved := mem["images/travel/paris/photo1.jpg"]
+	require.NotNil(t, moved)
+	assert.Nil(t, mem["images/nature/sunset/photo1.jpg"])
+	assert.Equal(t, "travel", moved.tags["collection"])
+	assert.Equal(t, "paris", moved.tags["album"])
+	assert.Equal(t, "travel/paris/photo1.jpg", moved.tags["name"])
+	assert.Equal(t, "true", moved.tags["albumImage"], "first photo of the new album")
+	assert.Equal(t, "true", moved.tags["collectionImage"], "first photo of the new collection")
+	assert.Equal(t, "nature/sunset/photo1.jpg", moved.md[models.MetaOriginalName])
+
+	assert.NotNil(t, mem["renditions/thumb/travel/paris/photo1.jpg"])
+	assert.Nil(t, mem["renditions/thumb/nature/sunset/photo1.jpg"])
+
+	left := mem["images/nature/sunset/photo2.jpg"]
+	assert.Equal(t, "true", left.tags["albumImage"], "takes over the album cover")
+	assert.Equal(t, "true", left.tags["collectionImage"], "takes over the collection cover")
+}
+
+func TestMoveHandler_Rejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		source photoLocation
+		dest   photoLocation
+		status int
+	}{
+		{"same album", photoLocation{"nature", "sunset", "photo1.jpg"}, photoLocation{Collection: "nature", Album: "sunset"}, http.StatusBadRequest},
+		{"invalid name", photoLocation{"nature", "sunset", "../x.jpg"}, photoLocation{Collection: "travel", Album: "paris"}, http.StatusBadRequest},
+		{"missing destination", photoLocation{"nature", "sunset", "photo1.jpg"}, photoLocation{Collection: "travel"}, http.StatusBadRequest},
+		{"source not found", photoLocation{"nature", "sunset", "photo9.jpg"}, photoLocation{Collection: "travel", Album: "paris"}, http.StatusNotFound},
+		{"target exists", photoLocation{"nature", "sunset", "photo1.jpg"}, photoLocation{Collection: "travel", Album: "paris"}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mem := jobStore(sampleBlobs()[:1])
+			mem["images/travel/paris/photo1.jpg"] = &memBlob{}
+			cfg := jobConfig(store)
+
+			w := httptest.NewRecorder()
+			MoveHandler(store, cfg).ServeHTTP(w, moveRequestBody(t, moveRequest{Sources: []photoLocation{tt.source}, Destination: tt.dest}))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Empty(t, store.CopyBlobCalls)
+		})
+	}
+}
+
+// ── Trash tests ─────────────────────────────────────────────────────
+
+func deletePhotoRequest(collection, album, name string) *http.Request {
+	req := httptest.NewRequest(http.MethodDelete, "/api/"+collection+"/"+album+"/"+name, nil)
+	req.SetPathValue("collection", collection)
+	req.SetPathValue("album", album)
+	req.SetPathValue("name", name)
+	return req
+}
+
+func TestSoftDeletePhotoHandler_StampsAndReassignsCovers(t *testing.T) {
+	store, mem := jobStore(sampleBlobs()[:2])
+
+	w := httptest.NewRecorder()
+	SoftDeletePhotoHandler(store, testConfig()).ServeHTTP(w, deletePhotoRequest("nature", "sunset", "photo1.jpg"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp mutationResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Affected)
+
+	deleted := mem["images/nature/sunset/photo1.jpg"]
+	assert.Equal(t, "true", deleted.tags["isDeleted"])
+	assert.Equal(t, "false", deleted.tags["albumImage"])
+	assert.Equal(t, "false", deleted.tags["collectionImage"])
+	assert.Equal(t, "A sunset photo", deleted.tags["description"])
+	deletedAt, ok := blobDeletedAt(deleted.md)
+	require.True(t, ok, "deletion time is recorded")
+	assert.WithinDuration(t, time.Now(), deletedAt, time.Minute)
+	assert.Equal(t, "1920", deleted.md["Width"], "other metadata is kept")
+
+	left := mem["images/nature/sunset/photo2.jpg"]
+	assert.Equal(t, "true", left.tags["albumImage"])
+	assert.Equal(t, "true", left.tags["collectionImage"])
+}
+
+func TestSoftDeletePhotoHandler_NotFound(t *testing.T) {
+	blobs := sampleBlobs()[:2]
+	blobs[1].Tags["isDeleted"] = "true"
+	store, _ := jobStore(blobs)
+
+	for _, name := range []string{"photo9.jpg", "photo2.jpg"} {
+		w := httptest.NewRecorder()
+		SoftDeletePhotoHandler(store, testConfig()).ServeHTTP(w, deletePhotoRequest("nature", "sunset", name))
+		assert.Equal(t, http.StatusNotFound, w.Code, name)
+	}
+	assert.Empty(t, store.SetBlobTagsCalls)
+}
+
+func TestTrashHandler(t *testing.T) {
+	blobs := []models.Blob{
+		{Name: "nature/a/old.jpg", Tags: map[string]string{"isDeleted": "true"}, MetaData: map[string]string{models.MetaDeletedAt: "2026-01-01T00:00:00Z"}},
+		{Name: "nature/a/legacy.jpg", Tags: map[string]string{"isDeleted": "true"}},
+		{Name: "nature/a/new.jpg", Tags: map[string]string{"isDeleted": "true"}, MetaData: map[string]string{models.MetaDeletedAt: "2026-02-01T00:00:00Z"}},
+	}
+	store := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			assert.Contains(t, query, "isDeleted='true'")
+			return blobs, nil
+		},
+	}
+	cfg := testConfig()
+	cfg.TrashRetention = 30 * 24 * time.Hour
+
+	w := httptest.NewRecorder()
+	TrashHandler(store, cfg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trash", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var items []trashItem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&items))
+	require.Len(t, items, 3)
+	assert.Equal(t, "nature/a/new.jpg", items[0].Name, "most recently deleted first")
+	assert.Equal(t, "nature/a/old.jpg", items[1].Name)
+	assert.Equal(t, "nature/a/legacy.jpg", items[2].Name, "unknown deletion time last")
+	require.NotNil(t, items[1].PurgeAt)
+	assert.Equal(t, time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC), items[1].PurgeAt.UTC())
+	assert.True(t, items[1].IsDeleted)
+	assert.Nil(t, items[2].DeletedAt)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	blobs := []models.Blob{
+		{Name: "nature/a/old.jpg", Tags: map[string]string{"isDeleted": "true"}, MetaData: map[string]string{
+			models.MetaDeletedAt: "2026-01-01T00:00:00Z",
+			"Renditions":         "thumb",
+		}},
+		{Name: "nature/a/recent.jpg", Tags: map[string]string{"isDeleted": "true"}, MetaData: map[string]string{
+			models.MetaDeletedAt: "2026-02-20T00:00:00Z",
+		}},
+		{Name: "nature/a/legacy.jpg", Tags: map[string]string{"isDeleted": "true"}},
+	}
+	store, mem := jobStore(blobs)
+	mem["renditions/thumb/nature/a/old.jpg"] = &memBlob{}
+	mem["variants/nature/a/old.jpg/0123abcd/w200.webp"] = &memBlob{}
+	mem["variants/nature/a/old.jpg/4567cdef/w400.jpeg"] = &memBlob{}
+	mem["variants/nature/a/old.jpg2/0123abcd/w200.webp"] = &memBlob{}
+	mem["uploads/nature/a/old.jpg"] = &memBlob{}
+	mem["uploads/nature/a/recent.jpg"] = &memBlob{}
+
+	cfg := testConfig()
+	cfg.TrashRetention = 30 * 24 * time.Hour
+	faces, err := facestore.NewSQLiteStore(t.TempDir() + "/faces.db")
+	require.NoError(t, err)
+	defer faces.Close()
+	cfg.FaceStore = faces
+	oldRef := facestore.PhotoRef{Collection: "nature", Album: "a", Name: "old.jpg"}
+	require.NoError(t, faces.SaveFace(context.Background(), facestore.Face{FaceID: "f1", PersonID: "p1", PhotoRef: oldRef}))
+
+	res, err := PurgeTrash(context.Background(), store, cfg, now)
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Scanned: 3, Purged: 1, Stamped: 1}, res)
+
+	assert.Nil(t, mem["images/nature/a/old.jpg"])
+	assert.Nil(t, mem["uploads/nature/a/old.jpg"])
+	assert.Nil(t, mem["renditions/thumb/nature/a/old.jpg"])
+	assert.Nil(t, mem["variants/nature/a/old.jpg/0123abcd/w200.webp"])
+	assert.Nil(t, mem["variants/nature/a/old.jpg/4567cdef/w400.jpeg"])
+	assert.NotNil(t, mem["variants/nature/a/old.jpg2/0123abcd/w200.webp"], "another photo's variants")
+	remaining, err := faces.GetFacesByPhoto(context.Background(), oldRef)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+
+	assert.NotNil(t, mem["images/nature/a/recent.jpg"], "within the retention period")
+	assert.NotNil(t, mem["uploads/nature/a/recent.jpg"])
+	assert.Equal(t, "2026-03-01T00:00:00Z", mem["images/nature/a/legacy.jpg"].md[models.MetaDeletedAt])
+}
+
+// ── Audit log tests ─────────────────────────────────────────────────
+
+// auditConfig returns a test config that accepts test JWTs and records
+// audit entries in SQLite.
+func auditConfig(t *testing.T) (*Config, *audit.SQLiteSink) {
+	t.Helper()
+	sink, err := audit.NewSQLiteSink(t.TempDir() + "/audit.db")
+	require.NoError(t, err)
+	t.Cleanup(func() { sink.Close() })
+	cfg := testConfig()
+	cfg.JWTKeyfunc = testKeyfunc
+	cfg.Audit = sink
+	return cfg, sink
+}
+
+// signActorJWT signs a token with the upload role for the given subject
+// and display name.
+func signActorJWT(t *testing.T, sub, name string) string {
+	t.Helper()
+	claims := models.MyClaims{
+		Roles: []string{"photo.upload"},
+		Name:  name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testHMACSecret)
+	require.NoError(t, err)
+	return signed
+}
+
+func auditEntries(t *testing.T, sink audit.Sink) []audit.Entry {
+	t.Helper()
+	entries, err := sink.Query(context.Background(), audit.Filter{Limit: 100})
+	require.NoError(t, err)
+	return entries
+}
+
+func TestRequireRole_RecordsMutation(t *testing.T) {
+	cfg, sink := auditConfig(t)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := audit.ActorFrom(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "user-1", actor.ID)
+		auditChange(r.Context(), "nature/sunset/photo1.jpg",
+			map[string]string{"description": "old", "album": "sunset"},
+			map[string]string{"description": "new", "album": "sunset"})
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/update/nature/sunset/photo1.jpg", nil)
+	req.Pattern = "PUT /api/update/{collection}/{album}/{id}"
+	req.Header.Set("Authorization", "Bearer "+signActorJWT(t, "user-1", "Alice"))
+	w := httptest.NewRecorder()
+	RequireRole(cfg, next).ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	entries := auditEntries(t, sink)
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "user-1", e.Actor)
+	assert.Equal(t, "Alice", e.ActorName)
+	assert.Equal(t, "PUT /api/update/{collection}/{album}/{id}", e.Action)
+	assert.Equal(t, "nature/sunset/photo1.jpg", e.Target)
+	assert.Equal(t, http.StatusCreated, e.Status)
+	assert.Equal(t, map[string]string{"description": "old"}, e.Before, "unchanged tags are left out")
+	assert.Equal(t, map[string]string{"description": "new"}, e.After)
+	assert.WithinDuration(t, time.Now(), e.Time, time.Minute)
+}
+
+func TestRequireRole_DefaultTargetAndReads(t *testing.T) {
+	cfg, sink := auditConfig(t)
+	token := signActorJWT(t, "user-1", "Alice")
+	next := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "album not found", http.StatusNotFound)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/nature/sunset", nil)
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	req.Header.Set("Authorization", "Bearer "+token)
+	RequireRole(cfg, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/trash", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	RequireRole(cfg, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := auditEntries(t, sink)
+	require.Len(t, entries, 1, "reads are not recorded")
+	assert.Equal(t, "nature/sunset", entries[0].Target)
+	assert.Equal(t, "DELETE /api/nature/sunset", entries[0].Action)
+	assert.Equal(t, http.StatusNotFound, entries[0].Status, "failed attempts are recorded")
+}
+
+func TestSoftDeleteAlbumHandler_Audited(t *testing.T) {
+	store, _ := jobStore(sampleBlobs()[:2])
+	cfg, sink := auditConfig(t)
+	m := jobs.NewManager(context.Background(), jobs.NewMemoryStore())
+	RegisterJobOps(m, store, cfg)
+	cfg.Jobs = m
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/nature/sunset", nil)
+	req.SetPathValue("collection", "nature")
+	req.SetPathValue("album", "sunset")
+	req.Header.Set("Authorization", "Bearer "+signActorJWT(t, "user-1", "Alice"))
+	w := httptest.NewRecorder()
+	RequireRole(cfg, SoftDeleteAlbumHandler(store, cfg)).ServeHTTP(w, req)
+	resp, _ := decodeAccepted(t, w, cfg)
+
+	entries := auditEntries(t, sink)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "nature/sunset", entries[0].Target)
+	assert.Equal(t, map[string]string{"isDeleted": "false"}, entries[0].Before)
+	assert.Equal(t, map[string]string{"isDeleted": "true"}, entries[0].After)
+	assert.Equal(t, resp.JobID, entries[0].JobID)
+	assert.Equal(t, http.StatusAccepted, entries[0].Status)
+}
+
+func TestBatchUploadHandler_AuditsEachStoredFile(t *testing.T) {
+	cfg, sink := auditConfig(t)
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg"},
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg", Description: "first"},
+			{Collection: "travel", Album: "paris", Type: "image/jpeg", Description: "second"},
+		},
+		[]batchFile{
+			{"broken.jpg", []byte("not an image")},
+			{"a.jpg", makeJPEG(t, 10, 10)},
+			{"b.jpg", makeJPEG(t, 10, 10)},
+		},
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/batch", body)
+	req.Pattern = "POST /api/upload/batch"
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+signActorJWT(t, "user-1", "Alice"))
+	w := httptest.NewRecorder()
+	RequireRole(cfg, BatchUploadHandler(acceptSaves(), cfg)).ServeHTTP(w, req)
+	require.Equal(t, http.StatusPartialContent, w.Code)
+
+	byTarget := map[string]audit.Entry{}
+	for _, e := range auditEntries(t, sink) {
+		assert.Equal(t, "user-1", e.Actor)
+		assert.Equal(t, "POST /api/upload/batch", e.Action)
+		byTarget[e.Target] = e
+	}
+	require.Len(t, byTarget, 3, "one entry per stored file and one for the batch")
+	assert.Equal(t, http.StatusPartialContent, byTarget["/api/upload/batch"].Status)
+	first := byTarget["nature/sunset/a.jpg"]
+	assert.Equal(t, http.StatusCreated, first.Status)
+	assert.Equal(t, "first", first.After["description"])
+	assert.Equal(t, "second", byTarget["travel/paris/b.jpg"].After["description"])
+	assert.NotContains(t, byTarget, "nature/sunset/broken.jpg", "files that were not stored are not recorded")
+}
+
+func TestAuditHandler(t *testing.T) {
+	cfg, sink := auditConfig(t)
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, sink.Record(context.Background(), audit.Entry{ID: "1", Time: base, Actor: "user-1", ActorName: "Alice", Target: "nature/sunset"}))
+	require.NoError(t, sink.Record(context.Background(), audit.Entry{ID: "2", Time: base.Add(time.Hour), Actor: "user-2", ActorName: "Bob", Target: "travel"}))
+
+	get := func(cfg *Config, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		AuditHandler(cfg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/audit?"+query, nil))
+		return w
+	}
+
+	w := get(cfg, "actor=Alice&target=nature&since=2026-10-01T00:00:00Z")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var entries []audit.Entry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "1", entries[0].ID)
+
+	w = get(cfg, "since=2026-10-01T00:30:00Z")
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2", entries[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, get(cfg, "since=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, get(cfg, "limit=0").Code)
+
+	logCfg := testConfig()
+	logCfg.Audit = audit.NewLogSink(nil)
+	assert.Equal(t, http.StatusNotImplemented, get(logCfg, "").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, get(testConfig(), "").Code)
+}
@@ -1,15 +1,20 @@
 package handler
 
 import (
+	"fmt"
+	"log/slog"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/cbellee/photo-api/internal/exif"
 	"github.com/cbellee/photo-api/internal/models"
 )
 
 // BlobsToPhotos converts a slice of Blob models into a slice of Photo models.
 // It centralises the repeated mapping logic that was previously duplicated across
 // collectionHandler, albumHandler, and photoHandler.
-func BlobsToPhotos(blobs []models.Blob) []models.Photo {
+func BlobsToPhotos(blobs []models.Blob, cfg *Config) []models.Photo {
 	photos := make([]models.Photo, 0, len(blobs))
 
 	for _, b := range blobs {
@@ -36,15 +41,22 @@ func BlobsToPhotos(blobs []models.Blob) []models.Photo {
 			orientation = 0
 		}
 
+		src := b.Path
+		if cfg.ImageBaseURL != "" {
+			src = proxyImageURL(cfg, b, "")
+		}
+
 		photo := models.Photo{
-			Src:             b.Path,
+			Src:             src,
+			Renditions:      blobRenditions(b, cfg),
 			Name:            b.Name,
 			Width:           int(width),
 			Height:          int(height),
 			Album:           b.Tags["album"],
 			Collection:      b.Tags["collection"],
 			Description:     b.Tags["description"],
-			ExifData:        b.MetaData["ExifData"],
+			DateTaken:       blobDateTaken(b),
+			Exif:            blobExif(b),
 			IsDeleted:       isDeleted,
 			Orientation:     orientation,
 			AlbumImage:      albumImage,
@@ -56,3 +68,63 @@ func BlobsToPhotos(blobs []models.Blob) []models.Photo {
 
 	return photos
 }
+
+// blobRenditions maps the renditions recorded in a blob's metadata to their
+// URLs in the renditions container, plus "full" for the blob itself. The
+// storage root is taken from b.Path so the URLs match the backend that
+// produced it. With cfg.ImageBaseURL set, the URLs point at the image proxy.
+func blobRenditions(b models.Blob, cfg *Config) map[string]string {
+	names := b.MetaData["Renditions"]
+	if names == "" || cfg.RenditionsContainerName == "" {
+		return nil
+	}
+	if cfg.ImageBaseURL != "" {
+		renditions := map[string]string{"full": proxyImageURL(cfg, b, "")}
+		for _, name := range strings.Split(names, ",") {
+			renditions[name] = proxyImageURL(cfg, b, name)
+		}
+		return renditions
+	}
+	root, ok := strings.CutSuffix(b.Path, "/"+cfg.ImagesContainerName+"/"+b.Name)
+	if !ok {
+		return nil
+	}
+
+	renditions := map[string]string{"full": b.Path}
+	for _, name := range strings.Split(names, ",") {
+		renditions[name] = fmt.Sprintf("%s/%s/%s/%s", root, cfg.RenditionsContainerName, name, b.Name)
+	}
+	return renditions
+}
+
+// proxyImageURL returns the ImageHandler URL for b, or for one of its
+// renditions when rendition is not empty.
+func proxyImageURL(cfg *Config, b models.Blob, rendition string) string {
+	segments := strings.Split(b.Name, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	u := strings.TrimRight(cfg.ImageBaseURL, "/") + "/" + strings.Join(segments, "/")
+	if rendition != "" {
+		u += "?rendition=" + url.QueryEscape(rendition)
+	}
+	return u
+}
+
+// blobExif returns the structured EXIF data stored in a blob's metadata.
+// Blobs uploaded before fields were stored individually only carry the raw
+// goexif JSON under exif.MetaLegacyJSON, which is converted on the fly.
+func blobExif(b models.Blob) *models.ExifData {
+	if d := exif.FromMetadata(b.MetaData); d != nil {
+		return d
+	}
+	if raw := b.MetaData[exif.MetaLegacyJSON]; raw != "" {
+		d, err := exif.FromLegacyJSON(raw)
+		if err != nil {
+			slog.Debug("ignoring unreadable legacy exif data", "blob", b.Name, "error", err)
+			return nil
+		}
+		return d
+	}
+	return nil
+}
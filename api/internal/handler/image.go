@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// imageCacheControl lets browsers and CDNs reuse an image for an hour before
+// revalidating it with If-None-Match / If-Modified-Since.
+const imageCacheControl = "public, max-age=3600"
+
+// renditionPattern matches the rendition names accepted by the resize worker.
+var renditionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ImageHandler streams a photo, or with ?rendition=<name> one of its resized
+// renditions, from blob storage so the storage containers need not be
+// publicly readable. Responses carry ETag and Last-Modified validators,
+// conditional requests are answered with 304 and single byte ranges with 206.
+// Soft-deleted photos are 404 unless the caller has the upload role.
+//
+// GET /api/image/{collection}/{album}/{name}
+func ImageHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Image")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		album := r.PathValue("album")
+		if err := validatePathParam("album", album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.PathValue("name")
+		if err := validatePathParam("name", name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		container := cfg.ImagesContainerName
+		blobName := fmt.Sprintf("%s/%s/%s", collection, album, name)
+		rendition := r.URL.Query().Get("rendition")
+
+		variant, ok, err := parseVariantRequest(r.URL.Query(), cfg.ImageVariantSizes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// A photo in the trash is hidden from everyone but the upload role,
+		// and its responses must not be cached where others could see them.
+		tags, err := store.GetBlobTags(ctx, blobName, cfg.ImagesContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "image not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting image tags", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if tags["isDeleted"] == "true" {
+			if !hasRole(r, cfg) {
+				http.Error(w, "image not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+		if ok {
+			if rendition != "" {
+				http.Error(w, "rendition cannot be combined with w, h, fit, fmt or q", http.StatusBadRequest)
+				return
+			}
+			span.SetAttributes(attribute.String("blob.name", blobName), attribute.String("image.variant", variant.key()))
+			serveVariant(ctx, w, r, store, cfg, blobName, variant)
+			return
+		}
+
+		if rendition != "" && rendition != "full" {
+			if !renditionPattern.MatchString(rendition) {
+				http.Error(w, "invalid rendition", http.StatusBadRequest)
+				return
+			}
+			container = cfg.RenditionsContainerName
+			blobName = rendition + "/" + blobName
+		}
+		span.SetAttributes(attribute.String("blob.name", blobName), attribute.String("blob.container", container))
+
+		props, err := store.GetBlobProperties(ctx, blobName, container)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "image not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting image properties", "blob", blobName, "container", container, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		streamBlob(ctx, w, r, store, container, blobName, props)
+	}
+}
+
+// streamBlob answers r with the blob described by props, honouring
+// conditional and Range headers. props supplies the validators and size; the
+// content is only opened once a body is needed. A Content-Type or
+// Cache-Control header already set by the caller is kept.
+func streamBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, store storage.BlobStore, container, blobName string, props storage.BlobProperties) {
+	span := trace.SpanFromContext(ctx)
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", imageCacheControl)
+	}
+	if h.Get("Content-Type") != "" {
+		props.ContentType = h.Get("Content-Type")
+	}
+	if props.ETag != "" {
+		h.Set("ETag", props.ETag)
+	}
+	if !props.LastModified.IsZero() {
+		h.Set("Last-Modified", props.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, props) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	status, start, end := http.StatusOK, int64(0), int64(-1)
+	if ifRangeMatches(r, props) {
+		rs, re, ok, err := parseByteRange(r.Header.Get("Range"), props.Size)
+		if err != nil {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", props.Size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			status, start, end = http.StatusPartialContent, rs, re
+		}
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+	if r.Method == http.MethodHead {
+		h.Set("Content-Type", props.ContentType)
+		if status == http.StatusPartialContent {
+			h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, props.Size))
+			h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		} else {
+			h.Set("Content-Length", strconv.FormatInt(props.Size, 10))
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	rc, body, err := store.OpenBlob(ctx, blobName, container, start, end)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidRange) {
+		// The blob shrank after its properties were read.
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", props.Size))
+		http.Error(w, errRangeNotSatisfiable.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error opening image", "blob", blobName, "container", container, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", body.ContentType)
+	}
+	h.Set("Content-Length", strconv.FormatInt(body.ContentLength, 10))
+	if status == http.StatusPartialContent {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+body.ContentLength-1, body.Size))
+	}
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, rc); err != nil {
+		slog.WarnContext(ctx, "error streaming image", "blob", blobName, "error", err)
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no ETags
+// were sent, against the blob's validators.
+func notModified(r *http.Request, props storage.BlobProperties) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if props.ETag == "" {
+			return false
+		}
+		for tag := range strings.SplitSeq(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(props.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || props.LastModified.IsZero() {
+		return false
+	}
+	return !props.LastModified.Truncate(time.Second).After(ims)
+}
+
+// ifRangeMatches reports whether a Range header may be honoured: either no
+// If-Range was sent or it names the blob's current strong ETag or
+// modification time.
+func ifRangeMatches(r *http.Request, props storage.BlobProperties) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		return props.ETag != "" && !strings.HasPrefix(props.ETag, "W/") && ir == props.ETag
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && !props.LastModified.IsZero() && props.LastModified.Truncate(time.Second).Equal(t)
+}
+
+// parseByteRange parses a single "bytes=" range against a blob of size bytes
+// and returns its inclusive offsets. ok is false when the header is absent or
+// is not a single well-formed byte range, in which case the whole blob is
+// served. A range starting beyond the end of the blob returns
+// errRangeNotSatisfiable.
+func parseByteRange(header string, size int64) (start, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// Suffix range: the final n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		return size - min(n, size), size - 1, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	return start, end, true, nil
+}
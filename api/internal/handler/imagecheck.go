@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// formatTypes maps the format names reported by image.DecodeConfig to the
+// MIME types a file in that format may be declared as.
+var formatTypes = map[string][]string{
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"webp": {"image/webp"},
+	"heic": {"image/heic", "image/heif"},
+	"heif": {"image/heic", "image/heif"},
+}
+
+// checkSniffedType rejects a file whose leading bytes identify a different
+// image type from the declared one. http.DetectContentType does not know
+// HEIF, so formats it cannot identify are left to checkDecodedImage.
+func checkSniffedType(head []byte, declared string) error {
+	sniffed := http.DetectContentType(head)
+	if strings.HasPrefix(sniffed, "image/") && sniffed != declared {
+		return &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("file content is %s but was declared as %s", sniffed, declared),
+		}
+	}
+	return nil
+}
+
+// checkDecodedImage rejects a file whose decoder format does not match the
+// declared type, or whose dimensions exceed maxPixels (zero for no limit).
+// Dimensions come from the header alone, so this runs before anything
+// decodes the pixels.
+func checkDecodedImage(format string, img image.Config, declared string, maxPixels int64) error {
+	if !slices.Contains(formatTypes[format], declared) {
+		return &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("file is a %s image but was declared as %s", format, declared),
+		}
+	}
+	if img.Width <= 0 || img.Height <= 0 {
+		return &uploadError{Status: http.StatusBadRequest, Message: "Invalid image file"}
+	}
+	if maxPixels > 0 && int64(img.Width)*int64(img.Height) > maxPixels {
+		return &uploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("image is %dx%d pixels, more than the %d megapixel limit", img.Width, img.Height, maxPixels/1_000_000),
+		}
+	}
+	return nil
+}
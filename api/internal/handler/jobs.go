@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/cbellee/photo-api/internal/jobs"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Job kinds for the bulk mutations run by cfg.Jobs.
+const (
+	jobRenameCollection     = "rename-collection"
+	jobRenameAlbum          = "rename-album"
+	jobSoftDeleteCollection = "soft-delete-collection"
+	jobSoftDeleteAlbum      = "soft-delete-album"
+	jobRestoreCollection    = "restore-collection"
+	jobRestoreAlbum         = "restore-album"
+	jobMovePhotos           = "move-photos"
+)
+
+// RegisterJobOps registers the operations behind the bulk mutation
+// handlers. Renames and moves move each photo to its item's Target; soft
+// deletes and restores set its item's Tags and its deletion time.
+func RegisterJobOps(m *jobs.Manager, store storage.BlobStore, cfg *Config) {
+	move := moveBlobOp(store, cfg)
+	softDelete := softDeleteOp(store, cfg, true)
+	restore := softDeleteOp(store, cfg, false)
+	m.Register(jobRenameCollection, move)
+	m.Register(jobRenameAlbum, move)
+	m.Register(jobMovePhotos, move)
+	m.Register(jobSoftDeleteCollection, softDelete)
+	m.Register(jobSoftDeleteAlbum, softDelete)
+	m.Register(jobRestoreCollection, restore)
+	m.Register(jobRestoreAlbum, restore)
+}
+
+// moveBlobOp moves a photo to item.Target with movePhoto, setting item.Tags
+// on it.
+func moveBlobOp(store storage.BlobStore, cfg *Config) jobs.Op {
+	return func(ctx context.Context, job *jobs.Job, item *jobs.Item) error {
+		return movePhoto(ctx, store, cfg, item.Name, item.Target, item.Tags)
+	}
+}
+
+// softDeleteOp sets item.Tags on an image, keeping its other tags, and
+// records when it was deleted, or clears that record when it is restored.
+func softDeleteOp(store storage.BlobStore, cfg *Config, deleted bool) jobs.Op {
+	return func(ctx context.Context, job *jobs.Job, item *jobs.Item) error {
+		return setDeleted(ctx, store, cfg, item.Name, item.Tags, deleted)
+	}
+}
+
+// submitJob starts a bulk mutation as a job and responds 202 with its ID
+// and status URL.
+func submitJob(ctx context.Context, w http.ResponseWriter, cfg *Config, kind string, params map[string]string, items []jobs.Item, resp mutationResponse) {
+	if cfg.Jobs == nil {
+		http.Error(w, "background jobs not configured", http.StatusServiceUnavailable)
+		return
+	}
+	job, err := cfg.Jobs.Submit(ctx, kind, params, items)
+	if err != nil {
+		slog.ErrorContext(ctx, "error submitting job", "kind", kind, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	auditJob(ctx, job.ID)
+	resp.Affected = job.Total
+	resp.JobID = job.ID
+	resp.StatusURL = "/api/jobs/" + job.ID
+	w.Header().Set("Location", resp.StatusURL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// JobHandler returns a background job with its progress and the outcome of
+// each item.
+//
+// GET /api/jobs/{id}
+func JobHandler(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Job")
+		defer span.End()
+
+		if cfg.Jobs == nil {
+			http.Error(w, "background jobs not configured", http.StatusServiceUnavailable)
+			return
+		}
+		id := r.PathValue("id")
+		if !jobs.ValidID(id) {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(attribute.String("job.id", id))
+
+		job, err := cfg.Jobs.Get(ctx, id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting job", "job_id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// RetryJobHandler runs the failed items of a finished job again and
+// responds 202 with the job. It is 409 if the job is still running or has
+// no failed items.
+//
+// POST /api/jobs/{id}/retry
+func RetryJobHandler(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.RetryJob")
+		defer span.End()
+
+		if cfg.Jobs == nil {
+			http.Error(w, "background jobs not configured", http.StatusServiceUnavailable)
+			return
+		}
+		id := r.PathValue("id")
+		if !jobs.ValidID(id) {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(attribute.String("job.id", id))
+
+		job, err := cfg.Jobs.Retry(ctx, id)
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		case errors.Is(err, jobs.ErrRunning), errors.Is(err, jobs.ErrNothingToRetry):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.ErrorContext(ctx, "error retrying job", "job_id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		auditJob(ctx, job.ID)
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
@@ -5,32 +5,56 @@ import (
 	"net/http"
 	"slices"
 
+	"github.com/cbellee/photo-api/internal/audit"
+	"github.com/cbellee/photo-api/internal/models"
 	"github.com/cbellee/photo-api/internal/utils"
 	"go.opentelemetry.io/otel/attribute"
 )
 
 // RequireRole is HTTP middleware that verifies a JWT bearer token and checks
 // that the caller has the specified role claim. On failure it returns 401/403.
+// The caller's subject and name are kept in the request context, and the
+// mutations they make are recorded in the audit log.
 func RequireRole(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, span := tracer.Start(r.Context(), "middleware.RequireRole")
-		defer span.End()
-		span.SetAttributes(attribute.String("auth.required_role", cfg.RoleName))
-
-		claims, err := utils.VerifyToken(r, cfg.JwksURL, cfg.JWTKeyfunc)
-		if err != nil {
-			slog.ErrorContext(ctx, "token verification failed", "error", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		claims, ok := authorize(w, r, cfg)
+		if !ok {
 			return
 		}
+		actor := audit.Actor{ID: claims.Subject, Name: claims.Name}
+		serveAudited(w, r.WithContext(audit.WithActor(r.Context(), actor)), cfg, actor, next)
+	}
+}
 
-		if !slices.Contains(claims.Roles, cfg.RoleName) {
-			slog.WarnContext(ctx, "caller does not have required role", "required", cfg.RoleName, "roles", claims.Roles)
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
+// authorize performs the RequireRole checks for handlers that only need a
+// role for some requests. It writes the 401/403 response and returns false
+// when the caller is not authorised.
+func authorize(w http.ResponseWriter, r *http.Request, cfg *Config) (*models.MyClaims, bool) {
+	ctx, span := tracer.Start(r.Context(), "middleware.RequireRole")
+	defer span.End()
+	span.SetAttributes(attribute.String("auth.required_role", cfg.RoleName))
 
-		slog.DebugContext(ctx, "role claim found in token", "roles", claims.Roles)
-		next(w, r)
+	claims, err := utils.VerifyToken(r, cfg.JwksURL, cfg.JWTKeyfunc)
+	if err != nil {
+		slog.ErrorContext(ctx, "token verification failed", "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
 	}
+
+	if !slices.Contains(claims.Roles, cfg.RoleName) {
+		slog.WarnContext(ctx, "caller does not have required role", "required", cfg.RoleName, "roles", claims.Roles)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	slog.DebugContext(ctx, "role claim found in token", "roles", claims.Roles)
+	return claims, true
+}
+
+// hasRole reports whether r carries a valid token with the required role,
+// without writing a response, for handlers that hide rather than refuse
+// what other callers may not see.
+func hasRole(r *http.Request, cfg *Config) bool {
+	claims, err := utils.VerifyToken(r, cfg.JwksURL, cfg.JWTKeyfunc)
+	return err == nil && slices.Contains(claims.Roles, cfg.RoleName)
 }
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/cbellee/photo-api/internal/facestore"
+	"github.com/cbellee/photo-api/internal/jobs"
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// photoLocation identifies a photo, or with an empty Name an album, in
+// move requests.
+type photoLocation struct {
+	Collection string `json:"collection"`
+	Album      string `json:"album"`
+	Name       string `json:"name,omitempty"`
+}
+
+// moveRequest is the JSON body for POST /api/move.
+type moveRequest struct {
+	Sources     []photoLocation `json:"sources"`
+	Destination photoLocation   `json:"destination"`
+}
+
+// maxMoveSources bounds the photos moved by one request.
+const maxMoveSources = 1000
+
+// MoveHandler handles POST /api/move. It starts a job that moves the source
+// photos into the destination album, and responds 202 with the job's ID.
+//
+// Moved photos are retagged with their new collection, album and name. The
+// first becomes the destination album's (or collection's) image if it has
+// none, and a photo left behind takes over as the image of an album or
+// collection whose image was moved away. A photo that already exists in
+// the destination album is never overwritten: the request is 409.
+func MoveHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Move")
+		defer span.End()
+
+		if r.Body == nil {
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var req moveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		dest := req.Destination
+		if err := validatePathParam("destination collection", dest.Collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validatePathParam("destination album", dest.Album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Sources) == 0 {
+			http.Error(w, "sources is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Sources) > maxMoveSources {
+			http.Error(w, fmt.Sprintf("at most %d photos can be moved at once", maxMoveSources), http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(
+			attribute.String("destination.collection", dest.Collection),
+			attribute.String("destination.album", dest.Album),
+			attribute.Int("sources", len(req.Sources)),
+		)
+
+		// Check every source and target before moving anything.
+		type source struct {
+			name, target string
+			tags         map[string]string
+		}
+		sources := make([]source, 0, len(req.Sources))
+		seen := make(map[string]bool)   // file names, unique in the destination
+		moving := make(map[string]bool) // blob names
+		for _, src := range req.Sources {
+			for field, value := range map[string]string{"collection": src.Collection, "album": src.Album, "name": src.Name} {
+				if err := validatePathParam(field, value); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if src.Collection == dest.Collection && src.Album == dest.Album {
+				http.Error(w, fmt.Sprintf("%s is already in %s/%s", src.Name, dest.Collection, dest.Album), http.StatusBadRequest)
+				return
+			}
+			if seen[src.Name] {
+				http.Error(w, fmt.Sprintf("more than one photo is named %s", src.Name), http.StatusBadRequest)
+				return
+			}
+			seen[src.Name] = true
+
+			name := fmt.Sprintf("%s/%s/%s", src.Collection, src.Album, src.Name)
+			target := fmt.Sprintf("%s/%s/%s", dest.Collection, dest.Album, src.Name)
+			_, err := store.GetBlobProperties(ctx, name, cfg.ImagesContainerName)
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("photo %s not found", name), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "error getting photo to move", "blob", name, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			tags, err := store.GetBlobTags(ctx, name, cfg.ImagesContainerName)
+			if err != nil {
+				slog.ErrorContext(ctx, "error getting tags of photo to move", "blob", name, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			_, err = store.GetBlobProperties(ctx, target, cfg.ImagesContainerName)
+			if err == nil {
+				http.Error(w, fmt.Sprintf("photo %s already exists", target), http.StatusConflict)
+				return
+			}
+			if !errors.Is(err, storage.ErrNotFound) {
+				slog.ErrorContext(ctx, "error checking move target", "blob", target, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			sources = append(sources, source{name: name, target: target, tags: tags})
+			moving[name] = true
+		}
+
+		// Find which covers the destination lacks.
+		albumCovers, err := store.FilterBlobsByTags(ctx, fmt.Sprintf("@container='%s' and collection='%s' and album='%s' and albumImage='true'",
+			cfg.ImagesContainerName, dest.Collection, dest.Album), cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error querying destination album image", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		collectionCovers, err := store.FilterBlobsByTags(ctx, fmt.Sprintf("@container='%s' and collection='%s' and collectionImage='true'",
+			cfg.ImagesContainerName, dest.Collection), cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error querying destination collection image", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		albumHasCover, collectionHasCover := len(albumCovers) > 0, len(collectionCovers) > 0
+
+		items := make([]jobs.Item, 0, len(sources))
+		lostAlbumCover := make(map[string]bool)      // "collection/album"
+		lostCollectionCover := make(map[string]bool) // collection
+		for _, src := range sources {
+			srcCollection, srcAlbum, _ := splitBlobName(src.name)
+			tags := map[string]string{
+				"collection":      dest.Collection,
+				"album":           dest.Album,
+				"name":            src.target,
+				"albumImage":      "false",
+				"collectionImage": "false",
+			}
+			if src.tags["albumImage"] == "true" {
+				lostAlbumCover[srcCollection+"/"+srcAlbum] = true
+			}
+			if src.tags["collectionImage"] == "true" {
+				if srcCollection == dest.Collection {
+					tags["collectionImage"] = "true" // still its collection's image
+				} else {
+					lostCollectionCover[srcCollection] = true
+				}
+			}
+			if !albumHasCover {
+				tags["albumImage"], albumHasCover = "true", true
+			}
+			if !collectionHasCover {
+				tags["collectionImage"], collectionHasCover = "true", true
+			}
+			items = append(items, jobs.Item{Name: src.name, Target: src.target, Tags: tags})
+		}
+
+		// Photos left behind take over the covers that moved away. They are
+		// retagged in place, after the moves.
+		for key := range lostAlbumCover {
+			collection, album, _ := strings.Cut(key, "/")
+			query := fmt.Sprintf("@container='%s' and collection='%s' and album='%s' and isDeleted='false'",
+				cfg.ImagesContainerName, collection, album)
+			if name := remainingPhoto(ctx, store, cfg, query, moving); name != "" {
+				items = append(items, jobs.Item{Name: name, Target: name, Tags: map[string]string{"albumImage": "true"}})
+			}
+		}
+		for collection := range lostCollectionCover {
+			query := fmt.Sprintf("@container='%s' and collection='%s' and isDeleted='false'",
+				cfg.ImagesContainerName, collection)
+			if name := remainingPhoto(ctx, store, cfg, query, moving); name != "" {
+				items = append(items, jobs.Item{Name: name, Target: name, Tags: map[string]string{"collectionImage": "true"}})
+			}
+		}
+
+		slog.InfoContext(ctx, "moving photos", "collection", dest.Collection, "album", dest.Album, "count", len(sources))
+		// The audit entry names the destination, and the source when all
+		// photos come from one album; the job lists each photo.
+		from := map[string]string{"collection": req.Sources[0].Collection, "album": req.Sources[0].Album}
+		for _, src := range req.Sources[1:] {
+			if src.Collection != from["collection"] || src.Album != from["album"] {
+				from = nil
+				break
+			}
+		}
+		auditChange(ctx, dest.Collection+"/"+dest.Album, from, map[string]string{"collection": dest.Collection, "album": dest.Album})
+		submitJob(ctx, w, cfg, jobMovePhotos,
+			map[string]string{"collection": dest.Collection, "album": dest.Album},
+			items,
+			mutationResponse{Message: "move started"})
+	}
+}
+
+// remainingPhoto returns a photo matching query that is not being moved, or
+// "" if there is none. Query failures are logged; the cover is then left
+// unset, as it is for an emptied album.
+func remainingPhoto(ctx context.Context, store storage.BlobStore, cfg *Config, query string, moving map[string]bool) string {
+	blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+	if err != nil {
+		slog.WarnContext(ctx, "error finding replacement cover image", "query", query, "error", err)
+		return ""
+	}
+	for _, b := range blobs {
+		if !moving[b.Name] {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// movePhoto moves the photo at blob "from" to "to", setting tags on it:
+// it points the photo's face records at the new name, moves its
+// renditions, copies the image and checks the copy, then retags it and
+// deletes the original image. The upload it was resized from stays where
+// it is, recorded under models.MetaOriginalName.
+//
+// Face records move first, so the face detector started by the new blob
+// finds the photo already processed. Every step can be repeated, so a move
+// interrupted at any point is finished by running it again:
+//   - a copy left by an earlier attempt is overwritten;
+//   - a missing source whose target exists was already moved;
+//   - a photo already at its target, such as a copy that kept its old tags
+//     and was found by a second rename, is only retagged.
+func movePhoto(ctx context.Context, store storage.BlobStore, cfg *Config, from, to string, tags map[string]string) error {
+	container := cfg.ImagesContainerName
+	if from == to {
+		return retagBlob(ctx, store, container, from, tags)
+	}
+
+	src, err := store.GetBlobProperties(ctx, from, container)
+	if errors.Is(err, storage.ErrNotFound) {
+		if _, err := store.GetBlobProperties(ctx, to, container); err != nil {
+			return fmt.Errorf("%s no longer exists and %s cannot be read: %w", from, to, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s: %w", from, err)
+	}
+	md, err := store.GetBlobMetadata(ctx, from, container)
+	if err != nil {
+		return fmt.Errorf("get metadata %s: %w", from, err)
+	}
+	current, err := store.GetBlobTags(ctx, from, container)
+	if err != nil {
+		return fmt.Errorf("get tags %s: %w", from, err)
+	}
+
+	if err := updatePhotoRef(ctx, cfg, from, to); err != nil {
+		return err
+	}
+	for rendition := range strings.SplitSeq(md["Renditions"], ",") {
+		if rendition == "" {
+			continue
+		}
+		if err := moveBlob(ctx, store, cfg.RenditionsContainerName, rendition+"/"+from, rendition+"/"+to); err != nil {
+			return err
+		}
+	}
+
+	if err := copyBlob(ctx, store, container, from, to, src.Size); err != nil {
+		return err
+	}
+	if md[models.MetaOriginalName] == "" {
+		newMd := maps.Clone(md)
+		newMd[models.MetaOriginalName] = from
+		if err := store.SetBlobMetadata(ctx, to, container, newMd); err != nil {
+			return fmt.Errorf("set metadata %s: %w", to, err)
+		}
+	}
+	newTags := maps.Clone(current)
+	if newTags == nil {
+		newTags = map[string]string{}
+	}
+	maps.Copy(newTags, tags)
+	if err := store.SetBlobTags(ctx, to, container, newTags); err != nil {
+		return fmt.Errorf("set tags %s: %w", to, err)
+	}
+	if err := store.DeleteBlob(ctx, from, container); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("delete %s: %w", from, err)
+	}
+	return nil
+}
+
+// moveBlob moves a blob within container. A missing source has already
+// been moved, or never existed.
+func moveBlob(ctx context.Context, store storage.BlobStore, container, from, to string) error {
+	src, err := store.GetBlobProperties(ctx, from, container)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s/%s: %w", container, from, err)
+	}
+	if err := copyBlob(ctx, store, container, from, to, src.Size); err != nil {
+		return err
+	}
+	if err := store.DeleteBlob(ctx, from, container); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("delete %s/%s: %w", container, from, err)
+	}
+	return nil
+}
+
+// copyBlob copies a blob within container and checks that the copy has the
+// source's size, so the source can safely be deleted.
+func copyBlob(ctx context.Context, store storage.BlobStore, container, from, to string, size int64) error {
+	if err := store.CopyBlob(ctx, from, to, container); err != nil {
+		return fmt.Errorf("copy %s/%s: %w", container, from, err)
+	}
+	dst, err := store.GetBlobProperties(ctx, to, container)
+	if err != nil {
+		return fmt.Errorf("verify copy %s/%s: %w", container, to, err)
+	}
+	if dst.Size != size {
+		return fmt.Errorf("copy %s/%s is %d bytes, expected %d", container, to, dst.Size, size)
+	}
+	return nil
+}
+
+// retagBlob sets tags on a blob, keeping its other tags.
+func retagBlob(ctx context.Context, store storage.BlobStore, container, blobName string, tags map[string]string) error {
+	current, err := store.GetBlobTags(ctx, blobName, container)
+	if err != nil {
+		return fmt.Errorf("get tags %s: %w", blobName, err)
+	}
+	if current == nil {
+		current = map[string]string{}
+	}
+	maps.Copy(current, tags)
+	if err := store.SetBlobTags(ctx, blobName, container, current); err != nil {
+		return fmt.Errorf("set tags %s: %w", blobName, err)
+	}
+	return nil
+}
+
+// updatePhotoRef points the face records of the photo at blob "from" at
+// blob "to", if face detection is enabled.
+func updatePhotoRef(ctx context.Context, cfg *Config, from, to string) error {
+	fromRef, ok := photoRef(from)
+	toRef, toOK := photoRef(to)
+	if cfg.FaceStore == nil || !ok || !toOK {
+		return nil
+	}
+	if err := cfg.FaceStore.UpdatePhotoRef(ctx, fromRef, toRef); err != nil {
+		return fmt.Errorf("update faces %s: %w", from, err)
+	}
+	return nil
+}
+
+// photoRef returns the face store's reference to the photo at blobName,
+// reporting false if blobName is not of the form "collection/album/file".
+func photoRef(blobName string) (facestore.PhotoRef, bool) {
+	collection, album, name := splitBlobName(blobName)
+	if name == "" {
+		return facestore.PhotoRef{}, false
+	}
+	return facestore.PhotoRef{Collection: collection, Album: album, Name: name}, true
+}
+
+// splitBlobName splits an image name, "collection/album/file", into its
+// segments. They are empty if the name has fewer segments.
+func splitBlobName(blobName string) (collection, album, name string) {
+	parts := strings.SplitN(blobName, "/", 3)
+	if len(parts) < 3 {
+		return "", "", ""
+	}
+	return parts[0], parts[1], parts[2]
+}
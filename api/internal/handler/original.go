@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OriginalHandler streams the full-resolution upload a photo was derived
+// from. The resize worker records the original's container, size, SHA-256
+// and content type in the derived image's metadata, after checking the
+// upload against the hash taken when it was stored, so the recorded SHA-256
+// serves as the ETag and Repr-Digest without reading the content. Photos
+// resized before that fall back to the uploads container and the blob's
+// own validators and content type. A photo that has been moved also
+// records its original's name.
+//
+// GET /api/original/{collection}/{album}/{name}
+func OriginalHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Original")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		album := r.PathValue("album")
+		if err := validatePathParam("album", album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.PathValue("name")
+		if err := validatePathParam("name", name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		blobName := fmt.Sprintf("%s/%s/%s", collection, album, name)
+		span.SetAttributes(attribute.String("blob.name", blobName))
+
+		md, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "photo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting photo metadata", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		container, original := originalLocation(cfg, blobName, md)
+		props, err := store.GetBlobProperties(ctx, original, container)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "original not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting original properties", "blob", original, "container", container, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if sum, err := hex.DecodeString(md[models.MetaOriginalSha256]); err == nil && len(sum) == sha256.Size {
+			props.ETag = `"` + md[models.MetaOriginalSha256] + `"`
+			w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+		}
+		if ct := md[models.MetaOriginalContentType]; ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		streamBlob(ctx, w, r, store, container, original, props)
+	}
+}
+
+// originalLocation returns the container and name of the original upload of
+// the photo blobName, whose metadata is md.
+func originalLocation(cfg *Config, blobName string, md map[string]string) (container, name string) {
+	container, name = md[models.MetaOriginalContainer], md[models.MetaOriginalName]
+	if container == "" {
+		container = cfg.UploadsContainerName
+	}
+	if name == "" {
+		name = blobName
+	}
+	return container, name
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+)
+
+const (
+	// defaultPageSize is used when a request supplies ?cursor= without ?limit=.
+	defaultPageSize = 100
+	// maxPageSize caps ?limit= so a single request cannot page through an
+	// entire collection at once.
+	maxPageSize = 500
+	// maxEmptyPages bounds how many empty storage pages are skipped while
+	// looking for results. Azure may return an empty page with a continuation
+	// marker when a listing crosses a partition boundary.
+	maxEmptyPages = 10
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// photoPage is the JSON body returned by paged photo listings. Clients pass
+// NextCursor back as ?cursor= to fetch the following page; it is omitted on
+// the last page.
+type photoPage struct {
+	Photos     []models.Photo `json:"photos"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// pageRequest holds the parsed ?limit= and ?cursor= query parameters.
+type pageRequest struct {
+	Limit  int32
+	Cursor pageCursor
+}
+
+// first reports whether the request is for the first page.
+func (p pageRequest) first() bool {
+	return p.Cursor == pageCursor{}
+}
+
+// pageCursor is the decoded form of the opaque ?cursor= value. Wrapping the
+// storage marker keeps the public cursor format independent of the backend.
+// Sorted listings are paged in memory and use Offset instead of Marker.
+type pageCursor struct {
+	Marker string `json:"m,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+// encode returns the URL-safe string form of the cursor.
+func (c pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor produced by pageCursor.encode.
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Offset < 0 {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+// parsePageRequest reads ?limit= and ?cursor= from the query string. The
+// boolean result reports whether the caller asked for a paged response at
+// all; requests without either parameter keep the original un-paged shape.
+func parsePageRequest(q url.Values) (pageRequest, bool, error) {
+	limitStr, cursorStr := q.Get("limit"), q.Get("cursor")
+	if limitStr == "" && cursorStr == "" {
+		return pageRequest{}, false, nil
+	}
+
+	req := pageRequest{Limit: defaultPageSize}
+	if limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return req, true, fmt.Errorf("limit must be a positive integer")
+		}
+		req.Limit = int32(min(limit, maxPageSize))
+	}
+
+	if cursorStr != "" {
+		c, err := decodeCursor(cursorStr)
+		if err != nil {
+			return req, true, err
+		}
+		req.Cursor = c
+	}
+
+	return req, true, nil
+}
+
+// servePhotoList writes the photos matching query as JSON, honouring the
+// ?sort=, ?order=, ?limit= and ?cursor= parameters shared by the photo
+// listing endpoints. notFound is the 404 message used when the first page
+// is empty.
+func servePhotoList(ctx context.Context, w http.ResponseWriter, r *http.Request, store storage.BlobStore, cfg *Config, query string, notFound string) {
+	sortReq, err := parseSortRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// When ?limit= or ?cursor= is supplied, return a single page wrapped in
+	// a photoPage envelope; otherwise keep returning the full array.
+	pageReq, paged, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if paged {
+		photos, nextCursor, err := fetchPhotoPage(ctx, store, cfg, query, pageReq, sortReq)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting blobs by tags", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(photos) == 0 && pageReq.first() {
+			http.Error(w, notFound, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(photoPage{Photos: photos, NextCursor: nextCursor})
+		return
+	}
+
+	blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting blobs by tags", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if len(blobs) == 0 {
+		http.Error(w, notFound, http.StatusNotFound)
+		return
+	}
+
+	sortBlobs(blobs, sortReq)
+	photos := BlobsToPhotos(blobs, cfg)
+
+	slog.DebugContext(ctx, "filtered photos", "metadata", photos)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+// fetchPhotoPage returns one page of photos matching query. Unsorted
+// listings page through storage using its continuation marker. Storage
+// cannot order by tag value, so sorted listings load every match, sort in
+// memory and page by offset. The returned cursor is empty on the last page.
+func fetchPhotoPage(ctx context.Context, store storage.BlobStore, cfg *Config, query string, req pageRequest, sortReq sortRequest) ([]models.Photo, string, error) {
+	if sortReq.Field != "" {
+		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+		if err != nil {
+			return nil, "", err
+		}
+		sortBlobs(blobs, sortReq)
+
+		start := min(req.Cursor.Offset, len(blobs))
+		end := min(start+int(req.Limit), len(blobs))
+		var next string
+		if end < len(blobs) {
+			next = pageCursor{Offset: end}.encode()
+		}
+		return BlobsToPhotos(blobs[start:end], cfg), next, nil
+	}
+
+	marker := req.Cursor.Marker
+	var blobs []models.Blob
+	for i := 0; i < maxEmptyPages; i++ {
+		var err error
+		blobs, marker, err = store.FilterBlobsByTagsPage(ctx, query, cfg.ImagesContainerName, marker, req.Limit)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(blobs) > 0 || marker == "" {
+			break
+		}
+	}
+
+	var next string
+	if marker != "" {
+		next = pageCursor{Marker: marker}.encode()
+	}
+	return BlobsToPhotos(blobs, cfg), next, nil
+}
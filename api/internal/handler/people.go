@@ -123,11 +123,18 @@ func SetPersonNameHandler(cfg *Config) http.HandlerFunc {
 			return
 		}
 
+		// Read the current name for the audit log.
+		var before map[string]string
+		if p, err := cfg.FaceStore.GetPersonByID(ctx, personID); err == nil {
+			before = map[string]string{"name": p.Name}
+		}
+
 		if err := cfg.FaceStore.SetPersonName(ctx, personID, body.Name); err != nil {
 			slog.ErrorContext(ctx, "error setting person name", "personID", personID, "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		auditChange(ctx, personID, before, map[string]string{"name": body.Name})
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "ok", "personID": personID, "name": body.Name})
@@ -169,6 +176,9 @@ func MergePeopleHandler(cfg *Config) http.HandlerFunc {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		auditChange(ctx, body.TargetPersonID,
+			map[string]string{"personID": body.SourcePersonID},
+			map[string]string{"personID": body.TargetPersonID})
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
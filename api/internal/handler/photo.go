@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,6 +10,8 @@ import (
 )
 
 // PhotoHandler returns all photos within a specific collection/album.
+// Passing ?limit= and/or ?cursor= switches to a paged photoPage response, and
+// ?sort=dateTaken|name|uploaded&order=asc|desc orders the results.
 func PhotoHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.Photos")
@@ -43,21 +44,6 @@ func PhotoHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 		} else {
 			query = fmt.Sprintf("@container='%s' AND collection='%s' AND album='%s' AND isDeleted='false'", cfg.ImagesContainerName, collection, album)
 		}
-		filteredBlobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
-		if err != nil {
-			slog.ErrorContext(ctx, "error getting blobs by tags", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		if len(filteredBlobs) == 0 {
-			http.Error(w, "No photos found", http.StatusNotFound)
-			return
-		}
-
-		photos := BlobsToPhotos(filteredBlobs)
-
-		slog.DebugContext(ctx, "filtered photos", "metadata", photos)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(photos)
+		servePhotoList(ctx, w, r, store, cfg, query, "No photos found")
 	}
 }
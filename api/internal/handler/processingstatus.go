@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// processingStatusResponse is the JSON body returned by
+// ProcessingStatusHandler.
+type processingStatusResponse struct {
+	Collection string `json:"collection"`
+	Album      string `json:"album"`
+	Name       string `json:"name"`
+	// Status is one of pending, processing, done or failed.
+	Status string `json:"status"`
+	// Error explains a failed status.
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// ProcessingStatusHandler reports how far the resize worker has got with an
+// upload, so clients can wait for the photo to appear in the images
+// container and show failed conversions. The status is kept in the upload
+// blob's metadata; uploads made before it was recorded are reported as done
+// once their photo exists and pending until then.
+//
+// GET /api/upload/status/{collection}/{album}/{name}
+func ProcessingStatusHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.ProcessingStatus")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		album := r.PathValue("album")
+		if err := validatePathParam("album", album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.PathValue("name")
+		if err := validatePathParam("name", name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		blobName := fmt.Sprintf("%s/%s/%s", collection, album, name)
+		span.SetAttributes(attribute.String("blob.name", blobName))
+
+		md, err := store.GetBlobMetadata(ctx, blobName, cfg.UploadsContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting upload metadata", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := processingStatusResponse{
+			Collection: collection,
+			Album:      album,
+			Name:       name,
+			Status:     md[models.MetaProcessingStatus],
+			Error:      md[models.MetaProcessingError],
+			UpdatedAt:  md[models.MetaProcessingUpdatedAt],
+		}
+		if resp.Status == "" {
+			_, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+			switch {
+			case err == nil:
+				resp.Status = models.ProcessingDone
+			case errors.Is(err, storage.ErrNotFound):
+				resp.Status = models.ProcessingPending
+			default:
+				slog.ErrorContext(ctx, "error getting photo metadata", "blob", blobName, "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		span.SetAttributes(attribute.String("upload.status", resp.Status))
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
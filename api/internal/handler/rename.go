@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/cbellee/photo-api/internal/jobs"
 	"github.com/cbellee/photo-api/internal/storage"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -17,11 +18,16 @@ type renameRequest struct {
 }
 
 // RenameCollectionHandler handles PUT /api/rename/{collection}.
-// It renames a collection by:
-//  1. Finding all blobs with the given collection tag.
-//  2. Copying each blob to a new path with the new collection name.
-//  3. Updating tags on the new blob (collection + name).
-//  4. Deleting the old blob.
+// It finds all blobs with the given collection tag and starts a job that
+// moves each photo to a path with the new collection name, updating its
+// collection and name tags, its renditions and its face records (see
+// movePhoto).
+//
+// The job records every move before the first copy and each step can be
+// repeated, so a rename interrupted by a restart is resumed, and requesting
+// it again only moves what is left.
+//
+// It responds 202 with the job's ID; progress is reported by JobHandler.
 func RenameCollectionHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.RenameCollection")
@@ -69,63 +75,30 @@ func RenameCollectionHandler(store storage.BlobStore, cfg *Config) http.HandlerF
 		}
 
 		slog.InfoContext(ctx, "renaming collection", "from", collection, "to", req.NewName, "blobCount", len(blobs))
+		auditChange(ctx, collection, map[string]string{"collection": collection}, map[string]string{"collection": req.NewName})
 
-		var errors []string
+		items := make([]jobs.Item, 0, len(blobs))
 		for _, blob := range blobs {
-			// Build new blob name: replace the collection segment.
 			// Blob names follow the pattern: collection/album/filename
 			newBlobName := replaceFirstSegment(blob.Name, req.NewName)
-
-			// Copy blob to new location.
-			if err := store.CopyBlob(ctx, blob.Name, newBlobName, cfg.ImagesContainerName); err != nil {
-				errors = append(errors, fmt.Sprintf("copy %s: %v", blob.Name, err))
-				continue
-			}
-
-			// Update tags on the new blob.
-			newTags := make(map[string]string, len(blob.Tags))
-			for k, v := range blob.Tags {
-				newTags[k] = v
-			}
-			newTags["collection"] = req.NewName
-			newTags["name"] = newBlobName
-
-			if err := store.SetBlobTags(ctx, newBlobName, cfg.ImagesContainerName, newTags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", newBlobName, err))
-				continue
-			}
-
-			// Delete old blob.
-			if err := store.DeleteBlob(ctx, blob.Name, cfg.ImagesContainerName); err != nil {
-				errors = append(errors, fmt.Sprintf("delete %s: %v", blob.Name, err))
-			}
-		}
-
-		if len(errors) > 0 {
-			slog.ErrorContext(ctx, "rename completed with errors", "errors", errors)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:  "rename completed with errors",
-				Errors:   errors,
-				NewName:  req.NewName,
-				Affected: len(blobs),
+			items = append(items, jobs.Item{
+				Name:   blob.Name,
+				Target: newBlobName,
+				Tags:   map[string]string{"collection": req.NewName, "name": newBlobName},
 			})
-			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:  "collection renamed",
-			NewName:  req.NewName,
-			Affected: len(blobs),
-		})
+		submitJob(ctx, w, cfg, jobRenameCollection,
+			map[string]string{"collection": collection, "newName": req.NewName},
+			items,
+			mutationResponse{Message: "collection rename started", NewName: req.NewName})
 	}
 }
 
 // RenameAlbumHandler handles PUT /api/rename/{collection}/{album}.
-// It renames an album by finding all matching blobs, copying, retagging,
-// and deleting the originals.
+// It finds all matching blobs and starts a job that renames the album by
+// copying, retagging, and deleting the originals, as RenameCollectionHandler
+// does for collections. It responds 202 with the job's ID.
 func RenameAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.RenameAlbum")
@@ -182,53 +155,23 @@ func RenameAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 		}
 
 		slog.InfoContext(ctx, "renaming album", "collection", collection, "from", album, "to", req.NewName, "blobCount", len(blobs))
+		auditChange(ctx, collection+"/"+album, map[string]string{"album": album}, map[string]string{"album": req.NewName})
 
-		var errors []string
+		items := make([]jobs.Item, 0, len(blobs))
 		for _, blob := range blobs {
 			// Build new blob name: replace the album segment (second path segment).
 			newBlobName := replaceSecondSegment(blob.Name, req.NewName)
-
-			if err := store.CopyBlob(ctx, blob.Name, newBlobName, cfg.ImagesContainerName); err != nil {
-				errors = append(errors, fmt.Sprintf("copy %s: %v", blob.Name, err))
-				continue
-			}
-
-			newTags := make(map[string]string, len(blob.Tags))
-			for k, v := range blob.Tags {
-				newTags[k] = v
-			}
-			newTags["album"] = req.NewName
-			newTags["name"] = newBlobName
-
-			if err := store.SetBlobTags(ctx, newBlobName, cfg.ImagesContainerName, newTags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", newBlobName, err))
-				continue
-			}
-
-			// Delete old blob.
-			if err := store.DeleteBlob(ctx, blob.Name, cfg.ImagesContainerName); err != nil {
-				errors = append(errors, fmt.Sprintf("delete %s: %v", blob.Name, err))
-			}
-		}
-
-		if len(errors) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:  "album rename completed with errors",
-				Errors:   errors,
-				NewName:  req.NewName,
-				Affected: len(blobs),
+			items = append(items, jobs.Item{
+				Name:   blob.Name,
+				Target: newBlobName,
+				Tags:   map[string]string{"album": req.NewName, "name": newBlobName},
 			})
-			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:  "album renamed",
-			NewName:  req.NewName,
-			Affected: len(blobs),
-		})
+		submitJob(ctx, w, cfg, jobRenameAlbum,
+			map[string]string{"collection": collection, "album": album, "newName": req.NewName},
+			items,
+			mutationResponse{Message: "album rename started", NewName: req.NewName})
 	}
 }
 
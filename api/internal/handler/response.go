@@ -4,9 +4,11 @@ package handler
 // soft-delete, restore). Using a named struct instead of map[string]interface{}
 // gives compile-time safety and self-documenting field names.
 type mutationResponse struct {
-	Message           string   `json:"message"`
-	Affected          int      `json:"affected"`
-	Errors            []string `json:"errors,omitempty"`
-	NewName           string   `json:"newName,omitempty"`
-	CollectionDeleted bool     `json:"collectionDeleted,omitempty"`
+	Message  string `json:"message"`
+	Affected int    `json:"affected"`
+	NewName  string `json:"newName,omitempty"`
+	// JobID and StatusURL identify the background job that carries out
+	// the mutation.
+	JobID     string `json:"jobId,omitempty"`
+	StatusURL string `json:"statusUrl,omitempty"`
 }
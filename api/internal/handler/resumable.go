@@ -0,0 +1,485 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// maxResumableUploadBytes caps the declared size of a resumable upload.
+	maxResumableUploadBytes = 1 << 30
+	// maxUploadBlocks is the most blocks Azure allows in one block blob.
+	maxUploadBlocks = 50000
+	// uploadSessionTTL is how long a resumable upload stays open. Azure
+	// discards uncommitted blocks after seven days.
+	uploadSessionTTL = 24 * time.Hour
+)
+
+// validUploadID matches the IDs generated by newUploadID.
+var validUploadID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// uploadSession is the state of a resumable upload. It is stored as
+// "<id>/session.json" in the upload sessions container, next to the
+// "<id>/data" blob whose blocks hold the chunks received so far.
+type uploadSession struct {
+	ID       string           `json:"id"`
+	Filename string           `json:"filename"`
+	Size     int64            `json:"size"`
+	Metadata models.ImageTags `json:"metadata"`
+	Offset   int64            `json:"offset"`
+	Blocks   []string         `json:"blocks"`
+	// Direct marks a session whose data blob is uploaded by the client
+	// with a presigned URL rather than in chunks through the API.
+	Direct bool `json:"direct,omitempty"`
+	// Committed is set once the blocks have been committed to the data
+	// blob, so a retried commit does not commit them again.
+	Committed bool      `json:"committed"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// etag is the version of the session blob this copy was read from, so
+	// that saving it fails if another request has saved it since.
+	etag string
+}
+
+func (s *uploadSession) dataBlob() string { return sessionDataBlobName(s.ID) }
+
+func sessionBlobName(id string) string     { return id + "/session.json" }
+func sessionDataBlobName(id string) string { return id + "/data" }
+
+// createUploadRequest is the JSON body for CreateUploadHandler.
+type createUploadRequest struct {
+	Filename string           `json:"filename"`
+	Size     int64            `json:"size"`
+	Metadata models.ImageTags `json:"metadata"`
+}
+
+// uploadSessionResponse describes a resumable upload's progress.
+type uploadSessionResponse struct {
+	ID        string    `json:"id"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateUploadHandler starts a resumable upload of one photo. The body
+// declares the filename, total size and the same metadata as UploadHandler;
+// the response's Location is the session URL that chunks are sent to.
+//
+// A resumable upload is driven by the client:
+//
+//	POST   /api/uploads              create the session
+//	PATCH  /api/uploads/{id}         append a chunk at Upload-Offset
+//	GET    /api/uploads/{id}         read the offset to resume from
+//	POST   /api/uploads/{id}/commit  validate and store the photo
+//	DELETE /api/uploads/{id}         abandon the upload
+//
+// Chunks must be sent one at a time, in order.
+func CreateUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.CreateUpload")
+		defer span.End()
+
+		if r.Body == nil {
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var req createUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		sess, err := newUploadSession(req)
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			http.Error(w, ue.Message, ue.Status)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating upload id", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		id := sess.ID
+		span.SetAttributes(
+			attribute.String("upload.id", id),
+			attribute.String("filename", req.Filename),
+			attribute.Int64("file.size", req.Size),
+		)
+
+		if err := saveUploadSession(ctx, store, cfg, sess); err != nil {
+			slog.ErrorContext(ctx, "error saving upload session", "upload_id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(ctx, "resumable upload created",
+			"upload_id", id,
+			"filename", req.Filename,
+			"size", req.Size,
+			"collection", req.Metadata.Collection,
+			"album", req.Metadata.Album,
+		)
+
+		w.Header().Set("Location", "/api/uploads/"+id)
+		writeUploadSession(w, http.StatusCreated, sess)
+	}
+}
+
+// UploadStatusHandler reports how much of a resumable upload has been
+// received, in the Upload-Offset header and the JSON body. HEAD requests
+// return the headers alone.
+//
+// GET /api/uploads/{id}
+func UploadStatusHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.UploadStatus")
+		defer span.End()
+
+		sess, ok := loadUploadSession(ctx, w, store, cfg, r.PathValue("id"), false)
+		if !ok {
+			return
+		}
+		writeUploadSession(w, http.StatusOK, sess)
+	}
+}
+
+// AppendUploadHandler stages the request body as the next chunk of a
+// resumable upload. Upload-Offset must equal the bytes received so far;
+// otherwise the request is rejected with 409 and the current offset, which
+// is how a client that lost a response finds where to resume. Of two
+// chunks sent at once, the first to be recorded wins and the other gets
+// 409. Chunks are limited to cfg.MemoryLimitMb.
+//
+// PATCH /api/uploads/{id}
+func AppendUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.AppendUpload")
+		defer span.End()
+
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+			return
+		}
+
+		sess, ok := loadUploadSession(ctx, w, store, cfg, r.PathValue("id"), false)
+		if !ok {
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+		if offset != sess.Offset || sess.Committed {
+			http.Error(w, "offset does not match upload", http.StatusConflict)
+			return
+		}
+		if len(sess.Blocks) >= maxUploadBlocks {
+			http.Error(w, "too many chunks", http.StatusBadRequest)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		}
+		maxChunk := cfg.MemoryLimitMb << 20
+		remaining := sess.Size - sess.Offset
+		data, err := io.ReadAll(io.LimitReader(r.Body, min(maxChunk, remaining)+1))
+		if err != nil {
+			slog.WarnContext(ctx, "error reading upload chunk", "upload_id", sess.ID, "error", err)
+			http.Error(w, "error reading chunk", http.StatusBadRequest)
+			return
+		}
+		switch n := int64(len(data)); {
+		case n == 0:
+			http.Error(w, "body is empty", http.StatusBadRequest)
+			return
+		case n > remaining:
+			http.Error(w, "chunk exceeds declared size", http.StatusBadRequest)
+			return
+		case n > maxChunk:
+			http.Error(w, fmt.Sprintf("chunk exceeds %d MB", cfg.MemoryLimitMb), http.StatusRequestEntityTooLarge)
+			return
+		}
+		span.SetAttributes(
+			attribute.String("upload.id", sess.ID),
+			attribute.Int64("upload.offset", offset),
+			attribute.Int("chunk.size", len(data)),
+		)
+
+		// Every attempt stages its own block, so a concurrent request for the
+		// same offset cannot replace it; only the blocks recorded in the
+		// session are committed, and Azure discards the rest.
+		blockID, err := newBlockID(len(sess.Blocks))
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating block id", "upload_id", sess.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := store.StageBlock(ctx, sess.dataBlob(), cfg.UploadSessionsContainerName, blockID, bytes.NewReader(data), int64(len(data))); err != nil {
+			slog.ErrorContext(ctx, "error staging upload chunk", "upload_id", sess.ID, "offset", offset, "error", err)
+			span.SetStatus(codes.Error, "stage block failed")
+			span.RecordError(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		sess.Blocks = append(sess.Blocks, blockID)
+		sess.Offset += int64(len(data))
+		err = saveUploadSession(ctx, store, cfg, sess)
+		if errors.Is(err, storage.ErrConditionNotMet) {
+			// Another chunk was recorded first; the client reads the new
+			// offset and resumes from there.
+			w.Header().Del("Upload-Offset")
+			http.Error(w, "upload was changed by another request", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error saving upload session", "upload_id", sess.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CommitUploadHandler finishes a resumable upload once every byte has been
+// received: the chunks are committed to a staging blob, which is then
+// validated, tagged and stored exactly as UploadHandler does, streaming it
+// back from storage rather than holding it in memory. The session is
+// removed unless storage failed, in which case the commit can be retried.
+//
+// POST /api/uploads/{id}/commit
+func CommitUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.CommitUpload")
+		defer span.End()
+
+		uploadStart := time.Now()
+
+		sess, ok := loadUploadSession(ctx, w, store, cfg, r.PathValue("id"), false)
+		if !ok {
+			return
+		}
+		span.SetAttributes(attribute.String("upload.id", sess.ID))
+		if sess.Offset != sess.Size {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+			http.Error(w, "upload is incomplete", http.StatusConflict)
+			return
+		}
+
+		// The staging blob is committed as opaque bytes; processUpload
+		// validates it against the declared type.
+		if !sess.Committed {
+			if err := store.CommitBlockList(ctx, sess.dataBlob(), cfg.UploadSessionsContainerName, sess.Blocks, nil, nil, "application/octet-stream"); err != nil {
+				slog.ErrorContext(ctx, "error committing upload blocks", "upload_id", sess.ID, "blocks", len(sess.Blocks), "error", err)
+				span.SetStatus(codes.Error, "commit block list failed")
+				span.RecordError(err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			sess.Committed = true
+			err := saveUploadSession(ctx, store, cfg, sess)
+			if errors.Is(err, storage.ErrConditionNotMet) {
+				http.Error(w, "upload is already being committed", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "error saving upload session", "upload_id", sess.ID, "error", err)
+			}
+		}
+
+		finishUpload(ctx, w, store, cfg, sess, uploadStart)
+	}
+}
+
+// finishUpload stores the photo in a session's data blob as UploadHandler
+// would, streaming it from storage, and writes the response. The session is
+// removed unless storage failed, so that the request can be retried.
+func finishUpload(ctx context.Context, w http.ResponseWriter, store storage.BlobStore, cfg *Config, sess *uploadSession, uploadStart time.Time) {
+	file := storage.NewBlobReader(ctx, store, sess.dataBlob(), cfg.UploadSessionsContainerName, sess.Size)
+	blobPath, err := processUpload(ctx, store, cfg, sess.Metadata, sess.Filename, file, sess.Size, uploadStart)
+	file.Close()
+
+	var ue *uploadError
+	if err == nil || errors.As(err, &ue) {
+		deleteUploadSession(ctx, store, cfg, sess.ID)
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(uploadResult{
+		Filename: sess.Filename,
+		Status:   http.StatusCreated,
+		BlobPath: blobPath,
+	})
+}
+
+// AbortUploadHandler abandons a resumable upload and discards its chunks.
+//
+// DELETE /api/uploads/{id}
+func AbortUploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.AbortUpload")
+		defer span.End()
+
+		sess, ok := loadUploadSession(ctx, w, store, cfg, r.PathValue("id"), false)
+		if !ok {
+			return
+		}
+		deleteUploadSession(ctx, store, cfg, sess.ID)
+		slog.InfoContext(ctx, "resumable upload aborted", "upload_id", sess.ID, "offset", sess.Offset, "size", sess.Size)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newUploadID returns a random 128-bit upload session ID.
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newBlockID returns a block ID for the chunk at index: the index, which
+// keeps IDs the same length, and a random suffix unique to the attempt.
+func newBlockID(index int) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "%08d%x", index, b)), nil
+}
+
+// newUploadSession validates a request to upload one photo and returns a
+// new, unsaved session for it. Invalid requests return an uploadError.
+func newUploadSession(req createUploadRequest) (*uploadSession, error) {
+	if req.Filename == "" || strings.ContainsAny(req.Filename, `/\`) {
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: "invalid filename"}
+	}
+	if req.Size <= 0 || req.Size > maxResumableUploadBytes {
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: fmt.Sprintf("size must be between 1 and %d bytes", maxResumableUploadBytes)}
+	}
+	if !allowedImageTypes[req.Metadata.Type] {
+		return nil, &uploadError{Status: http.StatusUnsupportedMediaType, Message: "Unsupported image type"}
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &uploadSession{
+		ID:        id,
+		Filename:  req.Filename,
+		Size:      req.Size,
+		Metadata:  req.Metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(uploadSessionTTL),
+	}, nil
+}
+
+// loadUploadSession reads the session with the given id, which must be a
+// direct upload or not as given. On failure it writes the error response
+// and returns false.
+func loadUploadSession(ctx context.Context, w http.ResponseWriter, store storage.BlobStore, cfg *Config, id string, direct bool) (*uploadSession, bool) {
+	if !validUploadID.MatchString(id) {
+		http.Error(w, "invalid upload id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	rc, props, err := store.OpenBlob(ctx, sessionBlobName(id), cfg.UploadSessionsContainerName, 0, -1)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading upload session", "upload_id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	defer rc.Close()
+
+	var sess uploadSession
+	if err := json.NewDecoder(rc).Decode(&sess); err != nil {
+		slog.ErrorContext(ctx, "error decoding upload session", "upload_id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	sess.etag = props.ETag
+	if sess.Direct != direct {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		deleteUploadSession(ctx, store, cfg, id)
+		http.Error(w, "upload has expired", http.StatusGone)
+		return nil, false
+	}
+	return &sess, true
+}
+
+// saveUploadSession creates or updates a session. It fails with an error
+// wrapping storage.ErrConditionNotMet if the session has been saved since
+// sess was loaded.
+func saveUploadSession(ctx context.Context, store storage.BlobStore, cfg *Config, sess *uploadSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	etag, err := store.SaveBlobIfMatch(ctx, bytes.NewReader(data), int64(len(data)), sessionBlobName(sess.ID), cfg.UploadSessionsContainerName, nil, nil, "application/json", sess.etag)
+	if err != nil {
+		return err
+	}
+	sess.etag = etag
+	return nil
+}
+
+// deleteUploadSession removes a session and its data blob. Failures are
+// only logged: the session is finished either way.
+func deleteUploadSession(ctx context.Context, store storage.BlobStore, cfg *Config, id string) {
+	for _, name := range []string{sessionDataBlobName(id), sessionBlobName(id)} {
+		if err := store.DeleteBlob(ctx, name, cfg.UploadSessionsContainerName); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			slog.WarnContext(ctx, "error deleting upload session blob", "blob", name, "error", err)
+		}
+	}
+}
+
+func writeUploadSession(w http.ResponseWriter, status int, sess *uploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(sess.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(uploadSessionResponse{
+		ID:        sess.ID,
+		Offset:    sess.Offset,
+		Size:      sess.Size,
+		ExpiresAt: sess.ExpiresAt,
+	})
+}
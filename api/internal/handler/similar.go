@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/cbellee/photo-api/internal/similarity"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// similarResponse is the JSON body returned by SimilarHandler.
+type similarResponse struct {
+	Photo          string             `json:"photo"`
+	PerceptualHash string             `json:"perceptualHash"`
+	MaxHamming     int                `json:"maxHamming"`
+	Matches        []similarity.Match `json:"matches"`
+}
+
+// SimilarHandler lists non-deleted photos that look like the given one: those
+// whose perceptual hash, recorded by the resize worker, is within
+// ?maxHamming= bits (default similarity.DefaultMaxHamming) of its own. Photos
+// resized before hashing was introduced are not compared.
+//
+// GET /api/similar/{collection}/{album}/{name}
+func SimilarHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Similar")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		album := r.PathValue("album")
+		if err := validatePathParam("album", album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.PathValue("name")
+		if err := validatePathParam("name", name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		maxHamming := similarity.DefaultMaxHamming
+		if v := r.URL.Query().Get("maxHamming"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > similarity.HashBits {
+				http.Error(w, fmt.Sprintf("maxHamming must be between 0 and %d", similarity.HashBits), http.StatusBadRequest)
+				return
+			}
+			maxHamming = n
+		}
+
+		blobName := fmt.Sprintf("%s/%s/%s", collection, album, name)
+		span.SetAttributes(attribute.String("blob.name", blobName), attribute.Int("similar.max_hamming", maxHamming))
+
+		md, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "photo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting photo metadata", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		hash := md[similarity.MetadataKey]
+		if hash == "" {
+			http.Error(w, "photo has no perceptual hash", http.StatusConflict)
+			return
+		}
+
+		query := fmt.Sprintf("@container='%s' AND isDeleted='false'", cfg.ImagesContainerName)
+		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error filtering blobs by tags", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		photos, _ := similarity.FromBlobs(blobs)
+		candidates := photos[:0]
+		for _, p := range photos {
+			if p.Name != blobName {
+				candidates = append(candidates, p)
+			}
+		}
+		matches := similarity.Similar(hash, candidates, maxHamming)
+		span.SetAttributes(attribute.Int("photos.compared", len(candidates)), attribute.Int("similar.matches", len(matches)))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(similarResponse{
+			Photo:          blobName,
+			PerceptualHash: hash,
+			MaxHamming:     maxHamming,
+			Matches:        matches,
+		})
+	}
+}
@@ -1,17 +1,18 @@
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 
+	"github.com/cbellee/photo-api/internal/jobs"
 	"github.com/cbellee/photo-api/internal/storage"
 	"go.opentelemetry.io/otel/attribute"
 )
 
 // SoftDeleteCollectionHandler handles DELETE /api/{collection}.
-// It sets isDeleted='true' on every blob in the collection.
+// It starts a job that sets isDeleted='true' on every blob in the collection
+// and responds 202 with the job's ID.
 func SoftDeleteCollectionHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.SoftDeleteCollection")
@@ -39,40 +40,23 @@ func SoftDeleteCollectionHandler(store storage.BlobStore, cfg *Config) http.Hand
 		}
 
 		slog.InfoContext(ctx, "soft-deleting collection", "collection", collection, "blobCount", len(blobs))
+		auditChange(ctx, collection, map[string]string{"isDeleted": "false"}, map[string]string{"isDeleted": "true"})
 
-		var errors []string
+		items := make([]jobs.Item, 0, len(blobs))
 		for _, blob := range blobs {
-			blob.Tags["isDeleted"] = "true"
-			blob.Tags["collectionImage"] = "false"
-			blob.Tags["albumImage"] = "false"
-
-			if err := store.SetBlobTags(ctx, blob.Name, cfg.ImagesContainerName, blob.Tags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", blob.Name, err))
-			}
+			items = append(items, jobs.Item{Name: blob.Name, Tags: deletedTags()})
 		}
 
-		if len(errors) > 0 {
-			slog.ErrorContext(ctx, "soft-delete collection completed with errors", "collection", collection, "errors", errors)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:  "soft-delete completed with errors",
-				Errors:   errors,
-				Affected: len(blobs),
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:  "collection soft-deleted",
-			Affected: len(blobs),
-		})
+		submitJob(ctx, w, cfg, jobSoftDeleteCollection,
+			map[string]string{"collection": collection},
+			items,
+			mutationResponse{Message: "collection soft-delete started"})
 	}
 }
 
 // SoftDeleteAlbumHandler handles DELETE /api/{collection}/{album}.
-// It sets isDeleted='true' on every blob in the album.
+// It starts a job that sets isDeleted='true' on every blob in the album and
+// responds 202 with the job's ID.
 func SoftDeleteAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.SoftDeleteAlbum")
@@ -107,50 +91,23 @@ func SoftDeleteAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFu
 		}
 
 		slog.InfoContext(ctx, "soft-deleting album", "collection", collection, "album", album, "blobCount", len(blobs))
+		auditChange(ctx, collection+"/"+album, map[string]string{"isDeleted": "false"}, map[string]string{"isDeleted": "true"})
 
-		var errors []string
+		items := make([]jobs.Item, 0, len(blobs))
 		for _, blob := range blobs {
-			blob.Tags["isDeleted"] = "true"
-			blob.Tags["albumImage"] = "false"
-			blob.Tags["collectionImage"] = "false"
-
-			if err := store.SetBlobTags(ctx, blob.Name, cfg.ImagesContainerName, blob.Tags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", blob.Name, err))
-			}
-		}
-
-		// Check whether the entire collection is now soft-deleted.
-		remainingQuery := fmt.Sprintf("@container='%s' and collection='%s' and isDeleted='false'",
-			cfg.ImagesContainerName, collection)
-		remaining, _ := store.FilterBlobsByTags(ctx, remainingQuery, cfg.ImagesContainerName)
-		collectionDeleted := len(remaining) == 0
-		if collectionDeleted {
-			slog.InfoContext(ctx, "all albums deleted, collection is now soft-deleted", "collection", collection)
-		}
-
-		if len(errors) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:           "album soft-delete completed with errors",
-				Errors:            errors,
-				Affected:          len(blobs),
-				CollectionDeleted: collectionDeleted,
-			})
-			return
+			items = append(items, jobs.Item{Name: blob.Name, Tags: deletedTags()})
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:           "album soft-deleted",
-			Affected:          len(blobs),
-			CollectionDeleted: collectionDeleted,
-		})
+		submitJob(ctx, w, cfg, jobSoftDeleteAlbum,
+			map[string]string{"collection": collection, "album": album},
+			items,
+			mutationResponse{Message: "album soft-delete started"})
 	}
 }
 
 // RestoreAlbumHandler handles PATCH /api/{collection}/{album}.
-// It sets isDeleted='false' on every blob in the album and re-assigns an albumImage.
+// It starts a job that sets isDeleted='false' on every blob in the album and
+// re-assigns an albumImage, and responds 202 with the job's ID.
 func RestoreAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.RestoreAlbum")
@@ -186,44 +143,29 @@ func RestoreAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc
 		}
 
 		slog.InfoContext(ctx, "restoring album", "collection", collection, "album", album, "blobCount", len(blobs))
+		auditChange(ctx, collection+"/"+album, map[string]string{"isDeleted": "true"}, map[string]string{"isDeleted": "false"})
 
-		var errors []string
-		albumImageAssigned := false
-		for _, blob := range blobs {
-			blob.Tags["isDeleted"] = "false"
+		items := make([]jobs.Item, 0, len(blobs))
+		for i, blob := range blobs {
+			tags := map[string]string{"isDeleted": "false"}
 			// Re-assign albumImage to the first blob.
-			if !albumImageAssigned {
-				blob.Tags["albumImage"] = "true"
-				albumImageAssigned = true
-			}
-
-			if err := store.SetBlobTags(ctx, blob.Name, cfg.ImagesContainerName, blob.Tags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", blob.Name, err))
+			if i == 0 {
+				tags["albumImage"] = "true"
 			}
+			items = append(items, jobs.Item{Name: blob.Name, Tags: tags})
 		}
 
-		if len(errors) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:  "album restore completed with errors",
-				Errors:   errors,
-				Affected: len(blobs),
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:  "album restored",
-			Affected: len(blobs),
-		})
+		submitJob(ctx, w, cfg, jobRestoreAlbum,
+			map[string]string{"collection": collection, "album": album},
+			items,
+			mutationResponse{Message: "album restore started"})
 	}
 }
 
 // RestoreCollectionHandler handles PATCH /api/{collection}.
-// It sets isDeleted='false' on every blob in the collection and re-assigns
-// collectionImage and albumImage tags.
+// It starts a job that sets isDeleted='false' on every blob in the collection
+// and re-assigns collectionImage and albumImage tags, and responds 202 with
+// the job's ID.
 func RestoreCollectionHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.RestoreCollection")
@@ -251,48 +193,42 @@ func RestoreCollectionHandler(store storage.BlobStore, cfg *Config) http.Handler
 		}
 
 		slog.InfoContext(ctx, "restoring collection", "collection", collection, "blobCount", len(blobs))
+		auditChange(ctx, collection, map[string]string{"isDeleted": "true"}, map[string]string{"isDeleted": "false"})
 
 		// Track which albums have had albumImage re-assigned.
 		albumImageAssigned := make(map[string]bool)
-		collectionImageAssigned := false
 
-		var errors []string
-		for _, blob := range blobs {
-			blob.Tags["isDeleted"] = "false"
+		items := make([]jobs.Item, 0, len(blobs))
+		for i, blob := range blobs {
+			tags := map[string]string{"isDeleted": "false"}
 
 			// Re-assign collectionImage to the first blob overall.
-			if !collectionImageAssigned {
-				blob.Tags["collectionImage"] = "true"
-				collectionImageAssigned = true
+			if i == 0 {
+				tags["collectionImage"] = "true"
 			}
 
 			// Re-assign albumImage to the first blob per album.
 			album := blob.Tags["album"]
 			if album != "" && !albumImageAssigned[album] {
-				blob.Tags["albumImage"] = "true"
+				tags["albumImage"] = "true"
 				albumImageAssigned[album] = true
 			}
-
-			if err := store.SetBlobTags(ctx, blob.Name, cfg.ImagesContainerName, blob.Tags); err != nil {
-				errors = append(errors, fmt.Sprintf("set tags %s: %v", blob.Name, err))
-			}
+			items = append(items, jobs.Item{Name: blob.Name, Tags: tags})
 		}
 
-		if len(errors) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPartialContent)
-			json.NewEncoder(w).Encode(mutationResponse{
-				Message:  "collection restore completed with errors",
-				Errors:   errors,
-				Affected: len(blobs),
-			})
-			return
-		}
+		submitJob(ctx, w, cfg, jobRestoreCollection,
+			map[string]string{"collection": collection},
+			items,
+			mutationResponse{Message: "collection restore started"})
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(mutationResponse{
-			Message:  "collection restored",
-			Affected: len(blobs),
-		})
+// deletedTags returns the tags that soft-delete a blob. A deleted blob is
+// never an album or collection image.
+func deletedTags() map[string]string {
+	return map[string]string{
+		"isDeleted":       "true",
+		"collectionImage": "false",
+		"albumImage":      "false",
 	}
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/exif"
+	"github.com/cbellee/photo-api/internal/models"
+)
+
+// Supported values for the ?sort= query parameter.
+const (
+	sortByDateTaken = "dateTaken"
+	sortByName      = "name"
+	sortByUploaded  = "uploaded"
+)
+
+// sortRequest holds the parsed ?sort= and ?order= query parameters. An empty
+// Field means the storage listing order is kept.
+type sortRequest struct {
+	Field string
+	Desc  bool
+}
+
+// parseSortRequest reads ?sort=dateTaken|name|uploaded and ?order=asc|desc.
+// The order defaults to ascending.
+func parseSortRequest(q url.Values) (sortRequest, error) {
+	var req sortRequest
+
+	switch field := q.Get("sort"); field {
+	case "", sortByDateTaken, sortByName, sortByUploaded:
+		req.Field = field
+	default:
+		return req, fmt.Errorf("sort must be one of %s, %s or %s", sortByDateTaken, sortByName, sortByUploaded)
+	}
+
+	switch order := q.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		req.Desc = true
+	default:
+		return req, fmt.Errorf("order must be asc or desc")
+	}
+
+	return req, nil
+}
+
+// sortBlobs orders blobs in place. Blobs without a value for the sort field
+// (e.g. photos uploaded before capture times were recorded) always sort
+// last, whatever the direction. Ties are broken by blob name.
+func sortBlobs(blobs []models.Blob, req sortRequest) {
+	if req.Field == "" {
+		return
+	}
+
+	var key func(b models.Blob) time.Time
+	switch req.Field {
+	case sortByDateTaken:
+		key = blobDateTaken
+	case sortByUploaded:
+		key = blobUploadedAt
+	}
+
+	slices.SortStableFunc(blobs, func(a, b models.Blob) int {
+		if key != nil {
+			ta, tb := key(a), key(b)
+			switch {
+			case ta.IsZero() && tb.IsZero():
+			case ta.IsZero():
+				return 1
+			case tb.IsZero():
+				return -1
+			default:
+				if c := ta.Compare(tb); c != 0 {
+					if req.Desc {
+						return -c
+					}
+					return c
+				}
+			}
+		}
+
+		c := cmp.Compare(a.Name, b.Name)
+		if req.Desc && key == nil {
+			return -c
+		}
+		return c
+	})
+}
+
+// blobDateTaken returns the capture time recorded at upload, preferring the
+// index tag and falling back to metadata. A zero time means unknown.
+func blobDateTaken(b models.Blob) time.Time {
+	v := b.Tags["dateTaken"]
+	if v == "" {
+		v = b.MetaData[models.CanonicalMetadataKey(exif.MetaDateTaken)]
+	}
+	t, _ := time.Parse(time.RFC3339, v)
+	return t
+}
+
+// blobUploadedAt returns the upload time recorded in metadata. A zero time
+// means unknown.
+func blobUploadedAt(b models.Blob) time.Time {
+	t, _ := time.Parse(time.RFC3339, b.MetaData[models.MetaUploadedAt])
+	return t
+}
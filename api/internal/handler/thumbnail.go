@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"strconv"
 
@@ -78,6 +79,7 @@ func ThumbnailCollectionHandler(store storage.BlobStore, cfg *Config) http.Handl
 				return
 			}
 
+			oldTags := maps.Clone(newTags)
 			newTags["collectionImage"] = "true"
 
 			if req.Orientation != nil {
@@ -89,6 +91,7 @@ func ThumbnailCollectionHandler(store storage.BlobStore, cfg *Config) http.Handl
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			auditChange(ctx, req.ImageName, oldTags, newTags)
 
 			slog.InfoContext(ctx, "collection thumbnail updated", "collection", collection, "newImage", req.ImageName)
 		} else if req.Orientation != nil {
@@ -100,12 +103,14 @@ func ThumbnailCollectionHandler(store storage.BlobStore, cfg *Config) http.Handl
 			}
 
 			img := currentImages[0]
+			oldTags := maps.Clone(img.Tags)
 			img.Tags["orientation"] = strconv.Itoa(*req.Orientation)
 			if err := store.SetBlobTags(ctx, img.Name, cfg.ImagesContainerName, img.Tags); err != nil {
 				slog.ErrorContext(ctx, "error rotating collection thumbnail", "blob", img.Name, "error", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			auditChange(ctx, img.Name, oldTags, img.Tags)
 
 			slog.InfoContext(ctx, "collection thumbnail rotated", "collection", collection, "orientation", *req.Orientation)
 		}
@@ -179,6 +184,7 @@ func ThumbnailAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFun
 				return
 			}
 
+			oldTags := maps.Clone(newTags)
 			newTags["albumImage"] = "true"
 
 			if req.Orientation != nil {
@@ -190,6 +196,7 @@ func ThumbnailAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFun
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			auditChange(ctx, req.ImageName, oldTags, newTags)
 
 			slog.InfoContext(ctx, "album thumbnail updated", "collection", collection, "album", album, "newImage", req.ImageName)
 		} else if req.Orientation != nil {
@@ -203,12 +210,14 @@ func ThumbnailAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFun
 			}
 
 			img := currentAlbumImages[0]
+			oldTags := maps.Clone(img.Tags)
 			img.Tags["orientation"] = strconv.Itoa(*req.Orientation)
 			if err := store.SetBlobTags(ctx, img.Name, cfg.ImagesContainerName, img.Tags); err != nil {
 				slog.ErrorContext(ctx, "error rotating album thumbnail", "blob", img.Name, "error", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			auditChange(ctx, img.Name, oldTags, img.Tags)
 
 			slog.InfoContext(ctx, "album thumbnail rotated", "collection", collection, "album", album, "orientation", *req.Orientation)
 		}
@@ -221,7 +230,9 @@ func ThumbnailAlbumHandler(store storage.BlobStore, cfg *Config) http.HandlerFun
 }
 
 // CollectionPhotosHandler handles GET /api/photos/{collection}.
-// It returns ALL photos in a collection (for the thumbnail picker UI).
+// It returns ALL photos in a collection (for the thumbnail picker UI), or a
+// single photoPage when ?limit= and/or ?cursor= is supplied. Results can be
+// ordered with ?sort= and ?order=.
 func CollectionPhotosHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := tracer.Start(r.Context(), "handler.CollectionPhotos")
@@ -236,19 +247,6 @@ func CollectionPhotosHandler(store storage.BlobStore, cfg *Config) http.HandlerF
 
 		query := fmt.Sprintf("@container='%s' and collection='%s' and isDeleted='false'",
 			cfg.ImagesContainerName, collection)
-		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
-		if err != nil {
-			slog.ErrorContext(ctx, "error querying blobs", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		if len(blobs) == 0 {
-			http.Error(w, "no photos found", http.StatusNotFound)
-			return
-		}
-
-		photos := BlobsToPhotos(blobs)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(photos)
+		servePhotoList(ctx, w, r, store, cfg, query, "no photos found")
 	}
 }
@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// trashItem is one entry of the trash listing: a soft-deleted photo with
+// when it was deleted and when the purge job will remove it. Photos deleted
+// before deletion times were recorded have neither until the next purge run
+// stamps them.
+type trashItem struct {
+	models.Photo
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+// SoftDeletePhotoHandler handles DELETE /api/{collection}/{album}/{name}.
+// It sets isDeleted='true' on a single photo and records when it was
+// deleted. If the photo was its album's or collection's image, another
+// photo takes over.
+func SoftDeletePhotoHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.SoftDeletePhoto")
+		defer span.End()
+
+		collection := r.PathValue("collection")
+		if err := validatePathParam("collection", collection); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		album := r.PathValue("album")
+		if err := validatePathParam("album", album); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.PathValue("name")
+		if err := validatePathParam("name", name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		blobName := fmt.Sprintf("%s/%s/%s", collection, album, name)
+		span.SetAttributes(attribute.String("blob.name", blobName))
+
+		_, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "photo not found or already deleted", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting photo metadata", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tags, err := store.GetBlobTags(ctx, blobName, cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting photo tags", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if tags["isDeleted"] == "true" {
+			http.Error(w, "photo not found or already deleted", http.StatusNotFound)
+			return
+		}
+
+		if err := setDeleted(ctx, store, cfg, blobName, deletedTags(), true); err != nil {
+			slog.ErrorContext(ctx, "error soft-deleting photo", "blob", blobName, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(ctx, "soft-deleted photo", "blob", blobName)
+		after := maps.Clone(tags)
+		maps.Copy(after, deletedTags())
+		auditChange(ctx, blobName, tags, after)
+
+		// Another photo takes over the covers this one held. Failures are
+		// logged; the album and collection handlers then pick a cover for
+		// display.
+		deleted := map[string]bool{blobName: true}
+		if tags["albumImage"] == "true" {
+			query := fmt.Sprintf("@container='%s' and collection='%s' and album='%s' and isDeleted='false'",
+				cfg.ImagesContainerName, collection, album)
+			if next := remainingPhoto(ctx, store, cfg, query, deleted); next != "" {
+				if err := retagBlob(ctx, store, cfg.ImagesContainerName, next, map[string]string{"albumImage": "true"}); err != nil {
+					slog.WarnContext(ctx, "error reassigning album image", "blob", next, "error", err)
+				}
+			}
+		}
+		if tags["collectionImage"] == "true" {
+			query := fmt.Sprintf("@container='%s' and collection='%s' and isDeleted='false'",
+				cfg.ImagesContainerName, collection)
+			if next := remainingPhoto(ctx, store, cfg, query, deleted); next != "" {
+				if err := retagBlob(ctx, store, cfg.ImagesContainerName, next, map[string]string{"collectionImage": "true"}); err != nil {
+					slog.WarnContext(ctx, "error reassigning collection image", "blob", next, "error", err)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mutationResponse{Message: "photo soft-deleted", Affected: 1})
+	}
+}
+
+// TrashHandler lists soft-deleted photos, most recently deleted first, with
+// when each was deleted and when it will be purged.
+//
+// GET /api/trash
+func TrashHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler.Trash")
+		defer span.End()
+
+		query := fmt.Sprintf("@container='%s' and isDeleted='true'", cfg.ImagesContainerName)
+		blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+		if err != nil {
+			slog.ErrorContext(ctx, "error querying deleted photos", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		photos := BlobsToPhotos(blobs, cfg)
+		items := make([]trashItem, 0, len(blobs))
+		for i, b := range blobs {
+			item := trashItem{Photo: photos[i]}
+			if deletedAt, ok := blobDeletedAt(b.MetaData); ok {
+				purgeAt := deletedAt.Add(cfg.TrashRetention)
+				item.DeletedAt, item.PurgeAt = &deletedAt, &purgeAt
+			}
+			items = append(items, item)
+		}
+		slices.SortStableFunc(items, func(a, b trashItem) int {
+			switch {
+			case a.DeletedAt == nil && b.DeletedAt == nil:
+				return cmp.Compare(a.Name, b.Name)
+			case a.DeletedAt == nil:
+				return 1
+			case b.DeletedAt == nil:
+				return -1
+			}
+			if c := b.DeletedAt.Compare(*a.DeletedAt); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Name, b.Name)
+		})
+		span.SetAttributes(attribute.Int("photos.deleted", len(items)))
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+// PurgeResult summarises a PurgeTrash run.
+type PurgeResult struct {
+	Scanned int // soft-deleted photos found
+	Purged  int // photos permanently deleted
+	Stamped int // photos given a deletion time, to be purged later
+	Failed  int // photos that could not be purged
+}
+
+// PurgeTrash permanently deletes the soft-deleted photos that were deleted
+// more than cfg.TrashRetention before now: their image, renditions, cached
+// variants, original upload and face records. Photos with no recorded deletion time,
+// deleted before it was recorded, are stamped with now so they are purged a
+// full retention period later. A photo that fails is logged and retried by
+// the next run; the error reports how many failed.
+func PurgeTrash(ctx context.Context, store storage.BlobStore, cfg *Config, now time.Time) (PurgeResult, error) {
+	var res PurgeResult
+	query := fmt.Sprintf("@container='%s' and isDeleted='true'", cfg.ImagesContainerName)
+	blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+	if err != nil {
+		return res, fmt.Errorf("querying deleted photos: %w", err)
+	}
+	res.Scanned = len(blobs)
+
+	for _, b := range blobs {
+		deletedAt, ok := blobDeletedAt(b.MetaData)
+		if !ok {
+			if err := stampDeletedAt(ctx, store, cfg, b.Name, now); err != nil {
+				slog.WarnContext(ctx, "error recording deletion time", "blob", b.Name, "error", err)
+				res.Failed++
+				continue
+			}
+			res.Stamped++
+			continue
+		}
+		if now.Sub(deletedAt) < cfg.TrashRetention {
+			continue
+		}
+		if err := purgePhoto(ctx, store, cfg, b.Name, b.MetaData); err != nil {
+			slog.ErrorContext(ctx, "error purging photo", "blob", b.Name, "error", err)
+			res.Failed++
+			continue
+		}
+		slog.InfoContext(ctx, "purged photo", "blob", b.Name, "deleted_at", deletedAt)
+		res.Purged++
+	}
+
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d deleted photos could not be purged", res.Failed, res.Scanned)
+	}
+	return res, nil
+}
+
+// purgePhoto permanently deletes the photo blobName, whose metadata is md.
+// The image goes last, so a purge interrupted part way finds the photo in
+// the trash again; anything already gone is skipped.
+func purgePhoto(ctx context.Context, store storage.BlobStore, cfg *Config, blobName string, md map[string]string) error {
+	if ref, ok := photoRef(blobName); ok && cfg.FaceStore != nil {
+		if err := cfg.FaceStore.DeleteFacesByPhoto(ctx, ref); err != nil {
+			return fmt.Errorf("delete faces %s: %w", blobName, err)
+		}
+	}
+	for rendition := range strings.SplitSeq(md["Renditions"], ",") {
+		if rendition == "" {
+			continue
+		}
+		if err := deleteBlob(ctx, store, cfg.RenditionsContainerName, rendition+"/"+blobName); err != nil {
+			return err
+		}
+	}
+	variants, err := store.ListBlobNames(ctx, blobName+"/", cfg.VariantsContainerName)
+	if err != nil {
+		return fmt.Errorf("list variants %s: %w", blobName, err)
+	}
+	for _, variant := range variants {
+		if err := deleteBlob(ctx, store, cfg.VariantsContainerName, variant); err != nil {
+			return err
+		}
+	}
+	container, original := originalLocation(cfg, blobName, md)
+	if err := deleteBlob(ctx, store, container, original); err != nil {
+		return err
+	}
+	return deleteBlob(ctx, store, cfg.ImagesContainerName, blobName)
+}
+
+// deleteBlob deletes a blob, treating one that is already gone as deleted.
+func deleteBlob(ctx context.Context, store storage.BlobStore, container, blobName string) error {
+	if err := store.DeleteBlob(ctx, blobName, container); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("delete %s/%s: %w", container, blobName, err)
+	}
+	return nil
+}
+
+// setDeleted sets tags on the photo blobName, keeping its other tags, and
+// records that it was soft-deleted now, or clears the record when it is
+// restored.
+func setDeleted(ctx context.Context, store storage.BlobStore, cfg *Config, blobName string, tags map[string]string, deleted bool) error {
+	if err := retagBlob(ctx, store, cfg.ImagesContainerName, blobName, tags); err != nil {
+		return err
+	}
+	md, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+	if err != nil {
+		return fmt.Errorf("get metadata %s: %w", blobName, err)
+	}
+	if md == nil {
+		md = map[string]string{}
+	}
+	if deleted {
+		md[models.MetaDeletedAt] = time.Now().UTC().Format(time.RFC3339)
+	} else if _, ok := md[models.MetaDeletedAt]; ok {
+		delete(md, models.MetaDeletedAt)
+	} else {
+		return nil
+	}
+	if err := store.SetBlobMetadata(ctx, blobName, cfg.ImagesContainerName, md); err != nil {
+		return fmt.Errorf("set metadata %s: %w", blobName, err)
+	}
+	return nil
+}
+
+// stampDeletedAt records t as the deletion time of the photo blobName,
+// unless it already has one.
+func stampDeletedAt(ctx context.Context, store storage.BlobStore, cfg *Config, blobName string, t time.Time) error {
+	md, err := store.GetBlobMetadata(ctx, blobName, cfg.ImagesContainerName)
+	if err != nil {
+		return fmt.Errorf("get metadata %s: %w", blobName, err)
+	}
+	if _, ok := blobDeletedAt(md); ok {
+		return nil
+	}
+	if md == nil {
+		md = map[string]string{}
+	}
+	md[models.MetaDeletedAt] = t.UTC().Format(time.RFC3339)
+	if err := store.SetBlobMetadata(ctx, blobName, cfg.ImagesContainerName, md); err != nil {
+		return fmt.Errorf("set metadata %s: %w", blobName, err)
+	}
+	return nil
+}
+
+// blobDeletedAt returns the deletion time recorded in a photo's metadata.
+func blobDeletedAt(md map[string]string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, md[models.MetaDeletedAt])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
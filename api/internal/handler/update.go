@@ -70,6 +70,14 @@ func UpdateHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 		// remove 'Url' tag from comparison
 		delete(currTags, "Url")
 
+		// contentHash is set by the server at upload; clients cannot change
+		// it and need not send it back.
+		if hash, ok := currTags["contentHash"]; ok {
+			newTags["contentHash"] = hash
+		} else {
+			delete(newTags, "contentHash")
+		}
+
 		if maps.Equal(currTags, newTags) {
 			slog.InfoContext(ctx, "tags not modified", "tags", currTags)
 			http.Error(w, "Tags not modified", http.StatusNotModified)
@@ -105,6 +113,7 @@ func UpdateHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		auditChange(ctx, blobName, currTags, newTags)
 
 		w.WriteHeader(http.StatusOK)
 	}
@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -17,6 +22,10 @@ import (
 	"github.com/cbellee/photo-api/internal/utils"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	// Register the WebP decoder so image.DecodeConfig accepts WebP uploads.
+	_ "golang.org/x/image/webp"
 )
 
 // allowedImageTypes is the set of MIME types accepted for photo uploads.
@@ -25,10 +34,12 @@ var allowedImageTypes = map[string]bool{
 	"image/png":  true,
 	"image/gif":  true,
 	"image/webp": true,
+	"image/heic": true,
+	"image/heif": true,
 }
 
-// UploadHandler handles multipart file uploads, extracts EXIF data and image
-// dimensions, and saves the blob to the uploads container.
+// UploadHandler handles multipart file uploads, extracts EXIF data, capture
+// time and image dimensions, and saves the blob to the uploads container.
 //
 // Memory optimisation: the multipart file is used directly as an io.ReadSeeker
 // so we never allocate a second in-memory copy of the file data. With a low
@@ -116,17 +127,6 @@ func UploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			"description", truncate(it.Description, 100),
 		)
 
-		// Validate the declared content type.
-		if !allowedImageTypes[it.Type] {
-			slog.WarnContext(ctx, "upload rejected: unsupported image type",
-				"type", it.Type,
-				"allowed_types", allowedImageTypes,
-			)
-			span.SetStatus(codes.Error, "unsupported image type")
-			http.Error(w, "Unsupported image type", http.StatusUnsupportedMediaType)
-			return
-		}
-
 		fh, ok := r.MultipartForm.File["photo"]
 		if !ok || len(fh) == 0 {
 			slog.WarnContext(ctx, "upload rejected: missing photo file",
@@ -137,37 +137,6 @@ func UploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 			return
 		}
 
-		fileNameWithPrefix := fmt.Sprintf("%s/%s/%s", it.Collection, it.Album, fh[0].Filename)
-		span.SetAttributes(
-			attribute.String("collection", it.Collection),
-			attribute.String("album", it.Album),
-			attribute.String("filename", fh[0].Filename),
-			attribute.Int64("file.size", fh[0].Size),
-			attribute.String("file.content_type", it.Type),
-		)
-
-		slog.InfoContext(ctx, "processing upload",
-			"filename", fh[0].Filename,
-			"blob_path", fileNameWithPrefix,
-			"file_size", fh[0].Size,
-			"declared_content_type", it.Type,
-			"file_header_content_type", fh[0].Header.Get("Content-Type"),
-		)
-
-		tags := make(map[string]string)
-		tags["name"] = fileNameWithPrefix
-		tags["description"] = it.Description
-		tags["collection"] = it.Collection
-		tags["album"] = it.Album
-		tags["isDeleted"] = strconv.FormatBool(it.IsDeleted)
-		tags["collectionImage"] = strconv.FormatBool(it.CollectionImage)
-		tags["albumImage"] = strconv.FormatBool(it.AlbumImage)
-
-		// strip invalid characters from tag values
-		for k, v := range tags {
-			tags[k] = utils.StripInvalidTagCharacters(v)
-		}
-
 		file, err := fh[0].Open()
 		if err != nil {
 			slog.ErrorContext(ctx, "error opening multipart file",
@@ -190,132 +159,352 @@ func UploadHandler(store storage.BlobStore, cfg *Config) http.HandlerFunc {
 
 		// multipart.File implements io.ReadSeeker so we can rewind between
 		// operations without ever copying the full payload into a []byte.
-
-		// 1. Decode image dimensions (reads only the header bytes).
-		decodeStart := time.Now()
-		img, imgFormat, err := image.DecodeConfig(file)
+		_, err = processUpload(ctx, store, cfg, it, fh[0].Filename, file, fh[0].Size, uploadStart)
 		if err != nil {
-			slog.ErrorContext(ctx, "error decoding image config",
-				"error", err,
-				"filename", fh[0].Filename,
-				"declared_type", it.Type,
-			)
-			span.SetStatus(codes.Error, "image decode failed")
-			span.RecordError(err)
-			http.Error(w, "Invalid image file", http.StatusBadRequest)
+			writeUploadError(w, err)
 			return
 		}
-		slog.DebugContext(ctx, "image config decoded",
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// writeUploadError responds to a failed processUpload: a duplicate is
+// reported as JSON naming the existing photo, any other uploadError with its
+// status and message, and anything else as a 500.
+func writeUploadError(w http.ResponseWriter, err error) {
+	var ue *uploadError
+	switch {
+	case errors.As(err, &ue) && ue.Existing != "":
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(ue.Status)
+		json.NewEncoder(w).Encode(duplicateUploadResponse{
+			Message:     ue.Message,
+			Existing:    ue.Existing,
+			ContentHash: ue.ContentHash,
+		})
+	case errors.As(err, &ue):
+		http.Error(w, ue.Message, ue.Status)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// uploadError is a per-file upload failure that is the client's to fix. It
+// carries the HTTP status to report; any other error from processUpload is
+// an internal failure.
+type uploadError struct {
+	Status  int
+	Message string
+	// Existing and ContentHash are set when the photo duplicates one
+	// already in the collection.
+	Existing    string
+	ContentHash string
+}
+
+func (e *uploadError) Error() string { return e.Message }
+
+// uploadTags returns the index tags a photo is uploaded with, before the
+// content hash and capture time are added from the file itself.
+func uploadTags(it models.ImageTags, blobPath string) map[string]string {
+	tags := make(map[string]string)
+	tags["name"] = blobPath
+	tags["description"] = it.Description
+	tags["collection"] = it.Collection
+	tags["album"] = it.Album
+	tags["isDeleted"] = strconv.FormatBool(it.IsDeleted)
+	tags["collectionImage"] = strconv.FormatBool(it.CollectionImage)
+	tags["albumImage"] = strconv.FormatBool(it.AlbumImage)
+
+	// strip invalid characters from tag values
+	for k, v := range tags {
+		tags[k] = utils.StripInvalidTagCharacters(v)
+	}
+	return tags
+}
+
+// processUpload validates one photo, extracts its EXIF data, capture time,
+// dimensions and content hash, and saves it to the uploads container as
+// <collection>/<album>/<filename>. It returns the blob path. Details are
+// recorded on the span in ctx.
+func processUpload(ctx context.Context, store storage.BlobStore, cfg *Config, it models.ImageTags, filename string, file io.ReadSeeker, size int64, uploadStart time.Time) (string, error) {
+	span := trace.SpanFromContext(ctx)
+
+	// Validate the declared content type.
+	if !allowedImageTypes[it.Type] {
+		slog.WarnContext(ctx, "upload rejected: unsupported image type",
+			"type", it.Type,
+			"allowed_types", allowedImageTypes,
+		)
+		span.SetStatus(codes.Error, "unsupported image type")
+		return "", &uploadError{Status: http.StatusUnsupportedMediaType, Message: "Unsupported image type"}
+	}
+
+	fileNameWithPrefix := fmt.Sprintf("%s/%s/%s", it.Collection, it.Album, filename)
+	span.SetAttributes(
+		attribute.String("collection", it.Collection),
+		attribute.String("album", it.Album),
+		attribute.String("filename", filename),
+		attribute.Int64("file.size", size),
+		attribute.String("file.content_type", it.Type),
+	)
+
+	slog.InfoContext(ctx, "processing upload",
+		"filename", filename,
+		"blob_path", fileNameWithPrefix,
+		"file_size", size,
+		"declared_content_type", it.Type,
+	)
+
+	tags := uploadTags(it, fileNameWithPrefix)
+
+	// 1. Check that the content is the declared type, by its leading bytes
+	// and then by the decoder that accepts it, and decode the dimensions
+	// (reads only the header bytes).
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		slog.ErrorContext(ctx, "error reading file header",
+			"error", err,
+			"filename", filename,
+		)
+		span.SetStatus(codes.Error, "read failed")
+		span.RecordError(err)
+		return "", err
+	}
+	if err := checkSniffedType(head[:n], it.Type); err != nil {
+		slog.WarnContext(ctx, "upload rejected: content does not match declared type",
+			"filename", filename,
+			"declared_type", it.Type,
+			"sniffed_type", http.DetectContentType(head[:n]),
+		)
+		span.SetStatus(codes.Error, "content type mismatch")
+		return "", err
+	}
+
+	decodeStart := time.Now()
+	img, imgFormat, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head[:n]), file))
+	if err != nil {
+		slog.ErrorContext(ctx, "error decoding image config",
+			"error", err,
+			"filename", filename,
+			"declared_type", it.Type,
+		)
+		span.SetStatus(codes.Error, "image decode failed")
+		span.RecordError(err)
+		return "", &uploadError{Status: http.StatusBadRequest, Message: "Invalid image file"}
+	}
+	slog.DebugContext(ctx, "image config decoded",
+		"width", img.Width,
+		"height", img.Height,
+		"format", imgFormat,
+		"elapsed_ms", time.Since(decodeStart).Milliseconds(),
+	)
+	if err := checkDecodedImage(imgFormat, img, it.Type, cfg.MaxUploadPixels); err != nil {
+		slog.WarnContext(ctx, "upload rejected: image does not match declared type or is too large",
+			"filename", filename,
+			"declared_type", it.Type,
+			"format", imgFormat,
 			"width", img.Width,
 			"height", img.Height,
-			"format", imgFormat,
-			"elapsed_ms", time.Since(decodeStart).Milliseconds(),
+			"max_pixels", cfg.MaxUploadPixels,
 		)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
 
-		// 2. Rewind and extract EXIF metadata.
-		if _, err := file.Seek(0, io.SeekStart); err != nil {
-			slog.ErrorContext(ctx, "error seeking file for exif",
-				"error", err,
-				"filename", fh[0].Filename,
-			)
-			span.SetStatus(codes.Error, "seek failed")
-			span.RecordError(err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	// 2. Rewind and extract EXIF metadata.
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		slog.ErrorContext(ctx, "error seeking file for exif",
+			"error", err,
+			"filename", filename,
+		)
+		span.SetStatus(codes.Error, "seek failed")
+		span.RecordError(err)
+		return "", err
+	}
 
-		exifStart := time.Now()
-		exifData := ""
-		exifData, err = exif.GetExifJSON(file)
-		if err != nil {
-			slog.WarnContext(ctx, "exif extraction failed (non-fatal)",
-				"error", err,
-				"filename", fh[0].Filename,
-			)
-			span.AddEvent("exif_extraction_failed")
-			// EXIF errors are non-fatal — continue without EXIF data
-		} else {
-			slog.DebugContext(ctx, "exif data extracted",
-				"exif_length", len(exifData),
-				"elapsed_ms", time.Since(exifStart).Milliseconds(),
-			)
-		}
+	// The content hash is needed for the contentHash tag and the
+	// duplicate check before the blob is written, so it is computed
+	// here: the EXIF reader is teed into the hash and the rest of the
+	// file drained into it, reading the payload once.
+	hasher := sha256.New()
+	exifStart := time.Now()
+	exifData, err := exif.Extract(io.TeeReader(file, hasher))
+	if err != nil {
+		slog.WarnContext(ctx, "exif extraction failed (non-fatal)",
+			"error", err,
+			"filename", filename,
+		)
+		span.AddEvent("exif_extraction_failed")
+		// EXIF errors are non-fatal — continue without EXIF data
+	} else {
+		slog.DebugContext(ctx, "exif data extracted",
+			"make", exifData.Make,
+			"model", exifData.Model,
+			"elapsed_ms", time.Since(exifStart).Milliseconds(),
+		)
+	}
 
-		md := make(map[string]string)
-		md["height"] = fmt.Sprint(img.Height)
-		md["width"] = fmt.Sprint(img.Width)
-		md["size"] = strconv.Itoa(int(fh[0].Size))
+	if _, err := io.Copy(hasher, file); err != nil {
+		slog.ErrorContext(ctx, "error hashing file",
+			"error", err,
+			"filename", filename,
+		)
+		span.SetStatus(codes.Error, "hash failed")
+		span.RecordError(err)
+		return "", err
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	tags["contentHash"] = contentHash
+	span.SetAttributes(attribute.String("file.sha256", contentHash))
 
-		if exifData != "" {
-			md["exifData"] = exifData
+	if existing := findDuplicate(ctx, store, cfg, tags["collection"], contentHash, fileNameWithPrefix); existing != "" {
+		slog.WarnContext(ctx, "upload rejected: duplicate content",
+			"blob_path", fileNameWithPrefix,
+			"existing", existing,
+			"content_hash", contentHash,
+		)
+		span.SetStatus(codes.Error, "duplicate upload")
+		return "", &uploadError{
+			Status:      http.StatusConflict,
+			Message:     "photo already exists in this collection",
+			Existing:    existing,
+			ContentHash: contentHash,
 		}
+	}
 
-		// 3. Rewind and stream to blob storage — no second buffer needed.
-		if _, err := file.Seek(0, io.SeekStart); err != nil {
-			slog.ErrorContext(ctx, "error seeking file for blob upload",
-				"error", err,
-				"filename", fh[0].Filename,
-			)
-			span.SetStatus(codes.Error, "seek failed")
-			span.RecordError(err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	// EXIF fields are stored as individual metadata keys; the capture
+	// time is also indexed as a tag so listings can be sorted by it.
+	md := exif.ToMetadata(exifData)
+	md["height"] = fmt.Sprint(img.Height)
+	md["width"] = fmt.Sprint(img.Width)
+	md["size"] = strconv.Itoa(int(size))
+	md[models.MetaUploadedAt] = uploadStart.UTC().Format(time.RFC3339)
+	md[models.MetaProcessingStatus] = models.ProcessingPending
+	md[models.MetaProcessingUpdatedAt] = md[models.MetaUploadedAt]
+
+	if v, ok := md[exif.MetaDateTaken]; ok {
+		tags["dateTaken"] = v
+	}
+
+	// 3. Rewind and stream to blob storage — no second buffer needed.
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		slog.ErrorContext(ctx, "error seeking file for blob upload",
+			"error", err,
+			"filename", filename,
+		)
+		span.SetStatus(codes.Error, "seek failed")
+		span.RecordError(err)
+		return "", err
+	}
 
-		slog.InfoContext(ctx, "saving blob to storage",
+	slog.InfoContext(ctx, "saving blob to storage",
+		"blob_path", fileNameWithPrefix,
+		"container", cfg.UploadsContainerName,
+		"file_size", size,
+		"content_type", it.Type,
+		"num_tags", len(tags),
+		"num_metadata", len(md),
+	)
+
+	saveStart := time.Now()
+	err = store.SaveBlob(
+		ctx,
+		file,
+		size,
+		fileNameWithPrefix,
+		cfg.UploadsContainerName,
+		tags,
+		md,
+		it.Type,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "error saving blob to storage",
+			"error", err,
 			"blob_path", fileNameWithPrefix,
 			"container", cfg.UploadsContainerName,
-			"file_size", fh[0].Size,
-			"content_type", it.Type,
-			"num_tags", len(tags),
-			"num_metadata", len(md),
+			"file_size", size,
+			"elapsed_ms", time.Since(saveStart).Milliseconds(),
 		)
+		span.SetStatus(codes.Error, "blob save failed")
+		span.RecordError(err)
+		return "", err
+	}
 
-		saveStart := time.Now()
-		err = store.SaveBlob(
-			ctx,
-			file,
-			fh[0].Size,
-			fileNameWithPrefix,
-			cfg.UploadsContainerName,
-			tags,
-			md,
-			it.Type,
-		)
-		if err != nil {
-			slog.ErrorContext(ctx, "error saving blob to storage",
-				"error", err,
-				"blob_path", fileNameWithPrefix,
-				"container", cfg.UploadsContainerName,
-				"file_size", fh[0].Size,
-				"elapsed_ms", time.Since(saveStart).Milliseconds(),
-			)
-			span.SetStatus(codes.Error, "blob save failed")
-			span.RecordError(err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	totalElapsed := time.Since(uploadStart)
+	slog.InfoContext(ctx, "upload completed successfully",
+		"blob_path", fileNameWithPrefix,
+		"file_size", size,
+		"width", img.Width,
+		"height", img.Height,
+		"has_exif", exifData != nil,
+		"save_elapsed_ms", time.Since(saveStart).Milliseconds(),
+		"total_elapsed_ms", totalElapsed.Milliseconds(),
+	)
+	span.SetAttributes(
+		attribute.Int64("upload.total_ms", totalElapsed.Milliseconds()),
+		attribute.Int64("upload.save_ms", time.Since(saveStart).Milliseconds()),
+		attribute.Int("image.width", img.Width),
+		attribute.Int("image.height", img.Height),
+		attribute.Bool("image.has_exif", exifData != nil),
+	)
+
+	auditChange(ctx, fileNameWithPrefix, nil, tags)
+
+	return fileNameWithPrefix, nil
+}
 
-		totalElapsed := time.Since(uploadStart)
-		slog.InfoContext(ctx, "upload completed successfully",
-			"blob_path", fileNameWithPrefix,
-			"file_size", fh[0].Size,
-			"width", img.Width,
-			"height", img.Height,
-			"has_exif", exifData != "",
-			"save_elapsed_ms", time.Since(saveStart).Milliseconds(),
-			"total_elapsed_ms", totalElapsed.Milliseconds(),
-		)
-		span.SetAttributes(
-			attribute.Int64("upload.total_ms", totalElapsed.Milliseconds()),
-			attribute.Int64("upload.save_ms", time.Since(saveStart).Milliseconds()),
-			attribute.Int("image.width", img.Width),
-			attribute.Int("image.height", img.Height),
-			attribute.Bool("image.has_exif", exifData != ""),
-		)
+// duplicateUploadResponse is the 409 body returned when an upload's content
+// already exists in the target collection.
+type duplicateUploadResponse struct {
+	Message     string `json:"message"`
+	Existing    string `json:"existing"`
+	ContentHash string `json:"contentHash"`
+}
 
-		w.WriteHeader(http.StatusCreated)
+// findDuplicate returns the name of a non-deleted photo in collection whose
+// contentHash tag matches hash, ignoring blobName itself so a photo can be
+// re-uploaded in place. Photos are matched in the images container, which
+// carries the tags the resize worker copies from the upload, and then in the
+// uploads container, so a copy sent before the first has been resized is
+// caught too. Uploads are kept after resizing, so an upload only counts while
+// it has no resized image; otherwise the images lookup has already decided.
+// Lookup errors are logged and treated as no match; the duplicates report
+// still finds anything that slips through.
+func findDuplicate(ctx context.Context, store storage.BlobStore, cfg *Config, collection, hash, blobName string) string {
+	query := fmt.Sprintf("@container='%s' AND collection='%s' AND contentHash='%s' AND isDeleted='false'",
+		cfg.ImagesContainerName, collection, hash)
+	blobs, err := store.FilterBlobsByTags(ctx, query, cfg.ImagesContainerName)
+	if err != nil {
+		slog.WarnContext(ctx, "error checking for duplicate upload", "error", err)
+		return ""
+	}
+	for _, b := range blobs {
+		if b.Name != blobName {
+			return b.Name
+		}
+	}
+
+	query = fmt.Sprintf("@container='%s' AND collection='%s' AND contentHash='%s' AND isDeleted='false'",
+		cfg.UploadsContainerName, collection, hash)
+	blobs, err = store.FilterBlobsByTags(ctx, query, cfg.UploadsContainerName)
+	if err != nil {
+		slog.WarnContext(ctx, "error checking for duplicate upload", "error", err)
+		return ""
+	}
+	for _, b := range blobs {
+		if b.Name == blobName {
+			continue
+		}
+		_, err := store.GetBlobProperties(ctx, b.Name, cfg.ImagesContainerName)
+		if errors.Is(err, storage.ErrNotFound) {
+			return b.Name
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "error checking for duplicate upload", "blob", b.Name, "error", err)
+		}
 	}
+	return ""
 }
 
 // mapKeys returns the keys of a map as a slice (for logging available form fields).
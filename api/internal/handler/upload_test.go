@@ -3,15 +3,21 @@ package handler
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,6 +33,13 @@ import (
 // createMultipartBody builds a multipart/form-data body with a metadata JSON field
 // and a "photo" file field containing a valid JPEG.
 func createMultipartBody(t *testing.T, metadata models.ImageTags, imageWidth, imageHeight int) (*bytes.Buffer, string) {
+	t.Helper()
+	return createMultipartBodyWithFile(t, metadata, "test-photo.jpg", makeJPEG(t, imageWidth, imageHeight))
+}
+
+// createMultipartBodyWithFile builds a multipart/form-data body with a metadata
+// JSON field and a "photo" file field containing the given bytes.
+func createMultipartBodyWithFile(t *testing.T, metadata models.ImageTags, filename string, data []byte) (*bytes.Buffer, string) {
 	t.Helper()
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -36,20 +49,73 @@ func createMultipartBody(t *testing.T, metadata models.ImageTags, imageWidth, im
 	_ = writer.WriteField("metadata", string(mdJSON))
 
 	// photo file
-	part, err := writer.CreateFormFile("photo", "test-photo.jpg")
+	part, err := writer.CreateFormFile("photo", filename)
+	require.NoError(t, err)
+	_, err = part.Write(data)
 	require.NoError(t, err)
 
-	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
-	for x := 0; x < imageWidth; x++ {
-		for y := 0; y < imageHeight; y++ {
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+// makeJPEG encodes a solid red JPEG of the given size.
+func makeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
 			img.Set(x, y, color.RGBA{255, 0, 0, 255})
 		}
 	}
-	err = jpeg.Encode(part, img, nil)
-	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
 
-	writer.Close()
-	return body, writer.FormDataContentType()
+// withExifDate inserts an EXIF APP1 segment carrying DateTimeOriginal and
+// OffsetTimeOriginal directly after the SOI marker of a JPEG.
+func withExifDate(t *testing.T, jpegData []byte, dateTime, offset string) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+
+	// Layout: header(8) | IFD0 with one pointer entry(18) | EXIF IFD with two
+	// ASCII entries(30) | string data.
+	const exifIFDOffset = 8 + 18
+	dataOffset := uint32(exifIFDOffset + 30)
+
+	var tiff bytes.Buffer
+	tiff.Write([]byte{'I', 'I'})
+	binary.Write(&tiff, le, uint16(0x002A))
+	binary.Write(&tiff, le, uint32(8))
+
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, uint16(0x8769)) // ExifIFDPointer
+	binary.Write(&tiff, le, uint16(4))
+	binary.Write(&tiff, le, uint32(1))
+	binary.Write(&tiff, le, uint32(exifIFDOffset))
+	binary.Write(&tiff, le, uint32(0))
+
+	binary.Write(&tiff, le, uint16(2))
+	binary.Write(&tiff, le, uint16(0x9003)) // DateTimeOriginal
+	binary.Write(&tiff, le, uint16(2))
+	binary.Write(&tiff, le, uint32(len(dateTime)+1))
+	binary.Write(&tiff, le, dataOffset)
+	binary.Write(&tiff, le, uint16(0x9011)) // OffsetTimeOriginal
+	binary.Write(&tiff, le, uint16(2))
+	binary.Write(&tiff, le, uint32(len(offset)+1))
+	binary.Write(&tiff, le, dataOffset+uint32(len(dateTime)+1))
+	binary.Write(&tiff, le, uint32(0))
+
+	tiff.WriteString(dateTime + "\x00" + offset + "\x00")
+
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(tiff.Len()+6+2))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(jpegData[2:])
+	return out.Bytes()
 }
 
 func TestUploadHandler_Success(t *testing.T) {
@@ -97,6 +163,89 @@ func TestUploadHandler_Success(t *testing.T) {
 	assert.Equal(t, "200", savedMeta["height"])
 }
 
+func TestUploadHandler_RecordsDateTakenAndUploadTime(t *testing.T) {
+	var savedTags, savedMeta map[string]string
+	mock := &storage.MockBlobStore{
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			savedTags = tags
+			savedMeta = metadata
+			return nil
+		},
+	}
+
+	metadata := models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}
+	data := withExifDate(t, makeJPEG(t, 40, 30), "2024:06:01 14:03:22", "+10:00")
+	body, contentType := createMultipartBodyWithFile(t, metadata, "dated.jpg", data)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	before := time.Now().UTC().Truncate(time.Second)
+	UploadHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2024-06-01T14:03:22+10:00", savedTags["dateTaken"])
+	assert.Equal(t, "2024-06-01T14:03:22+10:00", savedMeta["dateTaken"])
+	assert.NotContains(t, savedMeta, "exifData", "raw goexif JSON is no longer stored")
+
+	uploadedAt, err := time.Parse(time.RFC3339, savedMeta[models.MetaUploadedAt])
+	require.NoError(t, err)
+	assert.False(t, uploadedAt.Before(before))
+
+	// The resize worker takes the upload from here.
+	assert.Equal(t, models.ProcessingPending, savedMeta[models.MetaProcessingStatus])
+	assert.Equal(t, savedMeta[models.MetaUploadedAt], savedMeta[models.MetaProcessingUpdatedAt])
+}
+
+func TestUploadHandler_NoExifDate_OmitsDateTaken(t *testing.T) {
+	var savedTags map[string]string
+	mock := &storage.MockBlobStore{
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			savedTags = tags
+			return nil
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 10, 10)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	UploadHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, savedTags, "dateTaken")
+}
+
+func TestUploadHandler_HEIC(t *testing.T) {
+	// 512x512 HEIC sample from the github.com/gen2brain/heic test suite.
+	data, err := os.ReadFile("../../testdata/sample.heic")
+	require.NoError(t, err)
+
+	var savedMeta map[string]string
+	var savedType string
+	mock := &storage.MockBlobStore{
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			saved, _ := io.ReadAll(reader)
+			assert.Equal(t, data, saved, "the original HEIC is stored unchanged")
+			savedMeta = metadata
+			savedType = contentType
+			return nil
+		},
+	}
+
+	metadata := models.ImageTags{Collection: "phone", Album: "camera-roll", Type: "image/heic"}
+	body, contentType := createMultipartBodyWithFile(t, metadata, "IMG_0001.HEIC", data)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	UploadHandler(mock, testConfig()).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "image/heic", savedType)
+	assert.Equal(t, "512", savedMeta["width"])
+	assert.Equal(t, "512", savedMeta["height"])
+}
+
 func TestUploadHandler_NilBody_Returns400(t *testing.T) {
 	cfg := testConfig()
 	mock := &storage.MockBlobStore{}
@@ -197,6 +346,58 @@ func TestUploadHandler_InvalidImage_Returns400(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestUploadHandler_ContentMustMatchDeclaredType(t *testing.T) {
+	heic, err := os.ReadFile("../../testdata/sample.heic")
+	require.NoError(t, err)
+	var pngData bytes.Buffer
+	require.NoError(t, png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+	tests := []struct {
+		name     string
+		declared string
+		data     []byte
+		want     int
+		message  string
+	}{
+		{"png declared as jpeg", "image/jpeg", pngData.Bytes(), http.StatusUnsupportedMediaType, "file content is image/png but was declared as image/jpeg"},
+		{"jpeg declared as webp", "image/webp", makeJPEG(t, 8, 8), http.StatusUnsupportedMediaType, "file content is image/jpeg"},
+		{"heic declared as jpeg", "image/jpeg", heic, http.StatusUnsupportedMediaType, "file is a heic image but was declared as image/jpeg"},
+		{"heic declared as heif", "image/heif", heic, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := acceptSaves()
+			body, contentType := createMultipartBodyWithFile(t, models.ImageTags{Collection: "c", Album: "a", Type: tt.declared}, "photo", tt.data)
+			req := httptest.NewRequest("POST", "/api/upload", body)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			UploadHandler(mock, testConfig()).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Contains(t, w.Body.String(), tt.message)
+			if tt.want != http.StatusCreated {
+				assert.Empty(t, mock.SaveBlobCalls)
+			}
+		})
+	}
+}
+
+func TestUploadHandler_TooManyPixels_Returns413(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxUploadPixels = 2_000_000
+	mock := acceptSaves()
+
+	body, contentType := createMultipartBodyWithFile(t, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"}, "big.jpg", makeJPEG(t, 2000, 1001))
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "image is 2000x1001 pixels, more than the 2 megapixel limit")
+	assert.Empty(t, mock.SaveBlobCalls)
+}
+
 func TestUploadHandler_SaveBlobError_Returns500(t *testing.T) {
 	cfg := testConfig()
 	mock := &storage.MockBlobStore{
@@ -271,6 +472,136 @@ func TestUploadHandler_TagStripping(t *testing.T) {
 	assert.NotContains(t, savedTags["description"], "!")
 }
 
+func TestUploadHandler_SetsContentHash(t *testing.T) {
+	cfg := testConfig()
+	var savedData []byte
+	var savedTags map[string]string
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			savedData, _ = io.ReadAll(reader)
+			savedTags = tags
+			return nil
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 30, 20)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	sum := sha256.Sum256(savedData)
+	assert.Equal(t, hex.EncodeToString(sum[:]), savedTags["contentHash"])
+	require.Len(t, mock.FilterBlobsByTagsCalls, 2)
+	assert.Equal(t, "@container='images' AND collection='nature' AND contentHash='"+savedTags["contentHash"]+"' AND isDeleted='false'", mock.FilterBlobsByTagsCalls[0].Query)
+	assert.Equal(t, "@container='uploads' AND collection='nature' AND contentHash='"+savedTags["contentHash"]+"' AND isDeleted='false'", mock.FilterBlobsByTagsCalls[1].Query)
+}
+
+func TestUploadHandler_DuplicateInCollection_Returns409(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{{Name: "nature/forest/original.jpg"}}, nil
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 30, 20)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, mock.SaveBlobCalls)
+	var resp duplicateUploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "nature/forest/original.jpg", resp.Existing)
+	assert.Len(t, resp.ContentHash, 64)
+}
+
+func TestUploadHandler_DuplicateAwaitingResize_Returns409(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			if containerName == "uploads" {
+				return []models.Blob{{Name: "nature/forest/resized.jpg"}, {Name: "nature/forest/pending.jpg"}}, nil
+			}
+			return nil, nil
+		},
+		GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+			assert.Equal(t, "images", containerName)
+			if blobName == "nature/forest/resized.jpg" {
+				// Already resized, and trashed since, so the images lookup skipped it.
+				return storage.BlobProperties{}, nil
+			}
+			return storage.BlobProperties{}, storage.ErrNotFound
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 30, 20)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, mock.SaveBlobCalls)
+	var resp duplicateUploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "nature/forest/pending.jpg", resp.Existing)
+}
+
+func TestUploadHandler_ReuploadSameName_NotDuplicate(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return []models.Blob{{Name: "nature/sunset/test-photo.jpg"}}, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			return nil
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 30, 20)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, mock.SaveBlobCalls, 1)
+}
+
+func TestUploadHandler_DuplicateCheckError_StillSaves(t *testing.T) {
+	cfg := testConfig()
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, fmt.Errorf("query failed")
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			return nil
+		},
+	}
+
+	body, contentType := createMultipartBody(t, models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}, 30, 20)
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	UploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, mock.SaveBlobCalls, 1)
+}
+
 // ── AlbumHandler edge cases ─────────────────────────────────────────
 
 func TestAlbumHandler_StorageError_Returns500(t *testing.T) {
@@ -610,3 +941,680 @@ func TestRequireRole_ExpiredToken_Returns401(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 	assert.False(t, called)
 }
+
+// ── BatchUploadHandler tests ────────────────────────────────────────
+
+type batchFile struct {
+	name string
+	data []byte
+}
+
+// createBatchBody builds a batch upload body: a metadata array followed by
+// one photo part per file.
+func createBatchBody(t *testing.T, metadata []models.ImageTags, files []batchFile) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	mdJSON, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("metadata", string(mdJSON)))
+
+	for _, f := range files {
+		part, err := writer.CreateFormFile("photo", f.name)
+		require.NoError(t, err)
+		_, err = part.Write(f.data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writer.Close())
+	return body, writer.FormDataContentType()
+}
+
+func serveBatch(t *testing.T, mock *storage.MockBlobStore, cfg *Config, body io.Reader, contentType string) (*httptest.ResponseRecorder, batchUploadResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/upload/batch", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	BatchUploadHandler(mock, cfg).ServeHTTP(w, req)
+
+	var resp batchUploadResponse
+	if w.Header().Get("Content-Type") == "application/json" {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w, resp
+}
+
+func acceptSaves() *storage.MockBlobStore {
+	return &storage.MockBlobStore{
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			return nil
+		},
+	}
+}
+
+func TestBatchUploadHandler_AllFilesStored(t *testing.T) {
+	mock := acceptSaves()
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg", Description: "first"},
+			{Collection: "nature", Album: "forest", Type: "image/jpeg", Description: "second"},
+		},
+		[]batchFile{{"a.jpg", makeJPEG(t, 20, 10)}, {"b.jpg", makeJPEG(t, 30, 40)}},
+	)
+
+	w, resp := serveBatch(t, mock, testConfig(), body, contentType)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 2, resp.Uploaded)
+	assert.Equal(t, []uploadResult{
+		{Filename: "a.jpg", Status: http.StatusCreated, BlobPath: "nature/sunset/a.jpg"},
+		{Filename: "b.jpg", Status: http.StatusCreated, BlobPath: "nature/forest/b.jpg"},
+	}, resp.Results)
+	require.Len(t, mock.SaveBlobCalls, 2)
+	assert.Equal(t, "uploads", mock.SaveBlobCalls[0].ContainerName)
+	assert.Equal(t, "first", mock.SaveBlobCalls[0].Tags["description"])
+	assert.Equal(t, "30", mock.SaveBlobCalls[1].Metadata["width"])
+	assert.Len(t, mock.SaveBlobCalls[1].Tags["contentHash"], 64)
+}
+
+func TestBatchUploadHandler_OutlastsServerTimeouts(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			time.Sleep(60 * time.Millisecond)
+			return nil
+		},
+	}
+	it := models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg"}
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{it, it, it},
+		[]batchFile{{"a.jpg", makeJPEG(t, 10, 10)}, {"b.jpg", makeJPEG(t, 10, 10)}, {"c.jpg", makeJPEG(t, 10, 10)}},
+	)
+
+	// The batch takes longer to store than the server's timeouts.
+	srv := httptest.NewUnstartedServer(BatchUploadHandler(mock, testConfig()))
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, contentType, body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var got batchUploadResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, 3, got.Uploaded)
+}
+
+func TestBatchUploadHandler_PartialFailureContinues(t *testing.T) {
+	mock := acceptSaves()
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg"},
+			{Collection: "nature", Album: "sunset", Type: "application/pdf"},
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg"},
+		},
+		[]batchFile{
+			{"broken.jpg", []byte("not an image")},
+			{"doc.pdf", []byte("%PDF-1.4")},
+			{"good.jpg", makeJPEG(t, 10, 10)},
+			{"extra.jpg", makeJPEG(t, 10, 10)},
+		},
+	)
+
+	w, resp := serveBatch(t, mock, testConfig(), body, contentType)
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "batch upload completed with errors", resp.Message)
+	assert.Equal(t, 1, resp.Uploaded)
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, uploadResult{Filename: "broken.jpg", Status: http.StatusBadRequest, Error: "Invalid image file"}, resp.Results[0])
+	assert.Equal(t, uploadResult{Filename: "doc.pdf", Status: http.StatusUnsupportedMediaType, Error: "Unsupported image type"}, resp.Results[1])
+	assert.Equal(t, uploadResult{Filename: "good.jpg", Status: http.StatusCreated, BlobPath: "nature/sunset/good.jpg"}, resp.Results[2])
+	assert.Equal(t, http.StatusBadRequest, resp.Results[3].Status)
+	assert.Len(t, mock.SaveBlobCalls, 1)
+}
+
+func TestBatchUploadHandler_SaveErrorAndDuplicateReported(t *testing.T) {
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			if strings.Contains(query, "collection='trips'") {
+				return []models.Blob{{Name: "trips/rome/first.jpg"}}, nil
+			}
+			return nil, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			return fmt.Errorf("storage failure")
+		},
+	}
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{
+			{Collection: "trips", Album: "rome", Type: "image/jpeg"},
+			{Collection: "nature", Album: "sunset", Type: "image/jpeg"},
+		},
+		[]batchFile{{"copy.jpg", makeJPEG(t, 10, 10)}, {"new.jpg", makeJPEG(t, 12, 12)}},
+	)
+
+	w, resp := serveBatch(t, mock, testConfig(), body, contentType)
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, 0, resp.Uploaded)
+	assert.Equal(t, []uploadResult{
+		{Filename: "copy.jpg", Status: http.StatusConflict, Error: "photo already exists in this collection", Existing: "trips/rome/first.jpg"},
+		{Filename: "new.jpg", Status: http.StatusInternalServerError, Error: "Internal Server Error"},
+	}, resp.Results)
+}
+
+func TestBatchUploadHandler_FileTooLarge_Returns413Result(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemoryLimitMb = 1
+	mock := acceptSaves()
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{{Collection: "c", Album: "a", Type: "image/jpeg"}, {Collection: "c", Album: "a", Type: "image/jpeg"}},
+		[]batchFile{{"huge.jpg", make([]byte, 1<<20+1)}, {"small.jpg", makeJPEG(t, 10, 10)}},
+	)
+
+	w, resp := serveBatch(t, mock, cfg, body, contentType)
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Results[0].Status)
+	assert.Equal(t, http.StatusCreated, resp.Results[1].Status)
+}
+
+func TestBatchUploadHandler_MissingPhotos_Returns206(t *testing.T) {
+	body, contentType := createBatchBody(t,
+		[]models.ImageTags{{Collection: "c", Album: "a", Type: "image/jpeg"}, {Collection: "c", Album: "a", Type: "image/jpeg"}},
+		[]batchFile{{"only.jpg", makeJPEG(t, 10, 10)}},
+	)
+
+	w, resp := serveBatch(t, acceptSaves(), testConfig(), body, contentType)
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, 1, resp.Uploaded)
+	assert.Len(t, resp.Results, 1)
+}
+
+func TestBatchUploadHandler_MetadataNotFirst_Returns400(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("photo", "a.jpg")
+	require.NoError(t, err)
+	_, _ = part.Write(makeJPEG(t, 10, 10))
+	require.NoError(t, writer.Close())
+
+	w, _ := serveBatch(t, acceptSaves(), testConfig(), body, writer.FormDataContentType())
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBatchUploadHandler_InvalidMetadata_Returns400(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("metadata", `{"collection":"not-an-array"}`))
+	require.NoError(t, writer.Close())
+
+	w, _ := serveBatch(t, acceptSaves(), testConfig(), body, writer.FormDataContentType())
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBatchUploadHandler_NotMultipart_Returns400(t *testing.T) {
+	w, _ := serveBatch(t, acceptSaves(), testConfig(), strings.NewReader("{}"), "application/json")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// ── Resumable upload tests ──────────────────────────────────────────
+
+// sessionStore returns a mock whose upload sessions container is held in
+// memory, with staged blocks committed by concatenation and conditional
+// saves checked against ETags as in Azure.
+func sessionStore() (*storage.MockBlobStore, map[string][]byte) {
+	blobs := map[string][]byte{}
+	blocks := map[string][]byte{}
+	etags := map[string]string{}
+	version := 0
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			return nil, nil
+		},
+		SaveBlobFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+			if containerName == "upload-sessions" {
+				data, _ := io.ReadAll(reader)
+				blobs[blobName] = data
+			}
+			return nil
+		},
+		SaveBlobIfMatchFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error) {
+			if _, ok := blobs[blobName]; ok && etags[blobName] != etag || !ok && etag != "" {
+				return "", fmt.Errorf("%w: %s", storage.ErrConditionNotMet, blobName)
+			}
+			data, _ := io.ReadAll(reader)
+			blobs[blobName] = data
+			version++
+			etags[blobName] = fmt.Sprintf(`"%d"`, version)
+			return etags[blobName], nil
+		},
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			data, ok := blobs[blobName]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, blobName)
+			}
+			return data, nil
+		},
+		OpenBlobFunc: func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, storage.BlobProperties, error) {
+			data, ok := blobs[blobName]
+			if !ok {
+				return nil, storage.BlobProperties{}, fmt.Errorf("%w: %s", storage.ErrNotFound, blobName)
+			}
+			return io.NopCloser(bytes.NewReader(data[rangeStart:])), storage.BlobProperties{Size: int64(len(data)), ETag: etags[blobName]}, nil
+		},
+		GetBlobPropertiesFunc: func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+			data, ok := blobs[blobName]
+			if !ok {
+				return storage.BlobProperties{}, fmt.Errorf("%w: %s", storage.ErrNotFound, blobName)
+			}
+			return storage.BlobProperties{ContentType: "image/jpeg", Size: int64(len(data))}, nil
+		},
+		StageBlockFunc: func(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error {
+			data, _ := io.ReadAll(reader)
+			blocks[blobName+"#"+blockID] = data
+			return nil
+		},
+		CommitBlockListFunc: func(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error {
+			var data []byte
+			for _, id := range blockIDs {
+				block, ok := blocks[blobName+"#"+id]
+				if !ok {
+					return fmt.Errorf("unknown block %s", id)
+				}
+				data = append(data, block...)
+			}
+			blobs[blobName] = data
+			return nil
+		},
+		DeleteBlobFunc: func(ctx context.Context, blobName string, containerName string) error {
+			delete(blobs, blobName)
+			delete(etags, blobName)
+			return nil
+		},
+	}
+	return mock, blobs
+}
+
+// serveUploads routes requests to the resumable upload handlers as main does.
+func serveUploads(mock *storage.MockBlobStore, cfg *Config, req *http.Request) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/uploads", CreateUploadHandler(mock, cfg))
+	mux.HandleFunc("GET /api/uploads/{id}", UploadStatusHandler(mock, cfg))
+	mux.HandleFunc("PATCH /api/uploads/{id}", AppendUploadHandler(mock, cfg))
+	mux.HandleFunc("POST /api/uploads/{id}/commit", CommitUploadHandler(mock, cfg))
+	mux.HandleFunc("DELETE /api/uploads/{id}", AbortUploadHandler(mock, cfg))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func createUpload(t *testing.T, mock *storage.MockBlobStore, cfg *Config, filename string, size int, it models.ImageTags) string {
+	t.Helper()
+	body, err := json.Marshal(createUploadRequest{Filename: filename, Size: int64(size), Metadata: it})
+	require.NoError(t, err)
+	w := serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var resp uploadSessionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "/api/uploads/"+resp.ID, w.Header().Get("Location"))
+	return resp.ID
+}
+
+func appendChunk(mock *storage.MockBlobStore, cfg *Config, id string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", "/api/uploads/"+id, bytes.NewReader(chunk))
+	req.Header.Set("Upload-Offset", fmt.Sprint(offset))
+	return serveUploads(mock, cfg, req)
+}
+
+func TestResumableUpload_ChunksCommittedAndStored(t *testing.T) {
+	mock, blobs := sessionStore()
+	cfg := testConfig()
+	photo := makeJPEG(t, 40, 30)
+	id := createUpload(t, mock, cfg, "big.jpg", len(photo), models.ImageTags{Collection: "nature", Album: "sunset", Type: "image/jpeg", Description: "resumed"})
+
+	half := len(photo) / 2
+	w := appendChunk(mock, cfg, id, 0, photo[:half])
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, fmt.Sprint(half), w.Header().Get("Upload-Offset"))
+
+	w = serveUploads(mock, cfg, httptest.NewRequest("GET", "/api/uploads/"+id, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, fmt.Sprint(half), w.Header().Get("Upload-Offset"))
+	assert.Equal(t, fmt.Sprint(len(photo)), w.Header().Get("Upload-Length"))
+
+	require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, half, photo[half:]).Code)
+
+	w = serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads/"+id+"/commit", nil))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var res uploadResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "nature/sunset/big.jpg", res.BlobPath)
+
+	var saved *storage.SaveBlobCall
+	for i, c := range mock.SaveBlobCalls {
+		if c.ContainerName == "uploads" {
+			saved = &mock.SaveBlobCalls[i]
+		}
+	}
+	require.NotNil(t, saved)
+	assert.Equal(t, photo, saved.Data)
+	assert.Equal(t, "resumed", saved.Tags["description"])
+	assert.Equal(t, "40", saved.Metadata["width"])
+	sum := sha256.Sum256(photo)
+	assert.Equal(t, hex.EncodeToString(sum[:]), saved.Tags["contentHash"])
+	require.Len(t, mock.CommitBlockListCalls, 1)
+	assert.Len(t, mock.CommitBlockListCalls[0].BlockIDs, 2)
+	assert.Empty(t, blobs, "session should be removed after commit")
+}
+
+func TestResumableUpload_OffsetMismatch_Returns409(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+	id := createUpload(t, mock, cfg, "a.jpg", 100, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+	require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, 0, make([]byte, 40)).Code)
+
+	// A retry of the first chunk after its response was lost.
+	w := appendChunk(mock, cfg, id, 0, make([]byte, 40))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "40", w.Header().Get("Upload-Offset"))
+	assert.Len(t, mock.StageBlockCalls, 1)
+}
+
+func TestResumableUpload_ConcurrentChunk_Returns409(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+	id := createUpload(t, mock, cfg, "a.jpg", 100, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+
+	// Another request appends a chunk between this one reading the session
+	// and saving it.
+	stage := mock.StageBlockFunc
+	mock.StageBlockFunc = func(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error {
+		mock.StageBlockFunc = stage
+		require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, 0, make([]byte, 30)).Code)
+		return stage(ctx, blobName, containerName, blockID, reader, size)
+	}
+	w := appendChunk(mock, cfg, id, 0, make([]byte, 40))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serveUploads(mock, cfg, httptest.NewRequest("GET", "/api/uploads/"+id, nil))
+	assert.Equal(t, "30", w.Header().Get("Upload-Offset"), "the first chunk recorded is kept")
+	require.Len(t, mock.StageBlockCalls, 2)
+	assert.NotEqual(t, mock.StageBlockCalls[0].BlockID, mock.StageBlockCalls[1].BlockID, "each attempt stages its own block")
+}
+
+func TestResumableUpload_ChunkPastDeclaredSize_Returns400(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+	id := createUpload(t, mock, cfg, "a.jpg", 10, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+
+	w := appendChunk(mock, cfg, id, 0, make([]byte, 11))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, mock.StageBlockCalls)
+}
+
+func TestResumableUpload_ChunkTooLarge_Returns413(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+	cfg.MemoryLimitMb = 1
+	id := createUpload(t, mock, cfg, "a.jpg", 4<<20, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+
+	w := appendChunk(mock, cfg, id, 0, make([]byte, 1<<20+1))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestResumableUpload_CommitIncomplete_Returns409(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+	id := createUpload(t, mock, cfg, "a.jpg", 100, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+	require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, 0, make([]byte, 40)).Code)
+
+	w := serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads/"+id+"/commit", nil))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "40", w.Header().Get("Upload-Offset"))
+	assert.Empty(t, mock.CommitBlockListCalls)
+}
+
+func TestResumableUpload_CommitInvalidImage_Returns400AndDiscards(t *testing.T) {
+	mock, blobs := sessionStore()
+	cfg := testConfig()
+	data := []byte("not an image at all")
+	id := createUpload(t, mock, cfg, "a.jpg", len(data), models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+	require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, 0, data).Code)
+
+	w := serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads/"+id+"/commit", nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid image file")
+	assert.Empty(t, blobs)
+}
+
+func TestResumableUpload_CommitSaveError_KeepsSession(t *testing.T) {
+	mock, blobs := sessionStore()
+	cfg := testConfig()
+	photo := makeJPEG(t, 10, 10)
+	id := createUpload(t, mock, cfg, "a.jpg", len(photo), models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+	require.Equal(t, http.StatusNoContent, appendChunk(mock, cfg, id, 0, photo).Code)
+
+	saveSession := mock.SaveBlobFunc
+	mock.SaveBlobFunc = func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+		if containerName == "uploads" {
+			return fmt.Errorf("storage failure")
+		}
+		return saveSession(ctx, reader, size, blobName, containerName, tags, metadata, contentType)
+	}
+	w := serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads/"+id+"/commit", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, blobs, sessionBlobName(id))
+
+	// The retry reuses the committed data blob.
+	mock.SaveBlobFunc = saveSession
+	w = serveUploads(mock, cfg, httptest.NewRequest("POST", "/api/uploads/"+id+"/commit", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, mock.CommitBlockListCalls, 1)
+}
+
+func TestResumableUpload_CreateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid json", `{`, http.StatusBadRequest},
+		{"path in filename", `{"filename":"../a.jpg","size":10,"metadata":{"type":"image/jpeg"}}`, http.StatusBadRequest},
+		{"zero size", `{"filename":"a.jpg","size":0,"metadata":{"type":"image/jpeg"}}`, http.StatusBadRequest},
+		{"too large", fmt.Sprintf(`{"filename":"a.jpg","size":%d,"metadata":{"type":"image/jpeg"}}`, maxResumableUploadBytes+1), http.StatusBadRequest},
+		{"unsupported type", `{"filename":"a.pdf","size":10,"metadata":{"type":"application/pdf"}}`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, _ := sessionStore()
+			w := serveUploads(mock, testConfig(), httptest.NewRequest("POST", "/api/uploads", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.want, w.Code)
+			assert.Empty(t, mock.SaveBlobIfMatchCalls)
+		})
+	}
+}
+
+func TestResumableUpload_UnknownAndExpiredSessions(t *testing.T) {
+	mock, blobs := sessionStore()
+	cfg := testConfig()
+
+	w := serveUploads(mock, cfg, httptest.NewRequest("GET", "/api/uploads/not-an-id", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveUploads(mock, cfg, httptest.NewRequest("GET", "/api/uploads/0123456789abcdef0123456789abcdef", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	expired := uploadSession{ID: "00000000000000000000000000000001", Size: 10, ExpiresAt: time.Now().Add(-time.Minute)}
+	blobs[sessionBlobName(expired.ID)], _ = json.Marshal(expired)
+	w = appendChunk(mock, cfg, expired.ID, 0, []byte("x"))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Empty(t, blobs)
+}
+
+func TestResumableUpload_Abort(t *testing.T) {
+	mock, blobs := sessionStore()
+	cfg := testConfig()
+	id := createUpload(t, mock, cfg, "a.jpg", 100, models.ImageTags{Collection: "c", Album: "a", Type: "image/jpeg"})
+
+	w := serveUploads(mock, cfg, httptest.NewRequest("DELETE", "/api/uploads/"+id, nil))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, blobs)
+	w = serveUploads(mock, cfg, httptest.NewRequest("GET", "/api/uploads/"+id, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// ── Direct upload tests ─────────────────────────────────────────────
+
+func presignDirect(t *testing.T, mock *storage.MockBlobStore, cfg *Config, body string) (*httptest.ResponseRecorder, directUploadResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	UploadSASHandler(mock, cfg).ServeHTTP(w, httptest.NewRequest("POST", "/api/upload/sas", strings.NewReader(body)))
+
+	var resp directUploadResponse
+	if w.Code == http.StatusCreated {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w, resp
+}
+
+func completeDirect(mock *storage.MockBlobStore, cfg *Config, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	CompleteUploadHandler(mock, cfg).ServeHTTP(w, httptest.NewRequest("POST", "/api/upload/complete", strings.NewReader(`{"id":"`+id+`"}`)))
+	return w
+}
+
+func acceptPresign(mock *storage.MockBlobStore) {
+	mock.PresignUploadFunc = func(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (storage.PresignedUpload, error) {
+		return storage.PresignedUpload{
+			URL:       "https://example.blob.core.windows.net/" + containerName + "/" + blobName + "?sig=x",
+			Method:    http.MethodPut,
+			Headers:   map[string]string{"Content-Type": contentType},
+			ExpiresOn: time.Now().Add(expiry),
+		}, nil
+	}
+}
+
+func TestDirectUpload_PresignAndComplete(t *testing.T) {
+	mock, blobs := sessionStore()
+	acceptPresign(mock)
+	cfg := testConfig()
+	photo := makeJPEG(t, 50, 20)
+
+	w, resp := presignDirect(t, mock, cfg, fmt.Sprintf(`{"filename":"direct.jpg","size":%d,"metadata":{"collection":"nature","album":"sunset","type":"image/jpeg","description":"straight to storage"}}`, len(photo)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.Len(t, mock.PresignUploadCalls, 1)
+	assert.Equal(t, storage.PresignUploadCall{
+		BlobName: resp.ID + "/data", ContainerName: "upload-sessions", ContentType: "image/jpeg", Expiry: directUploadExpiry,
+	}, mock.PresignUploadCalls[0])
+	assert.Contains(t, resp.UploadURL, "/upload-sessions/"+resp.ID+"/data?sig=")
+	assert.Equal(t, http.MethodPut, resp.Method)
+	assert.Equal(t, "image/jpeg", resp.Headers["Content-Type"])
+	assert.Equal(t, "nature/sunset/direct.jpg", resp.Tags["name"])
+	assert.Equal(t, "straight to storage", resp.Tags["description"])
+
+	// The client uploads the photo with the presigned URL.
+	blobs[sessionDataBlobName(resp.ID)] = photo
+
+	w = completeDirect(mock, cfg, resp.ID)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var res uploadResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "nature/sunset/direct.jpg", res.BlobPath)
+
+	var saved *storage.SaveBlobCall
+	for i, c := range mock.SaveBlobCalls {
+		if c.ContainerName == "uploads" {
+			saved = &mock.SaveBlobCalls[i]
+		}
+	}
+	require.NotNil(t, saved)
+	assert.Equal(t, photo, saved.Data)
+	assert.Equal(t, "50", saved.Metadata["width"])
+	assert.Len(t, saved.Tags["contentHash"], 64)
+	assert.Empty(t, blobs, "session should be removed after completion")
+}
+
+func TestDirectUpload_CompleteBeforeUpload_Returns409(t *testing.T) {
+	mock, blobs := sessionStore()
+	acceptPresign(mock)
+	cfg := testConfig()
+	_, resp := presignDirect(t, mock, cfg, `{"filename":"a.jpg","size":10,"metadata":{"type":"image/jpeg"}}`)
+
+	w := completeDirect(mock, cfg, resp.ID)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, blobs, sessionBlobName(resp.ID), "session is kept so the upload can be retried")
+}
+
+func TestDirectUpload_CompleteRejectsMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		want        int
+	}{
+		{"size", []byte("short"), "image/jpeg", http.StatusBadRequest},
+		{"content type", make([]byte, 10), "image/png", http.StatusUnsupportedMediaType},
+		{"not an image", make([]byte, 10), "image/jpeg", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, blobs := sessionStore()
+			acceptPresign(mock)
+			mock.GetBlobPropertiesFunc = func(ctx context.Context, blobName string, containerName string) (storage.BlobProperties, error) {
+				return storage.BlobProperties{ContentType: tt.contentType, Size: int64(len(blobs[blobName]))}, nil
+			}
+			cfg := testConfig()
+			_, resp := presignDirect(t, mock, cfg, `{"filename":"a.jpg","size":10,"metadata":{"type":"image/jpeg"}}`)
+			blobs[sessionDataBlobName(resp.ID)] = tt.data
+
+			w := completeDirect(mock, cfg, resp.ID)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Empty(t, blobs)
+			for _, c := range mock.SaveBlobCalls {
+				assert.NotEqual(t, "uploads", c.ContainerName)
+			}
+		})
+	}
+}
+
+func TestDirectUpload_SessionsAreNotInterchangeable(t *testing.T) {
+	mock, _ := sessionStore()
+	acceptPresign(mock)
+	cfg := testConfig()
+	_, direct := presignDirect(t, mock, cfg, `{"filename":"a.jpg","size":10,"metadata":{"type":"image/jpeg"}}`)
+	resumable := createUpload(t, mock, cfg, "b.jpg", 10, models.ImageTags{Type: "image/jpeg"})
+
+	assert.Equal(t, http.StatusNotFound, appendChunk(mock, cfg, direct.ID, 0, make([]byte, 10)).Code)
+	assert.Equal(t, http.StatusNotFound, completeDirect(mock, cfg, resumable).Code)
+}
+
+func TestDirectUpload_PresignValidationAndErrors(t *testing.T) {
+	mock, _ := sessionStore()
+	cfg := testConfig()
+
+	w, _ := presignDirect(t, mock, cfg, `{"filename":"a.pdf","size":10,"metadata":{"type":"application/pdf"}}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// PresignUpload is not configured, so signing fails.
+	w, _ = presignDirect(t, mock, cfg, `{"filename":"a.jpg","size":10,"metadata":{"type":"image/jpeg"}}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, mock.SaveBlobCalls)
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/cbellee/photo-api/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// variantRequest holds the ?w=&h=&fit=&fmt=&q= transformation parameters of
+// an image request.
+type variantRequest struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string // output content type
+	Quality int    // zero for lossless formats
+}
+
+// ParseVariantSizes parses a comma-separated list of the pixel sizes the
+// image endpoint may produce, e.g. "320,640,1280".
+func ParseVariantSizes(s string) ([]int, error) {
+	var sizes []int
+	for field := range strings.SplitSeq(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid image variant size %q", field)
+		}
+		sizes = append(sizes, n)
+	}
+	slices.Sort(sizes)
+	return slices.Compact(sizes), nil
+}
+
+// parseVariantRequest reads the transformation parameters from q. ok is false
+// when none are present. Width and height must be one of sizes so that the
+// number of variants generated and cached per photo stays bounded.
+func parseVariantRequest(q url.Values, sizes []int) (req variantRequest, ok bool, err error) {
+	if !q.Has("w") && !q.Has("h") && !q.Has("fit") && !q.Has("fmt") && !q.Has("q") {
+		return req, false, nil
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"w", &req.Width}, {"h", &req.Height}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || !slices.Contains(sizes, n) {
+			return req, false, fmt.Errorf("%s must be one of %s", p.name, joinInts(sizes))
+		}
+		*p.dst = n
+	}
+
+	switch fit := q.Get("fit"); fit {
+	case "", utils.FitContain:
+		req.Fit = utils.FitContain
+	case utils.FitCover:
+		req.Fit = utils.FitCover
+	default:
+		return req, false, fmt.Errorf("fit must be %s or %s", utils.FitContain, utils.FitCover)
+	}
+
+	switch format := q.Get("fmt"); format {
+	case "", "jpeg":
+		req.Format = "image/jpeg"
+		req.Quality = utils.DefaultJPEGQuality
+		if v := q.Get("q"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 100 {
+				return req, false, fmt.Errorf("q must be between 1 and 100")
+			}
+			req.Quality = n
+		}
+	case "webp":
+		// WebP output is lossless, since the pure-Go encoder has no lossy
+		// mode, so q is rejected rather than silently ignored.
+		if q.Has("q") {
+			return req, false, fmt.Errorf("q applies only to jpeg; webp output is lossless")
+		}
+		req.Format = "image/webp"
+	default:
+		return req, false, fmt.Errorf("fmt must be jpeg or webp")
+	}
+
+	return req, true, nil
+}
+
+// key identifies the variant within a photo's cache directory.
+func (v variantRequest) key() string {
+	ext := "jpg"
+	if v.Format == "image/webp" {
+		ext = "webp"
+	}
+	return fmt.Sprintf("w%d-h%d-%s-q%d.%s", v.Width, v.Height, v.Fit, v.Quality, ext)
+}
+
+// variantBlobName returns the cache blob for variant v of blobName. The
+// source's ETag is part of the name so that replacing a photo invalidates
+// its cached variants.
+func variantBlobName(blobName string, src storage.BlobProperties, v variantRequest) string {
+	version := src.ETag
+	if version == "" {
+		version = src.LastModified.String()
+	}
+	sum := sha256.Sum256([]byte(version))
+	return fmt.Sprintf("%s/%s/%s", blobName, hex.EncodeToString(sum[:8]), v.key())
+}
+
+// serveVariant answers r with variant v of the photo blobName. Variants are
+// generated from the resized image on first request and cached in
+// cfg.VariantsContainerName, so repeat requests are streamed without
+// decoding.
+func serveVariant(ctx context.Context, w http.ResponseWriter, r *http.Request, store storage.BlobStore, cfg *Config, blobName string, v variantRequest) {
+	span := trace.SpanFromContext(ctx)
+
+	src, err := store.GetBlobProperties(ctx, blobName, cfg.ImagesContainerName)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting image properties", "blob", blobName, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Variants are validated against their source so cached copies in
+	// browsers and CDNs expire with it.
+	cacheName := variantBlobName(blobName, src, v)
+	validators := storage.BlobProperties{
+		ContentType:  v.Format,
+		ETag:         `"` + strings.ReplaceAll(strings.TrimPrefix(cacheName, blobName+"/"), "/", "-") + `"`,
+		LastModified: src.LastModified,
+	}
+
+	if notModified(r, validators) {
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", imageCacheControl)
+		}
+		w.Header().Set("ETag", validators.ETag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cached, err := store.GetBlobProperties(ctx, cacheName, cfg.VariantsContainerName)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("image.variant.cached", true))
+		validators.Size = cached.Size
+		streamBlob(ctx, w, r, store, cfg.VariantsContainerName, cacheName, validators)
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		slog.WarnContext(ctx, "error checking variant cache", "blob", cacheName, "error", err)
+	}
+	span.SetAttributes(attribute.Bool("image.variant.cached", false))
+
+	data, err := store.GetBlob(ctx, blobName, cfg.ImagesContainerName)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting image", "blob", blobName, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	srcType := src.ContentType
+	if srcType == "" || srcType == "application/octet-stream" {
+		srcType = http.DetectContentType(data)
+	}
+
+	out, err := utils.TransformImage(data, srcType, utils.TransformOptions{
+		Width:       v.Width,
+		Height:      v.Height,
+		Fit:         v.Fit,
+		ContentType: v.Format,
+		Quality:     v.Quality,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error transforming image", "blob", blobName, "variant", v.key(), "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// A failed cache write only costs a re-render on the next request.
+	if err := store.SaveBlob(ctx, bytes.NewReader(out), int64(len(out)), cacheName, cfg.VariantsContainerName, nil, nil, v.Format); err != nil {
+		slog.WarnContext(ctx, "error caching image variant", "blob", cacheName, "error", err)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", v.Format)
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", imageCacheControl)
+	}
+	h.Set("ETag", validators.ETag)
+	http.ServeContent(w, r, "", validators.LastModified, bytes.NewReader(out))
+}
+
+// joinInts formats ns as a comma-separated list.
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,113 @@
+// Package jobs runs long admin mutations, such as renaming or soft-deleting
+// a collection, in the background. A job is a list of items, usually blobs,
+// each processed by the operation registered for the job's kind. Progress
+// and per-item outcomes are persisted, so a job survives restarts and its
+// failed items can be retried.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusFailed means at least one item failed; the others were
+	// processed and the failed ones can be retried.
+	StatusFailed = "failed"
+)
+
+// Item states.
+const (
+	ItemPending = "pending"
+	ItemDone    = "done"
+	ItemFailed  = "failed"
+)
+
+var (
+	// ErrNotFound is returned when a job does not exist.
+	ErrNotFound = errors.New("job not found")
+	// ErrRunning is returned when retrying a job that has not finished.
+	ErrRunning = errors.New("job is still running")
+	// ErrNothingToRetry is returned when retrying a job with no failed items.
+	ErrNothingToRetry = errors.New("job has no failed items")
+	// ErrUnknownKind is returned when submitting a job of a kind with no
+	// registered operation.
+	ErrUnknownKind = errors.New("unknown job kind")
+	// ErrConflict is returned by Store.Save when another process has saved
+	// the job since it was read, and so now owns it.
+	ErrConflict = errors.New("job saved by another process")
+)
+
+// Item is one unit of work in a job, such as a blob to move or retag.
+type Item struct {
+	// Name identifies the item, usually a blob name.
+	Name string `json:"name"`
+	// Target is where the item goes, for operations that move it.
+	Target string `json:"target,omitempty"`
+	// Tags are tag values the operation sets on the item.
+	Tags     map[string]string `json:"tags,omitempty"`
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Attempts int               `json:"attempts,omitempty"`
+}
+
+// Job is a background mutation and its progress.
+type Job struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Params describe the mutation, e.g. the collection and its new name.
+	Params     map[string]string `json:"params,omitempty"`
+	Status     string            `json:"status"`
+	Total      int               `json:"total"`
+	Completed  int               `json:"completed"`
+	Failed     int               `json:"failed"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	Items      []Item            `json:"items"`
+
+	// etag is the version of the job last read or saved by this process;
+	// empty for a job that has not been saved.
+	etag string
+}
+
+// Finished reports whether the job has stopped, successfully or not.
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// count updates the item totals from the item states.
+func (j *Job) count() {
+	j.Total, j.Completed, j.Failed = len(j.Items), 0, 0
+	for _, it := range j.Items {
+		switch it.Status {
+		case ItemDone:
+			j.Completed++
+		case ItemFailed:
+			j.Failed++
+		}
+	}
+}
+
+// ValidID reports whether id has the form of a job ID.
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
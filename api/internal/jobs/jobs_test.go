@@ -0,0 +1,318 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failing returns an Op that fails for the named items and records every
+// item it is called with.
+func failing(names ...string) (Op, *[]string) {
+	var mu sync.Mutex
+	var calls []string
+	return func(ctx context.Context, job *Job, item *Item) error {
+		mu.Lock()
+		calls = append(calls, item.Name)
+		mu.Unlock()
+		for _, n := range names {
+			if item.Name == n {
+				return fmt.Errorf("cannot process %s", n)
+			}
+		}
+		return nil
+	}, &calls
+}
+
+func items(names ...string) []Item {
+	var its []Item
+	for _, n := range names {
+		its = append(its, Item{Name: n})
+	}
+	return its
+}
+
+func TestManager_RunsItemsAndRecordsFailures(t *testing.T) {
+	store := NewMemoryStore()
+	m := NewManager(context.Background(), store)
+	op, calls := failing("b")
+	m.Register("retag", op)
+
+	job, err := m.Submit(context.Background(), "retag", map[string]string{"collection": "c"}, items("a", "b", "c"))
+	require.NoError(t, err)
+	assert.True(t, ValidID(job.ID))
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, 3, job.Total)
+	m.Wait()
+
+	got, err := m.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, 2, got.Completed)
+	assert.Equal(t, 1, got.Failed)
+	assert.NotNil(t, got.FinishedAt)
+	assert.Equal(t, "c", got.Params["collection"])
+	assert.Equal(t, ItemDone, got.Items[0].Status)
+	assert.Equal(t, Item{Name: "b", Status: ItemFailed, Error: "cannot process b", Attempts: 1}, got.Items[1])
+	assert.Equal(t, []string{"a", "b", "c"}, *calls)
+}
+
+func TestManager_RetryRunsFailedItems(t *testing.T) {
+	store := NewMemoryStore()
+	m := NewManager(context.Background(), store)
+	fail := true
+	var calls []string
+	m.Register("retag", func(ctx context.Context, job *Job, item *Item) error {
+		calls = append(calls, item.Name)
+		if item.Name == "b" && fail {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	job, err := m.Submit(context.Background(), "retag", nil, items("a", "b"))
+	require.NoError(t, err)
+	m.Wait()
+
+	fail = false
+	retried, err := m.Retry(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, retried.Status)
+	assert.Equal(t, 1, retried.Completed)
+	m.Wait()
+
+	got, err := m.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	assert.Equal(t, 2, got.Completed)
+	assert.Equal(t, Item{Name: "b", Status: ItemDone, Attempts: 2}, got.Items[1])
+	assert.Equal(t, []string{"a", "b", "b"}, calls)
+
+	_, err = m.Retry(context.Background(), job.ID)
+	assert.ErrorIs(t, err, ErrNothingToRetry)
+	_, err = m.Retry(context.Background(), "0123456789abcdef0123456789abcdef")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_RetryWhileRunning(t *testing.T) {
+	m := NewManager(context.Background(), NewMemoryStore())
+	release := make(chan struct{})
+	m.Register("retag", func(ctx context.Context, job *Job, item *Item) error {
+		<-release
+		return errors.New("failed")
+	})
+
+	job, err := m.Submit(context.Background(), "retag", nil, items("a"))
+	require.NoError(t, err)
+	_, err = m.Retry(context.Background(), job.ID)
+	assert.ErrorIs(t, err, ErrRunning)
+
+	close(release)
+	m.Wait()
+	_, err = m.Retry(context.Background(), job.ID)
+	assert.NoError(t, err)
+	m.Wait()
+}
+
+func TestManager_SubmitUnknownKind(t *testing.T) {
+	m := NewManager(context.Background(), NewMemoryStore())
+	_, err := m.Submit(context.Background(), "rename", nil, items("a"))
+	assert.ErrorIs(t, err, ErrUnknownKind)
+}
+
+func TestManager_ResumesStaleJobs(t *testing.T) {
+	store := NewMemoryStore()
+	old := time.Now().Add(-time.Hour)
+	stale := &Job{
+		ID: "00000000000000000000000000000001", Kind: "retag", Status: StatusRunning, UpdatedAt: old,
+		Items: []Item{{Name: "a", Status: ItemDone}, {Name: "b", Status: ItemPending}},
+	}
+	fresh := &Job{
+		ID: "00000000000000000000000000000002", Kind: "retag", Status: StatusRunning, UpdatedAt: time.Now(),
+		Items: []Item{{Name: "c", Status: ItemPending}},
+	}
+	done := &Job{
+		ID: "00000000000000000000000000000003", Kind: "retag", Status: StatusSucceeded, UpdatedAt: old,
+		Items: []Item{{Name: "d", Status: ItemDone}},
+	}
+	for _, j := range []*Job{stale, fresh, done} {
+		require.NoError(t, store.Save(context.Background(), j))
+	}
+
+	m := NewManager(context.Background(), store)
+	op, calls := failing()
+	m.Register("retag", op)
+	require.NoError(t, m.Resume(context.Background()))
+	m.Wait()
+
+	assert.Equal(t, []string{"b"}, *calls, "only the pending item of the stale job is processed")
+	got, err := store.Get(context.Background(), stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	assert.Equal(t, 2, got.Completed)
+
+	got, err = store.Get(context.Background(), fresh.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, got.Status, "a recently saved job belongs to another process")
+}
+
+func TestManager_InterruptedJobKeepsProgress(t *testing.T) {
+	store := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(ctx, store)
+	m.Register("retag", func(ctx context.Context, job *Job, item *Item) error {
+		cancel() // shut down after the first item
+		return nil
+	})
+
+	job, err := m.Submit(context.Background(), "retag", nil, items("a", "b"))
+	require.NoError(t, err)
+	m.Wait()
+
+	got, err := store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, got.Status)
+	assert.Equal(t, ItemDone, got.Items[0].Status)
+	assert.Equal(t, ItemPending, got.Items[1].Status)
+	assert.Nil(t, got.FinishedAt)
+}
+
+func TestManager_OneProcessResumesAJob(t *testing.T) {
+	store := NewMemoryStore()
+	stale := &Job{
+		ID: "00000000000000000000000000000001", Kind: "retag", Status: StatusRunning, UpdatedAt: time.Now().Add(-time.Hour),
+		Items: []Item{{Name: "a", Status: ItemPending}, {Name: "b", Status: ItemPending}},
+	}
+	require.NoError(t, store.Save(context.Background(), stale))
+
+	// Two replicas find the job stale at the same moment; only the first to
+	// save it runs it.
+	op, calls := failing()
+	m1, m2 := NewManager(context.Background(), store), NewManager(context.Background(), store)
+	m1.Register("retag", op)
+	m2.Register("retag", op)
+	jobs, err := store.Unfinished(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	copy1, copy2 := jobs[0], jobs[0].clone()
+	m1.claim(stale.ID)
+	m2.claim(stale.ID)
+	m1.launch(copy1)
+	m1.Wait()
+	m2.launch(copy2)
+	m2.Wait()
+
+	assert.Equal(t, []string{"a", "b"}, *calls)
+	got, err := store.Get(context.Background(), stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+}
+
+func TestManager_HeartbeatAndTakeover(t *testing.T) {
+	defer func(d time.Duration) { heartbeatInterval = d }(heartbeatInterval)
+	heartbeatInterval = 5 * time.Millisecond
+
+	store := NewMemoryStore()
+	m := NewManager(context.Background(), store)
+	var calls []string
+	taken := make(chan struct{})
+	m.Register("retag", func(ctx context.Context, job *Job, item *Item) error {
+		calls = append(calls, item.Name)
+		// A slow item: the job is saved while it runs, until another
+		// process takes the job over.
+		first, err := store.Get(context.Background(), job.ID)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			got, err := store.Get(context.Background(), job.ID)
+			return err == nil && got.UpdatedAt.After(first.UpdatedAt)
+		}, time.Second, time.Millisecond, "heartbeat saves the job")
+
+		got, err := store.Get(context.Background(), job.ID)
+		require.NoError(t, err)
+		got.Params = map[string]string{"owner": "other"}
+		require.NoError(t, store.Save(context.Background(), got))
+		close(taken)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	job, err := m.Submit(context.Background(), "retag", nil, items("a", "b"))
+	require.NoError(t, err)
+	<-taken
+	m.Wait()
+
+	assert.Equal(t, []string{"a"}, calls, "the job stops once another process owns it")
+	got, err := store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "other", got.Params["owner"], "the other process's save is kept")
+	assert.Equal(t, ItemPending, got.Items[0].Status)
+}
+
+func TestBlobStore_SaveGetUnfinished(t *testing.T) {
+	saved := map[string][]byte{}
+	etags := map[string]string{}
+	version := 0
+	var savedTags map[string]string
+	mock := &storage.MockBlobStore{
+		SaveBlobIfMatchFunc: func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error) {
+			assert.Equal(t, "jobs", containerName)
+			assert.Equal(t, "application/json", contentType)
+			if etags[blobName] != etag {
+				return "", fmt.Errorf("save blob status 412: %w", storage.ErrConditionNotMet)
+			}
+			data, _ := io.ReadAll(reader)
+			saved[blobName] = data
+			savedTags = tags
+			version++
+			etags[blobName] = fmt.Sprintf(`"v%d"`, version)
+			return etags[blobName], nil
+		},
+		OpenBlobFunc: func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, storage.BlobProperties, error) {
+			data, ok := saved[blobName]
+			if !ok {
+				return nil, storage.BlobProperties{}, fmt.Errorf("open blob status 404: %w", storage.ErrNotFound)
+			}
+			return io.NopCloser(bytes.NewReader(data)), storage.BlobProperties{ETag: etags[blobName]}, nil
+		},
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			if query == "@container='jobs' and jobStatus='running'" {
+				return []models.Blob{{Name: "0123456789abcdef0123456789abcdef.json"}, {Name: "ffffffffffffffffffffffffffffffff.json"}}, nil
+			}
+			assert.Equal(t, "@container='jobs' and jobStatus='queued'", query)
+			return nil, nil
+		},
+	}
+	s := NewBlobStore(mock, "jobs")
+
+	job := &Job{ID: "0123456789abcdef0123456789abcdef", Kind: "rename-album", Status: StatusRunning, Items: items("a")}
+	require.NoError(t, s.Save(context.Background(), job))
+	assert.Equal(t, map[string]string{"jobStatus": "running", "jobKind": "rename-album"}, savedTags)
+
+	got, err := s.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job, got)
+
+	stale := *got
+	require.NoError(t, s.Save(context.Background(), got))
+	assert.ErrorIs(t, s.Save(context.Background(), &stale), ErrConflict, "saved since it was read")
+	fresh := &Job{ID: job.ID, Kind: job.Kind, Status: StatusQueued}
+	assert.ErrorIs(t, s.Save(context.Background(), fresh), ErrConflict, "a new job must not exist")
+
+	_, err = s.Get(context.Background(), "ffffffffffffffffffffffffffffffff")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	unfinished, err := s.Unfinished(context.Background())
+	require.NoError(t, err)
+	require.Len(t, unfinished, 1, "jobs deleted since they were listed are skipped")
+	assert.Equal(t, job.ID, unfinished[0].ID)
+}
@@ -0,0 +1,359 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var tracer = otel.Tracer("jobs")
+
+const (
+	// saveInterval is how often a running job's progress is saved. Items
+	// finished since the last save are processed again if the job is
+	// resumed, so operations must be idempotent.
+	saveInterval = time.Second
+	// staleAfter is how long an unfinished job can go without being saved
+	// before Resume assumes its process has stopped and runs it again.
+	staleAfter = 2 * time.Minute
+)
+
+// heartbeatInterval is how often a job is saved while one of its items is
+// being processed, so that a slow item does not make the job look stale. It
+// is a variable so tests can shorten it.
+var heartbeatInterval = staleAfter / 4
+
+// Op processes one item of a job and returns why it failed, if it did. It
+// must be idempotent: an item is processed again when it is retried, or
+// when its job is resumed after a restart.
+type Op func(ctx context.Context, job *Job, item *Item) error
+
+// Manager runs jobs in the background: one goroutine per job, processing
+// its items in order with the Op registered for its kind.
+type Manager struct {
+	ctx   context.Context
+	store Store
+	ops   map[string]Op
+
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// NewManager returns a Manager that keeps jobs in store. Jobs run until ctx
+// is cancelled; an interrupted job is resumed by a later call to Resume.
+func NewManager(ctx context.Context, store Store) *Manager {
+	return &Manager{
+		ctx:     ctx,
+		store:   store,
+		ops:     map[string]Op{},
+		running: map[string]bool{},
+	}
+}
+
+// Register sets the operation for jobs of kind. Operations must be
+// registered before jobs are submitted or resumed.
+func (m *Manager) Register(kind string, op Op) {
+	m.ops[kind] = op
+}
+
+// Submit saves a new job over items and starts it. It returns a copy of
+// the job as submitted.
+func (m *Manager) Submit(ctx context.Context, kind string, params map[string]string, items []Item) (*Job, error) {
+	if _, ok := m.ops[kind]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, fmt.Errorf("generating job id: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        id,
+		Kind:      kind,
+		Params:    params,
+		Status:    StatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Items:     items,
+	}
+	for i := range job.Items {
+		job.Items[i].Status = ItemPending
+		job.Items[i].Error = ""
+	}
+	job.count()
+	if err := m.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "job submitted", "job_id", job.ID, "kind", kind, "items", job.Total)
+	m.claim(job.ID)
+	submitted := job.clone()
+	m.launch(job)
+	return submitted, nil
+}
+
+// Get returns a job as last saved.
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// Retry runs a finished job's failed items again. It returns ErrRunning if
+// the job has not finished and ErrNothingToRetry if none of its items
+// failed.
+func (m *Manager) Retry(ctx context.Context, id string) (*Job, error) {
+	if !m.claim(id) {
+		return nil, ErrRunning
+	}
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		m.release(id)
+		return nil, err
+	}
+	switch {
+	case !job.Finished():
+		err = ErrRunning
+	case job.Failed == 0:
+		err = ErrNothingToRetry
+	case m.ops[job.Kind] == nil:
+		err = fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+	if err != nil {
+		m.release(id)
+		return nil, err
+	}
+
+	for i := range job.Items {
+		if job.Items[i].Status == ItemFailed {
+			job.Items[i].Status = ItemPending
+		}
+	}
+	job.Status = StatusQueued
+	job.FinishedAt = nil
+	job.UpdatedAt = time.Now().UTC()
+	job.count()
+	if err := m.store.Save(ctx, job); err != nil {
+		m.release(id)
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrRunning // retried or resumed by another process
+		}
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "job retried", "job_id", id, "kind", job.Kind, "items", job.Total-job.Completed)
+	retried := job.clone()
+	m.launch(job)
+	return retried, nil
+}
+
+// Resume starts the unfinished jobs that no process is running: those not
+// saved for staleAfter, because the process running them stopped or was
+// restarted. When several processes resume a job at once, the first to save
+// it runs it and the others leave it.
+func (m *Manager) Resume(ctx context.Context) error {
+	jobs, err := m.store.Unfinished(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if time.Since(job.UpdatedAt) < staleAfter {
+			continue
+		}
+		if m.ops[job.Kind] == nil {
+			slog.WarnContext(ctx, "cannot resume job of unknown kind", "job_id", job.ID, "kind", job.Kind)
+			continue
+		}
+		if !m.claim(job.ID) {
+			continue
+		}
+		slog.InfoContext(ctx, "resuming job", "job_id", job.ID, "kind", job.Kind, "status", job.Status, "updated_at", job.UpdatedAt)
+		m.launch(job)
+	}
+	return nil
+}
+
+// Run calls Resume at startup and then every interval until the Manager's
+// context is cancelled. Failures are logged.
+func (m *Manager) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Resume(m.ctx); err != nil && m.ctx.Err() == nil {
+			slog.ErrorContext(m.ctx, "error resuming jobs", "error", err)
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wait blocks until every started job has finished or stopped after the
+// Manager's context was cancelled.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// claim marks a job as running in this process, returning false if it
+// already is.
+func (m *Manager) claim(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running[id] {
+		return false
+	}
+	m.running[id] = true
+	return true
+}
+
+func (m *Manager) release(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running, id)
+}
+
+// launch runs a claimed job in a new goroutine.
+func (m *Manager) launch(job *Job) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.release(job.ID)
+		m.run(job)
+	}()
+}
+
+// run processes the pending items of job and saves the outcome. If the
+// Manager's context is cancelled it stops between items, leaving the job
+// running so that Resume picks it up. If the job cannot be saved it is
+// abandoned: another process that saved it carries on with it, and
+// otherwise Resume runs it again once it is stale.
+func (m *Manager) run(job *Job) {
+	ctx, span := tracer.Start(m.ctx, "jobs.run")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.kind", job.Kind),
+	)
+	start := time.Now()
+	op := m.ops[job.Kind]
+
+	job.Status = StatusRunning
+	if !m.save(ctx, job) {
+		return
+	}
+	lastSave := time.Now()
+
+	for i := range job.Items {
+		item := &job.Items[i]
+		if item.Status != ItemPending {
+			continue
+		}
+		if ctx.Err() != nil {
+			m.save(ctx, job)
+			slog.InfoContext(ctx, "job interrupted", "job_id", job.ID, "completed", job.Completed, "total", job.Total)
+			return
+		}
+
+		item.Attempts++
+		if !m.process(ctx, op, job, item) {
+			return
+		}
+
+		if time.Since(lastSave) >= saveInterval {
+			if !m.save(ctx, job) {
+				return
+			}
+			lastSave = time.Now()
+		}
+	}
+
+	job.count()
+	job.Status = StatusSucceeded
+	if job.Failed > 0 {
+		job.Status = StatusFailed
+		span.SetStatus(codes.Error, fmt.Sprintf("%d items failed", job.Failed))
+	}
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	if !m.save(ctx, job) {
+		return
+	}
+
+	slog.InfoContext(ctx, "job finished",
+		"job_id", job.ID,
+		"kind", job.Kind,
+		"status", job.Status,
+		"completed", job.Completed,
+		"failed", job.Failed,
+		"elapsed_ms", time.Since(start).Milliseconds(),
+	)
+}
+
+// process runs op on item and records the outcome, saving the job every
+// heartbeatInterval meanwhile. If a save fails, op's context is cancelled
+// and process returns false once op has returned, leaving the item pending.
+func (m *Manager) process(ctx context.Context, op Op, job *Job, item *Item) bool {
+	opCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- op(opCtx, job, item) }()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	saved := true
+	for {
+		select {
+		case err := <-done:
+			if !saved {
+				return false
+			}
+			if err != nil {
+				item.Status, item.Error = ItemFailed, err.Error()
+				slog.WarnContext(ctx, "job item failed", "job_id", job.ID, "item", item.Name, "error", err)
+			} else {
+				item.Status, item.Error = ItemDone, ""
+			}
+			return true
+		case <-heartbeat.C:
+			if saved && !m.save(ctx, job) {
+				saved = false
+				cancel()
+			}
+		}
+	}
+}
+
+// save records the job's progress and reports whether it was saved. It is
+// saved even after the Manager's context is cancelled, so an interrupted job
+// keeps its progress. Failures are logged; the caller then stops running
+// the job, as another process may have taken it over.
+func (m *Manager) save(ctx context.Context, job *Job) bool {
+	job.count()
+	job.UpdatedAt = time.Now().UTC()
+	err := m.store.Save(context.WithoutCancel(ctx), job)
+	if errors.Is(err, ErrConflict) {
+		slog.WarnContext(ctx, "job taken over by another process, stopping", "job_id", job.ID)
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error saving job, stopping", "job_id", job.ID, "error", err)
+		return false
+	}
+	return true
+}
+
+// clone returns a copy of job that shares no items with it.
+func (j *Job) clone() *Job {
+	c := *j
+	c.Items = append([]Item(nil), j.Items...)
+	return &c
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cbellee/photo-api/internal/storage"
+)
+
+// Store persists jobs.
+type Store interface {
+	// Save creates or replaces a job. It fails with an error wrapping
+	// ErrConflict if the job has been saved since this copy was read or, for
+	// a new job, if it already exists, so that only one process runs a job.
+	Save(ctx context.Context, job *Job) error
+	// Get returns a job, or an error wrapping ErrNotFound.
+	Get(ctx context.Context, id string) (*Job, error)
+	// Unfinished returns the queued and running jobs.
+	Unfinished(ctx context.Context) ([]*Job, error)
+}
+
+// statusTag is the index tag holding a job's status, so unfinished jobs can
+// be found without reading every job.
+const statusTag = "jobStatus"
+
+// blobStore keeps each job as "<id>.json" in a blob container.
+type blobStore struct {
+	blobs         storage.BlobStore
+	containerName string
+}
+
+// NewBlobStore returns a Store that keeps jobs in containerName.
+func NewBlobStore(blobs storage.BlobStore, containerName string) Store {
+	return &blobStore{blobs: blobs, containerName: containerName}
+}
+
+func (s *blobStore) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	tags := map[string]string{statusTag: job.Status, "jobKind": job.Kind}
+	etag, err := s.blobs.SaveBlobIfMatch(ctx, bytes.NewReader(data), int64(len(data)), job.ID+".json", s.containerName, tags, nil, "application/json", job.etag)
+	if errors.Is(err, storage.ErrConditionNotMet) {
+		return fmt.Errorf("saving job %s: %w", job.ID, ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	job.etag = etag
+	return nil
+}
+
+func (s *blobStore) Get(ctx context.Context, id string) (*Job, error) {
+	r, props, err := s.blobs.OpenBlob(ctx, id+".json", s.containerName, 0, -1)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	defer r.Close()
+	var job Job
+	if err := json.NewDecoder(r).Decode(&job); err != nil {
+		return nil, fmt.Errorf("decoding job %s: %w", id, err)
+	}
+	job.etag = props.ETag
+	return &job, nil
+}
+
+func (s *blobStore) Unfinished(ctx context.Context) ([]*Job, error) {
+	var jobs []*Job
+	// Tag queries cannot OR values, so each status is queried separately.
+	for _, status := range []string{StatusQueued, StatusRunning} {
+		query := fmt.Sprintf("@container='%s' and %s='%s'", s.containerName, statusTag, status)
+		blobs, err := s.blobs.FilterBlobsByTags(ctx, query, s.containerName)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s jobs: %w", status, err)
+		}
+		for _, b := range blobs {
+			job, err := s.Get(ctx, strings.TrimSuffix(b.Name, ".json"))
+			if errors.Is(err, ErrNotFound) {
+				continue // deleted since it was listed
+			}
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// MemoryStore keeps jobs in memory. It is meant for tests and for running
+// without persistent storage.
+type MemoryStore struct {
+	mu      sync.Mutex
+	jobs    map[string]memoryJob
+	version int
+}
+
+// memoryJob is a saved job and its version.
+type memoryJob struct {
+	data []byte
+	etag string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]memoryJob{}}
+}
+
+// Save stores a copy of job.
+func (s *MemoryStore) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs[job.ID].etag != job.etag {
+		return fmt.Errorf("saving job %s: %w", job.ID, ErrConflict)
+	}
+	s.version++
+	job.etag = strconv.Itoa(s.version)
+	s.jobs[job.ID] = memoryJob{data: data, etag: job.etag}
+	return nil
+}
+
+// Get returns a copy of the stored job.
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	saved, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	var job Job
+	if err := json.Unmarshal(saved.data, &job); err != nil {
+		return nil, err
+	}
+	job.etag = saved.etag
+	return &job, nil
+}
+
+// Unfinished returns copies of the queued and running jobs.
+func (s *MemoryStore) Unfinished(ctx context.Context) ([]*Job, error) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.jobs))
+	for id := range s.jobs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	var jobs []*Job
+	for _, id := range ids {
+		job, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !job.Finished() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// metadataKeys maps each registered blob metadata key, lower-cased, to the
+// casing it is read back with.
+var metadataKeys = map[string]string{}
+
+func init() {
+	RegisterMetadataKeys(
+		MetaDeletedAt,
+		MetaProcessingStatus, MetaProcessingError, MetaProcessingUpdatedAt,
+		MetaOriginalContainer, MetaOriginalSize, MetaOriginalContentType, MetaOriginalSha256,
+		MetaOriginalName, MetaUploadedAt,
+	)
+}
+
+// RegisterMetadataKeys records blob metadata keys whose casing must survive
+// a round trip through the blob store. Azure returns metadata names in
+// canonical HTTP header form, so "DeletedAt" comes back as "Deletedat";
+// CanonicalMetadataKey maps it back. Packages that define metadata keys
+// register them from init.
+func RegisterMetadataKeys(keys ...string) {
+	for _, key := range keys {
+		metadataKeys[strings.ToLower(key)] = capitalise(key)
+	}
+}
+
+// CanonicalMetadataKey returns key in the casing the services read it
+// with, whatever casing the blob store returned it in: a registered key as
+// registered, and any key with its first letter upper-cased, as blobemu
+// returns them.
+func CanonicalMetadataKey(key string) string {
+	if k, ok := metadataKeys[strings.ToLower(key)]; ok {
+		return k
+	}
+	return capitalise(key)
+}
+
+// capitalise upper-cases the first letter of key.
+func capitalise(key string) string {
+	r, size := utf8.DecodeRuneInString(key)
+	if r == utf8.RuneError {
+		return key
+	}
+	return string(unicode.ToUpper(r)) + key[size:]
+}
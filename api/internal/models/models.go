@@ -29,6 +29,47 @@ type ImageTags struct {
 	Orientation     int    `json:"orientation,string"`
 }
 
+// Upload processing status. The resize worker records it in the metadata of
+// the upload blob, under MetaProcessingStatus, as it turns the upload into
+// the photo in the images container. The keys are capitalised as the blob
+// stores return them, and registered so that Azure's "Processingstatus" is
+// read back as MetaProcessingStatus.
+const (
+	MetaProcessingStatus    = "ProcessingStatus"
+	MetaProcessingError     = "ProcessingError"
+	MetaProcessingUpdatedAt = "ProcessingUpdatedAt"
+
+	ProcessingPending    = "pending"
+	ProcessingInProgress = "processing"
+	ProcessingDone       = "done"
+	ProcessingFailed     = "failed"
+)
+
+// MetaUploadedAt records, in the metadata of an upload and the photo made
+// from it, when the photo was uploaded (RFC 3339).
+const MetaUploadedAt = "UploadedAt"
+
+// The resize worker records, in the metadata of each photo it derives, the
+// container, size, content type and SHA-256 of the upload it was made from.
+const (
+	MetaOriginalContainer   = "OriginalContainer"
+	MetaOriginalSize        = "OriginalSize"
+	MetaOriginalContentType = "OriginalContentType"
+	MetaOriginalSha256      = "OriginalSha256"
+)
+
+// MetaOriginalName records, in the metadata of a photo that has been moved
+// or renamed, the name its original upload is stored under. Originals are
+// left where they were uploaded, since writing to the uploads container
+// would start the resize worker again.
+const MetaOriginalName = "OriginalName"
+
+// MetaDeletedAt records, in the metadata of a soft-deleted photo, when it
+// was deleted (RFC 3339), so it can be purged after a retention period. It
+// is metadata rather than a tag because photos can already have the 10 tags
+// Azure allows.
+const MetaDeletedAt = "DeletedAt"
+
 type Blob struct {
 	Name     string
 	Path     string
@@ -37,19 +78,43 @@ type Blob struct {
 }
 
 type Photo struct {
-	Src             string    `json:"src"`
-	Name            string    `json:"name"`
-	Width           int       `json:"width"`
-	Height          int       `json:"height"`
-	Album           string    `json:"album"`
-	Collection      string    `json:"collection"`
-	Description     string    `json:"description"`
-	DateTaken       time.Time `json:"dateTaken"`
-	ExifData        string    `json:"exifData"`
-	IsDeleted       bool      `json:"isDeleted"`
-	Orientation     int       `json:"orientation"`
-	AlbumImage      bool      `json:"albumImage"`
-	CollectionImage bool      `json:"collectionImage"`
+	Src string `json:"src"`
+	// Renditions maps rendition names (e.g. "thumb", "medium", "full") to
+	// their URLs. It is omitted for photos processed before renditions were
+	// generated; clients should fall back to Src.
+	Renditions      map[string]string `json:"renditions,omitempty"`
+	Name            string            `json:"name"`
+	Width           int               `json:"width"`
+	Height          int               `json:"height"`
+	Album           string            `json:"album"`
+	Collection      string            `json:"collection"`
+	Description     string            `json:"description"`
+	DateTaken       time.Time         `json:"dateTaken"`
+	Exif            *ExifData         `json:"exif,omitempty"`
+	IsDeleted       bool              `json:"isDeleted"`
+	Orientation     int               `json:"orientation"`
+	AlbumImage      bool              `json:"albumImage"`
+	CollectionImage bool              `json:"collectionImage"`
+}
+
+// ExifData holds the camera settings, location and capture time read from a
+// photo's EXIF block. Optional numeric fields that can legitimately be zero
+// (flash, GPS) are pointers so "absent" and "zero" can be told apart.
+type ExifData struct {
+	Make         string    `json:"make,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	LensModel    string    `json:"lensModel,omitempty"`
+	FocalLength  float64   `json:"focalLength,omitempty"`  // millimetres
+	Aperture     float64   `json:"aperture,omitempty"`     // f-number
+	ExposureTime float64   `json:"exposureTime,omitempty"` // seconds
+	ShutterSpeed string    `json:"shutterSpeed,omitempty"` // display form, e.g. "1/250"
+	ISO          int       `json:"iso,omitempty"`
+	Flash        *bool     `json:"flash,omitempty"` // whether the flash fired
+	Orientation  int       `json:"orientation,omitempty"`
+	Latitude     *float64  `json:"latitude,omitempty"`  // decimal degrees, south negative
+	Longitude    *float64  `json:"longitude,omitempty"` // decimal degrees, west negative
+	Altitude     *float64  `json:"altitude,omitempty"`  // metres, below sea level negative
+	DateTaken    time.Time `json:"dateTaken,omitzero"`
 }
 
 type Album struct {
@@ -62,6 +127,8 @@ type Collection struct {
 
 type MyClaims struct {
 	Roles []string `json:"roles"`
+	// Name is the caller's display name, recorded in the audit log.
+	Name string `json:"name"`
 	jwt.RegisteredClaims
 }
 
@@ -0,0 +1,90 @@
+package similarity
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+)
+
+// FromBlobs returns the photos among blobs that carry a perceptual hash in
+// their metadata, and the names of those that do not.
+func FromBlobs(blobs []models.Blob) (hashed []Photo, unhashed []string) {
+	for _, b := range blobs {
+		if h := b.MetaData[MetadataKey]; h != "" {
+			hashed = append(hashed, Photo{Name: b.Name, Hash: h})
+		} else {
+			unhashed = append(unhashed, b.Name)
+		}
+	}
+	return hashed, unhashed
+}
+
+// Scan returns every non-deleted photo in container with its perceptual
+// hash. Photos resized before hashing was introduced are downloaded and
+// hashed, concurrency at a time, and the hash is saved to their metadata so
+// the next scan need not download them again; photos that cannot be hashed
+// are logged and left out.
+func Scan(ctx context.Context, store storage.BlobStore, container string, concurrency int) ([]Photo, error) {
+	blobs, err := store.FilterBlobsByTags(ctx,
+		fmt.Sprintf("@container='%s' AND isDeleted='false'", container),
+		container)
+	if err != nil {
+		return nil, fmt.Errorf("listing photos: %w", err)
+	}
+
+	photos, unhashed := FromBlobs(blobs)
+	slog.InfoContext(ctx, "photos found", "count", len(blobs), "unhashed", len(unhashed))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	for _, name := range unhashed {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, err := store.GetBlob(ctx, name, container)
+			if err != nil {
+				slog.WarnContext(ctx, "download failed", "blob", name, "error", err)
+				return
+			}
+			hash, err := HashBytes(data)
+			if err != nil {
+				slog.WarnContext(ctx, "hashing failed", "blob", name, "error", err)
+				return
+			}
+			if err := saveHash(ctx, store, name, container, hash); err != nil {
+				slog.WarnContext(ctx, "saving hash failed", "blob", name, "error", err)
+			}
+			mu.Lock()
+			photos = append(photos, Photo{Name: name, Hash: hash})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return photos, nil
+}
+
+// saveHash records hash in the metadata of blobName, keeping its other
+// metadata.
+func saveHash(ctx context.Context, store storage.BlobStore, blobName, container, hash string) error {
+	md, err := store.GetBlobMetadata(ctx, blobName, container)
+	if err != nil {
+		return fmt.Errorf("reading metadata: %w", err)
+	}
+	if md == nil {
+		md = map[string]string{}
+	}
+	md[MetadataKey] = hash
+	if err := store.SetBlobMetadata(ctx, blobName, container, md); err != nil {
+		return fmt.Errorf("writing metadata: %w", err)
+	}
+	return nil
+}
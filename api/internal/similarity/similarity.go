@@ -0,0 +1,162 @@
+// Package similarity finds near-duplicate photos by comparing 64-bit
+// difference hashes (dHash) of the whole image. Re-exported, rescaled or
+// recompressed copies of a photo hash to within a few bits of each other,
+// whereas the contentHash tag only matches byte-identical uploads.
+package similarity
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"slices"
+	"strconv"
+
+	"github.com/cbellee/photo-api/internal/facedetect"
+	"github.com/cbellee/photo-api/internal/models"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MetadataKey is the blob metadata key under which the resize worker stores
+// a photo's perceptual hash.
+const MetadataKey = "PerceptualHash"
+
+func init() {
+	models.RegisterMetadataKeys(MetadataKey)
+}
+
+// DefaultMaxHamming is the largest Hamming distance, out of 64 bits, at which
+// two photos are reported as near-duplicates by default.
+const DefaultMaxHamming = 10
+
+// HashBits is the number of bits in a perceptual hash and so the largest
+// possible Hamming distance.
+const HashBits = 64
+
+// Hash returns the perceptual hash of img as a 16-character hex string.
+func Hash(img image.Image) string {
+	return facedetect.ComputeDHash(img)
+}
+
+// HashBytes decodes a JPEG, PNG, GIF or WebP image and returns its
+// perceptual hash.
+func HashBytes(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding image: %w", err)
+	}
+	return Hash(img), nil
+}
+
+// Photo pairs a blob name with its perceptual hash.
+type Photo struct {
+	Name string
+	Hash string
+}
+
+// Match is a photo within the requested distance of another.
+type Match struct {
+	Name     string `json:"name"`
+	Distance int    `json:"distance"`
+}
+
+// Cluster is a group of photos linked by near-duplicate pairs. Photos are
+// ordered by name.
+type Cluster struct {
+	Photos []string `json:"photos"`
+	// MaxDistance is the largest distance between two linked photos.
+	MaxDistance int `json:"maxDistance"`
+}
+
+// Similar returns the photos whose hash is within maxHamming bits of hash,
+// closest first. Photos with malformed hashes are ignored.
+func Similar(hash string, photos []Photo, maxHamming int) []Match {
+	matches := []Match{}
+	for _, p := range photos {
+		if d := facedetect.HammingDistance(hash, p.Hash); d <= maxHamming {
+			matches = append(matches, Match{Name: p.Name, Distance: d})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return matches
+}
+
+// Clusters groups photos so that every photo within maxHamming bits of
+// another ends up in the same cluster, and returns the clusters with more
+// than one photo, largest first. Every pair is compared, which is fast enough
+// for a nightly run over a personal library.
+func Clusters(photos []Photo, maxHamming int) []Cluster {
+	hashes := make([]uint64, 0, len(photos))
+	valid := make([]Photo, 0, len(photos))
+	for _, p := range photos {
+		// Bit order does not affect the distance, so the hex string can be
+		// parsed directly.
+		h, err := strconv.ParseUint(p.Hash, 16, 64)
+		if err != nil || len(p.Hash) != HashBits/4 {
+			continue
+		}
+		hashes = append(hashes, h)
+		valid = append(valid, p)
+	}
+
+	parent := make([]int, len(valid))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	maxDist := make(map[int]int)
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			d := bits.OnesCount64(hashes[i] ^ hashes[j])
+			if d > maxHamming {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[rj] = ri
+				maxDist[ri] = max(maxDist[ri], maxDist[rj])
+				delete(maxDist, rj)
+			}
+			maxDist[ri] = max(maxDist[ri], d)
+		}
+	}
+
+	members := make(map[int][]string)
+	for i, p := range valid {
+		r := find(i)
+		members[r] = append(members[r], p.Name)
+	}
+
+	clusters := []Cluster{}
+	for r, names := range members {
+		if len(names) < 2 {
+			continue
+		}
+		slices.Sort(names)
+		clusters = append(clusters, Cluster{Photos: names, MaxDistance: maxDist[r]})
+	}
+	slices.SortFunc(clusters, func(a, b Cluster) int {
+		if c := cmp.Compare(len(b.Photos), len(a.Photos)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Photos[0], b.Photos[0])
+	})
+	return clusters
+}
@@ -0,0 +1,152 @@
+package similarity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"testing"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/cbellee/photo-api/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/draw"
+)
+
+// gradient draws a diagonal gradient with a bright block, so the dHash has a
+// mix of set and clear bits.
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := uint8((x*255/w + y*128/h) % 256)
+			if x > w/3 && x < w/2 && y > h/4 && y < h/2 {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}))
+	return buf.Bytes()
+}
+
+func TestHashBytes_RecompressedCopyIsNear(t *testing.T) {
+	src := gradient(640, 480)
+	orig, err := HashBytes(encodeJPEG(t, src, 95))
+	require.NoError(t, err)
+	assert.Len(t, orig, 16)
+
+	small := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	draw.CatmullRom.Scale(small, small.Bounds(), src, src.Bounds(), draw.Src, nil)
+	copyHash, err := HashBytes(encodeJPEG(t, small, 40))
+	require.NoError(t, err)
+
+	matches := Similar(orig, []Photo{{Name: "copy.jpg", Hash: copyHash}}, DefaultMaxHamming)
+	require.Len(t, matches, 1)
+	assert.LessOrEqual(t, matches[0].Distance, DefaultMaxHamming)
+}
+
+func TestHashBytes_InvalidImage(t *testing.T) {
+	_, err := HashBytes([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+func TestSimilar_OrdersByDistance(t *testing.T) {
+	photos := []Photo{
+		{Name: "far.jpg", Hash: "ffffffffffffffff"},
+		{Name: "b.jpg", Hash: "0000000000000003"},
+		{Name: "a.jpg", Hash: "0000000000000001"},
+		{Name: "c.jpg", Hash: "0000000000000003"},
+		{Name: "bad.jpg", Hash: "zz"},
+	}
+	matches := Similar("0000000000000000", photos, 4)
+	assert.Equal(t, []Match{
+		{Name: "a.jpg", Distance: 1},
+		{Name: "b.jpg", Distance: 2},
+		{Name: "c.jpg", Distance: 2},
+	}, matches)
+}
+
+func TestClusters_LinksTransitively(t *testing.T) {
+	photos := []Photo{
+		{Name: "x/1.jpg", Hash: "0000000000000000"},
+		{Name: "x/2.jpg", Hash: "000000000000000f"}, // 4 from 1
+		{Name: "x/3.jpg", Hash: "00000000000000ff"}, // 4 from 2, 8 from 1
+		{Name: "y/1.jpg", Hash: "ffffffffffffffff"},
+		{Name: "y/2.jpg", Hash: "fffffffffffffffe"},
+		{Name: "z/alone.jpg", Hash: "00ff00ff00ff00ff"},
+		{Name: "z/bad.jpg", Hash: "not-hex"},
+	}
+	clusters := Clusters(photos, 4)
+	assert.Equal(t, []Cluster{
+		{Photos: []string{"x/1.jpg", "x/2.jpg", "x/3.jpg"}, MaxDistance: 4},
+		{Photos: []string{"y/1.jpg", "y/2.jpg"}, MaxDistance: 1},
+	}, clusters)
+}
+
+func TestClusters_NoneWithinThreshold(t *testing.T) {
+	photos := []Photo{
+		{Name: "a.jpg", Hash: "0000000000000000"},
+		{Name: "b.jpg", Hash: "ffffffffffffffff"},
+	}
+	assert.Empty(t, Clusters(photos, DefaultMaxHamming))
+}
+
+func TestScan_HashesPhotosWithoutMetadata(t *testing.T) {
+	unhashed := encodeJPEG(t, gradient(64, 48), 90)
+	want, err := HashBytes(unhashed)
+	require.NoError(t, err)
+
+	mock := &storage.MockBlobStore{
+		FilterBlobsByTagsFunc: func(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
+			assert.Equal(t, "@container='images' AND isDeleted='false'", query)
+			return []models.Blob{
+				{Name: "a/b/hashed.jpg", MetaData: map[string]string{MetadataKey: "0123456789abcdef"}},
+				{Name: "a/b/old.jpg", MetaData: map[string]string{}},
+				{Name: "a/b/missing.jpg"},
+			}, nil
+		},
+		GetBlobFunc: func(ctx context.Context, blobName string, containerName string) ([]byte, error) {
+			if blobName == "a/b/old.jpg" {
+				return unhashed, nil
+			}
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, blobName)
+		},
+		GetBlobMetadataFunc: func(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
+			return map[string]string{"Width": "64"}, nil
+		},
+	}
+
+	photos, err := Scan(context.Background(), mock, "images", 2)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Photo{
+		{Name: "a/b/hashed.jpg", Hash: "0123456789abcdef"},
+		{Name: "a/b/old.jpg", Hash: want},
+	}, photos)
+
+	// The new hash is saved so the next scan does not download the photo.
+	require.Len(t, mock.SetBlobMetadataCalls, 1)
+	assert.Equal(t, "a/b/old.jpg", mock.SetBlobMetadataCalls[0].BlobName)
+	assert.Equal(t, map[string]string{"Width": "64", MetadataKey: want}, mock.SetBlobMetadataCalls[0].Metadata)
+}
+
+func TestFromBlobs_AzureKeyCasing(t *testing.T) {
+	// Azure returns "PerceptualHash" as "Perceptualhash"; the store maps it
+	// back through the registered key.
+	key := models.CanonicalMetadataKey(http.CanonicalHeaderKey(MetadataKey))
+	hashed, unhashed := FromBlobs([]models.Blob{
+		{Name: "a/b/c.jpg", MetaData: map[string]string{key: "0123456789abcdef"}},
+	})
+	assert.Equal(t, []Photo{{Name: "a/b/c.jpg", Hash: "0123456789abcdef"}}, hashed)
+	assert.Empty(t, unhashed)
+}
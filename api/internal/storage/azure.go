@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"slices"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/cbellee/photo-api/internal/models"
 )
 
@@ -29,14 +36,59 @@ func NewAzureBlobStore(client *azblob.Client, storageUrl string) *AzureBlobStore
 }
 
 func (s *AzureBlobStore) FilterBlobsByTags(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
-	var blobs []models.Blob
-
 	resp, err := s.client.ServiceClient().FilterBlobs(ctx, query, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, _blob := range resp.Blobs {
+	blobs, err := s.filterBlobItemsToBlobs(ctx, resp.Blobs, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blobs) == 0 {
+		slog.Debug("no blobs found", "query", query)
+		return nil, nil
+	}
+
+	slog.Info("found blobs by tag query", "query", query, "num_blobs", len(blobs))
+	return blobs, nil
+}
+
+func (s *AzureBlobStore) FilterBlobsByTagsPage(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+	opts := &service.FilterBlobsOptions{}
+	if marker != "" {
+		opts.Marker = &marker
+	}
+	if maxResults > 0 {
+		opts.MaxResults = &maxResults
+	}
+
+	resp, err := s.client.ServiceClient().FilterBlobs(ctx, query, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	blobs, err := s.filterBlobItemsToBlobs(ctx, resp.Blobs, containerName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextMarker string
+	if resp.NextMarker != nil {
+		nextMarker = *resp.NextMarker
+	}
+
+	slog.Info("found blobs by paged tag query", "query", query, "num_blobs", len(blobs), "has_more", nextMarker != "")
+	return blobs, nextMarker, nil
+}
+
+// filterBlobItemsToBlobs resolves the tags and metadata for each FilterBlobs
+// result item.
+func (s *AzureBlobStore) filterBlobItemsToBlobs(ctx context.Context, items []*service.FilterBlobItem, containerName string) ([]models.Blob, error) {
+	var blobs []models.Blob
+
+	for _, _blob := range items {
 		blobPath := fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, *_blob.Name)
 
 		tags, err := s.GetBlobTags(ctx, *_blob.Name, containerName)
@@ -51,7 +103,7 @@ func (s *AzureBlobStore) FilterBlobsByTags(ctx context.Context, query string, co
 
 		b := models.Blob{
 			Name:     *_blob.Name,
-			Path:     fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, *_blob.Name),
+			Path:     blobPath,
 			Tags:     tags,
 			MetaData: md,
 		}
@@ -59,12 +111,6 @@ func (s *AzureBlobStore) FilterBlobsByTags(ctx context.Context, query string, co
 		blobs = append(blobs, b)
 	}
 
-	if len(blobs) == 0 {
-		slog.Debug("no blobs found", "query", query)
-		return nil, nil
-	}
-
-	slog.Info("found blobs by tag query", "query", query, "num_blobs", len(blobs))
 	return blobs, nil
 }
 
@@ -101,17 +147,44 @@ func (s *AzureBlobStore) GetBlobMetadata(ctx context.Context, blobName string, c
 
 	mdResponse, err := blobClient.GetProperties(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("getting blob metadata %s/%s: %w", containerName, blobName, err)
+		return nil, fmt.Errorf("getting blob metadata %s/%s: %w", containerName, blobName, notFound(err))
 	}
 
-	m := make(map[string]string)
-	for key, value := range mdResponse.Metadata {
-		m[key] = *value
-	}
+	m := metadataFromHeaders(mdResponse.Metadata)
 	slog.Debug("got blob metadata", "blob", blobName, "metadata", m)
 	return m, nil
 }
 
+// metadataFromHeaders converts metadata returned by the SDK, whose keys are
+// in canonical HTTP header form ("Deletedat"), to the casing the services
+// look keys up by ("DeletedAt").
+func metadataFromHeaders(md map[string]*string) map[string]string {
+	m := make(map[string]string, len(md))
+	for key, value := range md {
+		if value != nil {
+			m[models.CanonicalMetadataKey(key)] = *value
+		}
+	}
+	return m
+}
+
+func (s *AzureBlobStore) SetBlobMetadata(ctx context.Context, blobName string, containerName string, metadata map[string]string) error {
+	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	md := make(map[string]*string)
+	for key, value := range metadata {
+		v := value
+		md[key] = &v
+	}
+
+	_, err := blockBlob.SetMetadata(ctx, md, nil)
+	if err != nil {
+		return fmt.Errorf("setting blob metadata %s/%s: %w", containerName, blobName, notFound(err))
+	}
+	slog.Debug("set blob metadata", "blob", blobName, "metadata", metadata)
+	return nil
+}
+
 func (s *AzureBlobStore) GetBlobTagList(ctx context.Context, containerName string) (map[string][]string, error) {
 	pager := s.client.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{
 		Include: container.ListBlobsInclude{
@@ -155,13 +228,32 @@ func (s *AzureBlobStore) GetBlobTagList(ctx context.Context, containerName strin
 	return blobTagMap, nil
 }
 
+func (s *AzureBlobStore) ListBlobNames(ctx context.Context, prefix string, containerName string) ([]string, error) {
+	pager := s.client.ServiceClient().NewContainerClient(containerName).NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: &prefix,
+	})
+	var names []string
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing blobs %s/%s: %w", containerName, prefix, notFound(err))
+		}
+		for _, item := range resp.Segment.BlobItems {
+			if item.Name != nil {
+				names = append(names, *item.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
 func (s *AzureBlobStore) GetBlob(ctx context.Context, blobName string, containerName string) ([]byte, error) {
 	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
 
 	// Ensure blob exists.
 	_, err := blockBlob.GetProperties(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("blob not found %s/%s: %w", containerName, blobName, err)
+		return nil, fmt.Errorf("blob not found %s/%s: %w", containerName, blobName, notFound(err))
 	}
 
 	blobStream, err := blockBlob.DownloadStream(ctx, &blob.DownloadStreamOptions{})
@@ -179,6 +271,69 @@ func (s *AzureBlobStore) GetBlob(ctx context.Context, blobName string, container
 	return buf.Bytes(), nil
 }
 
+func (s *AzureBlobStore) GetBlobProperties(ctx context.Context, blobName string, containerName string) (BlobProperties, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	resp, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		return BlobProperties{}, fmt.Errorf("getting blob properties %s/%s: %w", containerName, blobName, notFound(err))
+	}
+
+	var props BlobProperties
+	if resp.ContentType != nil {
+		props.ContentType = *resp.ContentType
+	}
+	if resp.ContentLength != nil {
+		props.ContentLength = *resp.ContentLength
+		props.Size = *resp.ContentLength
+	}
+	if resp.ETag != nil {
+		props.ETag = string(*resp.ETag)
+	}
+	if resp.LastModified != nil {
+		props.LastModified = *resp.LastModified
+	}
+	return props, nil
+}
+
+func (s *AzureBlobStore) OpenBlob(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error) {
+	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	opts := &blob.DownloadStreamOptions{Range: blob.HTTPRange{Offset: rangeStart}}
+	if rangeEnd >= 0 {
+		opts.Range.Count = rangeEnd - rangeStart + 1
+	}
+	resp, err := blockBlob.DownloadStream(ctx, opts)
+	if bloberror.HasCode(err, bloberror.InvalidRange) {
+		return nil, BlobProperties{}, fmt.Errorf("opening blob %s/%s: %w: %w", containerName, blobName, ErrInvalidRange, err)
+	}
+	if err != nil {
+		return nil, BlobProperties{}, fmt.Errorf("opening blob %s/%s: %w", containerName, blobName, notFound(err))
+	}
+
+	var props BlobProperties
+	if resp.ContentType != nil {
+		props.ContentType = *resp.ContentType
+	}
+	if resp.ContentLength != nil {
+		props.ContentLength = *resp.ContentLength
+	}
+	props.Size = props.ContentLength
+	if resp.ContentRange != nil {
+		if n := rangeSize(*resp.ContentRange); n >= 0 {
+			props.Size = n
+		}
+	}
+	if resp.ETag != nil {
+		props.ETag = string(*resp.ETag)
+	}
+	if resp.LastModified != nil {
+		props.LastModified = *resp.LastModified
+	}
+
+	return resp.NewRetryReader(ctx, &azblob.RetryReaderOptions{}), props, nil
+}
+
 func (s *AzureBlobStore) SaveBlob(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
 	blobUrl := fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, blobName)
 	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
@@ -204,14 +359,157 @@ func (s *AzureBlobStore) SaveBlob(ctx context.Context, reader io.ReadSeeker, siz
 	return nil
 }
 
+// SaveBlobIfMatch uploads with If-Match, or If-None-Match: * for a new
+// blob, so Azure rejects the write if another writer got there first.
+func (s *AzureBlobStore) SaveBlobIfMatch(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error) {
+	blobUrl := fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, blobName)
+	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	md := make(map[string]*string)
+	for key, value := range metadata {
+		v := value
+		md[key] = &v
+	}
+
+	cond := &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)}
+	if etag != "" {
+		cond = &blob.ModifiedAccessConditions{IfMatch: to.Ptr(azcore.ETag(etag))}
+	}
+	resp, err := blockBlob.Upload(ctx, streaming.NopCloser(reader), &blockblob.UploadOptions{
+		Tags:     tags,
+		Metadata: md,
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: &contentType,
+		},
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: cond},
+	})
+	if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+		return "", fmt.Errorf("uploading blob %s: %w: %w", blobUrl, ErrConditionNotMet, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("uploading blob %s: %w", blobUrl, err)
+	}
+
+	slog.Debug("uploaded blob", "blob_url", blobUrl, "if_match", etag)
+	if resp.ETag == nil {
+		return "", nil
+	}
+	return string(*resp.ETag), nil
+}
+
+func (s *AzureBlobStore) StageBlock(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error {
+	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	_, err := blockBlob.StageBlock(ctx, blockID, streaming.NopCloser(reader), nil)
+	if err != nil {
+		return fmt.Errorf("staging block %s of %s/%s: %w", blockID, containerName, blobName, err)
+	}
+
+	slog.Debug("staged block", "container", containerName, "blob", blobName, "block_id", blockID, "size", size)
+	return nil
+}
+
+func (s *AzureBlobStore) CommitBlockList(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error {
+	blobUrl := fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, blobName)
+	blockBlob := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+
+	md := make(map[string]*string)
+	for key, value := range metadata {
+		v := value
+		md[key] = &v
+	}
+
+	_, err := blockBlob.CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		Tags:     tags,
+		Metadata: md,
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: &contentType,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("committing block list of %s: %w", blobUrl, err)
+	}
+
+	slog.Debug("committed block list", "blob_url", blobUrl, "blocks", len(blockIDs))
+	return nil
+}
+
+// PresignUpload signs a blob-scoped, create/write-only SAS with a user
+// delegation key, so it works with the managed identity and needs no account
+// key. The start time is backdated to tolerate clock skew.
+func (s *AzureBlobStore) PresignUpload(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (PresignedUpload, error) {
+	now := time.Now().UTC()
+	start, expiresOn := now.Add(-5*time.Minute), now.Add(expiry)
+
+	startStr, expiryStr := start.Format(sas.TimeFormat), expiresOn.Format(sas.TimeFormat)
+	cred, err := s.client.ServiceClient().GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  &startStr,
+		Expiry: &expiryStr,
+	}, nil)
+	if err != nil {
+		return PresignedUpload{}, fmt.Errorf("getting user delegation key: %w", err)
+	}
+
+	qp, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     start,
+		ExpiryTime:    expiresOn,
+		Permissions:   (&sas.BlobPermissions{Create: true, Write: true}).String(),
+		ContainerName: containerName,
+		BlobName:      blobName,
+	}.SignWithUserDelegation(cred)
+	if err != nil {
+		return PresignedUpload{}, fmt.Errorf("signing upload sas for %s: %w", blobName, err)
+	}
+
+	blobClient := s.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName)
+	return PresignedUpload{
+		URL:    blobClient.URL() + "?" + qp.Encode(),
+		Method: http.MethodPut,
+		Headers: map[string]string{
+			"x-ms-blob-type": "BlockBlob",
+			"Content-Type":   contentType,
+		},
+		ExpiresOn: expiresOn,
+	}, nil
+}
+
+// copyPollInterval is how often CopyBlob checks on a copy that Azure has
+// not finished synchronously.
+const copyPollInterval = 500 * time.Millisecond
+
 func (s *AzureBlobStore) CopyBlob(ctx context.Context, srcBlobName string, destBlobName string, containerName string) error {
-	srcURL := fmt.Sprintf("%s/%s/%s", s.storageUrl, containerName, srcBlobName)
 	container := s.client.ServiceClient().NewContainerClient(containerName)
+	srcURL := container.NewBlobClient(srcBlobName).URL()
 	destBlob := container.NewBlockBlobClient(destBlobName)
 
-	_, err := destBlob.StartCopyFromURL(ctx, srcURL, nil)
+	resp, err := destBlob.StartCopyFromURL(ctx, srcURL, nil)
 	if err != nil {
-		return fmt.Errorf("copying blob %s to %s: %w", srcBlobName, destBlobName, err)
+		return fmt.Errorf("copying blob %s to %s: %w", srcBlobName, destBlobName, notFound(err))
+	}
+
+	// Copies within an account usually complete synchronously, but Azure
+	// may report them pending; the source must not be deleted until the
+	// copy has succeeded.
+	status, desc := resp.CopyStatus, (*string)(nil)
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("copying blob %s to %s: %w", srcBlobName, destBlobName, ctx.Err())
+		case <-time.After(copyPollInterval):
+		}
+		props, err := destBlob.GetProperties(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("checking copy of %s to %s: %w", srcBlobName, destBlobName, err)
+		}
+		status, desc = props.CopyStatus, props.CopyStatusDescription
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		reason := ""
+		if desc != nil {
+			reason = ": " + *desc
+		}
+		return fmt.Errorf("copying blob %s to %s: copy %s%s", srcBlobName, destBlobName, *status, reason)
 	}
 
 	slog.Debug("copied blob", "src", srcBlobName, "dest", destBlobName)
@@ -224,12 +522,21 @@ func (s *AzureBlobStore) DeleteBlob(ctx context.Context, blobName string, contai
 
 	_, err := blobClient.Delete(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("deleting blob %s: %w", blobName, err)
+		return fmt.Errorf("deleting blob %s: %w", blobName, notFound(err))
 	}
 
 	slog.Debug("deleted blob", "blob", blobName)
 	return nil
 }
 
+// notFound wraps err with ErrNotFound when Azure reports that the blob or
+// its container does not exist.
+func notFound(err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
 // Compile-time check that AzureBlobStore implements BlobStore.
 var _ BlobStore = (*AzureBlobStore)(nil)
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/cbellee/photo-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataFromHeaders(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	// Azure returns metadata names in canonical HTTP header form.
+	got := metadataFromHeaders(map[string]*string{
+		"Deletedat":        value("2026-03-01T00:00:00Z"),
+		"Processingstatus": value("done"),
+		"Originalsha256":   value("abc123"),
+		"Originalname":     value("nature/sunset/IMG_1.jpg"),
+		"Uploadedat":       value("2026-02-01T00:00:00Z"),
+		"Width":            value("800"),
+		"height":           value("600"),
+		"Missing":          nil,
+	})
+
+	assert.Equal(t, map[string]string{
+		models.MetaDeletedAt:        "2026-03-01T00:00:00Z",
+		models.MetaProcessingStatus: "done",
+		models.MetaOriginalSha256:   "abc123",
+		models.MetaOriginalName:     "nature/sunset/IMG_1.jpg",
+		models.MetaUploadedAt:       "2026-02-01T00:00:00Z",
+		"Width":                     "800",
+		"Height":                    "600",
+	}, got)
+}
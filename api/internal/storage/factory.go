@@ -15,7 +15,9 @@ import (
 func NewBlobStore(storageUrl string, azureClientID string) (BlobStore, error) {
 	if blobEmuURL := os.Getenv("BLOB_EMULATOR_URL"); blobEmuURL != "" {
 		slog.Info("using local blob emulator", "url", blobEmuURL)
-		return NewLocalBlobStore(blobEmuURL, storageUrl), nil
+		store := NewLocalBlobStore(blobEmuURL, storageUrl)
+		store.signingKey = []byte(os.Getenv("BLOB_SIGNING_KEY"))
+		return store, nil
 	}
 
 	isProduction := false
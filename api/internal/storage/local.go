@@ -3,13 +3,18 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +28,8 @@ type LocalBlobStore struct {
 	baseURL    string // internal URL for API calls to blobemu
 	publicURL  string // browser-reachable URL used in Blob.Path
 	httpClient *http.Client
+	// signingKey is shared with blobemu to sign presigned upload URLs.
+	signingKey []byte
 }
 
 // NewLocalBlobStore creates a store that proxies all operations to the
@@ -46,35 +53,55 @@ type blobResponse struct {
 	Metadata  map[string]string `json:"metadata"`
 }
 
+// queryRequest mirrors the JSON body accepted by the emulator's /query endpoint.
+type queryRequest struct {
+	Query      string `json:"query"`
+	Marker     string `json:"marker,omitempty"`
+	MaxResults int32  `json:"maxResults,omitempty"`
+}
+
 // ---------- BlobStore implementation ----------
 
 func (s *LocalBlobStore) FilterBlobsByTags(ctx context.Context, query string, containerName string) ([]models.Blob, error) {
-	body, _ := json.Marshal(map[string]string{"query": query})
+	blobs, _, err := s.queryBlobs(ctx, query, containerName, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, nil
+	}
+	return blobs, nil
+}
+
+func (s *LocalBlobStore) FilterBlobsByTagsPage(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+	return s.queryBlobs(ctx, query, containerName, marker, maxResults)
+}
+
+// queryBlobs posts a tag query to the emulator. The emulator returns the
+// continuation marker in the X-Next-Marker response header.
+func (s *LocalBlobStore) queryBlobs(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+	body, _ := json.Marshal(queryRequest{Query: query, Marker: marker, MaxResults: maxResults})
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/query", bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("query request failed: %w", err)
+		return nil, "", fmt.Errorf("query request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("query failed (%d): %s", resp.StatusCode, string(b))
+		return nil, "", fmt.Errorf("query failed (%d): %s", resp.StatusCode, string(b))
 	}
 
 	var items []blobResponse
 	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
-	}
-
-	if len(items) == 0 {
-		return nil, nil
+		return nil, "", fmt.Errorf("decoding response: %w", err)
 	}
 
 	blobs := make([]models.Blob, 0, len(items))
@@ -86,7 +113,7 @@ func (s *LocalBlobStore) FilterBlobsByTags(ctx context.Context, query string, co
 			MetaData: item.Metadata,
 		})
 	}
-	return blobs, nil
+	return blobs, resp.Header.Get("X-Next-Marker"), nil
 }
 
 func (s *LocalBlobStore) GetBlobTags(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
@@ -151,6 +178,9 @@ func (s *LocalBlobStore) GetBlobMetadata(ctx context.Context, blobName string, c
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get metadata status %d: %w", resp.StatusCode, ErrNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("get metadata status %d", resp.StatusCode)
 	}
@@ -162,6 +192,32 @@ func (s *LocalBlobStore) GetBlobMetadata(ctx context.Context, blobName string, c
 	return md, nil
 }
 
+func (s *LocalBlobStore) SetBlobMetadata(ctx context.Context, blobName string, containerName string, metadata map[string]string) error {
+	body, _ := json.Marshal(metadata)
+	u := s.blobURL(containerName, blobName) + "?comp=metadata"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("set metadata failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("set metadata status %d: %w", resp.StatusCode, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("set metadata status %d: %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
 func (s *LocalBlobStore) GetBlobTagList(ctx context.Context, containerName string) (map[string][]string, error) {
 	u := fmt.Sprintf("%s/%s", s.baseURL, url.PathEscape(containerName))
 
@@ -197,6 +253,35 @@ func (s *LocalBlobStore) GetBlobTagList(ctx context.Context, containerName strin
 	return tagMap, nil
 }
 
+func (s *LocalBlobStore) ListBlobNames(ctx context.Context, prefix string, containerName string) ([]string, error) {
+	u := fmt.Sprintf("%s/%s?prefix=%s", s.baseURL, url.PathEscape(containerName), url.QueryEscape(prefix))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list blobs failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list blobs status %d", resp.StatusCode)
+	}
+
+	var items []blobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names, nil
+}
+
 func (s *LocalBlobStore) GetBlob(ctx context.Context, blobName string, containerName string) ([]byte, error) {
 	u := s.blobURL(containerName, blobName)
 
@@ -211,6 +296,9 @@ func (s *LocalBlobStore) GetBlob(ctx context.Context, blobName string, container
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get blob status %d: %w", resp.StatusCode, ErrNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("get blob status %d: %s", resp.StatusCode, string(b))
@@ -225,15 +313,99 @@ func (s *LocalBlobStore) GetBlob(ctx context.Context, blobName string, container
 	return data, nil
 }
 
+func (s *LocalBlobStore) GetBlobProperties(ctx context.Context, blobName string, containerName string) (BlobProperties, error) {
+	u := s.blobURL(containerName, blobName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return BlobProperties{}, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return BlobProperties{}, fmt.Errorf("get properties failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return BlobProperties{}, fmt.Errorf("get properties status %d: %w", resp.StatusCode, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return BlobProperties{}, fmt.Errorf("get properties status %d", resp.StatusCode)
+	}
+
+	return responseProperties(resp), nil
+}
+
+func (s *LocalBlobStore) OpenBlob(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error) {
+	u := s.blobURL(containerName, blobName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, BlobProperties{}, err
+	}
+	if rangeStart > 0 || rangeEnd >= 0 {
+		end := ""
+		if rangeEnd >= 0 {
+			end = strconv.FormatInt(rangeEnd, 10)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%s", rangeStart, end))
+	}
+
+	// The client timeout would cut off slow readers of large blobs, so the
+	// stream is bounded by ctx alone.
+	client := *s.httpClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, BlobProperties{}, fmt.Errorf("open blob failed: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, BlobProperties{}, fmt.Errorf("open blob status %d: %w", resp.StatusCode, ErrNotFound)
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, BlobProperties{}, fmt.Errorf("open blob status %d: %w", resp.StatusCode, ErrInvalidRange)
+	default:
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, BlobProperties{}, fmt.Errorf("open blob status %d: %s", resp.StatusCode, string(b))
+	}
+
+	slog.Debug("opened blob via emulator", "container", containerName, "name", blobName, "status", resp.StatusCode)
+	return resp.Body, responseProperties(resp), nil
+}
+
 func (s *LocalBlobStore) SaveBlob(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error {
+	_, err := s.putBlob(ctx, reader, size, blobName, containerName, tags, metadata, contentType, nil)
+	return err
+}
+
+func (s *LocalBlobStore) SaveBlobIfMatch(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error) {
+	cond := http.Header{"If-None-Match": {"*"}}
+	if etag != "" {
+		cond = http.Header{"If-Match": {etag}}
+	}
+	return s.putBlob(ctx, reader, size, blobName, containerName, tags, metadata, contentType, cond)
+}
+
+// putBlob uploads a blob with any extra request headers and returns its
+// new ETag.
+func (s *LocalBlobStore) putBlob(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, header http.Header) (string, error) {
 	u := s.blobURL(containerName, blobName)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, io.NopCloser(reader))
 	if err != nil {
-		return err
+		return "", err
 	}
 	req.ContentLength = size
 
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
@@ -248,19 +420,119 @@ func (s *LocalBlobStore) SaveBlob(ctx context.Context, reader io.ReadSeeker, siz
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("save blob failed: %w", err)
+		return "", fmt.Errorf("save blob failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return "", fmt.Errorf("save blob status %d: %w", resp.StatusCode, ErrConditionNotMet)
+	}
 	if resp.StatusCode != http.StatusCreated {
 		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("save blob status %d: %s", resp.StatusCode, string(b))
+		return "", fmt.Errorf("save blob status %d: %s", resp.StatusCode, string(b))
 	}
 
 	slog.Debug("saved blob via emulator", "container", containerName, "name", blobName)
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *LocalBlobStore) StageBlock(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error {
+	u := s.blobURL(containerName, blobName) + "?comp=block&blockid=" + url.QueryEscape(blockID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, io.NopCloser(reader))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stage block failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("stage block status %d: %s", resp.StatusCode, string(b))
+	}
+
+	slog.Debug("staged block via emulator", "container", containerName, "name", blobName, "block_id", blockID)
 	return nil
 }
 
+func (s *LocalBlobStore) CommitBlockList(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error {
+	u := s.blobURL(containerName, blobName) + "?comp=blocklist"
+
+	body, err := json.Marshal(blockIDs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		req.Header.Set("X-Blob-Content-Type", contentType)
+	}
+	if tags != nil {
+		j, _ := json.Marshal(tags)
+		req.Header.Set("X-Blob-Tags", string(j))
+	}
+	if metadata != nil {
+		j, _ := json.Marshal(metadata)
+		req.Header.Set("X-Blob-Metadata", string(j))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("commit block list failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("commit block list status %d: %s", resp.StatusCode, string(b))
+	}
+
+	slog.Debug("committed block list via emulator", "container", containerName, "name", blobName, "blocks", len(blockIDs))
+	return nil
+}
+
+// uploadPermissions is the sp value of presigned uploads: create and write.
+const uploadPermissions = "cw"
+
+// PresignUpload returns a browser-reachable URL signed with the key shared
+// with blobemu, which checks the signature and expiry before accepting the
+// PUT.
+func (s *LocalBlobStore) PresignUpload(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (PresignedUpload, error) {
+	if len(s.signingKey) == 0 {
+		return PresignedUpload{}, errors.New("presigned uploads need BLOB_SIGNING_KEY to be set")
+	}
+
+	expiresOn := time.Now().Add(expiry).UTC().Truncate(time.Second)
+	se := strconv.FormatInt(expiresOn.Unix(), 10)
+	q := url.Values{
+		"se":  {se},
+		"sp":  {uploadPermissions},
+		"sig": {signUpload(s.signingKey, containerName, blobName, uploadPermissions, se)},
+	}
+	return PresignedUpload{
+		URL:       s.publicURL + "/" + escapeBlobPath(containerName, blobName) + "?" + q.Encode(),
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresOn: expiresOn,
+	}, nil
+}
+
+// signUpload computes the signature of a presigned upload. It must match
+// the check in blobemu's main.go.
+func signUpload(key []byte, container, blobName, permissions, expiry string) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s/%s\n%s", permissions, container, blobName, expiry)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func (s *LocalBlobStore) CopyBlob(ctx context.Context, srcBlobName string, destBlobName string, containerName string) error {
 	// Download the source blob and re-upload as the destination.
 	data, err := s.GetBlob(ctx, srcBlobName, containerName)
@@ -270,8 +542,9 @@ func (s *LocalBlobStore) CopyBlob(ctx context.Context, srcBlobName string, destB
 
 	tags, _ := s.GetBlobTags(ctx, srcBlobName, containerName)
 	md, _ := s.GetBlobMetadata(ctx, srcBlobName, containerName)
+	props, _ := s.GetBlobProperties(ctx, srcBlobName, containerName)
 
-	if err := s.SaveBlob(ctx, bytes.NewReader(data), int64(len(data)), destBlobName, containerName, tags, md, ""); err != nil {
+	if err := s.SaveBlob(ctx, bytes.NewReader(data), int64(len(data)), destBlobName, containerName, tags, md, props.ContentType); err != nil {
 		return fmt.Errorf("copy: writing dest blob: %w", err)
 	}
 
@@ -293,6 +566,9 @@ func (s *LocalBlobStore) DeleteBlob(ctx context.Context, blobName string, contai
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("delete blob status %d: %w", resp.StatusCode, ErrNotFound)
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		b, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("delete blob status %d: %s", resp.StatusCode, string(b))
@@ -304,14 +580,37 @@ func (s *LocalBlobStore) DeleteBlob(ctx context.Context, blobName string, contai
 
 // ---------- helpers ----------
 
+// responseProperties reads BlobProperties from the emulator's download
+// response headers.
+func responseProperties(resp *http.Response) BlobProperties {
+	props := BlobProperties{
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		Size:          resp.ContentLength,
+		ETag:          resp.Header.Get("ETag"),
+	}
+	if n := rangeSize(resp.Header.Get("Content-Range")); n >= 0 {
+		props.Size = n
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		props.LastModified = t
+	}
+	return props
+}
+
 // blobURL builds a properly encoded URL for a blob, preserving
 // slashes in the blob name as path separators.
 func (s *LocalBlobStore) blobURL(container, blobName string) string {
+	return s.baseURL + "/" + escapeBlobPath(container, blobName)
+}
+
+// escapeBlobPath percent-encodes each segment of "container/blobName".
+func escapeBlobPath(container, blobName string) string {
 	segments := strings.Split(blobName, "/")
 	for i, seg := range segments {
 		segments[i] = url.PathEscape(seg)
 	}
-	return fmt.Sprintf("%s/%s/%s", s.baseURL, url.PathEscape(container), strings.Join(segments, "/"))
+	return url.PathEscape(container) + "/" + strings.Join(segments, "/")
 }
 
 // Compile-time check.
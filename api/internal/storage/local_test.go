@@ -6,8 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -96,6 +99,43 @@ func TestLocalBlobStore_FilterBlobsByTags_ServerError(t *testing.T) {
 	assert.Contains(t, err.Error(), "500")
 }
 
+func TestLocalBlobStore_FilterBlobsByTagsPage_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload queryRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, "7", payload.Marker)
+		assert.Equal(t, int32(2), payload.MaxResults)
+
+		w.Header().Set("X-Next-Marker", "9")
+		json.NewEncoder(w).Encode([]blobResponse{
+			{Name: "nature/sunset/p8.jpg"},
+			{Name: "nature/sunset/p9.jpg"},
+		})
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, "http://public:10000")
+	blobs, next, err := store.FilterBlobsByTagsPage(context.Background(), "collection='nature'", "images", "7", 2)
+
+	require.NoError(t, err)
+	require.Len(t, blobs, 2)
+	assert.Equal(t, "9", next)
+	assert.Equal(t, "http://public:10000/images/nature/sunset/p8.jpg", blobs[0].Path)
+}
+
+func TestLocalBlobStore_FilterBlobsByTagsPage_LastPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]blobResponse{})
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	blobs, next, err := store.FilterBlobsByTagsPage(context.Background(), "q", "c", "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, blobs)
+	assert.Empty(t, next, "no header means no further pages")
+}
+
 // ── GetBlobTags ──────────────────────────────────────────────────────
 
 func TestLocalBlobStore_GetBlobTags_Success(t *testing.T) {
@@ -158,6 +198,37 @@ func TestLocalBlobStore_SetBlobTags_Error(t *testing.T) {
 	assert.Contains(t, err.Error(), "403")
 }
 
+// ── SetBlobMetadata ──────────────────────────────────────────────────
+
+func TestLocalBlobStore_SetBlobMetadata_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "comp=metadata", r.URL.RawQuery)
+
+		var md map[string]string
+		json.NewDecoder(r.Body).Decode(&md)
+		assert.Equal(t, map[string]string{"ProcessingStatus": "done"}, md)
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.SetBlobMetadata(context.Background(), "a/b/p.jpg", "uploads", map[string]string{"ProcessingStatus": "done"})
+	assert.NoError(t, err)
+}
+
+func TestLocalBlobStore_SetBlobMetadata_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blob not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.SetBlobMetadata(context.Background(), "p.jpg", "uploads", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 // ── GetBlobMetadata ──────────────────────────────────────────────────
 
 func TestLocalBlobStore_GetBlobMetadata_Success(t *testing.T) {
@@ -182,7 +253,7 @@ func TestLocalBlobStore_GetBlobMetadata_Error(t *testing.T) {
 
 	store := NewLocalBlobStore(srv.URL, srv.URL)
 	_, err := store.GetBlobMetadata(context.Background(), "p.jpg", "images")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 // ── GetBlobTagList ───────────────────────────────────────────────────
@@ -242,10 +313,133 @@ func TestLocalBlobStore_GetBlob_Error(t *testing.T) {
 
 	store := NewLocalBlobStore(srv.URL, srv.URL)
 	_, err := store.GetBlob(context.Background(), "missing.jpg", "images")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 	assert.Contains(t, err.Error(), "404")
 }
 
+func TestLocalBlobStore_GetBlob_ServerErrorIsNotNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	_, err := store.GetBlob(context.Background(), "p.jpg", "images")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
+
+// ── OpenBlob ─────────────────────────────────────────────────────────
+
+// serveBlob answers like blobemu's GET handler, honouring Range.
+func serveBlob(t *testing.T, content string, modTime time.Time) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "p.jpg", modTime, strings.NewReader(content))
+	}))
+}
+
+func TestLocalBlobStore_OpenBlob_Whole(t *testing.T) {
+	modTime := time.Date(2024, 7, 1, 9, 15, 0, 0, time.UTC)
+	srv := serveBlob(t, "0123456789", modTime)
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	rc, props, err := store.OpenBlob(context.Background(), "p.jpg", "images", 0, -1)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+	assert.Equal(t, BlobProperties{
+		ContentType:   "image/jpeg",
+		ContentLength: 10,
+		Size:          10,
+		ETag:          `"v1"`,
+		LastModified:  modTime,
+	}, props)
+}
+
+func TestLocalBlobStore_OpenBlob_Range(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		start, end int64
+		want       string
+	}{
+		{"bounded", 2, 5, "2345"},
+		{"open ended", 7, -1, "789"},
+		{"end clamped", 8, 100, "89"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := serveBlob(t, "0123456789", time.Time{})
+			defer srv.Close()
+
+			store := NewLocalBlobStore(srv.URL, srv.URL)
+			rc, props, err := store.OpenBlob(context.Background(), "p.jpg", "images", tc.start, tc.end)
+			require.NoError(t, err)
+			defer rc.Close()
+
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(data))
+			assert.Equal(t, int64(len(tc.want)), props.ContentLength)
+			assert.Equal(t, int64(10), props.Size)
+		})
+	}
+}
+
+func TestLocalBlobStore_OpenBlob_InvalidRange(t *testing.T) {
+	srv := serveBlob(t, "0123456789", time.Time{})
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	_, _, err := store.OpenBlob(context.Background(), "p.jpg", "images", 20, -1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestLocalBlobStore_OpenBlob_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blob not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	_, _, err := store.OpenBlob(context.Background(), "p.jpg", "images", 0, -1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalBlobStore_GetBlobProperties(t *testing.T) {
+	modTime := time.Date(2024, 7, 1, 9, 15, 0, 0, time.UTC)
+	srv := serveBlob(t, "0123456789", modTime)
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	props, err := store.GetBlobProperties(context.Background(), "p.jpg", "images")
+	require.NoError(t, err)
+	assert.Equal(t, BlobProperties{
+		ContentType:   "image/jpeg",
+		ContentLength: 10,
+		Size:          10,
+		ETag:          `"v1"`,
+		LastModified:  modTime,
+	}, props)
+}
+
+func TestLocalBlobStore_GetBlobProperties_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	_, err := store.GetBlobProperties(context.Background(), "p.jpg", "images")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 // ── SaveBlob ─────────────────────────────────────────────────────────
 
 func TestLocalBlobStore_SaveBlob_Success(t *testing.T) {
@@ -283,6 +477,124 @@ func TestLocalBlobStore_SaveBlob_Success(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestLocalBlobStore_SaveBlobIfMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("If-None-Match") == "*" && r.Header.Get("If-Match") == "":
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusCreated)
+		case r.Header.Get("If-Match") == `"v1"` && r.Header.Get("If-None-Match") == "":
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "condition not met", http.StatusPreconditionFailed)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	save := func(etag string) (string, error) {
+		return store.SaveBlobIfMatch(context.Background(), strings.NewReader("{}"), 2, "j.json", "jobs", nil, nil, "application/json", etag)
+	}
+	etag, err := save("")
+	require.NoError(t, err)
+	assert.Equal(t, `"v1"`, etag)
+	etag, err = save(etag)
+	require.NoError(t, err)
+	assert.Equal(t, `"v2"`, etag)
+	_, err = save(`"v0"`)
+	assert.ErrorIs(t, err, ErrConditionNotMet)
+}
+
+func TestLocalBlobStore_StageBlock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/sessions/abc/data", r.URL.Path)
+		assert.Equal(t, "block", r.URL.Query().Get("comp"))
+		assert.Equal(t, "MDAwMDAwMDE=", r.URL.Query().Get("blockid"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "chunk", string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.StageBlock(context.Background(), "abc/data", "sessions", "MDAwMDAwMDE=", strings.NewReader("chunk"), 5)
+	assert.NoError(t, err)
+}
+
+func TestLocalBlobStore_StageBlock_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.StageBlock(context.Background(), "abc/data", "sessions", "MDA=", strings.NewReader("x"), 1)
+	assert.ErrorContains(t, err, "stage block status 500")
+}
+
+func TestLocalBlobStore_CommitBlockList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "blocklist", r.URL.Query().Get("comp"))
+		assert.Equal(t, "image/jpeg", r.Header.Get("X-Blob-Content-Type"))
+
+		var tags map[string]string
+		json.Unmarshal([]byte(r.Header.Get("X-Blob-Tags")), &tags)
+		assert.Equal(t, "nature", tags["collection"])
+
+		var ids []string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ids))
+		assert.Equal(t, []string{"MDA=", "MDE="}, ids)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.CommitBlockList(context.Background(), "abc/data", "sessions", []string{"MDA=", "MDE="},
+		map[string]string{"collection": "nature"}, nil, "image/jpeg")
+	assert.NoError(t, err)
+}
+
+func TestLocalBlobStore_CommitBlockList_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown block", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.CommitBlockList(context.Background(), "abc/data", "sessions", []string{"MDA="}, nil, nil, "")
+	assert.ErrorContains(t, err, "commit block list status 400")
+}
+
+func TestLocalBlobStore_PresignUpload(t *testing.T) {
+	store := NewLocalBlobStore("http://blobemu:10000", "http://localhost:10000")
+	store.signingKey = []byte("secret")
+
+	up, err := store.PresignUpload(context.Background(), "abc/my photo.jpg", "upload-sessions", "image/jpeg", 15*time.Minute)
+	require.NoError(t, err)
+
+	u, err := url.Parse(up.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:10000", u.Host)
+	assert.Equal(t, "/upload-sessions/abc/my%20photo.jpg", u.EscapedPath())
+	q := u.Query()
+	assert.Equal(t, "cw", q.Get("sp"))
+	assert.Equal(t, strconv.FormatInt(up.ExpiresOn.Unix(), 10), q.Get("se"))
+	assert.Equal(t, signUpload([]byte("secret"), "upload-sessions", "abc/my photo.jpg", "cw", q.Get("se")), q.Get("sig"))
+	assert.NotEqual(t, signUpload([]byte("other"), "upload-sessions", "abc/my photo.jpg", "cw", q.Get("se")), q.Get("sig"))
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), up.ExpiresOn, 2*time.Second)
+	assert.Equal(t, http.MethodPut, up.Method)
+	assert.Equal(t, map[string]string{"Content-Type": "image/jpeg"}, up.Headers)
+}
+
+func TestLocalBlobStore_PresignUpload_NoKey(t *testing.T) {
+	store := NewLocalBlobStore("http://blobemu:10000", "http://localhost:10000")
+	_, err := store.PresignUpload(context.Background(), "a.jpg", "upload-sessions", "image/jpeg", time.Minute)
+	assert.ErrorContains(t, err, "BLOB_SIGNING_KEY")
+}
+
 func TestLocalBlobStore_SaveBlob_Error(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "disk full", http.StatusInternalServerError)
@@ -308,6 +620,40 @@ func TestLocalBlobStore_SaveBlob_NoContentType(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// ── CopyBlob / DeleteBlob ────────────────────────────────────────────
+
+func TestLocalBlobStore_CopyBlob_KeepsContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+			assert.Equal(t, "/images/b.png", r.URL.Path)
+			assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Query().Get("comp") != "":
+			w.Write([]byte("{}"))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png-data"))
+		}
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	assert.NoError(t, store.CopyBlob(context.Background(), "a.png", "b.png", "images"))
+}
+
+func TestLocalBlobStore_DeleteBlob_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		http.Error(w, "blob not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	store := NewLocalBlobStore(srv.URL, srv.URL)
+	err := store.DeleteBlob(context.Background(), "p.jpg", "images")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 // ── Context cancellation ─────────────────────────────────────────────
 
 func TestLocalBlobStore_CancelledContext(t *testing.T) {
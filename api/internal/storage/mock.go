@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/cbellee/photo-api/internal/models"
 )
@@ -18,6 +19,10 @@ type MockBlobStore struct {
 	FilterBlobsByTagsFunc  func(ctx context.Context, query string, containerName string) ([]models.Blob, error)
 	FilterBlobsByTagsCalls []FilterBlobsByTagsCall
 
+	// FilterBlobsByTagsPage configuration
+	FilterBlobsByTagsPageFunc  func(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error)
+	FilterBlobsByTagsPageCalls []FilterBlobsByTagsPageCall
+
 	// GetBlobTags configuration
 	GetBlobTagsFunc  func(ctx context.Context, blobName string, containerName string) (map[string]string, error)
 	GetBlobTagsCalls []GetBlobTagsCall
@@ -30,6 +35,10 @@ type MockBlobStore struct {
 	GetBlobMetadataFunc  func(ctx context.Context, blobName string, containerName string) (map[string]string, error)
 	GetBlobMetadataCalls []GetBlobMetadataCall
 
+	// SetBlobMetadata configuration
+	SetBlobMetadataFunc  func(ctx context.Context, blobName string, containerName string, metadata map[string]string) error
+	SetBlobMetadataCalls []SetBlobMetadataCall
+
 	// GetBlobTagList configuration
 	GetBlobTagListFunc  func(ctx context.Context, containerName string) (map[string][]string, error)
 	GetBlobTagListCalls []GetBlobTagListCall
@@ -38,10 +47,38 @@ type MockBlobStore struct {
 	SaveBlobFunc  func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error
 	SaveBlobCalls []SaveBlobCall
 
+	// SaveBlobIfMatch configuration
+	SaveBlobIfMatchFunc  func(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error)
+	SaveBlobIfMatchCalls []SaveBlobIfMatchCall
+
+	// ListBlobNames configuration
+	ListBlobNamesFunc  func(ctx context.Context, prefix string, containerName string) ([]string, error)
+	ListBlobNamesCalls []ListBlobNamesCall
+
 	// GetBlob configuration
 	GetBlobFunc  func(ctx context.Context, blobName string, containerName string) ([]byte, error)
 	GetBlobCalls []GetBlobCall
 
+	// GetBlobProperties configuration
+	GetBlobPropertiesFunc  func(ctx context.Context, blobName string, containerName string) (BlobProperties, error)
+	GetBlobPropertiesCalls []GetBlobPropertiesCall
+
+	// OpenBlob configuration
+	OpenBlobFunc  func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error)
+	OpenBlobCalls []OpenBlobCall
+
+	// StageBlock configuration
+	StageBlockFunc  func(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error
+	StageBlockCalls []StageBlockCall
+
+	// CommitBlockList configuration
+	CommitBlockListFunc  func(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error
+	CommitBlockListCalls []CommitBlockListCall
+
+	// PresignUpload configuration
+	PresignUploadFunc  func(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (PresignedUpload, error)
+	PresignUploadCalls []PresignUploadCall
+
 	// CopyBlob configuration
 	CopyBlobFunc  func(ctx context.Context, srcBlobName string, destBlobName string, containerName string) error
 	CopyBlobCalls []CopyBlobCall
@@ -58,6 +95,13 @@ type FilterBlobsByTagsCall struct {
 	ContainerName string
 }
 
+type FilterBlobsByTagsPageCall struct {
+	Query         string
+	ContainerName string
+	Marker        string
+	MaxResults    int32
+}
+
 type GetBlobTagsCall struct {
 	BlobName      string
 	ContainerName string
@@ -74,6 +118,12 @@ type GetBlobMetadataCall struct {
 	ContainerName string
 }
 
+type SetBlobMetadataCall struct {
+	BlobName      string
+	ContainerName string
+	Metadata      map[string]string
+}
+
 type GetBlobTagListCall struct {
 	ContainerName string
 }
@@ -88,11 +138,57 @@ type SaveBlobCall struct {
 	ContentType   string
 }
 
+type SaveBlobIfMatchCall struct {
+	SaveBlobCall
+	ETag string
+}
+
+type ListBlobNamesCall struct {
+	Prefix        string
+	ContainerName string
+}
+
 type GetBlobCall struct {
 	BlobName      string
 	ContainerName string
 }
 
+type GetBlobPropertiesCall struct {
+	BlobName      string
+	ContainerName string
+}
+
+type OpenBlobCall struct {
+	BlobName      string
+	ContainerName string
+	RangeStart    int64
+	RangeEnd      int64
+}
+
+type StageBlockCall struct {
+	Data          []byte // Data is populated by reading the reader at call time.
+	BlobName      string
+	ContainerName string
+	BlockID       string
+	Size          int64
+}
+
+type CommitBlockListCall struct {
+	BlobName      string
+	ContainerName string
+	BlockIDs      []string
+	Tags          map[string]string
+	Metadata      map[string]string
+	ContentType   string
+}
+
+type PresignUploadCall struct {
+	BlobName      string
+	ContainerName string
+	ContentType   string
+	Expiry        time.Duration
+}
+
 type CopyBlobCall struct {
 	SrcBlobName   string
 	DestBlobName  string
@@ -117,6 +213,19 @@ func (m *MockBlobStore) FilterBlobsByTags(ctx context.Context, query string, con
 	return nil, fmt.Errorf("FilterBlobsByTags not configured")
 }
 
+func (m *MockBlobStore) FilterBlobsByTagsPage(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error) {
+	m.mu.Lock()
+	m.FilterBlobsByTagsPageCalls = append(m.FilterBlobsByTagsPageCalls, FilterBlobsByTagsPageCall{
+		Query: query, ContainerName: containerName, Marker: marker, MaxResults: maxResults,
+	})
+	m.mu.Unlock()
+
+	if m.FilterBlobsByTagsPageFunc != nil {
+		return m.FilterBlobsByTagsPageFunc(ctx, query, containerName, marker, maxResults)
+	}
+	return nil, "", fmt.Errorf("FilterBlobsByTagsPage not configured")
+}
+
 func (m *MockBlobStore) GetBlobTags(ctx context.Context, blobName string, containerName string) (map[string]string, error) {
 	m.mu.Lock()
 	m.GetBlobTagsCalls = append(m.GetBlobTagsCalls, GetBlobTagsCall{
@@ -156,6 +265,19 @@ func (m *MockBlobStore) GetBlobMetadata(ctx context.Context, blobName string, co
 	return nil, fmt.Errorf("GetBlobMetadata not configured")
 }
 
+func (m *MockBlobStore) SetBlobMetadata(ctx context.Context, blobName string, containerName string, metadata map[string]string) error {
+	m.mu.Lock()
+	m.SetBlobMetadataCalls = append(m.SetBlobMetadataCalls, SetBlobMetadataCall{
+		BlobName: blobName, ContainerName: containerName, Metadata: metadata,
+	})
+	m.mu.Unlock()
+
+	if m.SetBlobMetadataFunc != nil {
+		return m.SetBlobMetadataFunc(ctx, blobName, containerName, metadata)
+	}
+	return nil
+}
+
 func (m *MockBlobStore) GetBlobTagList(ctx context.Context, containerName string) (map[string][]string, error) {
 	m.mu.Lock()
 	m.GetBlobTagListCalls = append(m.GetBlobTagListCalls, GetBlobTagListCall{
@@ -187,6 +309,38 @@ func (m *MockBlobStore) SaveBlob(ctx context.Context, reader io.ReadSeeker, size
 	return nil
 }
 
+func (m *MockBlobStore) SaveBlobIfMatch(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error) {
+	data, _ := io.ReadAll(reader)
+	reader.Seek(0, io.SeekStart)
+
+	m.mu.Lock()
+	m.SaveBlobIfMatchCalls = append(m.SaveBlobIfMatchCalls, SaveBlobIfMatchCall{
+		SaveBlobCall: SaveBlobCall{
+			Data: data, Size: size, BlobName: blobName, ContainerName: containerName, Tags: tags, Metadata: metadata, ContentType: contentType,
+		},
+		ETag: etag,
+	})
+	m.mu.Unlock()
+
+	if m.SaveBlobIfMatchFunc != nil {
+		return m.SaveBlobIfMatchFunc(ctx, reader, size, blobName, containerName, tags, metadata, contentType, etag)
+	}
+	return "", nil
+}
+
+func (m *MockBlobStore) ListBlobNames(ctx context.Context, prefix string, containerName string) ([]string, error) {
+	m.mu.Lock()
+	m.ListBlobNamesCalls = append(m.ListBlobNamesCalls, ListBlobNamesCall{
+		Prefix: prefix, ContainerName: containerName,
+	})
+	m.mu.Unlock()
+
+	if m.ListBlobNamesFunc != nil {
+		return m.ListBlobNamesFunc(ctx, prefix, containerName)
+	}
+	return nil, fmt.Errorf("ListBlobNames not configured")
+}
+
 func (m *MockBlobStore) GetBlob(ctx context.Context, blobName string, containerName string) ([]byte, error) {
 	m.mu.Lock()
 	m.GetBlobCalls = append(m.GetBlobCalls, GetBlobCall{
@@ -200,6 +354,76 @@ func (m *MockBlobStore) GetBlob(ctx context.Context, blobName string, containerN
 	return nil, fmt.Errorf("GetBlob not configured")
 }
 
+func (m *MockBlobStore) GetBlobProperties(ctx context.Context, blobName string, containerName string) (BlobProperties, error) {
+	m.mu.Lock()
+	m.GetBlobPropertiesCalls = append(m.GetBlobPropertiesCalls, GetBlobPropertiesCall{
+		BlobName: blobName, ContainerName: containerName,
+	})
+	m.mu.Unlock()
+
+	if m.GetBlobPropertiesFunc != nil {
+		return m.GetBlobPropertiesFunc(ctx, blobName, containerName)
+	}
+	return BlobProperties{}, fmt.Errorf("GetBlobProperties not configured")
+}
+
+func (m *MockBlobStore) OpenBlob(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error) {
+	m.mu.Lock()
+	m.OpenBlobCalls = append(m.OpenBlobCalls, OpenBlobCall{
+		BlobName: blobName, ContainerName: containerName, RangeStart: rangeStart, RangeEnd: rangeEnd,
+	})
+	m.mu.Unlock()
+
+	if m.OpenBlobFunc != nil {
+		return m.OpenBlobFunc(ctx, blobName, containerName, rangeStart, rangeEnd)
+	}
+	return nil, BlobProperties{}, fmt.Errorf("OpenBlob not configured")
+}
+
+func (m *MockBlobStore) StageBlock(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error {
+	// Read all data so tests can inspect it.
+	data, _ := io.ReadAll(reader)
+	// Rewind in case the caller needs the reader again.
+	reader.Seek(0, io.SeekStart)
+
+	m.mu.Lock()
+	m.StageBlockCalls = append(m.StageBlockCalls, StageBlockCall{
+		Data: data, BlobName: blobName, ContainerName: containerName, BlockID: blockID, Size: size,
+	})
+	m.mu.Unlock()
+
+	if m.StageBlockFunc != nil {
+		return m.StageBlockFunc(ctx, blobName, containerName, blockID, reader, size)
+	}
+	return nil
+}
+
+func (m *MockBlobStore) CommitBlockList(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error {
+	m.mu.Lock()
+	m.CommitBlockListCalls = append(m.CommitBlockListCalls, CommitBlockListCall{
+		BlobName: blobName, ContainerName: containerName, BlockIDs: blockIDs, Tags: tags, Metadata: metadata, ContentType: contentType,
+	})
+	m.mu.Unlock()
+
+	if m.CommitBlockListFunc != nil {
+		return m.CommitBlockListFunc(ctx, blobName, containerName, blockIDs, tags, metadata, contentType)
+	}
+	return nil
+}
+
+func (m *MockBlobStore) PresignUpload(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (PresignedUpload, error) {
+	m.mu.Lock()
+	m.PresignUploadCalls = append(m.PresignUploadCalls, PresignUploadCall{
+		BlobName: blobName, ContainerName: containerName, ContentType: contentType, Expiry: expiry,
+	})
+	m.mu.Unlock()
+
+	if m.PresignUploadFunc != nil {
+		return m.PresignUploadFunc(ctx, blobName, containerName, contentType, expiry)
+	}
+	return PresignedUpload{}, fmt.Errorf("PresignUpload not configured")
+}
+
 func (m *MockBlobStore) CopyBlob(ctx context.Context, srcBlobName string, destBlobName string, containerName string) error {
 	m.mu.Lock()
 	m.CopyBlobCalls = append(m.CopyBlobCalls, CopyBlobCall{
@@ -23,6 +23,17 @@ func TestMock_FilterBlobsByTags_DefaultError(t *testing.T) {
 	assert.Len(t, m.FilterBlobsByTagsCalls, 1)
 }
 
+func TestMock_FilterBlobsByTagsPage_DefaultError(t *testing.T) {
+	m := &MockBlobStore{}
+	blobs, next, err := m.FilterBlobsByTagsPage(context.Background(), "q", "c", "m", 5)
+	assert.Nil(t, blobs)
+	assert.Empty(t, next)
+	assert.Error(t, err)
+	require.Len(t, m.FilterBlobsByTagsPageCalls, 1)
+	assert.Equal(t, "m", m.FilterBlobsByTagsPageCalls[0].Marker)
+	assert.Equal(t, int32(5), m.FilterBlobsByTagsPageCalls[0].MaxResults)
+}
+
 func TestMock_GetBlobTags_DefaultError(t *testing.T) {
 	m := &MockBlobStore{}
 	tags, err := m.GetBlobTags(context.Background(), "b", "c")
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// BlobReader reads a blob as an io.ReadSeeker without downloading it up
+// front. Each Read continues a ranged OpenBlob stream; a Seek closes the
+// stream and the next Read opens one from the new offset. Callers must
+// Close it.
+type BlobReader struct {
+	ctx           context.Context
+	store         BlobStore
+	blobName      string
+	containerName string
+	size          int64
+
+	offset int64
+	rc     io.ReadCloser
+}
+
+// NewBlobReader returns a reader over the size bytes of blobName.
+func NewBlobReader(ctx context.Context, store BlobStore, blobName string, containerName string, size int64) *BlobReader {
+	return &BlobReader{ctx: ctx, store: store, blobName: blobName, containerName: containerName, size: size}
+}
+
+func (r *BlobReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, _, err := r.store.OpenBlob(r.ctx, r.blobName, r.containerName, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	n, err := r.rc.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	if offset != r.offset {
+		r.closeStream()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the open stream, if any.
+func (r *BlobReader) Close() error {
+	return r.closeStream()
+}
+
+func (r *BlobReader) closeStream() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
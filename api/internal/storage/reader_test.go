@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rangedStore(content string) *MockBlobStore {
+	return &MockBlobStore{
+		OpenBlobFunc: func(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error) {
+			return io.NopCloser(strings.NewReader(content[rangeStart:])), BlobProperties{Size: int64(len(content))}, nil
+		},
+	}
+}
+
+func TestBlobReader_ReadSeek(t *testing.T) {
+	mock := rangedStore("0123456789")
+	r := NewBlobReader(context.Background(), mock, "p.jpg", "sessions", 10)
+	defer r.Close()
+
+	head := make([]byte, 4)
+	_, err := io.ReadFull(r, head)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(head))
+
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "456789", string(rest))
+	assert.Len(t, mock.OpenBlobCalls, 1, "sequential reads share one stream")
+
+	pos, err := r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pos)
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(all))
+
+	pos, err = r.Seek(-3, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), pos)
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "789", string(tail))
+
+	require.Len(t, mock.OpenBlobCalls, 3)
+	assert.Equal(t, int64(7), mock.OpenBlobCalls[2].RangeStart)
+	assert.Equal(t, int64(-1), mock.OpenBlobCalls[2].RangeEnd)
+}
+
+func TestBlobReader_AtEndDoesNotOpen(t *testing.T) {
+	mock := rangedStore("abc")
+	r := NewBlobReader(context.Background(), mock, "p.jpg", "sessions", 3)
+
+	_, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	n, err := r.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	assert.Empty(t, mock.OpenBlobCalls)
+}
+
+func TestBlobReader_ShortBlob(t *testing.T) {
+	r := NewBlobReader(context.Background(), rangedStore("abc"), "p.jpg", "sessions", 5)
+	_, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestBlobReader_NegativeSeek(t *testing.T) {
+	r := NewBlobReader(context.Background(), rangedStore("abc"), "p.jpg", "sessions", 3)
+	_, err := r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
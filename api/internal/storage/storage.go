@@ -2,11 +2,50 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cbellee/photo-api/internal/models"
 )
 
+// ErrNotFound is wrapped by GetBlob and GetBlobMetadata when the blob (or its
+// container) does not exist. Test for it with errors.Is.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrConditionNotMet is wrapped by SaveBlobIfMatch when the blob has
+// changed since its ETag was read.
+var ErrConditionNotMet = errors.New("blob condition not met")
+
+// ErrInvalidRange is wrapped by OpenBlob when the requested range starts
+// beyond the end of the blob.
+var ErrInvalidRange = errors.New("range not satisfiable")
+
+// BlobProperties describes a blob's content as returned by GetBlobProperties
+// and OpenBlob.
+type BlobProperties struct {
+	ContentType string
+	// ContentLength is the number of bytes in the reader returned by OpenBlob,
+	// which is less than Size for ranged reads.
+	ContentLength int64
+	// Size is the total size of the blob.
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// PresignedUpload is a credential-free request that writes one blob,
+// returned by PresignUpload for clients to upload directly to storage.
+type PresignedUpload struct {
+	URL    string
+	Method string
+	// Headers must be sent with the upload request.
+	Headers   map[string]string
+	ExpiresOn time.Time
+}
+
 // BlobStore abstracts blob storage operations so handlers can be tested with mock implementations.
 // The storage URL is provided at construction time so callers only need to pass the container name.
 type BlobStore interface {
@@ -14,6 +53,11 @@ type BlobStore interface {
 	// with their tags and metadata fully populated.
 	FilterBlobsByTags(ctx context.Context, query string, containerName string) ([]models.Blob, error)
 
+	// FilterBlobsByTagsPage is the paged form of FilterBlobsByTags. It returns at most maxResults
+	// blobs starting at marker (empty for the first page) together with the marker for the next
+	// page, which is empty once the listing is exhausted. Markers are opaque to callers.
+	FilterBlobsByTagsPage(ctx context.Context, query string, containerName string, marker string, maxResults int32) ([]models.Blob, string, error)
+
 	// GetBlobTags returns the index tags for a single blob.
 	GetBlobTags(ctx context.Context, blobName string, containerName string) (map[string]string, error)
 
@@ -23,20 +67,75 @@ type BlobStore interface {
 	// GetBlobMetadata returns custom metadata for a single blob.
 	GetBlobMetadata(ctx context.Context, blobName string, containerName string) (map[string]string, error)
 
+	// SetBlobMetadata replaces the custom metadata of a single blob, leaving
+	// its content and tags unchanged.
+	SetBlobMetadata(ctx context.Context, blobName string, containerName string, metadata map[string]string) error
+
 	// GetBlobTagList returns a map of collection to album list built from all blobs in a container.
 	GetBlobTagList(ctx context.Context, containerName string) (map[string][]string, error)
 
+	// ListBlobNames returns the names of the blobs in a container that start
+	// with prefix, in no particular order.
+	ListBlobNames(ctx context.Context, prefix string, containerName string) ([]string, error)
+
 	// GetBlob downloads blob content and returns the raw bytes.
 	GetBlob(ctx context.Context, blobName string, containerName string) ([]byte, error)
 
+	// GetBlobProperties returns a blob's content type, size, ETag and
+	// modification time without downloading it.
+	GetBlobProperties(ctx context.Context, blobName string, containerName string) (BlobProperties, error)
+
+	// OpenBlob streams blob content. rangeStart and rangeEnd are inclusive byte
+	// offsets as in an HTTP Range header; a negative rangeEnd reads to the end
+	// of the blob, so 0, -1 reads the whole blob. The caller must close the
+	// returned reader.
+	OpenBlob(ctx context.Context, blobName string, containerName string, rangeStart int64, rangeEnd int64) (io.ReadCloser, BlobProperties, error)
+
 	// SaveBlob uploads a blob from a seekable reader with tags, metadata, and content type.
 	// The caller is responsible for seeking the reader to the desired position before calling.
 	SaveBlob(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string) error
 
+	// SaveBlobIfMatch is SaveBlob made conditional on the blob's ETag, as
+	// returned by OpenBlob or GetBlobProperties: it writes only if the blob
+	// still has that ETag or, when etag is empty, if the blob does not exist.
+	// Otherwise it returns an error wrapping ErrConditionNotMet. It returns
+	// the blob's new ETag.
+	SaveBlobIfMatch(ctx context.Context, reader io.ReadSeeker, size int64, blobName string, containerName string, tags map[string]string, metadata map[string]string, contentType string, etag string) (string, error)
+
+	// StageBlock uploads one block of a block blob without changing the blob's
+	// content. blockID must be base64 and the same length for every block of
+	// the blob. Blocks that are never committed are discarded by the service.
+	StageBlock(ctx context.Context, blobName string, containerName string, blockID string, reader io.ReadSeeker, size int64) error
+
+	// CommitBlockList writes a block blob from previously staged blocks in the
+	// given order, replacing any existing content, tags and metadata.
+	CommitBlockList(ctx context.Context, blobName string, containerName string, blockIDs []string, tags map[string]string, metadata map[string]string, contentType string) error
+
+	// PresignUpload returns a request that creates or overwrites blobName,
+	// with the given content type, until expiry has passed. It grants no
+	// other access: the blob cannot be read, and no other blob written.
+	PresignUpload(ctx context.Context, blobName string, containerName string, contentType string, expiry time.Duration) (PresignedUpload, error)
+
 	// CopyBlob copies a blob from srcBlobName to destBlobName within the same container,
-	// preserving tags and metadata.
+	// preserving tags and metadata. It returns once the copy has completed,
+	// so the source can then be deleted.
 	CopyBlob(ctx context.Context, srcBlobName string, destBlobName string, containerName string) error
 
-	// DeleteBlob permanently deletes a blob from storage.
+	// DeleteBlob permanently deletes a blob from storage. Deleting a blob
+	// that does not exist returns an error wrapping ErrNotFound.
 	DeleteBlob(ctx context.Context, blobName string, containerName string) error
 }
+
+// rangeSize returns the total blob size from a "bytes start-end/size"
+// Content-Range header value, or -1 if it is absent or unknown.
+func rangeSize(contentRange string) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"image"
+
+	"github.com/cbellee/photo-api/internal/exif"
+	"github.com/gen2brain/heic"
+)
+
+func init() {
+	// gen2brain/heic registers "heic" with the image package itself.
+	for _, brand := range exif.HEIFBrands {
+		if brand != "heic" {
+			image.RegisterFormat("heif", "????ftyp"+brand, heic.Decode, heic.DecodeConfig)
+		}
+	}
+}
+
+// IsHEIF reports whether contentType is a HEIF/HEIC image.
+func IsHEIF(contentType string) bool {
+	return contentType == "image/heic" || contentType == "image/heif"
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// ApplyOrientation returns img transformed so it displays upright for the
+// given EXIF Orientation value:
+//
+//	1 = normal                  5 = transpose (mirror + rotate 270° CW)
+//	2 = mirror horizontally     6 = rotate 90° CW
+//	3 = rotate 180°             7 = transverse (mirror + rotate 90° CW)
+//	4 = mirror vertically       8 = rotate 270° CW
+//
+// Values 5-8 swap width and height. Any other value (including 0 for
+// "missing") returns img unchanged.
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	// Normalise to RGBA first so the pixel shuffle below is a plain 4-byte
+	// copy rather than an interface call per pixel.
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
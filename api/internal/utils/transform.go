@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit modes for TransformImage.
+const (
+	// FitContain scales the image to fit within the requested box.
+	FitContain = "contain"
+	// FitCover scales the image to fill the requested box and crops the
+	// overflow, keeping the centre.
+	FitCover = "cover"
+)
+
+// TransformOptions describes an on-the-fly image variant.
+type TransformOptions struct {
+	// Width and Height bound the output. Zero leaves that side unconstrained.
+	Width  int
+	Height int
+	// Fit is FitContain or FitCover. Cover needs both Width and Height and
+	// otherwise behaves like contain.
+	Fit string
+	// ContentType is the output format: image/jpeg or image/webp.
+	ContentType string
+	// Quality is the JPEG encoder quality (1-100). Zero selects
+	// DefaultJPEGQuality. WebP output is lossless.
+	Quality int
+	// Kernel is the resampling kernel. Nil selects draw.CatmullRom.
+	Kernel draw.Interpolator
+}
+
+// TransformImage decodes imgBytes, scales (and for FitCover, crops) it to
+// opts and re-encodes it as opts.ContentType. Like ResizeImage it never
+// upscales: a contain box larger than the image yields the image at its own
+// size, and a cover box is shrunk to the largest crop of the same aspect
+// ratio.
+func TransformImage(imgBytes []byte, imageFormat string, opts TransformOptions) ([]byte, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", opts.Width, opts.Height)
+	}
+	src, err := decodeImage(imgBytes, imageFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	crop, width, height := transformGeometry(src.Bounds(), opts)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	kernel := opts.Kernel
+	if kernel == nil {
+		kernel = draw.CatmullRom
+	}
+	kernel.Scale(dst, dst.Rect, src, crop, draw.Over, nil)
+
+	return encodeImage(dst, opts.ContentType, opts.Quality)
+}
+
+// transformGeometry returns the source rectangle to sample and the output
+// dimensions for an image with bounds b.
+func transformGeometry(b image.Rectangle, opts TransformOptions) (image.Rectangle, int, int) {
+	sw, sh := float64(b.Dx()), float64(b.Dy())
+	w, h := float64(opts.Width), float64(opts.Height)
+
+	if opts.Fit == FitCover && w > 0 && h > 0 {
+		scale := math.Max(w/sw, h/sh)
+		if scale > 1 {
+			// Shrink the box, keeping its aspect ratio, rather than upscale.
+			w, h, scale = w/scale, h/scale, 1
+		}
+		cw, ch := min(sw, w/scale), min(sh, h/scale)
+		x0 := b.Min.X + int((sw-cw)/2)
+		y0 := b.Min.Y + int((sh-ch)/2)
+		crop := image.Rect(x0, y0, x0+int(math.Round(cw)), y0+int(math.Round(ch)))
+		return crop, max(1, int(math.Round(cw*scale))), max(1, int(math.Round(ch*scale)))
+	}
+
+	scale := 1.0
+	if w > 0 {
+		scale = min(scale, w/sw)
+	}
+	if h > 0 {
+		scale = min(scale, h/sh)
+	}
+	return b, max(1, int(math.Round(sw*scale))), max(1, int(math.Round(sh*scale)))
+}
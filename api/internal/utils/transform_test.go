@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := range w {
+		for y := range h {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+func TestTransformImage_Geometry(t *testing.T) {
+	src := encodePNG(t, 400, 200)
+
+	for _, tc := range []struct {
+		name         string
+		opts         TransformOptions
+		wantW, wantH int
+	}{
+		{"contain width", TransformOptions{Width: 100}, 100, 50},
+		{"contain height", TransformOptions{Height: 100}, 200, 100},
+		{"contain box", TransformOptions{Width: 100, Height: 100, Fit: FitContain}, 100, 50},
+		{"cover box", TransformOptions{Width: 100, Height: 100, Fit: FitCover}, 100, 100},
+		{"cover one side", TransformOptions{Width: 100, Fit: FitCover}, 100, 50},
+		{"no upscale", TransformOptions{Width: 800}, 400, 200},
+		{"cover no upscale", TransformOptions{Width: 300, Height: 300, Fit: FitCover}, 200, 200},
+		{"unconstrained", TransformOptions{}, 400, 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.ContentType = "image/jpeg"
+			out, err := TransformImage(src, "image/png", tc.opts)
+			require.NoError(t, err)
+
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantW, cfg.Width)
+			assert.Equal(t, tc.wantH, cfg.Height)
+		})
+	}
+}
+
+func TestTransformImage_CoverKeepsCentre(t *testing.T) {
+	// A wide image whose outer thirds are black and centre is white.
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for x := 100; x < 200; x++ {
+		for y := range 100 {
+			img.Set(x, y, color.White)
+		}
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, img))
+
+	out, err := TransformImage(buf.Bytes(), "image/png", TransformOptions{Width: 50, Height: 50, Fit: FitCover, ContentType: "image/jpeg", Quality: 100})
+	require.NoError(t, err)
+
+	dst, err := jpeg.Decode(bytes.NewReader(out))
+	require.NoError(t, err)
+	for _, p := range []image.Point{{5, 5}, {25, 25}, {44, 44}} {
+		r, _, _, _ := dst.At(p.X, p.Y).RGBA()
+		assert.Greater(t, r>>8, uint32(200), "pixel %v should come from the white centre", p)
+	}
+}
+
+func TestTransformImage_WebP(t *testing.T) {
+	out, err := TransformImage(encodePNG(t, 64, 32), "image/png", TransformOptions{Width: 32, ContentType: "image/webp"})
+	require.NoError(t, err)
+
+	cfg, err := webp.DecodeConfig(bytes.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, 32, cfg.Width)
+	assert.Equal(t, 16, cfg.Height)
+}
+
+func TestTransformImage_Errors(t *testing.T) {
+	_, err := TransformImage(encodePNG(t, 8, 8), "image/png", TransformOptions{Width: 4, ContentType: "image/avif"})
+	assert.Error(t, err)
+
+	_, err = TransformImage([]byte("not an image"), "image/jpeg", TransformOptions{Width: 4, ContentType: "image/jpeg"})
+	assert.Error(t, err)
+
+	_, err = TransformImage(encodePNG(t, 8, 8), "image/png", TransformOptions{Width: -1, ContentType: "image/jpeg"})
+	assert.Error(t, err)
+}
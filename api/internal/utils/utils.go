@@ -20,10 +20,13 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	nativewebp "github.com/HugoSmits86/nativewebp"
 	jwksKeyfunc "github.com/MicahParks/keyfunc/v3"
 	"github.com/dapr/go-sdk/service/common"
+	"github.com/gen2brain/heic"
 	jwtLib "github.com/golang-jwt/jwt/v5"
 	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
 )
 
 // CreateAzureBlobClient builds an [azblob.Client] using the best available
@@ -76,33 +79,113 @@ func CreateAzureBlobClient(storageUrl string, isProduction bool, azureClientId s
 	return client, nil
 }
 
+// DefaultJPEGQuality is the JPEG quality used when ResizeOptions.JPEGQuality
+// is zero. The standard library default (75) shows visible artefacts on
+// photographs.
+const DefaultJPEGQuality = 90
+
+// EncodedContentType returns the content type ResizeImage produces for an
+// input of imageFormat. WebP and HEIF are decoded but re-encoded as JPEG,
+// since there are no pure-Go encoders for them and browsers support HEIF
+// poorly; every other supported format is kept.
+func EncodedContentType(imageFormat string) string {
+	if imageFormat == "image/webp" || IsHEIF(imageFormat) {
+		return "image/jpeg"
+	}
+	return imageFormat
+}
+
+// ResizeOptions controls how ResizeImage scales and encodes an image.
+type ResizeOptions struct {
+	MaxHeight int
+	MaxWidth  int
+	// Orientation is the EXIF orientation (1-8, 0 if unknown). It is applied
+	// to the pixels before scaling, since re-encoding drops the EXIF block
+	// that carried it. It is ignored for HEIF, whose decoder already applies
+	// the container's rotation and mirroring.
+	Orientation int
+	// Kernel is the resampling kernel. Nil selects draw.CatmullRom.
+	Kernel draw.Interpolator
+	// JPEGQuality is the JPEG encoder quality (1-100). Zero selects
+	// DefaultJPEGQuality.
+	JPEGQuality int
+}
+
+// ParseKernel returns the resampling kernel for name, which is one of
+// "catmullrom", "bilinear" or "nearest" (case-insensitive). An empty name
+// selects draw.CatmullRom.
+func ParseKernel(name string) (draw.Interpolator, error) {
+	switch strings.ToLower(name) {
+	case "", "catmullrom":
+		return draw.CatmullRom, nil
+	case "bilinear", "approxbilinear":
+		return draw.ApproxBiLinear, nil
+	case "nearest", "nearestneighbor":
+		return draw.NearestNeighbor, nil
+	default:
+		return nil, fmt.Errorf("unknown resampling kernel %q", name)
+	}
+}
+
 // ResizeImage scales imgBytes so the longer dimension fits within
-// maxWidth/maxHeight while preserving the aspect ratio.
+// opts.MaxWidth/opts.MaxHeight while preserving the aspect ratio. Images that
+// already fit are re-encoded at their original size rather than upscaled.
+// The output format is EncodedContentType(imageFormat).
 // It decodes the image only once (using image.DecodeConfig for cheap
 // dimension lookup) and returns the re-encoded result.
-func ResizeImage(imgBytes []byte, imageFormat string, blobName string, maxHeight int, maxWidth int) ([]byte, error) {
+func ResizeImage(imgBytes []byte, imageFormat string, blobName string, opts ResizeOptions) ([]byte, error) {
 	// Get dimensions from the image header without a full decode.
 	cfg, _, err := image.DecodeConfig(bytes.NewReader(imgBytes))
 	if err != nil {
 		return nil, fmt.Errorf("decode image config: %w", err)
 	}
 
+	orientation := opts.Orientation
+	if IsHEIF(imageFormat) {
+		orientation = 1
+	}
+
 	height := cfg.Height
 	width := cfg.Width
+	if orientation >= 5 && orientation <= 8 {
+		// 90° rotations swap the displayed dimensions.
+		width, height = height, width
+	}
 
-	var dst *image.RGBA
-	if height > width { // portrait — fit to maxHeight
-		newWidth := maxHeight * width / height
-		dst = image.NewRGBA(image.Rect(0, 0, newWidth, maxHeight))
-		slog.Info("resizing image", "name", blobName, "original_height", height, "original_width", width, "new_height", maxHeight, "new_width", newWidth)
-	} else { // landscape or square — fit to maxWidth
-		newHeight := maxWidth * height / width
-		dst = image.NewRGBA(image.Rect(0, 0, maxWidth, newHeight))
-		slog.Info("resizing image", "name", blobName, "original_height", height, "original_width", width, "new_height", newHeight, "new_width", maxWidth)
+	newWidth, newHeight := width, height
+	switch {
+	case width <= opts.MaxWidth && height <= opts.MaxHeight:
+		// Already within bounds — never upscale.
+	case height > width: // portrait — fit to maxHeight
+		newWidth, newHeight = opts.MaxHeight*width/height, opts.MaxHeight
+	default: // landscape or square — fit to maxWidth
+		newWidth, newHeight = opts.MaxWidth, opts.MaxWidth*height/width
 	}
+	slog.Info("resizing image", "name", blobName, "original_height", height, "original_width", width, "new_height", newHeight, "new_width", newWidth)
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
 
 	// Decode once with the format-specific decoder.
+	src, err := decodeImage(imgBytes, imageFormat)
+	if err != nil {
+		return nil, err
+	}
+	src = ApplyOrientation(src, orientation)
+
+	kernel := opts.Kernel
+	if kernel == nil {
+		kernel = draw.CatmullRom
+	}
+	slog.Info("scaling image", "name", blobName, "format", imageFormat, "orientation", orientation)
+	kernel.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
+
+	// Encode the scaled image.
+	return encodeImage(dst, EncodedContentType(imageFormat), opts.JPEGQuality)
+}
+
+// decodeImage decodes imgBytes with the decoder for imageFormat.
+func decodeImage(imgBytes []byte, imageFormat string) (image.Image, error) {
 	var src image.Image
+	var err error
 	switch imageFormat {
 	case "image/jpeg":
 		src, err = jpeg.Decode(bytes.NewReader(imgBytes))
@@ -110,30 +193,42 @@ func ResizeImage(imgBytes []byte, imageFormat string, blobName string, maxHeight
 		src, err = png.Decode(bytes.NewReader(imgBytes))
 	case "image/gif":
 		src, err = gif.Decode(bytes.NewReader(imgBytes))
+	case "image/webp":
+		src, err = webp.Decode(bytes.NewReader(imgBytes))
+	case "image/heic", "image/heif":
+		src, err = heic.Decode(bytes.NewReader(imgBytes))
 	default:
 		return nil, fmt.Errorf("unsupported image format: %s", imageFormat)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("decode %s: %w", imageFormat, err)
 	}
+	return src, nil
+}
 
-	slog.Info("scaling image", "name", blobName, "format", imageFormat)
-	draw.NearestNeighbor.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
-
-	// Encode the scaled image.
+// encodeImage encodes img as contentType. quality applies to JPEG output;
+// zero selects DefaultJPEGQuality. WebP output is lossless.
+func encodeImage(img image.Image, contentType string, quality int) ([]byte, error) {
+	if quality == 0 {
+		quality = DefaultJPEGQuality
+	}
 	buf := new(bytes.Buffer)
-	switch imageFormat {
+	var err error
+	switch contentType {
 	case "image/jpeg":
-		err = jpeg.Encode(buf, dst, nil)
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
 	case "image/png":
-		err = png.Encode(buf, dst)
+		err = png.Encode(buf, img)
 	case "image/gif":
-		err = gif.Encode(buf, dst, nil)
+		err = gif.Encode(buf, img, nil)
+	case "image/webp":
+		err = nativewebp.Encode(buf, img, nil)
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", contentType)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("encode %s: %w", imageFormat, err)
+		return nil, fmt.Errorf("encode %s: %w", contentType, err)
 	}
-
 	return buf.Bytes(), nil
 }
 
@@ -40,7 +40,7 @@ func TestResizeImage(t *testing.T) {
 		err := jpeg.Encode(buf, img, nil)
 		assert.NoError(t, err)
 
-		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "test.jpeg", 100, 50)
+		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "test.jpeg", ResizeOptions{MaxHeight: 100, MaxWidth: 50, Orientation: 1})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resizedImgBytes)
 
@@ -55,7 +55,7 @@ func TestResizeImage(t *testing.T) {
 		err := png.Encode(buf, img)
 		assert.NoError(t, err)
 
-		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/png", "test.png", 50, 100)
+		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/png", "test.png", ResizeOptions{MaxHeight: 50, MaxWidth: 100, Orientation: 1})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resizedImgBytes)
 
@@ -70,7 +70,7 @@ func TestResizeImage(t *testing.T) {
 		err := gif.Encode(buf, img, nil)
 		assert.NoError(t, err)
 
-		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/gif", "test.gif", 100, 100)
+		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/gif", "test.gif", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resizedImgBytes)
 
@@ -85,7 +85,7 @@ func TestResizeImage(t *testing.T) {
 		err := jpeg.Encode(buf, img, nil)
 		assert.NoError(t, err)
 
-		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "test.jpeg", 100, 100)
+		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "test.jpeg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resizedImgBytes)
 
@@ -100,19 +100,19 @@ func TestResizeImage(t *testing.T) {
 		err := jpeg.Encode(buf, img, nil)
 		assert.NoError(t, err)
 
-		_, err = ResizeImage(buf.Bytes(), "image/webp", "test.webp", 100, 100)
+		_, err = ResizeImage(buf.Bytes(), "image/bmp", "test.bmp", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "unsupported image format")
 	})
 
 	t.Run("invalid image bytes returns error", func(t *testing.T) {
-		_, err := ResizeImage([]byte("not-an-image"), "image/jpeg", "bad.jpg", 100, 100)
+		_, err := ResizeImage([]byte("not-an-image"), "image/jpeg", "bad.jpg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "decode image config")
 	})
 
 	t.Run("empty image bytes returns error", func(t *testing.T) {
-		_, err := ResizeImage([]byte{}, "image/jpeg", "empty.jpg", 100, 100)
+		_, err := ResizeImage([]byte{}, "image/jpeg", "empty.jpg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.Error(t, err)
 	})
 
@@ -122,7 +122,7 @@ func TestResizeImage(t *testing.T) {
 		err := jpeg.Encode(buf, sqImg, nil)
 		assert.NoError(t, err)
 
-		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "square.jpg", 100, 100)
+		resizedImgBytes, err := ResizeImage(buf.Bytes(), "image/jpeg", "square.jpg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 1})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resizedImgBytes)
 
@@ -133,6 +133,152 @@ func TestResizeImage(t *testing.T) {
 	})
 }
 
+// orientationFixture is a 3x2 image with a distinct colour in each pixel:
+//
+//	A B C
+//	D E F
+func orientationFixture() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i, c := range []color.RGBA{
+		{1, 0, 0, 255}, {2, 0, 0, 255}, {3, 0, 0, 255},
+		{4, 0, 0, 255}, {5, 0, 0, 255}, {6, 0, 0, 255},
+	} {
+		img.SetRGBA(i%3, i/3, c)
+	}
+	return img
+}
+
+// pixelGrid returns the red channel of each pixel row by row.
+func pixelGrid(img image.Image) [][]uint8 {
+	b := img.Bounds()
+	grid := make([][]uint8, b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			grid[y] = append(grid[y], uint8(r>>8))
+		}
+	}
+	return grid
+}
+
+func TestApplyOrientation(t *testing.T) {
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("orientation %d", tt.orientation), func(t *testing.T) {
+			got := ApplyOrientation(orientationFixture(), tt.orientation)
+			assert.Equal(t, tt.want, pixelGrid(got))
+		})
+	}
+
+	t.Run("unknown values leave the image untouched", func(t *testing.T) {
+		src := orientationFixture()
+		assert.Same(t, src, ApplyOrientation(src, 0))
+		assert.Same(t, src, ApplyOrientation(src, 9))
+	})
+}
+
+func TestResizeImage_AppliesOrientation(t *testing.T) {
+	// A 200x100 landscape buffer tagged orientation 6 is a portrait photo.
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+
+	out, err := ResizeImage(buf.Bytes(), "image/png", "rotated.png", ResizeOptions{MaxHeight: 100, MaxWidth: 100, Orientation: 6})
+	assert.NoError(t, err)
+
+	resized, _, err := image.Decode(bytes.NewReader(out))
+	assert.NoError(t, err)
+	assert.Equal(t, 50, resized.Bounds().Dx())
+	assert.Equal(t, 100, resized.Bounds().Dy())
+}
+
+func TestResizeImage_NoUpscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+
+	out, err := ResizeImage(buf.Bytes(), "image/png", "small.png", ResizeOptions{MaxHeight: 1200, MaxWidth: 1600})
+	assert.NoError(t, err)
+
+	resized, _, err := image.Decode(bytes.NewReader(out))
+	assert.NoError(t, err)
+	assert.Equal(t, 40, resized.Bounds().Dx())
+	assert.Equal(t, 30, resized.Bounds().Dy())
+}
+
+func TestResizeImage_JPEGQuality(t *testing.T) {
+	// A noisy image so the encoded size depends on quality.
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * y), uint8(x + y), uint8(x ^ y), 0xff})
+		}
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 100}))
+
+	low, err := ResizeImage(buf.Bytes(), "image/jpeg", "q.jpg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, JPEGQuality: 30})
+	assert.NoError(t, err)
+	high, err := ResizeImage(buf.Bytes(), "image/jpeg", "q.jpg", ResizeOptions{MaxHeight: 100, MaxWidth: 100, JPEGQuality: 95})
+	assert.NoError(t, err)
+	assert.Less(t, len(low), len(high))
+}
+
+func TestResizeImage_Kernels(t *testing.T) {
+	// A 1px checkerboard scaled to half size: nearest-neighbour keeps hard
+	// black/white pixels, while the smoothing kernels average towards grey.
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			if (x+y)%2 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+
+	centre := func(name string) uint8 {
+		kernel, err := ParseKernel(name)
+		assert.NoError(t, err)
+		out, err := ResizeImage(buf.Bytes(), "image/png", "k.png", ResizeOptions{MaxHeight: 32, MaxWidth: 32, Kernel: kernel})
+		assert.NoError(t, err)
+		resized, _, err := image.Decode(bytes.NewReader(out))
+		assert.NoError(t, err)
+		r, _, _, _ := resized.At(16, 16).RGBA()
+		return uint8(r >> 8)
+	}
+
+	nearest := centre("nearest")
+	assert.True(t, nearest == 0 || nearest == 0xff, "nearest should not blend, got %d", nearest)
+	assert.InDelta(t, 0x80, centre("bilinear"), 0x20)
+	assert.InDelta(t, 0x80, centre("catmullrom"), 0x20)
+}
+
+func TestParseKernel(t *testing.T) {
+	for _, name := range []string{"", "catmullrom", "CatmullRom", "bilinear", "approxbilinear", "nearest", "NearestNeighbor"} {
+		k, err := ParseKernel(name)
+		assert.NoError(t, err, name)
+		assert.NotNil(t, k, name)
+	}
+
+	_, err := ParseKernel("lanczos")
+	assert.Error(t, err)
+}
+
 func TestGetEnvValue(t *testing.T) {
 	os.Setenv("TEST_ENV_VAR", "test_value")
 
@@ -6,6 +6,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/rabbitmq/amqp091-go v1.10.0
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/image v0.25.0
 	modernc.org/sqlite v1.34.4
 )
 
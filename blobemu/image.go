@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// heifBrands are the ISOBMFF major brands used for HEIF stills. It copies
+// exif.HEIFBrands in the photo API, which this module does not import, and
+// must be kept in step with it.
+var heifBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// formatTypes maps the format names reported by image.DecodeConfig to the
+// content types a blob in that format may be uploaded as.
+var formatTypes = map[string][]string{
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"webp": {"image/webp"},
+}
+
+// imageError is an upload rejected by validateImage.
+type imageError struct {
+	status int
+	msg    string
+}
+
+func (e *imageError) Error() string { return e.msg }
+
+// validateImage applies the photo API's upload checks to an image/* blob
+// read from r: the content must be the declared type, judged by its leading
+// bytes and its decoder, and its header dimensions must not exceed
+// maxPixels (zero for no limit). Only the header is read, so r may stream a
+// large blob. Other content types are not checked. HEIF is only checked by
+// its ftyp brand, as the emulator has no HEIF decoder.
+func validateImage(r io.Reader, ct string, maxPixels int64) *imageError {
+	if !strings.HasPrefix(ct, "image/") {
+		return nil
+	}
+	// http.DetectContentType considers at most 512 bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return &imageError{http.StatusInternalServerError, "error reading image"}
+	}
+	head = head[:n]
+	if sniffed := http.DetectContentType(head); strings.HasPrefix(sniffed, "image/") && sniffed != ct {
+		return &imageError{http.StatusUnsupportedMediaType, fmt.Sprintf("content is %s but was declared as %s", sniffed, ct)}
+	}
+	if ct == "image/heic" || ct == "image/heif" {
+		if len(head) < 12 || string(head[4:8]) != "ftyp" || !slices.Contains(heifBrands, string(head[8:12])) {
+			return &imageError{http.StatusUnsupportedMediaType, "content is not a HEIF image"}
+		}
+		return nil
+	}
+
+	cfg, format, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		return &imageError{http.StatusBadRequest, "invalid image"}
+	}
+	if !slices.Contains(formatTypes[format], ct) {
+		return &imageError{http.StatusUnsupportedMediaType, fmt.Sprintf("content is a %s image but was declared as %s", format, ct)}
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return &imageError{http.StatusBadRequest, "invalid image"}
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return &imageError{http.StatusRequestEntityTooLarge, fmt.Sprintf("image is %dx%d pixels, more than %d", cfg.Width, cfg.Height, maxPixels)}
+	}
+	return nil
+}
@@ -5,20 +5,30 @@
 // REST API
 //
 //	POST  /query                         Filter blobs by tag query
-//	GET   /{container}                    List blobs in a container
-//	GET   /{container}/{blob...}          Download blob (or ?comp=tags / ?comp=metadata)
-//	PUT   /{container}/{blob...}          Upload blob  (or ?comp=tags to set tags)
+//	GET   /{container}                    List blobs in a container (?prefix= to filter by name)
+//	GET   /{container}/{blob...}          Download blob, honouring Range (or ?comp=tags / ?comp=metadata)
+//	PUT   /{container}/{blob...}          Upload blob  (or ?comp=tags to set tags,
+//	                                      ?comp=block&blockid= to stage a block,
+//	                                      ?comp=blocklist to commit staged blocks)
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -85,13 +95,23 @@ func main() {
 	}
 	maxBodySize := maxBodyMB << 20
 
+	// Largest image, in pixels, accepted by PUT (default 100 megapixels;
+	// 0 disables the limit).
+	maxPixels, err := strconv.ParseInt(env("MAX_IMAGE_PIXELS", "100000000"), 10, 64)
+	if err != nil || maxPixels < 0 {
+		maxPixels = 100_000_000
+	}
+
 	// Allowed blob content types.
 	allowedContentTypes := map[string]bool{
 		"image/jpeg":               true,
 		"image/png":                true,
 		"image/gif":                true,
 		"image/webp":               true,
+		"image/heic":               true,
+		"image/heif":               true,
 		"application/octet-stream": true,
+		"application/json":         true,
 	}
 
 	// CORS origins from env (default: restrictive for local dev).
@@ -105,7 +125,8 @@ func main() {
 	mux.HandleFunc("GET /{container}/{blob...}", blobGetHandler(store))
 	publishContainer := env("PUBLISH_CONTAINER", "uploads")
 	facePublishContainer := env("FACE_PUBLISH_CONTAINER", "images")
-	mux.HandleFunc("PUT /{container}/{blob...}", blobPutHandler(store, pub, publishContainer, facePub, facePublishContainer, maxBodySize, allowedContentTypes))
+	signingKey := []byte(env("BLOB_SIGNING_KEY", ""))
+	mux.HandleFunc("PUT /{container}/{blob...}", requireSignature(signingKey, blobPutHandler(store, pub, publishContainer, facePub, facePublishContainer, maxBodySize, allowedContentTypes, maxPixels)))
 	mux.HandleFunc("DELETE /{container}/{blob...}", blobDeleteHandler(store))
 
 	srv := &http.Server{
@@ -162,26 +183,80 @@ func validateBlobPath(blob string) bool {
 	return true
 }
 
+// requireSignature checks presigned uploads sent by browsers. A request
+// with a sig query parameter must be an unexpired upload of the blob it was
+// signed for, signed with the key shared with photo-api. Unsigned requests
+// come from services on the internal network and pass through.
+func requireSignature(key []byte, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !q.Has("sig") {
+			next(w, r)
+			return
+		}
+		if len(key) == 0 || q.Has("comp") || !validUploadSignature(key, r.PathValue("container"), r.PathValue("blob"), q, time.Now()) {
+			http.Error(w, "signature is invalid or expired", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validUploadSignature mirrors signUpload in api/internal/storage/local.go:
+// sig is the HMAC-SHA256 of "sp\ncontainer/blob\nse" and se the expiry in
+// Unix seconds.
+func validUploadSignature(key []byte, container, blob string, q url.Values, now time.Time) bool {
+	if q.Get("sp") != "cw" {
+		return false
+	}
+	se, err := strconv.ParseInt(q.Get("se"), 10, 64)
+	if err != nil || now.Unix() > se {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s/%s\n%s", q.Get("sp"), container, blob, q.Get("se"))
+	want := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(q.Get("sig")))
+}
+
+// validBlockID reports whether id is a base64 block ID of at most 64 bytes,
+// as Azure requires.
+func validBlockID(id string) bool {
+	b, err := base64.StdEncoding.DecodeString(id)
+	return err == nil && len(b) > 0 && len(b) <= 64
+}
+
 func queryHandler(store *Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Limit query body to 64 KB.
 		r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
 		var req struct {
-			Query string `json:"query"`
+			Query      string `json:"query"`
+			Marker     string `json:"marker"`
+			MaxResults int    `json:"maxResults"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid JSON body", http.StatusBadRequest)
 			return
 		}
+		if req.MaxResults < 0 {
+			http.Error(w, "maxResults must not be negative", http.StatusBadRequest)
+			return
+		}
 
-		blobs, err := store.FilterByTags(req.Query)
+		blobs, nextMarker, err := store.FilterByTagsPage(req.Query, req.Marker, req.MaxResults)
 		if err != nil {
 			slog.Error("filter error", "query", req.Query, "error", err)
 			http.Error(w, "query failed", http.StatusInternalServerError)
 			return
 		}
 
-		slog.Debug("query", "query", req.Query, "results", len(blobs))
+		slog.Debug("query", "query", req.Query, "results", len(blobs), "nextMarker", nextMarker)
+		// The body stays a plain JSON array for backwards compatibility; the
+		// continuation marker travels in a header, like Azure's NextMarker.
+		if nextMarker != "" {
+			w.Header().Set("X-Next-Marker", nextMarker)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(blobs)
 	}
@@ -201,6 +276,11 @@ func listHandler(store *Store) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+			blobs = slices.DeleteFunc(blobs, func(b BlobInfo) bool {
+				return !strings.HasPrefix(b.Name, prefix)
+			})
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(blobs)
@@ -238,18 +318,30 @@ func blobGetHandler(store *Store) http.HandlerFunc {
 			json.NewEncoder(w).Encode(md)
 
 		default:
-			data, ct, err := store.GetBlob(container, blob)
+			f, ct, etag, err := store.OpenBlob(container, blob)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusNotFound)
 				return
 			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// ServeContent handles Range, If-Range and the conditional
+			// headers; the ETag changes whenever the blob is rewritten.
+			if etag == "" {
+				etag = fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+			}
 			w.Header().Set("Content-Type", ct)
-			w.Write(data)
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, blob, fi.ModTime(), f)
 		}
 	}
 }
 
-func blobPutHandler(store *Store, pub *Publisher, publishContainer string, facePub *Publisher, facePublishContainer string, maxBodySize int64, allowedCT map[string]bool) http.HandlerFunc {
+func blobPutHandler(store *Store, pub *Publisher, publishContainer string, facePub *Publisher, facePublishContainer string, maxBodySize int64, allowedCT map[string]bool, maxPixels int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		container := r.PathValue("container")
 		blob := r.PathValue("blob")
@@ -274,6 +366,100 @@ func blobPutHandler(store *Store, pub *Publisher, publishContainer string, faceP
 			}
 			w.WriteHeader(http.StatusOK)
 
+		case "metadata":
+			var metadata map[string]string
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&metadata); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			err := store.SetMetadata(container, blob, metadata)
+			if errors.Is(err, errBlobNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				slog.Error("set metadata error", "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		case "block":
+			blockID := r.URL.Query().Get("blockid")
+			if !validBlockID(blockID) {
+				http.Error(w, "invalid block id", http.StatusBadRequest)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "error reading body", http.StatusBadRequest)
+				return
+			}
+			if err := store.StageBlock(container, blob, blockID, data); err != nil {
+				slog.Error("stage block error", "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+
+		case "blocklist":
+			var blockIDs []string
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&blockIDs); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+
+			ct := r.Header.Get("X-Blob-Content-Type")
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			if !allowedCT[ct] {
+				http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			var tags map[string]string
+			if h := r.Header.Get("X-Blob-Tags"); h != "" {
+				json.NewDecoder(strings.NewReader(h)).Decode(&tags)
+			}
+
+			var metadata map[string]string
+			if h := r.Header.Get("X-Blob-Metadata"); h != "" {
+				json.NewDecoder(strings.NewReader(h)).Decode(&metadata)
+			}
+
+			blocks, err := store.OpenBlockList(container, blob, blockIDs)
+			if errors.Is(err, errUnknownBlock) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				slog.Error("open block list error", "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer blocks.Close()
+
+			// The image header is checked as it streams past and only the
+			// bytes read for it are kept, to be saved ahead of the rest.
+			var head bytes.Buffer
+			if ie := validateImage(io.TeeReader(blocks, &head), ct, maxPixels); ie != nil {
+				http.Error(w, ie.msg, ie.status)
+				return
+			}
+			size, err := store.SaveBlobFrom(container, blob, io.MultiReader(&head, blocks), tags, metadata, ct)
+			if err != nil {
+				slog.Error("commit block list error", "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			blocks.Close()
+			store.DiscardBlocks(container, blob)
+
+			publishCreated(pub, publishContainer, facePub, facePublishContainer, container, blob, ct, int(size))
+			w.WriteHeader(http.StatusCreated)
+
 		default:
 			// Enforce body size limit.
 			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
@@ -293,6 +479,10 @@ func blobPutHandler(store *Store, pub *Publisher, publishContainer string, faceP
 				http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
 				return
 			}
+			if ie := validateImage(bytes.NewReader(data), ct, maxPixels); ie != nil {
+				http.Error(w, ie.msg, ie.status)
+				return
+			}
 
 			var tags map[string]string
 			if h := r.Header.Get("X-Blob-Tags"); h != "" {
@@ -304,29 +494,40 @@ func blobPutHandler(store *Store, pub *Publisher, publishContainer string, faceP
 				json.NewDecoder(strings.NewReader(h)).Decode(&metadata)
 			}
 
-			if err := store.SaveBlob(container, blob, data, tags, metadata, ct); err != nil {
+			pre := Precondition{IfMatch: r.Header.Get("If-Match"), IfNoneMatch: r.Header.Get("If-None-Match")}
+			etag, err := store.SaveBlobIf(container, blob, data, tags, metadata, ct, pre)
+			if errors.Is(err, errConditionNotMet) {
+				http.Error(w, err.Error(), http.StatusPreconditionFailed)
+				return
+			}
+			if err != nil {
 				slog.Error("save error", "error", err)
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			// Publish a BlobCreated event to RabbitMQ only for the watched
-			// container to avoid an infinite loop (resize writes to images).
-			if pub != nil && container == publishContainer {
-				if err := pub.PublishBlobCreated(container, blob, ct, len(data)); err != nil {
-					slog.Error("failed to publish blob event", "container", container, "blob", blob, "error", err)
-					// Non-fatal: the blob is saved, just the event failed.
-				}
-			}
+			publishCreated(pub, publishContainer, facePub, facePublishContainer, container, blob, ct, len(data))
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}
+}
 
-			// Publish to the face-events exchange when blobs land in the images container.
-			if facePub != nil && container == facePublishContainer {
-				if err := facePub.PublishBlobCreated(container, blob, ct, len(data)); err != nil {
-					slog.Error("failed to publish face event", "container", container, "blob", blob, "error", err)
-				}
-			}
+// publishCreated sends the BlobCreated events for a newly written blob.
+func publishCreated(pub *Publisher, publishContainer string, facePub *Publisher, facePublishContainer string, container, blob, ct string, size int) {
+	// Publish a BlobCreated event to RabbitMQ only for the watched
+	// container to avoid an infinite loop (resize writes to images).
+	if pub != nil && container == publishContainer {
+		if err := pub.PublishBlobCreated(container, blob, ct, size); err != nil {
+			slog.Error("failed to publish blob event", "container", container, "blob", blob, "error", err)
+			// Non-fatal: the blob is saved, just the event failed.
+		}
+	}
 
-			w.WriteHeader(http.StatusCreated)
+	// Publish to the face-events exchange when blobs land in the images container.
+	if facePub != nil && container == facePublishContainer {
+		if err := facePub.PublishBlobCreated(container, blob, ct, size); err != nil {
+			slog.Error("failed to publish face event", "container", container, "blob", blob, "error", err)
 		}
 	}
 }
@@ -376,8 +577,8 @@ func corsHandler(next http.Handler, allowedCSV string) http.Handler {
 			w.Header().Set("Vary", "Origin")
 		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, DELETE, HEAD, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Blob-Tags, X-Blob-Metadata")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Type, Content-Length")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Blob-Tags, X-Blob-Metadata, X-Blob-Content-Type")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type, Content-Length, X-Next-Marker")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	pngenc "image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,6 +34,15 @@ func blobURL(base, container, blobName string) string {
 	return base + "/" + url.PathEscape(container) + "/" + strings.Join(segments, "/")
 }
 
+// testJPEG returns a small valid JPEG, as blobemu rejects image uploads
+// whose content does not match their content type.
+func testJPEG(t *testing.T, w, h int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil))
+	return buf.String()
+}
+
 // newTestMux creates an http.ServeMux wired to the given Store, identical
 // to the production setup in main() but without CORS or body-size limits.
 func newTestMux(store *Store) *http.ServeMux {
@@ -35,7 +54,7 @@ func newTestMux(store *Store) *http.ServeMux {
 		"image/jpeg":               true,
 		"application/octet-stream": true,
 	}
-	mux.HandleFunc("PUT /{container}/{blob...}", blobPutHandler(store, nil, "uploads", nil, "", 100<<20, allowedCT))
+	mux.HandleFunc("PUT /{container}/{blob...}", blobPutHandler(store, nil, "uploads", nil, "", 100<<20, allowedCT, 100_000_000))
 	mux.HandleFunc("DELETE /{container}/{blob...}", blobDeleteHandler(store))
 	return mux
 }
@@ -53,7 +72,7 @@ func TestBlobRoundTrip_SpacesInName(t *testing.T) {
 
 	container := "uploads"
 	blobName := "sport/ravens vs stingrays/Ravens vs Stingrays - August 2025-71.jpg"
-	body := "fake jpeg data"
+	body := testJPEG(t, 8, 8)
 	tags := map[string]string{"collection": "sport", "album": "ravens vs stingrays"}
 	tagsJSON, _ := json.Marshal(tags)
 
@@ -111,7 +130,7 @@ func TestBlobRoundTrip_NoSpaces(t *testing.T) {
 
 	container := "uploads"
 	blobName := "sport/soccer/goal.jpg"
-	body := "simple image data"
+	body := testJPEG(t, 8, 8)
 
 	putURL := blobURL(ts.URL, container, blobName)
 	req, err := http.NewRequest(http.MethodPut, putURL, strings.NewReader(body))
@@ -147,7 +166,7 @@ func TestBlobRoundTrip_SpecialChars(t *testing.T) {
 
 	container := "uploads"
 	blobName := "events/party (2025)/photo #1 & friends.jpg"
-	body := "special chars data"
+	body := testJPEG(t, 8, 8)
 
 	putURL := blobURL(ts.URL, container, blobName)
 	req, err := http.NewRequest(http.MethodPut, putURL, strings.NewReader(body))
@@ -184,7 +203,7 @@ func TestDeleteRemovesFile(t *testing.T) {
 
 	container := "uploads"
 	blobName := "sport/soccer/goal.jpg"
-	body := "staging blob data"
+	body := testJPEG(t, 8, 8)
 
 	// PUT the blob.
 	putURL := blobURL(ts.URL, container, blobName)
@@ -221,6 +240,382 @@ func TestDeleteRemovesFile(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, getResp.StatusCode)
 }
 
+// TestBlobGet_Range verifies that blob downloads honour Range and
+// conditional requests, as Azure Blob Storage does.
+func TestBlobGet_Range(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ts := httptest.NewServer(newTestMux(store))
+	defer ts.Close()
+
+	u := blobURL(ts.URL, "images", "sport/soccer/goal.jpg")
+	body := testJPEG(t, 8, 8)
+	req, err := http.NewRequest(http.MethodPut, u, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "image/jpeg")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	get := func(header, value string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		require.NoError(t, err)
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp = get("Range", "bytes=2-5")
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body[2:6], string(data))
+	assert.Equal(t, fmt.Sprintf("bytes 2-5/%d", len(body)), resp.Header.Get("Content-Range"))
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotEmpty(t, resp.Header.Get("Last-Modified"))
+
+	resp = get("Range", fmt.Sprintf("bytes=%d-", len(body)))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+
+	resp = get("If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+// TestConditionalPut verifies that PUT honours If-None-Match: * and
+// If-Match, returning the new ETag on success and 412 when the blob has
+// changed.
+func TestConditionalPut(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ts := httptest.NewServer(newTestMux(store))
+	defer ts.Close()
+	u := blobURL(ts.URL, "jobs", "job1.json")
+
+	put := func(body, header, value string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, u, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := put("v1", "If-None-Match", "*")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	v1 := resp.Header.Get("ETag")
+	require.NotEmpty(t, v1)
+	assert.Equal(t, http.StatusPreconditionFailed, put("v1", "If-None-Match", "*").StatusCode, "already exists")
+
+	resp = put("v2", "If-Match", v1)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	v2 := resp.Header.Get("ETag")
+	assert.NotEqual(t, v1, v2)
+	assert.Equal(t, http.StatusPreconditionFailed, put("v3", "If-Match", v1).StatusCode, "stale ETag")
+
+	get, err := http.Get(u)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	assert.Equal(t, "v2", string(data))
+	assert.Equal(t, v2, get.Header.Get("ETag"))
+}
+
+// TestSetMetadata verifies that PUT ?comp=metadata replaces a blob's
+// metadata without touching its content or tags.
+func TestSetMetadata(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ts := httptest.NewServer(newTestMux(store))
+	defer ts.Close()
+
+	photo := testJPEG(t, 8, 8)
+	require.NoError(t, store.SaveBlob("uploads", "a/b/p.jpg", []byte(photo),
+		map[string]string{"collection": "a"}, map[string]string{"width": "8", "processingStatus": "pending"}, "image/jpeg"))
+
+	put := func(name, body string) int {
+		req, err := http.NewRequest(http.MethodPut, blobURL(ts.URL, "uploads", name)+"?comp=metadata", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, put("a/b/p.jpg", `{"width":"8","processingStatus":"done"}`))
+	assert.Equal(t, http.StatusNotFound, put("a/b/missing.jpg", `{}`))
+	assert.Equal(t, http.StatusBadRequest, put("a/b/p.jpg", `not json`))
+
+	md, err := store.GetMetadata("uploads", "a/b/p.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Width": "8", "ProcessingStatus": "done"}, md)
+	tags, err := store.GetTags("uploads", "a/b/p.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"collection": "a"}, tags)
+}
+
+// TestBlockUpload stages blocks out of order and verifies that committing a
+// block list writes them in list order with the given tags and content type.
+func TestBlockUpload(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ts := httptest.NewServer(newTestMux(store))
+	defer ts.Close()
+
+	u := blobURL(ts.URL, "upload-sessions", "abc/data")
+	put := func(rawURL string, body string, header map[string]string) int {
+		req, err := http.NewRequest(http.MethodPut, rawURL, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	photo := testJPEG(t, 8, 8)
+	ids := []string{"MDAwMDAwMDA=", "MDAwMDAwMDE="}
+	require.Equal(t, http.StatusCreated, put(u+"?comp=block&blockid="+url.QueryEscape(ids[1]), photo[100:], nil))
+	require.Equal(t, http.StatusCreated, put(u+"?comp=block&blockid="+url.QueryEscape(ids[0]), photo[:100], nil))
+	assert.Equal(t, http.StatusBadRequest, put(u+"?comp=block&blockid=not-base64!", "x", nil))
+
+	// Staged blocks are not visible until committed.
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	assert.Equal(t, http.StatusBadRequest, put(u+"?comp=blocklist", `["MDAwMDAwMDk="]`, nil))
+
+	body, _ := json.Marshal(ids)
+	require.Equal(t, http.StatusCreated, put(u+"?comp=blocklist", string(body), map[string]string{
+		"X-Blob-Content-Type": "image/jpeg",
+		"X-Blob-Tags":         `{"collection":"sport"}`,
+	}))
+
+	resp, err = http.Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, photo, string(data))
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+
+	tags, err := store.GetTags("upload-sessions", "abc/data")
+	require.NoError(t, err)
+	assert.Equal(t, "sport", tags["collection"])
+}
+
+// TestImageValidation verifies that image PUTs are checked against their
+// content type and the pixel limit, and that other blobs are stored as is.
+func TestImageValidation(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	mux := http.NewServeMux()
+	allowedCT := map[string]bool{"image/jpeg": true, "image/webp": true, "image/heic": true, "application/octet-stream": true}
+	mux.HandleFunc("PUT /{container}/{blob...}", blobPutHandler(store, nil, "uploads", nil, "", 100<<20, allowedCT, 10_000))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	var png bytes.Buffer
+	require.NoError(t, pngenc.Encode(&png, image.NewGray(image.Rect(0, 0, 8, 8))))
+	heic := "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"
+
+	tests := []struct {
+		name string
+		ct   string
+		body string
+		want int
+	}{
+		{"jpeg", "image/jpeg", testJPEG(t, 100, 100), http.StatusCreated},
+		{"png declared as jpeg", "image/jpeg", png.String(), http.StatusUnsupportedMediaType},
+		{"jpeg declared as webp", "image/webp", testJPEG(t, 8, 8), http.StatusUnsupportedMediaType},
+		{"not an image", "image/jpeg", "fake jpeg data", http.StatusBadRequest},
+		{"too many pixels", "image/jpeg", testJPEG(t, 101, 100), http.StatusRequestEntityTooLarge},
+		{"heic", "image/heic", heic, http.StatusCreated},
+		{"jpeg declared as heic", "image/heic", testJPEG(t, 8, 8), http.StatusUnsupportedMediaType},
+		{"octet-stream is not checked", "application/octet-stream", "fake jpeg data", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, blobURL(ts.URL, "uploads", "a/b/photo"), strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tt.ct)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+
+	// Committed block lists are checked too, and rejected blocks are kept.
+	u := blobURL(ts.URL, "uploads", "a/b/blocks")
+	req, err := http.NewRequest(http.MethodPut, u+"?comp=block&blockid=MDA=", strings.NewReader(png.String()))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, u+"?comp=blocklist", strings.NewReader(`["MDA="]`))
+	require.NoError(t, err)
+	req.Header.Set("X-Blob-Content-Type", "image/jpeg")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	_, err = os.Stat(store.blockDir("uploads", "a/b/blocks"))
+	assert.NoError(t, err)
+}
+
+// TestPresignedUpload verifies that signed PUTs are accepted only for the
+// blob and expiry they were signed for, and that unsigned PUTs still work.
+func TestPresignedUpload(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	key := []byte("secret")
+	mux := http.NewServeMux()
+	allowedCT := map[string]bool{"image/jpeg": true}
+	mux.HandleFunc("PUT /{container}/{blob...}", requireSignature(key, blobPutHandler(store, nil, "uploads", nil, "", 100<<20, allowedCT, 100_000_000)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// sign mirrors signUpload in api/internal/storage/local.go.
+	sign := func(key []byte, container, blob string, expiry time.Time) string {
+		se := strconv.FormatInt(expiry.Unix(), 10)
+		mac := hmac.New(sha256.New, key)
+		fmt.Fprintf(mac, "cw\n%s/%s\n%s", container, blob, se)
+		return url.Values{"se": {se}, "sp": {"cw"}, "sig": {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}}.Encode()
+	}
+	photo := testJPEG(t, 8, 8)
+	put := func(u string) int {
+		req, err := http.NewRequest(http.MethodPut, u, strings.NewReader(photo))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "image/jpeg")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	u := blobURL(ts.URL, "upload-sessions", "abc/my photo.jpg")
+	later := time.Now().Add(time.Minute)
+	assert.Equal(t, http.StatusCreated, put(u+"?"+sign(key, "upload-sessions", "abc/my photo.jpg", later)))
+	assert.Equal(t, http.StatusForbidden, put(u+"?"+sign([]byte("wrong"), "upload-sessions", "abc/my photo.jpg", later)))
+	assert.Equal(t, http.StatusForbidden, put(u+"?"+sign(key, "upload-sessions", "abc/other.jpg", later)))
+	assert.Equal(t, http.StatusForbidden, put(u+"?"+sign(key, "upload-sessions", "abc/my photo.jpg", time.Now().Add(-time.Minute))))
+	assert.Equal(t, http.StatusForbidden, put(u+"?comp=tags&"+sign(key, "upload-sessions", "abc/my photo.jpg", later)))
+	assert.Equal(t, http.StatusCreated, put(u))
+}
+
+// TestListPrefix verifies that GET /{container}?prefix= lists only the
+// blobs whose names start with the prefix.
+func TestListPrefix(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ts := httptest.NewServer(newTestMux(store))
+	defer ts.Close()
+
+	for _, name := range []string{"a/p.jpg/1/w100", "a/p.jpg/2/w200", "a/p.jpg2/1/w100"} {
+		require.NoError(t, store.SaveBlob("variants", name, []byte("x"), nil, nil, "image/jpeg"))
+	}
+
+	resp, err := http.Get(ts.URL + "/variants?prefix=" + url.QueryEscape("a/p.jpg/"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var blobs []BlobInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&blobs))
+	var names []string
+	for _, b := range blobs {
+		names = append(names, b.Name)
+	}
+	assert.ElementsMatch(t, []string{"a/p.jpg/1/w100", "a/p.jpg/2/w200"}, names)
+}
+
+// TestQueryPagination verifies that /query honours maxResults and marker and
+// that walking every page returns each matching blob exactly once.
+func TestQueryPagination(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	mux := newTestMux(store)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"} {
+		require.NoError(t, store.SaveBlob("images", "sport/soccer/"+name, []byte("x"),
+			map[string]string{"collection": "sport", "album": "soccer"}, nil, "image/jpeg"))
+	}
+	// A blob in another album must never appear in the results.
+	require.NoError(t, store.SaveBlob("images", "sport/rugby/z.jpg", []byte("x"),
+		map[string]string{"collection": "sport", "album": "rugby"}, nil, "image/jpeg"))
+
+	query := "@container='images' and collection='sport' and album='soccer'"
+	var seen []string
+	marker := ""
+	pages := 0
+	for {
+		body, _ := json.Marshal(map[string]any{"query": query, "marker": marker, "maxResults": 2})
+		resp, err := http.Post(ts.URL+"/query", "application/json", strings.NewReader(string(body)))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var page []BlobInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		resp.Body.Close()
+		assert.LessOrEqual(t, len(page), 2)
+		for _, b := range page {
+			seen = append(seen, b.Name)
+		}
+		pages++
+
+		marker = resp.Header.Get("X-Next-Marker")
+		if marker == "" {
+			break
+		}
+		require.Less(t, pages, 10, "pagination did not terminate")
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{
+		"sport/soccer/a.jpg", "sport/soccer/b.jpg", "sport/soccer/c.jpg",
+		"sport/soccer/d.jpg", "sport/soccer/e.jpg",
+	}, seen)
+}
+
+// TestQueryPagination_InvalidMarker verifies that a garbage marker is rejected.
+func TestQueryPagination_InvalidMarker(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, _, err = store.FilterByTagsPage("@container='images'", "not-a-marker", 10)
+	assert.Error(t, err)
+}
+
 // TestPublisherURLEncoding verifies that encodeBlobPath produces valid
 // URL paths that round-trip correctly through url.Parse → u.Path.
 func TestPublisherURLEncoding(t *testing.T) {
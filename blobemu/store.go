@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -83,6 +89,7 @@ func initSchema(db *sql.DB) error {
 			size         INTEGER DEFAULT 0,
 			created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			deleted_at   TIMESTAMP,
+			etag         TEXT,
 			UNIQUE(container, name)
 		);
 		CREATE TABLE IF NOT EXISTS tags (
@@ -103,7 +110,14 @@ func initSchema(db *sql.DB) error {
 		CREATE INDEX IF NOT EXISTS idx_blobs_container       ON blobs(container);
 		CREATE INDEX IF NOT EXISTS idx_blobs_container_name  ON blobs(container, name);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+	// Databases created before ETags were recorded lack the column.
+	if _, err := db.Exec("ALTER TABLE blobs ADD COLUMN etag TEXT"); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+		return err
+	}
+	return nil
 }
 
 // Close releases the database connection.
@@ -116,39 +130,91 @@ func (s *Store) blobPath(container, name string) string {
 
 // ---------- write operations ----------
 
+// errConditionNotMet is returned by SaveBlobIf when the blob's ETag does
+// not satisfy the write's precondition.
+var errConditionNotMet = errors.New("condition not met")
+
+// Precondition is the If-Match / If-None-Match header of a write. The zero
+// value writes unconditionally.
+type Precondition struct {
+	IfMatch     string // the blob must exist with this ETag, or "*" to exist at all
+	IfNoneMatch string // "*": the blob must not exist
+}
+
 // SaveBlob stores blob data on disk and upserts the metadata/tag rows.
 func (s *Store) SaveBlob(container, name string, data []byte, tags, metadata map[string]string, contentType string) error {
+	_, err := s.SaveBlobIf(container, name, data, tags, metadata, contentType, Precondition{})
+	return err
+}
+
+// SaveBlobIf is SaveBlob made conditional on the blob's current ETag. It
+// returns the blob's new ETag, or errConditionNotMet without writing
+// anything. The check and the write share a transaction, and with it the
+// store's only connection, so concurrent writers cannot interleave.
+func (s *Store) SaveBlobIf(container, name string, data []byte, tags, metadata map[string]string, contentType string, pre Precondition) (string, error) {
+	etag, _, err := s.saveBlob(container, name, bytes.NewReader(data), tags, metadata, contentType, pre)
+	return etag, err
+}
+
+// SaveBlobFrom is SaveBlob for content read from r, which is copied to
+// disk without being held in memory. It returns the blob's size.
+func (s *Store) SaveBlobFrom(container, name string, r io.Reader, tags, metadata map[string]string, contentType string) (int64, error) {
+	_, size, err := s.saveBlob(container, name, r, tags, metadata, contentType, Precondition{})
+	return size, err
+}
+
+// saveBlob writes the content of r and the blob's rows, if pre holds.
+func (s *Store) saveBlob(container, name string, r io.Reader, tags, metadata map[string]string, contentType string, pre Precondition) (etag string, size int64, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var blobID int64
+	var current sql.NullString
+	err = tx.QueryRow("SELECT id, etag FROM blobs WHERE container = ? AND name = ? AND deleted_at IS NULL", container, name).Scan(&blobID, &current)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return "", 0, fmt.Errorf("querying blob: %w", err)
+	}
+	switch {
+	case pre.IfNoneMatch == "*" && exists,
+		pre.IfMatch != "" && !exists,
+		pre.IfMatch != "" && pre.IfMatch != "*" && pre.IfMatch != current.String:
+		return "", 0, errConditionNotMet
+	}
+
 	// Persist bytes to disk.
 	fpath := s.blobPath(container, name)
 	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-		return fmt.Errorf("creating directories: %w", err)
+		return "", 0, fmt.Errorf("creating directories: %w", err)
+	}
+	f, err := os.Create(fpath)
+	if err != nil {
+		return "", 0, fmt.Errorf("creating blob file: %w", err)
 	}
-	if err := os.WriteFile(fpath, data, 0644); err != nil {
-		return fmt.Errorf("writing blob data: %w", err)
+	size, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-
-	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("beginning transaction: %w", err)
+		return "", 0, fmt.Errorf("writing blob data: %w", err)
 	}
-	defer tx.Rollback()
 
-	var blobID int64
-	err = tx.QueryRow("SELECT id FROM blobs WHERE container = ? AND name = ? AND deleted_at IS NULL", container, name).Scan(&blobID)
-	if err == sql.ErrNoRows {
+	etag = newETag()
+	if !exists {
 		res, err := tx.Exec(
-			"INSERT INTO blobs (container, name, content_type, size) VALUES (?, ?, ?, ?)",
-			container, name, contentType, len(data),
+			"INSERT INTO blobs (container, name, content_type, size, etag) VALUES (?, ?, ?, ?, ?)",
+			container, name, contentType, size, etag,
 		)
 		if err != nil {
-			return fmt.Errorf("inserting blob: %w", err)
+			return "", 0, fmt.Errorf("inserting blob: %w", err)
 		}
 		blobID, _ = res.LastInsertId()
-	} else if err != nil {
-		return fmt.Errorf("querying blob: %w", err)
 	} else {
-		if _, err := tx.Exec("UPDATE blobs SET content_type = ?, size = ? WHERE id = ?", contentType, len(data), blobID); err != nil {
-			return fmt.Errorf("updating blob: %w", err)
+		if _, err := tx.Exec("UPDATE blobs SET content_type = ?, size = ?, etag = ? WHERE id = ?", contentType, size, etag, blobID); err != nil {
+			return "", 0, fmt.Errorf("updating blob: %w", err)
 		}
 		tx.Exec("DELETE FROM tags WHERE blob_id = ?", blobID)
 		tx.Exec("DELETE FROM metadata WHERE blob_id = ?", blobID)
@@ -156,18 +222,28 @@ func (s *Store) SaveBlob(container, name string, data []byte, tags, metadata map
 
 	for k, v := range tags {
 		if _, err := tx.Exec("INSERT INTO tags (blob_id, key, value) VALUES (?, ?, ?)", blobID, k, v); err != nil {
-			return fmt.Errorf("inserting tag %s: %w", k, err)
+			return "", 0, fmt.Errorf("inserting tag %s: %w", k, err)
 		}
 	}
 	for k, v := range metadata {
 		normKey := capitaliseKey(k)
 		if _, err := tx.Exec("INSERT INTO metadata (blob_id, key, value) VALUES (?, ?, ?)", blobID, normKey, v); err != nil {
-			return fmt.Errorf("inserting metadata %s: %w", normKey, err)
+			return "", 0, fmt.Errorf("inserting metadata %s: %w", normKey, err)
 		}
 	}
 
 	slog.Debug("saved blob", "container", container, "name", name, "tags", len(tags), "metadata", len(metadata))
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return "", 0, err
+	}
+	return etag, size, nil
+}
+
+// newETag returns a fresh, quoted ETag for a blob's content.
+func newETag() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return `"0x` + strings.ToUpper(hex.EncodeToString(b)) + `"`
 }
 
 // SetTags replaces all tags on a blob.
@@ -194,10 +270,117 @@ func (s *Store) SetTags(container, name string, tags map[string]string) error {
 	return tx.Commit()
 }
 
+// errBlobNotFound is returned by SetMetadata when the blob does not exist.
+var errBlobNotFound = errors.New("blob not found")
+
+// SetMetadata replaces all custom metadata on a blob. It returns
+// errBlobNotFound if the blob does not exist.
+func (s *Store) SetMetadata(container, name string, metadata map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var blobID int64
+	if err := tx.QueryRow("SELECT id FROM blobs WHERE container = ? AND name = ? AND deleted_at IS NULL", container, name).Scan(&blobID); err != nil {
+		return fmt.Errorf("%w: %s/%s", errBlobNotFound, container, name)
+	}
+
+	if _, err := tx.Exec("DELETE FROM metadata WHERE blob_id = ?", blobID); err != nil {
+		return fmt.Errorf("deleting old metadata: %w", err)
+	}
+	// As in Azure, changing metadata changes the ETag; tags do not.
+	if _, err := tx.Exec("UPDATE blobs SET etag = ? WHERE id = ?", newETag(), blobID); err != nil {
+		return fmt.Errorf("updating etag: %w", err)
+	}
+	for k, v := range metadata {
+		normKey := capitaliseKey(k)
+		if _, err := tx.Exec("INSERT INTO metadata (blob_id, key, value) VALUES (?, ?, ?)", blobID, normKey, v); err != nil {
+			return fmt.Errorf("inserting metadata %s: %w", normKey, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// errUnknownBlock is returned by OpenBlockList when a block ID was never
+// staged.
+var errUnknownBlock = errors.New("unknown block")
+
+// blockDir returns the directory holding a blob's uncommitted blocks.
+func (s *Store) blockDir(container, name string) string {
+	return filepath.Join(s.dataDir, "blocks", container, name)
+}
+
+// StageBlock stores an uncommitted block of a blob. As in Azure, staged
+// blocks do not change the blob until a committed block list names them.
+// Block IDs are base64 and may contain '/', so they are hex-encoded as file
+// names.
+func (s *Store) StageBlock(container, name, blockID string, data []byte) error {
+	dir := s.blockDir(container, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating block directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, hex.EncodeToString([]byte(blockID))), data, 0644); err != nil {
+		return fmt.Errorf("writing block: %w", err)
+	}
+	return nil
+}
+
+// OpenBlockList returns a reader over the named staged blocks of a blob in
+// order, so the caller can check and save the content without loading it.
+// The caller must close it.
+func (s *Store) OpenBlockList(container, name string, blockIDs []string) (io.ReadCloser, error) {
+	dir := s.blockDir(container, name)
+	br := &blockReader{}
+	readers := make([]io.Reader, 0, len(blockIDs))
+	for _, id := range blockIDs {
+		f, err := os.Open(filepath.Join(dir, hex.EncodeToString([]byte(id))))
+		if err != nil {
+			br.Close()
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: %s", errUnknownBlock, id)
+			}
+			return nil, fmt.Errorf("opening block: %w", err)
+		}
+		br.files = append(br.files, f)
+		readers = append(readers, f)
+	}
+	br.Reader = io.MultiReader(readers...)
+	return br, nil
+}
+
+// blockReader reads a blob's staged blocks in order.
+type blockReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// Close closes the block files; it may be called more than once.
+func (b *blockReader) Close() error {
+	for _, f := range b.files {
+		f.Close()
+	}
+	b.files = nil
+	return nil
+}
+
+// DiscardBlocks removes a blob's uncommitted blocks, as Azure does once a
+// block list is committed.
+func (s *Store) DiscardBlocks(container, name string) {
+	dir := s.blockDir(container, name)
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Warn("failed to remove staged blocks", "path", dir, "error", err)
+	}
+}
+
 // DeleteBlob permanently deletes a blob: removes the DB row (plus
 // associated tags/metadata) and the file from disk.
 // Returns nil if the blob does not exist (idempotent).
 func (s *Store) DeleteBlob(container, name string) error {
+	// Uncommitted blocks go with the blob, even if it was never committed.
+	s.DiscardBlocks(container, name)
+
 	// Look up the blob id so we can cascade-delete tags & metadata.
 	var blobID int64
 	err := s.db.QueryRow(
@@ -259,24 +442,27 @@ func (s *Store) removeFile(container, name string) error {
 
 // ---------- read operations ----------
 
-// GetBlob returns the raw bytes and content-type.
+// OpenBlob opens the blob's file for streaming and returns its content-type
+// and ETag, which is empty for blobs saved before ETags were recorded.
 // The blob must exist both on disk AND in the database; orphaned files
 // (left over from a previous run whose DB was recreated) are treated as
 // not-found so behaviour is consistent with GetTags / GetMetadata.
-func (s *Store) GetBlob(container, name string) ([]byte, string, error) {
+// The caller must close the file.
+func (s *Store) OpenBlob(container, name string) (*os.File, string, string, error) {
 	var ct string
-	if err := s.db.QueryRow("SELECT content_type FROM blobs WHERE container = ? AND name = ? AND deleted_at IS NULL", container, name).Scan(&ct); err != nil {
-		return nil, "", fmt.Errorf("blob not found %s/%s", container, name)
+	var etag sql.NullString
+	if err := s.db.QueryRow("SELECT content_type, etag FROM blobs WHERE container = ? AND name = ? AND deleted_at IS NULL", container, name).Scan(&ct, &etag); err != nil {
+		return nil, "", "", fmt.Errorf("blob not found %s/%s", container, name)
 	}
 
-	data, err := os.ReadFile(s.blobPath(container, name))
+	f, err := os.Open(s.blobPath(container, name))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, "", fmt.Errorf("blob not found: %s/%s", container, name)
+			return nil, "", "", fmt.Errorf("blob not found: %s/%s", container, name)
 		}
-		return nil, "", fmt.Errorf("reading blob: %w", err)
+		return nil, "", "", fmt.Errorf("opening blob: %w", err)
 	}
-	return data, ct, nil
+	return f, ct, etag.String, nil
 }
 
 // GetTags returns the index tags for a blob.
@@ -347,16 +533,40 @@ func (s *Store) ListBlobs(container string) ([]BlobInfo, error) {
 // with tags and metadata fully populated.
 // Uses JOINs to fetch tags and metadata in bulk instead of per-blob queries.
 func (s *Store) FilterByTags(query string) ([]BlobInfo, error) {
+	blobs, _, err := s.FilterByTagsPage(query, "", 0)
+	return blobs, err
+}
+
+// FilterByTagsPage is the paged form of FilterByTags. Results are ordered by
+// insertion so the returned marker (the last blob id, opaque to callers) can be
+// passed back to resume the listing. A maxResults of zero or less returns all
+// remaining matches. The returned marker is empty when there are no more pages.
+func (s *Store) FilterByTagsPage(query string, marker string, maxResults int) ([]BlobInfo, string, error) {
 	conditions, err := ParseTagQuery(query)
 	if err != nil {
-		return nil, fmt.Errorf("parsing query: %w", err)
+		return nil, "", fmt.Errorf("parsing query: %w", err)
+	}
+
+	var afterID int64
+	if marker != "" {
+		afterID, err = strconv.ParseInt(marker, 10, 64)
+		if err != nil || afterID < 0 {
+			return nil, "", fmt.Errorf("invalid marker %q", marker)
+		}
 	}
 
-	// Step 1: find matching blob IDs.
+	// Step 1: find matching blob IDs. One extra row is fetched so we know
+	// whether another page follows without a second count query.
 	sqlText, args := BuildFilterSQL(conditions)
+	sqlText += " AND b.id > ? ORDER BY b.id"
+	args = append(args, afterID)
+	if maxResults > 0 {
+		sqlText += " LIMIT ?"
+		args = append(args, maxResults+1)
+	}
 	rows, err := s.db.Query(sqlText, args...)
 	if err != nil {
-		return nil, fmt.Errorf("executing filter: %w", err)
+		return nil, "", fmt.Errorf("executing filter: %w", err)
 	}
 
 	type blobRow struct {
@@ -369,14 +579,20 @@ func (s *Store) FilterByTags(query string) ([]BlobInfo, error) {
 		var br blobRow
 		if err := rows.Scan(&br.id, &br.container, &br.name); err != nil {
 			rows.Close()
-			return nil, err
+			return nil, "", err
 		}
 		matched = append(matched, br)
 	}
 	rows.Close()
 
+	var nextMarker string
+	if maxResults > 0 && len(matched) > maxResults {
+		matched = matched[:maxResults]
+		nextMarker = strconv.FormatInt(matched[len(matched)-1].id, 10)
+	}
+
 	if len(matched) == 0 {
-		return []BlobInfo{}, nil
+		return []BlobInfo{}, "", nil
 	}
 
 	// Build id list for bulk fetch.
@@ -435,7 +651,7 @@ func (s *Store) FilterByTags(query string) ([]BlobInfo, error) {
 		}
 		out = append(out, BlobInfo{Name: br.name, Container: br.container, Tags: tags, Metadata: md})
 	}
-	return out, nil
+	return out, nextMarker, nil
 }
 
 // ---------- helpers ----------